@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config"
+
+	// module loader
+	_ "github.com/tsaikd/gogstash/modloader"
+)
+
+// errors
+var (
+	ErrorCheckFailed2 = errutil.NewFactory("config %q check failed: %d problems found")
+)
+
+// check initializes all plugins of config without starting them, and prints problems found
+func check(ctx context.Context, confpath string) (err error) {
+	if confpath == "" {
+		confpath = searchConfigPath()
+	}
+
+	if err = openKeystore(flagKeystore.String()); err != nil {
+		return err
+	}
+	errs := config.CheckFile(ctx, confpath)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) > 0 {
+		return ErrorCheckFailed2.New(nil, confpath, len(errs))
+	}
+
+	fmt.Printf("config %q OK\n", confpath)
+	return nil
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/logstash"
+)
+
+// errors
+var (
+	ErrorConvertArgs = errutil.NewFactory("convert needs exactly one logstash config file, usage: gogstash convert pipeline.conf")
+	ErrorConvert1    = errutil.NewFactory("convert %q failed")
+)
+
+// convert prints the gogstash config in YAML format converted from the logstash config file
+func convert(args []string) (err error) {
+	if len(args) != 1 {
+		return ErrorConvertArgs.New(nil)
+	}
+	path := args[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ErrorConvert1.New(err, path)
+	}
+	if data, err = logstash.ToYAML(data); err != nil {
+		return ErrorConvert1.New(err, path)
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
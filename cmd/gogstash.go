@@ -39,6 +39,9 @@ func gogstash(
 		confpath = searchConfigPath()
 	}
 
+	if err = openKeystore(flagKeystore.String()); err != nil {
+		return err
+	}
 	conf, err := config.LoadFromFile(confpath)
 	if err != nil {
 		return err
@@ -73,11 +76,27 @@ func gogstash(
 	if conf.Worker > 1 && !workerMode {
 		return startWorkers(ctx, conf.Worker)
 	}
+	if workerMode && conf.Monitor != nil {
+		// worker processes can not listen on the same address
+		goglog.Logger.Warnf("monitor is not supported with worker > 1, disabled")
+		conf.Monitor = nil
+	}
+
+	var reloadInterval time.Duration
+	if flagConfigReload.Bool() {
+		if reloadInterval, err = time.ParseDuration(flagConfigReloadInterval.String()); err != nil {
+			return err
+		}
+	}
 
 	if err := conf.Start(ctx); err != nil {
 		return err
 	}
 
+	reloadCtx, cancelReload := context.WithCancel(ctx)
+	defer cancelReload()
+	go watchReload(reloadCtx, &conf, confpath, reloadInterval)
+
 	if pprofAddress != "" {
 		go func() {
 			if err := http.ListenAndServe(pprofAddress, nil); err != nil {
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+	"github.com/tsaikd/KDGoLib/futil"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/keystore"
+)
+
+// errors
+var (
+	ErrorKeystoreArgs1 = errutil.NewFactory("keystore command needs a secret name, usage: gogstash keystore %s <name>")
+	ErrorReadSecret1   = errutil.NewFactory("read value of secret %q from stdin failed")
+)
+
+// openKeystore opens the keystore of path if exists, for secret references of config
+func openKeystore(path string) (err error) {
+	if path == "" || !futil.IsExist(path) {
+		return nil
+	}
+	store, err := keystore.Open(path, os.Getenv(keystore.PasswordEnv))
+	if err != nil {
+		return err
+	}
+	config.SetKeystore(store)
+	return nil
+}
+
+// keystoreAdd adds or replaces the secret of name with the value read from stdin
+func keystoreAdd(path string, args []string) (err error) {
+	if len(args) != 1 {
+		return ErrorKeystoreArgs1.New(nil, "add")
+	}
+	name := args[0]
+	store, err := keystore.Open(path, os.Getenv(keystore.PasswordEnv))
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprintf(os.Stderr, "Enter value of secret %q: ", name)
+	}
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return ErrorReadSecret1.New(err, name)
+	}
+	value = strings.TrimRight(value, "\r\n")
+
+	if err = store.Set(name, value); err != nil {
+		return err
+	}
+	if err = store.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("secret %q added to keystore %q\n", name, path)
+	return nil
+}
+
+// keystoreList prints names of secrets, values are never printed
+func keystoreList(path string) (err error) {
+	store, err := keystore.Open(path, os.Getenv(keystore.PasswordEnv))
+	if err != nil {
+		return err
+	}
+	for _, name := range store.Names() {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// keystoreRemove removes the secret of name
+func keystoreRemove(path string, args []string) (err error) {
+	if len(args) != 1 {
+		return ErrorKeystoreArgs1.New(nil, "remove")
+	}
+	store, err := keystore.Open(path, os.Getenv(keystore.PasswordEnv))
+	if err != nil {
+		return err
+	}
+	if err = store.Remove(args[0]); err != nil {
+		return err
+	}
+	if err = store.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("secret %q removed from keystore %q\n", args[0], path)
+	return nil
+}
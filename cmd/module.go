@@ -21,6 +21,24 @@ var (
 		Usage:   "Enable debug logging",
 		EnvVar:  "DEBUG",
 	}
+	flagConfigReload = &cobrather.BoolFlag{
+		Name:    "config-reload",
+		Default: false,
+		Usage:   "Reload config when the config file modified, config is always reloaded on SIGHUP",
+		EnvVar:  "CONFIG_RELOAD",
+	}
+	flagConfigReloadInterval = &cobrather.StringFlag{
+		Name:    "config-reload-interval",
+		Default: "3s",
+		Usage:   "Interval to check the config file modified, used with --config-reload",
+		EnvVar:  "CONFIG_RELOAD_INTERVAL",
+	}
+	flagKeystore = &cobrather.StringFlag{
+		Name:    "keystore",
+		Default: "gogstash.keystore",
+		Usage:   "Path to keystore file of secrets referenced by ${secret:name} in config, password from env KEYSTORE_PASSWORD",
+		EnvVar:  "KEYSTORE",
+	}
 	flagPProf = &cobrather.StringFlag{
 		Name:    "pprof",
 		Default: "",
@@ -31,8 +49,12 @@ var (
 
 // modules
 var (
-	WorkerModule *cobrather.Module
-	Module       *cobrather.Module
+	WorkerModule   *cobrather.Module
+	CheckModule    *cobrather.Module
+	TestModule     *cobrather.Module
+	ConvertModule  *cobrather.Module
+	KeystoreModule *cobrather.Module
+	Module         *cobrather.Module
 )
 
 func init() {
@@ -45,6 +67,62 @@ func init() {
 		},
 	}
 
+	// CheckModule info
+	CheckModule = &cobrather.Module{
+		Use:   "check",
+		Short: "Check config by initializing all plugins without starting them",
+		RunE: func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			return check(ctx, flagConfig.String())
+		},
+	}
+
+	// TestModule info
+	TestModule = &cobrather.Module{
+		Use:   "test [fixture files]",
+		Short: "Test filters of config with input events and expected output events of fixture files",
+		RunE: func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			return test(ctx, flagConfig.String(), args)
+		},
+	}
+
+	// ConvertModule info
+	ConvertModule = &cobrather.Module{
+		Use:   "convert [logstash config file]",
+		Short: "Convert logstash config to gogstash config in YAML format",
+		RunE: func(ctx context.Context, cmd *cobra.Command, args []string) error {
+			return convert(args)
+		},
+	}
+
+	// KeystoreModule info
+	KeystoreModule = &cobrather.Module{
+		Use:   "keystore",
+		Short: "Manage secrets of keystore, referenced by ${secret:name} in config",
+		Commands: []*cobrather.Module{
+			{
+				Use:   "add [name]",
+				Short: "Add or replace a secret, the value is read from stdin",
+				RunE: func(ctx context.Context, cmd *cobra.Command, args []string) error {
+					return keystoreAdd(flagKeystore.String(), args)
+				},
+			},
+			{
+				Use:   "list",
+				Short: "List names of secrets",
+				RunE: func(ctx context.Context, cmd *cobra.Command, args []string) error {
+					return keystoreList(flagKeystore.String())
+				},
+			},
+			{
+				Use:   "remove [name]",
+				Short: "Remove a secret",
+				RunE: func(ctx context.Context, cmd *cobra.Command, args []string) error {
+					return keystoreRemove(flagKeystore.String(), args)
+				},
+			},
+		},
+	}
+
 	// Module info
 	Module = &cobrather.Module{
 		Use:   "gogstash",
@@ -52,10 +130,17 @@ func init() {
 		Commands: []*cobrather.Module{
 			cobrather.VersionModule,
 			WorkerModule,
+			CheckModule,
+			TestModule,
+			ConvertModule,
+			KeystoreModule,
 		},
 		GlobalFlags: []cobrather.Flag{
 			flagConfig,
+			flagConfigReload,
+			flagConfigReloadInterval,
 			flagDebug,
+			flagKeystore,
 			flagPProf,
 		},
 		RunE: func(ctx context.Context, cmd *cobra.Command, args []string) error {
@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+)
+
+// watchReload reloads conf from confpath on SIGHUP, or when config files of confpath modified
+// if interval > 0, until ctx is done
+func watchReload(ctx context.Context, conf *config.Config, confpath string, interval time.Duration) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	modTime := configModTime(confpath)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigChan:
+			goglog.Logger.Infof("%v received, reloading config %q", sig, confpath)
+		case <-tick:
+			t := configModTime(confpath)
+			if t.Equal(modTime) {
+				continue
+			}
+			goglog.Logger.Infof("config %q modified, reloading", confpath)
+		}
+		modTime = configModTime(confpath)
+
+		// secrets may be added for the new config
+		if err := openKeystore(flagKeystore.String()); err != nil {
+			goglog.Logger.Errorf("open keystore failed, keep running with current config: %v", err)
+			continue
+		}
+		newConf, err := config.LoadFromFile(confpath)
+		if err != nil {
+			goglog.Logger.Errorf("load config %q failed, keep running with current config: %v", confpath, err)
+			continue
+		}
+		if err = conf.Reload(&newConf); err != nil {
+			goglog.Logger.Errorf("reload config %q failed: %v", confpath, err)
+			continue
+		}
+		goglog.Logger.Info("config reloaded")
+	}
+}
+
+// configModTime returns the latest modified time of confpath and config files of it,
+// including the directory of config files, which is modified when files added or removed
+func configModTime(confpath string) (modTime time.Time) {
+	paths, _ := config.ConfigFiles(confpath)
+	for _, path := range append(paths, confpath) {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/pipelinetest"
+)
+
+// errors
+var (
+	ErrorNoFixtures = errutil.NewFactory("no fixture files, usage: gogstash --config config.yml test fixture.yml...")
+)
+
+// exit codes of test command, CI fails on non-zero
+const (
+	testExitFailed = 1 // some cases failed
+	testExitError  = 2 // invalid config or fixtures
+)
+
+// test runs fixture files through the filters of config, exits non-zero if any case failed
+func test(ctx context.Context, confpath string, fixtures []string) (err error) {
+	if err = runTest(ctx, confpath, fixtures); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(testExitError)
+	}
+	return nil
+}
+
+func runTest(ctx context.Context, confpath string, fixtures []string) (err error) {
+	if len(fixtures) < 1 {
+		return ErrorNoFixtures.New(nil)
+	}
+	if confpath == "" {
+		confpath = searchConfigPath()
+	}
+	if err = openKeystore(flagKeystore.String()); err != nil {
+		return err
+	}
+	conf, err := config.LoadFromFile(confpath)
+	if err != nil {
+		return err
+	}
+
+	passed, failed := 0, 0
+	for _, path := range fixtures {
+		fixture, err := pipelinetest.LoadFixture(path)
+		if err != nil {
+			return err
+		}
+		results, err := pipelinetest.Run(ctx, &conf, path, fixture)
+		if err != nil {
+			return err
+		}
+		for _, result := range results {
+			if result.Passed() {
+				passed++
+				fmt.Printf("PASS %s: %s\n", result.File, result.Case)
+				continue
+			}
+			failed++
+			fmt.Printf("FAIL %s: %s\n", result.File, result.Case)
+			for _, diff := range result.Diffs {
+				fmt.Printf("    %s\n", diff)
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		os.Exit(testExitFailed)
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ package cmd
 import (
 	"context"
 	"os"
+	"os/signal"
+	"sync"
 	"syscall"
 
 	"golang.org/x/sync/errgroup"
@@ -22,7 +24,37 @@ func startWorker(args []string, attr *syscall.ProcAttr) (pid int, err error) {
 	return
 }
 
-func waitWorkers(ctx context.Context, pids []int, args []string, attr *syscall.ProcAttr) error {
+// workerPids is pids of workers, updated when a worker is restarted
+type workerPids struct {
+	mutex sync.Mutex
+	pids  []int
+}
+
+// replace replaces pid of the stopped worker by restarting it, returns false if pid is not a worker
+func (t *workerPids) replace(pid int, restart func() int) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i, p := range t.pids {
+		if p == pid {
+			t.pids[i] = restart()
+			return true
+		}
+	}
+	return false
+}
+
+// signal sends sig to all workers
+func (t *workerPids) signal(sig os.Signal) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, pid := range t.pids {
+		if p, err := os.FindProcess(pid); err == nil {
+			_ = p.Signal(sig)
+		}
+	}
+}
+
+func waitWorkers(ctx context.Context, pids *workerPids, args []string, attr *syscall.ProcAttr) error {
 	var ws syscall.WaitStatus
 	for {
 		// wait for any child process
@@ -37,15 +69,28 @@ func waitWorkers(ctx context.Context, pids []int, args []string, attr *syscall.P
 		default:
 			// pass
 		}
-		for i, p := range pids {
-			// match our worker's pid
-			if p == pid {
-				goglog.Logger.Warnf("worker %d stopped unexpectedly (wstatus: %d)", pid, ws)
-				// only restart once after stopped unexpectedly
-				pid, _ = startWorker(args, attr)
-				pids[i] = pid
-				break
-			}
+		// match our worker's pid
+		pids.replace(pid, func() int {
+			goglog.Logger.Warnf("worker %d stopped unexpectedly (wstatus: %d)", pid, ws)
+			// only restart once after stopped unexpectedly
+			pid, _ := startWorker(args, attr)
+			return pid
+		})
+	}
+}
+
+// forwardReloadSignal forwards SIGHUP to workers, so workers reload config
+func forwardReloadSignal(ctx context.Context, pids *workerPids) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-sigChan:
+			pids.signal(sig)
 		}
 	}
 }
@@ -60,13 +105,13 @@ func startWorkers(ctx context.Context, workerNum int) error {
 	}
 	args := append([]string{os.Args[0], WorkerModule.Use}, os.Args[1:]...)
 
-	pids := make([]int, workerNum)
+	pids := &workerPids{pids: make([]int, workerNum)}
 	for i := 0; i < workerNum; i++ {
 		pid, err := startWorker(args, attr)
 		if err != nil {
 			return err
 		}
-		pids[i] = pid
+		pids.pids[i] = pid
 	}
 
 	eg, ctx := errgroup.WithContext(ctx)
@@ -74,14 +119,11 @@ func startWorkers(ctx context.Context, workerNum int) error {
 		return waitWorkers(ctx, pids, args, attr)
 	})
 
+	go forwardReloadSignal(ctx, pids)
+
 	signal := waitSignals(ctx)
 	if signal != nil {
-		for _, pid := range pids {
-			p, err := os.FindProcess(pid)
-			if err == nil {
-				_ = p.Signal(signal)
-			}
-		}
+		pids.signal(signal)
 	}
 
 	return nil
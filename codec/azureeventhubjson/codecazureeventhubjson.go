@@ -82,6 +82,8 @@ func (c *Codec) Decode(ctx context.Context, data any,
 			ok = false
 			return ok, err
 		}
+		event.SetMetadataFromContext(ctx)
+		event.SetAck(logevent.AckFromContext(ctx))
 		msgChan <- event
 	}
 
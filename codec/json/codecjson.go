@@ -65,6 +65,8 @@ func (c *Codec) Decode(ctx context.Context, data any,
 		goglog.Logger.Error(err)
 	}
 
+	event.SetMetadataFromContext(ctx)
+	event.SetAck(logevent.AckFromContext(ctx))
 	msgChan <- event
 	ok = true
 
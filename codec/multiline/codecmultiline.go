@@ -0,0 +1,286 @@
+package codecmultiline
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "multiline"
+
+// MultilineTag tag added to events joined from more than one line
+const MultilineTag = "multiline"
+
+// TruncatedTag tag added to events split by max_lines or max_bytes
+const TruncatedTag = "gogstash_codec_multiline_truncated"
+
+// which event lines matching pattern belong to
+const (
+	WhatPrevious = "previous"
+	WhatNext     = "next"
+)
+
+// errors
+var (
+	ErrorNoPattern    = errutil.NewFactory("no pattern for multiline codec")
+	ErrorInvalidWhat1 = errutil.NewFactory("invalid what: %q, must be previous or next")
+)
+
+// Codec joins lines of a stream into events, e.g. stack traces
+type Codec struct {
+	config.CodecConfig
+	Pattern        string `json:"pattern"`                   // regexp of lines joined with other lines
+	Negate         bool   `json:"negate,omitempty"`          // join lines not matching pattern
+	What           string `json:"what"`                      // one of ["previous", "next"]
+	MaxLines       int    `json:"max_lines,omitempty"`       // default: 500, 0 for unlimited
+	MaxBytes       int    `json:"max_bytes,omitempty"`       // default: 10 MiB, 0 for unlimited
+	FlushTimeout   string `json:"flush_timeout,omitempty"`   // flush lines of a stream idle for the duration, default: 1s, 0 to disable
+	StreamIdentity string `json:"stream_identity,omitempty"` // format of the stream key of lines
+
+	re           *regexp.Regexp
+	flushTimeout time.Duration
+	identity     *logevent.Template
+	streams      map[string]*stream
+	mutex        sync.Mutex // guards streams
+}
+
+// stream holds lines of an event not completed yet
+type stream struct {
+	mutex   sync.Mutex
+	key     string
+	event   logevent.LogEvent
+	lines   []string
+	bytes   int
+	acks    []*logevent.Ack // acks of lines, released after the event delivered
+	ctx     context.Context // context of the last line, flushed events are sent until done
+	msgChan chan<- logevent.LogEvent
+	timer   *time.Timer
+	updated time.Time // time of the last line
+	removed bool      // removed from streams after flushed by timeout
+}
+
+// DefaultCodec returns a Codec struct with default values
+func DefaultCodec() Codec {
+	return Codec{
+		CodecConfig: config.CodecConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+		What:           WhatPrevious,
+		MaxLines:       500,
+		MaxBytes:       10 * 1024 * 1024,
+		FlushTimeout:   "1s",
+		StreamIdentity: "%{@metadata.path:-}|%{@metadata.remote_address:-}",
+	}
+}
+
+// InitHandler initialize the codec plugin
+func InitHandler(ctx context.Context, raw config.ConfigRaw) (config.TypeCodecConfig, error) {
+	c := DefaultCodec()
+	err := config.ReflectConfig(raw, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Pattern == "" {
+		return nil, ErrorNoPattern.New(nil)
+	}
+	if c.re, err = regexp.Compile(c.Pattern); err != nil {
+		return nil, err
+	}
+	if c.What != WhatPrevious && c.What != WhatNext {
+		return nil, ErrorInvalidWhat1.New(nil, c.What)
+	}
+	if c.FlushTimeout != "" && c.FlushTimeout != "0" {
+		if c.flushTimeout, err = time.ParseDuration(c.FlushTimeout); err != nil {
+			return nil, err
+		}
+	}
+	if c.identity, err = logevent.NewTemplate(c.StreamIdentity); err != nil {
+		return nil, err
+	}
+	c.streams = map[string]*stream{}
+
+	return &c, nil
+}
+
+// Decode adds the line of 'data' to the event of its stream, 'ok' is true if a completed event was sent,
+// streams are identified by stream_identity formatted with the line, lines of an event hold their
+// acknowledgements until the event is delivered
+func (c *Codec) Decode(ctx context.Context, data any,
+	eventExtra map[string]any,
+	tags []string,
+	msgChan chan<- logevent.LogEvent) (ok bool, err error) {
+	var line string
+	switch v := data.(type) {
+	case string:
+		line = v
+	case []byte:
+		line = string(v)
+	default:
+		return false, config.ErrDecodeData
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	event := logevent.LogEvent{
+		Timestamp: time.Now(),
+		Extra:     eventExtra,
+	}
+	event.AddTag(tags...)
+	event.SetMetadataFromContext(ctx)
+
+	s := c.lockStream(c.identity.Format(event))
+	defer s.mutex.Unlock()
+	s.ctx = ctx
+	s.msgChan = msgChan
+	s.updated = time.Now()
+
+	matched := c.re.MatchString(line) != c.Negate
+	joined := len(s.lines) > 0 && (matched || c.What == WhatNext)
+	if joined && ((c.MaxLines > 0 && len(s.lines) >= c.MaxLines) ||
+		(c.MaxBytes > 0 && s.bytes+len(line) > c.MaxBytes)) {
+		// the line joining the event starts a new event instead
+		s.event.AddTag(TruncatedTag)
+		ok = c.flush(s)
+	}
+
+	switch c.What {
+	case WhatPrevious:
+		if !matched && len(s.lines) > 0 {
+			ok = c.flush(s) || ok
+		}
+		c.add(s, event, line, logevent.AckFromContext(ctx))
+	case WhatNext:
+		c.add(s, event, line, logevent.AckFromContext(ctx))
+		if !matched {
+			ok = c.flush(s) || ok
+		}
+	}
+
+	if len(s.lines) > 0 && c.flushTimeout > 0 {
+		if s.timer == nil {
+			s.timer = time.AfterFunc(c.flushTimeout, func() { c.flushIdle(s) })
+		} else {
+			s.timer.Reset(c.flushTimeout)
+		}
+	}
+	return ok, nil
+}
+
+// lockStream returns the locked stream of key, created if not found
+func (c *Codec) lockStream(key string) *stream {
+	for {
+		c.mutex.Lock()
+		s, ok := c.streams[key]
+		if !ok {
+			s = &stream{key: key}
+			c.streams[key] = s
+		}
+		c.mutex.Unlock()
+
+		s.mutex.Lock()
+		if !s.removed {
+			return s
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// add appends the line to the event of the stream, the first line
+// provides timestamp, fields, tags and metadata of the event
+func (c *Codec) add(s *stream, event logevent.LogEvent, line string, ack *logevent.Ack) {
+	if len(s.lines) < 1 {
+		s.event = event
+	}
+	s.lines = append(s.lines, line)
+	s.bytes += len(line)
+	if ack != nil {
+		ack.Add(1)
+		s.acks = append(s.acks, ack)
+	}
+}
+
+// flush sends the event of the stream, s.mutex must be held
+func (c *Codec) flush(s *stream) bool {
+	if len(s.lines) < 1 {
+		return false
+	}
+
+	event := s.event
+	event.Message = strings.Join(s.lines, "\n")
+	if len(s.lines) > 1 {
+		event.AddTag(MultilineTag)
+	}
+	if acks := s.acks; len(acks) > 0 {
+		ack := logevent.NewAck(func(err error) {
+			for _, ack := range acks {
+				ack.Done(err)
+			}
+		})
+		event.SetAck(ack)
+		ack.Done(nil)
+	}
+	s.event = logevent.LogEvent{}
+	s.lines = nil
+	s.bytes = 0
+	s.acks = nil
+
+	select {
+	case s.msgChan <- event:
+		return true
+	case <-s.ctx.Done():
+		// lines not delivered are read again after restart
+		event.Nack(s.ctx.Err())
+		return false
+	}
+}
+
+// flushIdle flushes the stream not receiving lines in flush_timeout, and forgets it
+func (c *Codec) flushIdle(s *stream) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.removed || time.Since(s.updated) < c.flushTimeout {
+		// the timer is reset by a new line
+		return
+	}
+	c.flush(s)
+
+	c.mutex.Lock()
+	delete(c.streams, s.key)
+	c.mutex.Unlock()
+	s.removed = true
+}
+
+// DecodeEvent decodes 'data' as one line to event
+func (c *Codec) DecodeEvent(data []byte, event *logevent.LogEvent) error {
+	if event == nil {
+		goglog.Logger.Errorf("Provided DecodeEvent target event pointer is nil")
+		return config.ErrDecodeNilTarget
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	event.Message = strings.TrimRight(string(data), "\r\n")
+
+	return nil
+}
+
+// Encode sends the message field, ignoring any extra fields
+func (c *Codec) Encode(ctx context.Context, event logevent.LogEvent, dataChan chan<- []byte) (ok bool, err error) {
+	if event.Message == "" {
+		return false, nil
+	}
+	dataChan <- []byte(event.Message)
+	return true, nil
+}
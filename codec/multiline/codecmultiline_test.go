@@ -0,0 +1,217 @@
+package codecmultiline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func init() {
+	goglog.Logger.SetLevel(logrus.DebugLevel)
+}
+
+func decodeLines(t *testing.T, codec config.TypeCodecConfig, ctx context.Context, msgChan chan logevent.LogEvent, lines ...string) {
+	for _, line := range lines {
+		_, err := codec.Decode(ctx, line+"\n", map[string]any{"line": line}, []string{}, msgChan)
+		require.NoError(t, err)
+	}
+}
+
+func TestDecodePrevious(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	codec, err := InitHandler(ctx, config.ConfigRaw{
+		"pattern":       `^\s`,
+		"flush_timeout": "100ms",
+	})
+	require.NoError(err)
+
+	msgChan := make(chan logevent.LogEvent, 10)
+	decodeLines(t, codec, ctx, msgChan, "Exception: failed", "  at a()", "  at b()", "next")
+	require.Len(msgChan, 1)
+	event := <-msgChan
+	require.Equal("Exception: failed\n  at a()\n  at b()", event.Message)
+	require.Equal("Exception: failed", event.GetString("line"))
+	require.Equal([]string{MultilineTag}, event.Tags)
+
+	// the last event is flushed after flush_timeout
+	select {
+	case event = <-msgChan:
+		require.Equal("next", event.Message)
+		require.Empty(event.Tags)
+	case <-time.After(time.Second):
+		require.FailNow("event not flushed")
+	}
+}
+
+func TestDecodeNextNegate(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	codec, err := InitHandler(ctx, config.ConfigRaw{
+		"pattern":       `;$`,
+		"negate":        true,
+		"what":          WhatNext,
+		"flush_timeout": "0",
+	})
+	require.NoError(err)
+
+	msgChan := make(chan logevent.LogEvent, 10)
+	decodeLines(t, codec, ctx, msgChan, "SELECT *", "FROM t", "WHERE a = 1;", "DELETE FROM t;")
+	require.Len(msgChan, 2)
+	require.Equal("SELECT *\nFROM t\nWHERE a = 1;", (<-msgChan).Message)
+	require.Equal("DELETE FROM t;", (<-msgChan).Message)
+}
+
+func TestDecodeMaxLines(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	codec, err := InitHandler(ctx, config.ConfigRaw{
+		"pattern":       `^\s`,
+		"max_lines":     2,
+		"max_bytes":     20,
+		"flush_timeout": "0",
+	})
+	require.NoError(err)
+
+	msgChan := make(chan logevent.LogEvent, 10)
+	decodeLines(t, codec, ctx, msgChan, "first", " 1", " 2", " 3", "a very long line", " 12345", "next")
+	require.Len(msgChan, 4)
+	event := <-msgChan
+	require.Equal("first\n 1", event.Message)
+	require.ElementsMatch([]string{MultilineTag, TruncatedTag}, event.Tags)
+	event = <-msgChan
+	require.Equal(" 2\n 3", event.Message)
+	require.Equal([]string{MultilineTag}, event.Tags)
+	event = <-msgChan
+	require.Equal("a very long line", event.Message)
+	require.Equal([]string{TruncatedTag}, event.Tags)
+	event = <-msgChan
+	require.Equal(" 12345", event.Message)
+	require.Empty(event.Tags)
+}
+
+func TestDecodeStreams(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	codec, err := InitHandler(ctx, config.ConfigRaw{
+		"pattern":       `^\s`,
+		"flush_timeout": "0",
+	})
+	require.NoError(err)
+
+	msgChan := make(chan logevent.LogEvent, 10)
+	ctxA := logevent.ContextWithMetadata(ctx, map[string]any{"path": "a.log"})
+	ctxB := logevent.ContextWithMetadata(ctx, map[string]any{"remote_address": "127.0.0.1:5000"})
+	decodeLines(t, codec, ctxA, msgChan, "a1")
+	decodeLines(t, codec, ctxB, msgChan, "b1")
+	decodeLines(t, codec, ctxA, msgChan, " a2")
+	decodeLines(t, codec, ctxB, msgChan, " b2", "b3")
+	decodeLines(t, codec, ctxA, msgChan, "a3")
+	require.Len(msgChan, 2)
+	event := <-msgChan
+	require.Equal("b1\n b2", event.Message)
+	require.Equal("127.0.0.1:5000", event.GetString("@metadata.remote_address"))
+	event = <-msgChan
+	require.Equal("a1\n a2", event.Message)
+	require.Equal("a.log", event.GetString("@metadata.path"))
+}
+
+func TestDecodeAck(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	codec, err := InitHandler(ctx, config.ConfigRaw{
+		"pattern":       `^\s`,
+		"flush_timeout": "0",
+	})
+	require.NoError(err)
+
+	msgChan := make(chan logevent.LogEvent, 10)
+	acked := []string{}
+	for _, line := range []string{"first", " second", "third"} {
+		ack := logevent.NewAck(func(err error) {
+			require.NoError(err)
+			acked = append(acked, line)
+		})
+		decodeLines(t, codec, logevent.ContextWithAck(ctx, ack), msgChan, line)
+		ack.Done(nil)
+	}
+	require.Empty(acked)
+
+	event := <-msgChan
+	require.Equal("first\n second", event.Message)
+	event.Ack()
+	require.Equal([]string{"first", " second"}, acked)
+}
+
+func TestDecodeAckCanceled(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	codec, err := InitHandler(ctx, config.ConfigRaw{
+		"pattern":       `^\s`,
+		"flush_timeout": "0",
+	})
+	require.NoError(err)
+
+	// nobody receives events, the joined event is not sent after ctx done
+	msgChan := make(chan logevent.LogEvent)
+	acked := map[string]error{}
+	for _, line := range []string{"first", " second", "third"} {
+		if line == "third" {
+			cancel()
+		}
+		ack := logevent.NewAck(func(err error) {
+			acked[line] = err
+		})
+		decodeLines(t, codec, logevent.ContextWithAck(ctx, ack), msgChan, line)
+		ack.Done(nil)
+	}
+	require.Equal(map[string]error{"first": context.Canceled, " second": context.Canceled}, acked)
+}
+
+func TestInitHandler(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	for _, raw := range []config.ConfigRaw{
+		{},
+		{"pattern": `[`},
+		{"pattern": `^\s`, "what": "both"},
+		{"pattern": `^\s`, "flush_timeout": "1x"},
+		{"pattern": `^\s`, "stream_identity": "%{path|unknown}"},
+	} {
+		_, err := InitHandler(ctx, raw)
+		require.Error(err, raw)
+	}
+}
@@ -0,0 +1,288 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+)
+
+// errors
+var (
+	ErrorUnknownKey1   = errutil.NewFactory("unknown key %q")
+	ErrorUnknownKeyOf2 = errutil.NewFactory("unknown key %q of %q")
+	ErrorTypeMismatch3 = errutil.NewFactory("key %q expects %s, got %s")
+)
+
+// CheckError is a problem found in config by Check
+type CheckError struct {
+	Location string // location in config, ex: pipeline "main" filter[1] (grok)
+	Err      error
+}
+
+func (t *CheckError) Error() string {
+	if t.Location == "" {
+		return t.Err.Error()
+	}
+	return t.Location + ": " + t.Err.Error()
+}
+
+// configChecker collects problems found by ReflectConfig while checking a plugin
+type configChecker struct {
+	raw          ConfigRaw // raw config of the checked plugin
+	errs         []error
+	typeMismatch bool
+}
+
+type configCheckerKey struct{}
+
+// contextWithConfigChecker returns a context carrying checker, plugins initialized with it report to checker
+func contextWithConfigChecker(ctx context.Context, checker *configChecker) context.Context {
+	return context.WithValue(ctx, configCheckerKey{}, checker)
+}
+
+// configCheckerFromContext returns the configChecker of ctx, or nil if not checking
+func configCheckerFromContext(ctx context.Context) *configChecker {
+	if ctx == nil {
+		return nil
+	}
+	checker, _ := ctx.Value(configCheckerKey{}).(*configChecker)
+	return checker
+}
+
+// IsCheck returns true if plugins are initialized by Config.Check with ctx, handlers should
+// only validate their config, without connecting to services, listening or registering global state
+func IsCheck(ctx context.Context) bool {
+	return configCheckerFromContext(ctx) != nil
+}
+
+// checkBuilt reports problems of raw to the config check carried by ctx after the handler returned,
+// unknown keys are found by reflecting raw to a new config of the type of plugin
+func checkBuilt(ctx context.Context, raw ConfigRaw, plugin any, err error) {
+	checker := configCheckerFromContext(ctx)
+	if checker == nil {
+		return
+	}
+	if err != nil {
+		// errors of nested plugins are already reported
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && !checker.typeMismatch {
+			checker.reflected(raw, nil, nil, err)
+		}
+		return
+	}
+	if wrapper, ok := plugin.(interface{ PluginConfig() any }); ok {
+		plugin = wrapper.PluginConfig()
+	}
+	rt := reflect.TypeOf(plugin)
+	if rt == nil || rt.Kind() != reflect.Ptr || rt.Elem().Kind() != reflect.Struct {
+		return
+	}
+	_ = ReflectConfigContext(ctx, raw, reflect.New(rt.Elem()).Interface())
+}
+
+// reflected records unknown keys and type mismatches of raw reflected to conf by ReflectConfigContext
+func (t *configChecker) reflected(raw ConfigRaw, obj map[string]any, conf any, err error) {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		t.errs = append(t.errs, ErrorTypeMismatch3.New(nil, typeErr.Field, typeErr.Type.String(), typeErr.Value))
+		t.typeMismatch = true
+		return
+	}
+
+	// codec is initialized by GetCodec, and checked with its own raw config
+	if _, ok := obj["codec"]; ok {
+		withoutCodec := make(map[string]any, len(obj))
+		for key, value := range obj {
+			if key != "codec" {
+				withoutCodec[key] = value
+			}
+		}
+		obj = withoutCodec
+	}
+
+	isPlugin := reflect.ValueOf(raw).Pointer() == reflect.ValueOf(t.raw).Pointer()
+	for _, key := range unknownKeys(obj, reflect.TypeOf(conf), "json", "") {
+		if isPlugin {
+			t.errs = append(t.errs, ErrorUnknownKey1.New(nil, key))
+		} else {
+			t.errs = append(t.errs, ErrorUnknownKeyOf2.New(nil, key, raw["type"]))
+		}
+	}
+}
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// unknownKeys returns keys of raw not matching any field of type rt, nested objects
+// are checked recursively, keys are matched case-insensitively like encoding/json,
+// the struct tag of tagName is used as field name
+func unknownKeys(raw any, rt reflect.Type, tagName string, path string) (keys []string) {
+	for rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if reflect.PointerTo(rt).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+
+	switch rt.Kind() {
+	case reflect.Struct:
+		obj, ok := raw.(map[string]any)
+		if !ok {
+			return nil
+		}
+		fields := structFields(rt, tagName)
+		for key, value := range obj {
+			fullKey := key
+			if path != "" {
+				fullKey = path + "." + key
+			}
+			field, ok := fields[strings.ToLower(key)]
+			if !ok {
+				keys = append(keys, fullKey)
+				continue
+			}
+			keys = append(keys, unknownKeys(value, field, tagName, fullKey)...)
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := raw.([]any)
+		if !ok {
+			return nil
+		}
+		for i, value := range list {
+			keys = append(keys, unknownKeys(value, rt.Elem(), tagName, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// structFields returns fields of struct type rt by lower case name, including embedded fields
+func structFields(rt reflect.Type, tagName string) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := strings.Split(field.Tag.Get(tagName), ",")
+		name := tag[0]
+		if name == "-" {
+			continue
+		}
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && fieldType.Kind() == reflect.Struct && (name == "" || hasTagOption(tag, "inline")) {
+			for key, value := range structFields(fieldType, tagName) {
+				if _, ok := fields[key]; !ok {
+					fields[key] = value
+				}
+			}
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
+
+func hasTagOption(tag []string, option string) bool {
+	for _, opt := range tag[1:] {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFile loads config from path, then checks config like Check,
+// unknown keys of the config files themselves are reported too
+func CheckFile(ctx context.Context, path string) (errs []error) {
+	files, err := loadConfigFiles(path)
+	if err != nil {
+		return []error{err}
+	}
+	for _, file := range files {
+		for _, key := range unknownKeys(file.obj, reflect.TypeOf(Config{}), file.tagName, "") {
+			errs = append(errs, &CheckError{Location: file.path, Err: ErrorUnknownKey1.New(nil, key)})
+		}
+	}
+
+	conf, err := LoadFromFile(path)
+	if err != nil {
+		return append(errs, &CheckError{Location: path, Err: err})
+	}
+	return append(errs, conf.Check(ctx)...)
+}
+
+// Check initializes all inputs, filters, outputs and codecs of all pipelines without
+// starting them, returns problems found with their location in config: unknown keys,
+// type mismatches, and errors of plugin initialization, ex: invalid expressions.
+func (t *Config) Check(ctx context.Context) (errs []error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// stop goroutines started by plugins on initialization
+	defer cancel()
+
+	for _, pipeline := range t.getPipelines() {
+		check := func(section string, raws []ConfigRaw, build func(ctx context.Context, raw ConfigRaw) error) {
+			for i, raw := range raws {
+				if isDisabled(raw) {
+					continue
+				}
+				location := fmt.Sprintf("pipeline %q %s[%d] (%v)", pipeline.Name, section, i, raw["type"])
+				if source := t.sources.sourceOf(pipeline == &t.PipelineConfig, pipeline.Name, section, i); source != "" {
+					location = fmt.Sprintf("%s %s", source, location)
+				}
+				for _, err := range checkPlugin(ctx, raw, build) {
+					errs = append(errs, &CheckError{Location: location, Err: err})
+				}
+			}
+		}
+		check("input", pipeline.InputRaw, func(ctx context.Context, raw ConfigRaw) (err error) {
+			_, err = newInput(ctx, raw, t)
+			return err
+		})
+		check("filter", pipeline.FilterRaw, func(ctx context.Context, raw ConfigRaw) (err error) {
+			_, err = newFilter(ctx, raw, t)
+			return err
+		})
+		check("output", pipeline.OutputRaw, func(ctx context.Context, raw ConfigRaw) (err error) {
+			_, err = newOutput(ctx, raw, t)
+			return err
+		})
+	}
+	return errs
+}
+
+// checkPlugin builds the plugin of raw config with a context carrying the checker,
+// returns problems found by ReflectConfig and the initialization error
+func checkPlugin(ctx context.Context, raw ConfigRaw, build func(ctx context.Context, raw ConfigRaw) error) (errs []error) {
+	checker := &configChecker{raw: raw}
+	err := build(contextWithConfigChecker(ctx, checker), raw)
+	errs = checker.errs
+	if err != nil && !checker.typeMismatch {
+		errs = append(errs, initErrorCause(err))
+	}
+	return errs
+}
+
+// initErrorCause returns the error returned by the plugin handler,
+// without the raw config printed by ErrorInitXFailed1
+func initErrorCause(err error) error {
+	errobj, ok := err.(errutil.ErrorObject)
+	if !ok || errobj.Parent() == nil {
+		return err
+	}
+	if ErrorInitInputFailed1.Match(err) || ErrorInitFilterFailed1.Match(err) || ErrorInitOutputFailed1.Match(err) {
+		return errobj.Parent()
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+type testCheckOutput struct {
+	OutputConfig
+	Port int `json:"port"`
+	TLS  struct {
+		Cert string `json:"cert"`
+	} `json:"tls"`
+}
+
+func (t *testCheckOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistOutputHandler("test_check", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		conf := testCheckOutput{}
+		if err := ReflectConfig(raw, &conf); err != nil {
+			return nil, err
+		}
+		if conf.Port < 0 {
+			return nil, ErrorTimeout1.New(nil, conf.Port)
+		}
+		return &conf, nil
+	})
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(os.WriteFile(path, []byte(strings.TrimSpace(`
+chsize: 10
+outptu: []
+output:
+  - type: test_check
+    id: ok
+    codec: json
+    port: 80
+    tls:
+      cert: a.pem
+  - type: test_check
+    prot: 80
+    tls:
+      crt: a.pem
+  - type: test_check
+    port: "80"
+  - type: test_check
+    port: -1
+  - type: test_check
+    disabled: true
+    port: "80"
+pipelines:
+  - name: p1
+    filter_wrokers: 2
+    output:
+      - type: test_check_not_found
+	`)), 0o600))
+
+	errs := CheckFile(context.Background(), path)
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	require.Equal([]string{
+		path + `: unknown key "outptu"`,
+		path + `: unknown key "pipelines[0].filter_wrokers"`,
+		`pipeline "main" output[1] (test_check): unknown key "prot"`,
+		`pipeline "main" output[1] (test_check): unknown key "tls.crt"`,
+		`pipeline "main" output[2] (test_check): key "port" expects int, got string`,
+		`pipeline "main" output[3] (test_check): timeout: -1`,
+		`pipeline "p1" output[0] (test_check_not_found): unknown output config type: "test_check_not_found"`,
+	}, messages)
+
+	require.NoError(os.WriteFile(path, []byte("output: ["), 0o600))
+	errs = CheckFile(context.Background(), path)
+	require.Len(errs, 1)
+	require.Contains(errs[0].Error(), path)
+}
+
+func TestCheckConcurrent(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistOutputHandler("test_check_concurrent", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		conf := testCheckOutput{}
+		return &conf, ReflectConfig(raw, &conf)
+	})
+
+	// checks and plugins initialized concurrently do not report to each other
+	var wg sync.WaitGroup
+	results := make([][]error, 10)
+	for i := range results {
+		wg.Add(2)
+		conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+output:
+  - type: test_check_concurrent
+    prot: 80
+		`)))
+		require.NoError(err)
+		go func() {
+			defer wg.Done()
+			results[i] = conf.Check(context.Background())
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = newOutput(context.Background(), ConfigRaw{"type": "test_check_concurrent", "unknown": true}, nil)
+		}()
+	}
+	wg.Wait()
+	for _, errs := range results {
+		require.Len(errs, 1)
+		require.Contains(errs[0].Error(), `unknown key "prot"`)
+	}
+}
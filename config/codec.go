@@ -101,7 +101,9 @@ func GetCodec(
 		return nil, ErrorUnknownCodecType1.New(nil, typeName)
 	}
 
-	if codec, err = handler(ctx, cfg); err != nil {
+	codec, err = handler(ctx, cfg)
+	checkBuilt(ctx, cfg, codec, err)
+	if err != nil {
 		return nil, ErrorInitCodecFailed1.New(err, cfg)
 	}
 
@@ -158,6 +160,8 @@ func (c *DefaultCodec) Decode(ctx context.Context, data any,
 	}
 
 	goglog.Logger.Debugf("%q %v", event.Message, event)
+	event.SetMetadataFromContext(ctx)
+	event.SetAck(logevent.AckFromContext(ctx))
 	msgChan <- event
 	ok = true
 
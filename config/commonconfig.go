@@ -8,7 +8,10 @@ type TypeCommonConfig interface {
 // CommonConfig is basic config struct
 type CommonConfig struct {
 	Type     string `json:"type"`
-	Disabled bool   `json:"disabled" yaml:"disabled"` // if set the input/output/filter will be disabled
+	ID       string `json:"id" yaml:"id"`               // identify the input/output/filter, defaults to type
+	Disabled bool   `json:"disabled" yaml:"disabled"`   // if set the input/output/filter will be disabled
+	If       string `json:"if,omitempty" yaml:"if"`     // condition to apply the input/output/filter on events, see config/condition
+	When     string `json:"when,omitempty" yaml:"when"` // alias of if
 }
 
 // GetType return module type of config
@@ -16,5 +19,21 @@ func (t CommonConfig) GetType() string {
 	return t.Type
 }
 
+// GetID return id of config, defaults to module type
+func (t CommonConfig) GetID() string {
+	if t.ID != "" {
+		return t.ID
+	}
+	return t.Type
+}
+
+// GetPluginID return id of config if supported, otherwise module type
+func GetPluginID(conf TypeCommonConfig) string {
+	if c, ok := conf.(interface{ GetID() string }); ok {
+		return c.GetID()
+	}
+	return conf.GetType()
+}
+
 // ConfigRaw is general config struct
 type ConfigRaw map[string]any
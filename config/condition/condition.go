@@ -0,0 +1,106 @@
+package condition
+
+import (
+	"math/rand"
+	"reflect"
+
+	"github.com/Knetic/govaluate"
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// errors
+var (
+	ErrorBuiltInFunctionParameters1 = errutil.NewFactory("Built-in function '%s' parameters error")
+	ErrorNotBoolean1                = errutil.NewFactory("condition returns not a boolean: %v")
+)
+
+// BuiltInFunctions are functions available in conditions
+var BuiltInFunctions = map[string]govaluate.ExpressionFunction{
+	"empty": func(args ...any) (any, error) {
+		if len(args) > 1 {
+			return nil, ErrorBuiltInFunctionParameters1.New(nil, "empty")
+		} else if len(args) == 0 {
+			return true, nil
+		}
+		return args[0] == nil, nil
+	},
+	"strlen": func(args ...any) (any, error) {
+		if len(args) > 1 {
+			return nil, ErrorBuiltInFunctionParameters1.New(nil, "strlen")
+		} else if len(args) == 0 {
+			return float64(0), nil
+		}
+		length := len(args[0].(string))
+		return float64(length), nil
+	},
+	"map": func(args ...any) (any, error) {
+		if len(args) > 1 {
+			return nil, ErrorBuiltInFunctionParameters1.New(nil, "map")
+		} else if len(args) == 0 {
+			return []any{}, nil
+		}
+
+		s := reflect.ValueOf(args[0])
+		if s.Kind() != reflect.Slice {
+			return nil, ErrorBuiltInFunctionParameters1.New(nil, "map")
+		}
+
+		ret := make([]any, s.Len())
+
+		for i := 0; i < s.Len(); i++ {
+			ret[i] = s.Index(i).Interface()
+		}
+
+		return ret, nil
+	},
+	"rand": func(args ...any) (any, error) {
+		if len(args) > 0 {
+			return nil, ErrorBuiltInFunctionParameters1.New(nil, "rand")
+		}
+		return rand.Float64(), nil
+	},
+}
+
+// EventParameters pack event's parameters by member function `Get` access
+type EventParameters struct {
+	Event *logevent.LogEvent
+}
+
+// Get obtaining value from event's specified field recursively
+func (ep *EventParameters) Get(field string) (any, error) {
+	return ep.Event.Get(field), nil
+}
+
+// Condition is a compiled govaluate expression evaluated on events
+type Condition struct {
+	expression *govaluate.EvaluableExpression
+}
+
+// New compiles the expression with the built-in functions
+func New(expression string) (*Condition, error) {
+	compiled, err := govaluate.NewEvaluableExpressionWithFunctions(expression, BuiltInFunctions)
+	if err != nil {
+		return nil, err
+	}
+	return &Condition{expression: compiled}, nil
+}
+
+// String returns the expression of the condition
+func (t *Condition) String() string {
+	return t.expression.String()
+}
+
+// Match returns true if the condition is satisfied by the event
+func (t *Condition) Match(event logevent.LogEvent) (bool, error) {
+	ret, err := t.expression.Eval(&EventParameters{Event: &event})
+	if err != nil {
+		return false, err
+	}
+	r, ok := ret.(bool)
+	if !ok {
+		return false, ErrorNotBoolean1.New(nil, ret)
+	}
+	return r, nil
+}
@@ -0,0 +1,48 @@
+package condition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func TestCondition(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	event := logevent.LogEvent{
+		Message: "test",
+		Tags:    []string{"tag1"},
+		Extra: map[string]any{
+			"level": "ERROR",
+			"nginx": map[string]any{
+				"status": 500,
+			},
+		},
+	}
+
+	for expression, expected := range map[string]bool{
+		"level == 'ERROR'":                      true,
+		"[nginx.status] >= 500":                 true,
+		"'tag1' IN map([tags])":                 true,
+		"!empty(level) && strlen(message) == 4": true,
+		"empty(foo)":                            true,
+		"message == 'other'":                    false,
+	} {
+		cond, err := New(expression)
+		require.NoError(err, expression)
+		match, err := cond.Match(event)
+		require.NoError(err, expression)
+		require.Equal(expected, match, expression)
+	}
+
+	cond, err := New("level")
+	require.NoError(err)
+	_, err = cond.Match(event)
+	require.True(ErrorNotBoolean1.In(err))
+
+	_, err = New("level ==")
+	require.Error(err)
+}
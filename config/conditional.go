@@ -0,0 +1,242 @@
+package config
+
+import (
+	"context"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/condition"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// errors
+var (
+	ErrorInvalidCondition1   = errutil.NewFactory("invalid condition: %q")
+	ErrorConditionConflicted = errutil.NewFactory("only one of if and when can be set")
+)
+
+// newCondition returns the condition set by if or when of raw config, nil if not set
+func newCondition(raw ConfigRaw) (*condition.Condition, error) {
+	ifRaw, hasIf := raw["if"]
+	whenRaw, hasWhen := raw["when"]
+	if hasIf && hasWhen {
+		return nil, ErrorConditionConflicted.New(nil)
+	}
+	expressionRaw := ifRaw
+	if hasWhen {
+		expressionRaw = whenRaw
+	}
+	if expressionRaw == nil {
+		return nil, nil
+	}
+	expression, ok := expressionRaw.(string)
+	if !ok {
+		return nil, ErrorInvalidCondition1.New(nil, expressionRaw)
+	}
+	if expression == "" {
+		return nil, nil
+	}
+	cond, err := condition.New(expression)
+	if err != nil {
+		return nil, ErrorInvalidCondition1.New(err, expression)
+	}
+	return cond, nil
+}
+
+// matchCondition returns true if the event satisfies cond,
+// an event failed to evaluate does not satisfy it
+func matchCondition(conf TypeCommonConfig, cond *condition.Condition, event logevent.LogEvent) bool {
+	ok, err := cond.Match(event)
+	if err != nil {
+		goglog.Logger.Errorf("%q evaluate condition %q failed: %v", GetPluginID(conf), cond, err)
+		return false
+	}
+	return ok
+}
+
+// forwardEvents forwards events from in to out until ctx is done, events which forward
+// returns false for are acknowledged and dropped. Events received after ctx is done are
+// not acknowledged until done is closed.
+func forwardEvents(
+	ctx context.Context,
+	done <-chan struct{},
+	in <-chan logevent.LogEvent,
+	out chan<- logevent.LogEvent,
+	forward func(event logevent.LogEvent) bool,
+) {
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case <-done:
+					return
+				case event := <-in:
+					event.Nack(ctx.Err())
+				}
+			}
+		case event := <-in:
+			if !forward(event) {
+				event.Ack()
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				event.Nack(ctx.Err())
+			case out <- event:
+			}
+		}
+	}
+}
+
+// conditionalInput sends events of the input satisfying the condition
+type conditionalInput struct {
+	TypeInputConfig
+	condition *condition.Condition
+}
+
+// GetID returns id of the wrapped input
+func (t *conditionalInput) GetID() string {
+	return GetPluginID(t.TypeInputConfig)
+}
+
+// Start starts the wrapped input, dropping events not satisfying the condition
+func (t *conditionalInput) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) error {
+	ch := make(chan logevent.LogEvent)
+	done := make(chan struct{})
+	defer close(done)
+	go forwardEvents(ctx, done, ch, msgChan, func(event logevent.LogEvent) bool {
+		return matchCondition(t.TypeInputConfig, t.condition, event)
+	})
+	return t.TypeInputConfig.Start(ctx, ch)
+}
+
+// conditionalFilter applies the filter on events satisfying the condition
+type conditionalFilter struct {
+	TypeFilterConfig
+	condition *condition.Condition
+}
+
+// GetID returns id of the wrapped filter
+func (t *conditionalFilter) GetID() string {
+	return GetPluginID(t.TypeFilterConfig)
+}
+
+// Event filters the event if it satisfies the condition, otherwise returns it unchanged
+func (t *conditionalFilter) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	if !matchCondition(t.TypeFilterConfig, t.condition, event) {
+		return event, false
+	}
+	return t.TypeFilterConfig.Event(ctx, event)
+}
+
+// Events filters the event if it satisfies the condition, for filters emitting many events
+func (t *conditionalFilter) Events(ctx context.Context, event logevent.LogEvent) ([]logevent.LogEvent, bool) {
+	if !matchCondition(t.TypeFilterConfig, t.condition, event) {
+		return []logevent.LogEvent{event}, false
+	}
+	if multi, ok := t.TypeFilterConfig.(TypeMultiFilterConfig); ok {
+		return multi.Events(ctx, event)
+	}
+	event, ok := t.TypeFilterConfig.Event(ctx, event)
+	return []logevent.LogEvent{event}, ok
+}
+
+// conditionalFlushFilter applies the filter implementing TypeFlushFilterConfig on events
+// satisfying the condition
+type conditionalFlushFilter struct {
+	conditionalFilter
+}
+
+// Flush flushes the wrapped filter regardless of the condition
+func (t *conditionalFlushFilter) Flush(ctx context.Context, final bool) []logevent.LogEvent {
+	return t.TypeFilterConfig.(TypeFlushFilterConfig).Flush(ctx, final)
+}
+
+// conditionalOutput sends events satisfying the condition to the output,
+// other events are acknowledged without sending
+type conditionalOutput struct {
+	TypeOutputConfig
+	condition *condition.Condition
+}
+
+// GetID returns id of the wrapped output
+func (t *conditionalOutput) GetID() string {
+	return GetPluginID(t.TypeOutputConfig)
+}
+
+// Output sends the event to the output if it satisfies the condition
+func (t *conditionalOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	if !matchCondition(t.TypeOutputConfig, t.condition, event) {
+		return nil
+	}
+	return t.TypeOutputConfig.Output(ctx, event)
+}
+
+func (t *conditionalOutput) getOutputQueue() (size int, overflow string) {
+	if conf, ok := t.TypeOutputConfig.(interface{ getOutputQueue() (int, string) }); ok {
+		return conf.getOutputQueue()
+	}
+	return 0, ""
+}
+
+func (t *conditionalOutput) getOutputBatch() (size int, bytes int, interval string) {
+	if conf, ok := t.TypeOutputConfig.(interface{ getOutputBatch() (int, int, string) }); ok {
+		return conf.getOutputBatch()
+	}
+	return 0, 0, ""
+}
+
+// conditionalBatchOutput sends batches of events satisfying the condition to the batch output
+type conditionalBatchOutput struct {
+	conditionalOutput
+}
+
+// OutputBatch sends events satisfying the condition to the output
+func (t *conditionalBatchOutput) OutputBatch(ctx context.Context, events []logevent.LogEvent) error {
+	matched := make([]logevent.LogEvent, 0, len(events))
+	for _, event := range events {
+		if matchCondition(t.TypeOutputConfig, t.condition, event) {
+			matched = append(matched, event)
+		}
+	}
+	if len(matched) < 1 {
+		return nil
+	}
+	return t.TypeOutputConfig.(TypeBatchOutputConfig).OutputBatch(ctx, matched)
+}
+
+// withInputCondition wraps the input by the condition of raw config
+func withInputCondition(input TypeInputConfig, raw ConfigRaw) (TypeInputConfig, error) {
+	cond, err := newCondition(raw)
+	if err != nil || cond == nil {
+		return input, err
+	}
+	return &conditionalInput{TypeInputConfig: input, condition: cond}, nil
+}
+
+// withFilterCondition wraps the filter by the condition of raw config
+func withFilterCondition(filter TypeFilterConfig, raw ConfigRaw) (TypeFilterConfig, error) {
+	cond, err := newCondition(raw)
+	if err != nil || cond == nil {
+		return filter, err
+	}
+	if _, ok := filter.(TypeFlushFilterConfig); ok {
+		return &conditionalFlushFilter{conditionalFilter{TypeFilterConfig: filter, condition: cond}}, nil
+	}
+	return &conditionalFilter{TypeFilterConfig: filter, condition: cond}, nil
+}
+
+// withOutputCondition wraps the output by the condition of raw config
+func withOutputCondition(output TypeOutputConfig, raw ConfigRaw) (TypeOutputConfig, error) {
+	cond, err := newCondition(raw)
+	if err != nil || cond == nil {
+		return output, err
+	}
+	conditional := conditionalOutput{TypeOutputConfig: output, condition: cond}
+	if _, ok := output.(TypeBatchOutputConfig); ok {
+		return &conditionalBatchOutput{conditionalOutput: conditional}, nil
+	}
+	return &conditional, nil
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+type testConditionalInput struct {
+	InputConfig
+	Messages []string `json:"messages"`
+}
+
+func (t *testConditionalInput) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) error {
+	for _, message := range t.Messages {
+		msgChan <- logevent.LogEvent{Message: message}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+type testConditionalFilter struct {
+	FilterConfig
+	Value string `json:"value"`
+}
+
+func (f *testConditionalFilter) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	event.SetValue("value", f.Value)
+	return event, true
+}
+
+func TestConditional(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistInputHandler("test_conditional", func(ctx context.Context, raw ConfigRaw, control Control) (TypeInputConfig, error) {
+		conf := &testConditionalInput{}
+		return conf, ReflectConfig(raw, conf)
+	})
+	RegistFilterHandler("test_conditional", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		conf := &testConditionalFilter{}
+		return conf, ReflectConfig(raw, conf)
+	})
+	var outputs []*testBatchOutput
+	RegistOutputHandler("test_batch", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		conf := &testBatchOutput{}
+		outputs = append(outputs, conf)
+		return conf, ReflectConfig(raw, conf)
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+input:
+  - type: test_conditional
+    messages: ["a", "b", "skip"]
+    if: "message != 'skip'"
+filter:
+  - type: test_conditional
+    value: "A"
+    if: "message == 'a'"
+    add_tag: ["tagged"]
+  - type: test_conditional
+    value: "B"
+    when: "message == 'b'"
+output:
+  - type: test_batch
+    id: "a"
+    batch_size: 1
+    if: "value == 'A'"
+  - type: test_batch
+    id: "b"
+    batch_size: 1
+    if: "'tagged' IN map([tags])"
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+	require.Len(outputs, 2)
+
+	var events []logevent.LogEvent
+	for range 2 {
+		event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+		require.NoError(err)
+		events = append(events, event)
+	}
+	// "skip" is dropped by the input condition
+	event, _ := conf.TestGetOutputEvent(100 * time.Millisecond)
+	require.Empty(event.Message)
+
+	require.Equal("a", events[0].Message)
+	require.Equal("A", events[0].GetString("value"))
+	require.Equal([]string{"tagged"}, events[0].Tags)
+	require.Equal("b", events[1].Message)
+	require.Equal("B", events[1].GetString("value"))
+	require.Empty(events[1].Tags)
+
+	require.Equal([][]string{{"a"}}, outputs[0].getBatches())
+	require.Equal([][]string{{"a"}}, outputs[1].getBatches())
+
+	cancel()
+	require.NoError(conf.Wait())
+
+	conf, err = LoadFromYAML([]byte(strings.TrimSpace(`
+output:
+  - type: test_batch
+    if: "message =="
+  - type: test_batch
+    if: "true"
+    when: "true"
+	`)))
+	require.NoError(err)
+	errs := conf.Check(context.Background())
+	require.Len(errs, 2)
+	require.True(ErrorInvalidCondition1.In(errs[0].(*CheckError).Err))
+	require.True(ErrorConditionConflicted.In(errs[1].(*CheckError).Err))
+}
@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -17,6 +19,8 @@ import (
 	"github.com/tsaikd/gogstash/config/ctxutil"
 	"github.com/tsaikd/gogstash/config/goglog"
 	"github.com/tsaikd/gogstash/config/logevent"
+	"github.com/tsaikd/gogstash/config/logstash"
+	"github.com/tsaikd/gogstash/config/monitor"
 )
 
 // errors
@@ -27,18 +31,20 @@ var (
 	ErrorTimeout1            = errutil.NewFactory("timeout: %v")
 	ErrorInvalidState        = errutil.NewFactory("Invalid state for pause/resume")
 	ErrorNoFilterName        = errutil.NewFactory("No name - probably invalid syntax in configuration section %s")
+	ErrorDuplicatePipeline1  = errutil.NewFactory("duplicate pipeline name: %q")
+	ErrorNoPipelineName1     = errutil.NewFactory("no name for pipeline at index %d")
+	ErrorPipelineFailed1     = errutil.NewFactory("pipeline %q failed")
 )
 
 // Config contains all config
 type Config struct {
-	InputRaw  []ConfigRaw `json:"input,omitempty" yaml:"input"`
-	FilterRaw []ConfigRaw `json:"filter,omitempty" yaml:"filter"`
-	OutputRaw []ConfigRaw `json:"output,omitempty" yaml:"output"`
+	// the main pipeline, configured by the top level input/filter/output sections
+	PipelineConfig `yaml:",inline"`
 
-	Event *logevent.Config `json:"event,omitempty" yaml:"event"`
+	// additional named pipelines running in the same process
+	Pipelines []*PipelineConfig `json:"pipelines,omitempty" yaml:"pipelines"`
 
-	// channel size: chInFilter, chFilterOut, chOutDebug
-	ChannelSize int `json:"chsize,omitempty" yaml:"chsize"`
+	Event *logevent.Config `json:"event,omitempty" yaml:"event"`
 
 	// worker number, defaults to 1
 	Worker int `json:"worker,omitempty" yaml:"worker"`
@@ -46,17 +52,20 @@ type Config struct {
 	// enable debug channel, used for testing
 	DebugChannel bool `json:"debugch,omitempty" yaml:"debugch"`
 
+	// monitoring API server, disabled by default
+	Monitor *monitor.Config `json:"monitor,omitempty" yaml:"monitor"`
+
 	Sentry struct {
 		DSN                  string        `json:"dsn,omitempty" yaml:"dsn"`
 		SyncTransport        bool          `json:"syncTransport,omitempty" yaml:"syncTransport"`
 		SyncTransportTimeout time.Duration `json:"syncTransportTimeout,omitempty" yaml:"syncTransportTimeout"`
 	} `json:"sentry,omitempty" yaml:"sentry"`
 
-	chInFilter  MsgChan // channel from input to filter
-	chFilterOut MsgChan // channel from filter to output
-	chOutDebug  MsgChan // channel from output to debug
 	ctx         context.Context
 	eg          *errgroup.Group
+	reloadMutex *sync.Mutex
+	monitor     *monitor.Registry // nil if monitor disabled
+	sources     *configSources    // nil if loaded from a single config file
 
 	state        int32
 	signalPause  *ctxutil.Broadcaster
@@ -64,26 +73,57 @@ type Config struct {
 }
 
 var defaultConfig = Config{
-	ChannelSize: 100,
-	Worker:      1,
+	PipelineConfig: PipelineConfig{
+		Name:          DefaultPipelineName,
+		ChannelSize:   100,
+		FilterWorkers: 1,
+	},
+	Worker: 1,
 }
 
 // MsgChan message channel type
 type MsgChan chan logevent.LogEvent
 
-// LoadFromFile load config from filepath
+// LoadFromFile load config from filepath, which is a file, a directory or a glob pattern,
+// config files are merged in lexical order with files included by them
 func LoadFromFile(path string) (config Config, err error) {
+	files, err := loadConfigFiles(path)
+	if err != nil {
+		return config, err
+	}
+	if len(files) > 1 || isConfigFiles(path) {
+		return loadFromFiles(path, files)
+	}
+
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return config, ErrorReadConfigFile1.New(err, path)
 	}
+	if isLogstashPath(path) {
+		config, err = LoadFromLogstash(data)
+	} else if isYAMLPath(path) {
+		config, err = LoadFromYAML(data)
+	} else {
+		config, err = LoadFromJSON(data)
+	}
+	if err != nil {
+		return config, ErrorLoadConfigFile1.New(err, path)
+	}
+	return config, nil
+}
+
+// isLogstashPath returns whether the config file of path is in logstash config DSL
+func isLogstashPath(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".conf"
+}
 
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
+// isYAMLPath returns whether the config file of path is in YAML format, otherwise JSON
+func isYAMLPath(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
 	case ".yml", ".yaml":
-		return LoadFromYAML(data)
+		return true
 	default:
-		return LoadFromJSON(data)
+		return false
 	}
 }
 
@@ -97,7 +137,7 @@ func LoadFromJSON(data []byte) (config Config, err error) {
 		return config, ErrorUnmarshalJSONConfig.New(err)
 	}
 
-	initConfig(&config)
+	err = initConfig(&config)
 	return
 }
 
@@ -106,72 +146,182 @@ func LoadFromYAML(data []byte) (config Config, err error) {
 	if err = yaml.Unmarshal(data, &config); err != nil {
 		return config, ErrorUnmarshalYAMLConfig.New(err)
 	}
-	initConfig(&config)
+	err = initConfig(&config)
 	return
 }
 
-func initConfig(config *Config) {
+func init() {
+	logstash.Registered = registeredPlugin
+}
+
+// registeredPlugin reports whether the plugin name of section is registered, used to convert
+// logstash config onto registered plugins
+func registeredPlugin(section string, name string) (ok bool) {
+	switch section {
+	case "input":
+		_, ok = mapInputHandler[name]
+	case "filter":
+		_, ok = mapFilterHandler[name]
+	case "output":
+		_, ok = mapOutputHandler[name]
+	case "codec":
+		_, ok = mapCodecHandler[name]
+	}
+	return
+}
+
+// LoadFromLogstash load config from []byte in logstash config DSL, see config/logstash
+func LoadFromLogstash(data []byte) (config Config, err error) {
+	if data, err = logstash.ToYAML(data); err != nil {
+		return
+	}
+	return LoadFromYAML(data)
+}
+
+func initConfig(config *Config) (err error) {
 	rv := reflect.ValueOf(&config)
 	formatReflect(rv)
 
 	if config.ChannelSize < 1 {
 		config.ChannelSize = defaultConfig.ChannelSize
 	}
+	if config.FilterWorkers < 1 {
+		config.FilterWorkers = defaultConfig.FilterWorkers
+	}
 	if config.Worker < 1 {
 		config.Worker = defaultConfig.Worker
 	}
-	if config.Event != nil {
-		logevent.SetConfig(config.Event)
+	if config.Name == "" {
+		config.Name = defaultConfig.Name
 	}
 
-	config.chInFilter = make(MsgChan, config.ChannelSize)
-	config.chFilterOut = make(MsgChan, config.ChannelSize)
-	if config.DebugChannel {
-		config.chOutDebug = make(MsgChan, config.ChannelSize)
+	if config.Monitor != nil {
+		if err = config.Monitor.Init(); err != nil {
+			return err
+		}
 	}
+
+	for i, pipeline := range config.Pipelines {
+		if pipeline == nil || pipeline.Name == "" {
+			return ErrorNoPipelineName1.New(nil, i)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, pipeline := range config.getPipelines() {
+		if names[pipeline.Name] {
+			return ErrorDuplicatePipeline1.New(nil, pipeline.Name)
+		}
+		names[pipeline.Name] = true
+		for _, raws := range [][]ConfigRaw{pipeline.InputRaw, pipeline.FilterRaw, pipeline.OutputRaw} {
+			if err = checkSecrets(raws); err != nil {
+				return err
+			}
+		}
+		if err = initPipeline(pipeline, config.PipelineConfig, config.DebugChannel); err != nil {
+			return err
+		}
+	}
+
 	config.state = stateNormal
 	config.signalPause = ctxutil.NewBroadcaster()
 	config.signalResume = ctxutil.NewBroadcaster()
+	config.reloadMutex = &sync.Mutex{}
+	return nil
+}
+
+// getPipelines returns the main pipeline followed by all named pipelines
+func (t *Config) getPipelines() []*PipelineConfig {
+	return append([]*PipelineConfig{&t.PipelineConfig}, t.Pipelines...)
+}
+
+// GetPipeline returns the pipeline with the given name, or nil if not found
+func (t *Config) GetPipeline(name string) *PipelineConfig {
+	for _, pipeline := range t.getPipelines() {
+		if pipeline.Name == name {
+			return pipeline
+		}
+	}
+	return nil
 }
 
 // Start config in goroutines
 func (t *Config) Start(ctx context.Context) (err error) {
-	ctx = contextWithOSSignal(ctx, goglog.Logger, os.Interrupt, syscall.SIGTERM)
-	t.eg, t.ctx = errgroup.WithContext(ctx)
+	t.ctx = contextWithOSSignal(ctx, goglog.Logger, os.Interrupt, syscall.SIGTERM)
+	if t.Event != nil {
+		logevent.SetConfig(t.Event)
+	}
+	// pipelines are isolated from each other, an error in one pipeline
+	// should not cancel the others, so the group is not bound to a context
+	t.eg = &errgroup.Group{}
 
-	if err = t.startInputs(); err != nil {
-		return
+	if t.Monitor != nil {
+		t.monitor = monitor.NewRegistry(func() bool {
+			return atomic.LoadInt32(&t.state) == statePause
+		})
+		if err = t.monitor.Serve(t.ctx, t.Monitor.Address); err != nil {
+			return err
+		}
 	}
-	if err = t.startFilters(); err != nil {
+
+	if err = startPipelines(t.ctx, t, t.monitor, t.getPipelines()); err != nil {
+		t.stopStartedPipelines()
 		return
 	}
-	if err = t.startOutputs(); err != nil {
-		return
+
+	for _, pipeline := range t.getPipelines() {
+		t.runPipeline(pipeline)
 	}
 	return
 }
 
-// Wait blocks until all filters returned, then
+// stopStartedPipelines cancels pipelines started before Start failed and waits for them
+func (t *Config) stopStartedPipelines() {
+	pipelines := t.getPipelines()
+	for _, pipeline := range pipelines {
+		if pipeline.cancel != nil {
+			atomic.StoreInt32(&pipeline.stopped, 1)
+			pipeline.cancel()
+		}
+	}
+	for _, pipeline := range pipelines {
+		if pipeline.done != nil {
+			_ = pipeline.wait()
+			close(pipeline.done)
+		}
+	}
+}
+
+// runPipeline waits for the started pipeline in the group of config,
+// errors of pipelines stopped by reload are ignored
+func (t *Config) runPipeline(pipeline *PipelineConfig) {
+	name := pipeline.Name
+	done := pipeline.done
+	t.eg.Go(func() error {
+		defer close(done)
+		err := pipeline.wait()
+		if err == nil || atomic.LoadInt32(&pipeline.stopped) == 1 {
+			return nil
+		}
+		goglog.Logger.Errorf("pipeline %q stopped: %v", name, err)
+		return ErrorPipelineFailed1.New(err, name)
+	})
+}
+
+// Wait blocks until all pipelines returned, then
 // returns the first non-nil error (if any) from them.
 func (t *Config) Wait() (err error) {
 	return t.eg.Wait()
 }
 
-// TestInputEvent send an event to chInFilter, used for testing
-func (t *Config) TestInputEvent(event logevent.LogEvent) {
-	t.chInFilter <- event
+func (t *Config) getInputs() (inputs []TypeInputConfig, err error) {
+	return t.PipelineConfig.getInputs(t.ctx, t)
 }
 
-// TestGetOutputEvent get an event from chOutDebug, used for testing
-func (t *Config) TestGetOutputEvent(timeout time.Duration) (event logevent.LogEvent, err error) {
-	ctx, cancel := context.WithTimeout(t.ctx, timeout)
-	defer cancel()
-	select {
-	case <-ctx.Done():
-		return
-	case ev := <-t.chOutDebug:
-		return ev, nil
-	case <-time.After(timeout + 10*time.Millisecond):
-		return event, ErrorTimeout1.New(nil, timeout)
-	}
+func (t *Config) getFilters() (filters []TypeFilterConfig, err error) {
+	return t.PipelineConfig.getFilters(t.ctx, t)
+}
+
+func (t *Config) getOutputs() (outputs []TypeOutputConfig, err error) {
+	return t.PipelineConfig.getOutputs(t.ctx, t)
 }
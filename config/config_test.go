@@ -1,10 +1,19 @@
 package config
 
 import (
+	"context"
+	"errors"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+	"github.com/tsaikd/gogstash/config/logstash"
+	"github.com/tsaikd/gogstash/config/persistqueue"
 )
 
 func TestLoadFromJSON(t *testing.T) {
@@ -107,3 +116,272 @@ output:
 	require.Error(err)
 	require.Len(outputs, 0)
 }
+
+func TestLoadFromLogstash(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	// plugins of modloader are not registered in this package
+	logstash.Registered = func(section string, name string) bool { return true }
+	defer func() { logstash.Registered = registeredPlugin }()
+
+	conf, err := LoadFromLogstash([]byte(strings.TrimSpace(`
+input {
+  exec { command => "uptime" interval => 3 }
+}
+filter {
+  if [level] == "debug" { drop {} } else { add_field { key => "env" value => "prod" } }
+}
+output {
+  stdout {}
+}
+	`)))
+	require.NoError(err)
+	require.Len(conf.InputRaw, 1)
+	require.Equal("exec", conf.InputRaw[0]["type"])
+	require.EqualValues(3, conf.InputRaw[0]["interval"])
+	require.Len(conf.FilterRaw, 1)
+	require.Equal("cond", conf.FilterRaw[0]["type"])
+	require.Equal("[level] == 'debug'", conf.FilterRaw[0]["condition"])
+	require.Len(conf.OutputRaw, 1)
+
+	_, err = LoadFromLogstash([]byte("input { exec { command => } }"))
+	require.Error(err)
+
+	logstash.Registered = registeredPlugin
+	_, err = LoadFromLogstash([]byte("filter { ruby { code => \"event.cancel\" } }"))
+	require.True(logstash.ErrorPluginNotSupported.In(err))
+}
+
+type testFailedInput struct {
+	InputConfig
+}
+
+func (t *testFailedInput) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) error {
+	return errors.New("test input failed")
+}
+
+func TestLoadPipelines(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+chsize: 10
+output:
+  - type: stdout
+pipelines:
+  - name: p1
+    chsize: 20
+    filter:
+      - type: add_field
+  - name: p2
+    input:
+      - type: exec
+	`)))
+	require.NoError(err)
+
+	require.Equal(DefaultPipelineName, conf.Name)
+	require.Len(conf.OutputRaw, 1)
+	require.Len(conf.Pipelines, 2)
+	require.Equal(conf.GetPipeline(DefaultPipelineName), &conf.PipelineConfig)
+	require.Nil(conf.GetPipeline("p3"))
+
+	p1 := conf.GetPipeline("p1")
+	require.NotNil(p1)
+	require.Equal(20, p1.ChannelSize)
+	require.Equal(20, cap(p1.chInFilter))
+	require.Len(p1.FilterRaw, 1)
+	p2 := conf.GetPipeline("p2")
+	require.NotNil(p2)
+	require.Equal(10, p2.ChannelSize)
+	require.Len(p2.InputRaw, 1)
+
+	_, err = LoadFromYAML([]byte(strings.TrimSpace(`
+pipelines:
+  - name: p1
+  - name: p1
+	`)))
+	require.True(ErrorDuplicatePipeline1.Match(err))
+
+	_, err = LoadFromJSON([]byte(`{
+		"pipelines": [{"input": []}]
+	}`))
+	require.True(ErrorNoPipelineName1.Match(err))
+}
+
+func TestPipelineIsolation(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistInputHandler("test_failed", func(ctx context.Context, raw ConfigRaw, control Control) (TypeInputConfig, error) {
+		return &testFailedInput{}, nil
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+pipelines:
+  - name: failed
+    input:
+      - type: test_failed
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(context.Background()))
+
+	failed := conf.GetPipeline("failed")
+	require.Error(failed.wait())
+
+	conf.TestInputEvent(logevent.LogEvent{Message: "still running"})
+	event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+	require.NoError(err)
+	require.Equal("still running", event.Message)
+}
+
+type testBlockingInput struct {
+	InputConfig
+	running *int32
+}
+
+func (t *testBlockingInput) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) error {
+	atomic.AddInt32(t.running, 1)
+	defer atomic.AddInt32(t.running, -1)
+	<-ctx.Done()
+	return nil
+}
+
+func TestStartFailedStopsPipelines(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	var running int32
+	RegistInputHandler("test_blocking", func(ctx context.Context, raw ConfigRaw, control Control) (TypeInputConfig, error) {
+		return &testBlockingInput{running: &running}, nil
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+input:
+  - type: test_blocking
+pipelines:
+  - name: invalid
+    output:
+      - type: test_not_exist
+	`)))
+	require.NoError(err)
+	require.Error(conf.Start(context.Background()))
+
+	// the main pipeline started before the failed one is stopped
+	require.Equal(int32(0), atomic.LoadInt32(&running))
+	select {
+	case <-conf.PipelineConfig.ctx.Done():
+	default:
+		require.Fail("main pipeline is still running")
+	}
+}
+
+func TestPersistedQueue(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	queueConf := persistqueue.Config{Type: persistqueue.TypePersisted, Path: dir}
+	queue, err := persistqueue.Open(filepath.Join(dir, DefaultPipelineName), queueConf)
+	require.NoError(err)
+	require.NoError(queue.Push(context.Background(), logevent.LogEvent{Message: "replayed"}))
+	require.NoError(queue.Close())
+
+	conf, err := LoadFromYAML([]byte(`
+debugch: true
+queue:
+  type: persisted
+  path: ` + dir + `
+  fsync: always
+pipelines:
+  - name: p1
+`))
+	require.NoError(err)
+	require.Equal(dir, conf.GetPipeline("p1").Queue.Path)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(conf.Start(ctx))
+
+	event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+	require.NoError(err)
+	require.Equal("replayed", event.Message)
+
+	conf.TestInputEvent(logevent.LogEvent{Message: "new"})
+	event, err = conf.TestGetOutputEvent(300 * time.Millisecond)
+	require.NoError(err)
+	require.Equal("new", event.Message)
+
+	cancel()
+	require.NoError(conf.Wait())
+
+	queue, err = persistqueue.Open(filepath.Join(dir, DefaultPipelineName), queueConf)
+	require.NoError(err)
+	require.Equal(0, queue.Len())
+	require.NoError(queue.Close())
+	require.DirExists(filepath.Join(dir, "p1"))
+
+	_, err = LoadFromYAML([]byte(`
+queue:
+  type: persisted
+`))
+	require.True(persistqueue.ErrorNoPath.Match(err))
+}
+
+func TestMonitor(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistFilterHandler("test_ack", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		return &testAckFilter{FilterConfig: FilterConfig{CommonConfig: CommonConfig{Type: "test_ack"}}}, nil
+	})
+	RegistOutputHandler("test_ack", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		return &testAckOutput{OutputConfig: OutputConfig{CommonConfig: CommonConfig{Type: "test_ack"}}}, nil
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+chsize: 10
+monitor:
+  address: 127.0.0.1:0
+filter:
+  - type: test_ack
+output:
+  - type: test_ack
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+
+	for _, message := range []string{"accept", "drop", "reject"} {
+		conf.TestInputEvent(logevent.LogEvent{Message: message})
+	}
+	for range 2 {
+		_, err = conf.TestGetOutputEvent(300 * time.Millisecond)
+		require.NoError(err)
+	}
+
+	require.NoError(conf.RequestPause(ctx))
+	snapshot := conf.monitor.Snapshot()
+	require.True(snapshot.Paused)
+	pipeline := snapshot.Pipelines[DefaultPipelineName]
+	require.Equal(10, pipeline.Channels["in_filter"].Capacity)
+	require.Equal(10, pipeline.Channels["filter_out"].Capacity)
+	require.Len(pipeline.Plugins.Filters, 1)
+	filter := pipeline.Plugins.Filters[0]
+	require.Equal("test_ack", filter.Type)
+	require.EqualValues(3, filter.Events.In)
+	require.EqualValues(2, filter.Events.Out)
+	require.EqualValues(1, filter.Events.Dropped)
+	require.Len(pipeline.Plugins.Outputs, 1)
+	output := pipeline.Plugins.Outputs[0]
+	require.EqualValues(2, output.Events.In)
+	require.EqualValues(1, output.Events.Out)
+	require.EqualValues(1, output.Events.Errors)
+
+	require.Error(conf.Reload(&Config{PipelineConfig: conf.PipelineConfig, DebugChannel: true, Worker: 1}))
+
+	cancel()
+	require.NoError(conf.Wait())
+}
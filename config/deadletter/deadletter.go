@@ -0,0 +1,360 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+const (
+	segmentPrefix = "dlq."
+	segmentSuffix = ".log"
+)
+
+// errors
+var (
+	ErrorNoPath         = errutil.NewFactory("no path for dead letter queue")
+	ErrorEntryTooLarge2 = errutil.NewFactory("dead letter entry size %d exceeds max_file_bytes %d")
+)
+
+// Config is the dead letter queue config of a pipeline
+type Config struct {
+	Path         string `json:"path" yaml:"path"`                     // directory of segment files, required
+	MaxFileBytes int64  `json:"max_file_bytes" yaml:"max_file_bytes"` // max bytes of a segment file, default: 10MiB
+	MaxBytes     int64  `json:"max_bytes" yaml:"max_bytes"`           // max bytes of all segment files, oldest segments are removed when reached, default: 1GiB
+}
+
+// Init validates config and fills default values
+func (t *Config) Init() (err error) {
+	if t.Path == "" {
+		return ErrorNoPath.New(nil)
+	}
+	if t.MaxFileBytes < 1 {
+		t.MaxFileBytes = 10 * 1024 * 1024
+	}
+	if t.MaxBytes < 1 {
+		t.MaxBytes = 1024 * 1024 * 1024
+	}
+	return nil
+}
+
+// Entry is an event rejected by an output
+type Entry struct {
+	Timestamp  time.Time         `json:"timestamp"` // time the event was rejected
+	Pipeline   string            `json:"pipeline"`
+	PluginType string            `json:"plugin_type"`
+	PluginID   string            `json:"plugin_id"`
+	Reason     string            `json:"reason"`
+	Event      logevent.LogEvent `json:"-"`
+}
+
+// entryRecord is the serialized form of an entry
+type entryRecord struct {
+	Entry
+	EventTimestamp time.Time      `json:"event_timestamp"`
+	EventMessage   string         `json:"event_message,omitempty"`
+	EventTags      []string       `json:"event_tags,omitempty"`
+	EventExtra     map[string]any `json:"event_extra,omitempty"`
+	EventMetadata  map[string]any `json:"event_metadata,omitempty"`
+}
+
+// Position is the position of an entry in segment files
+type Position struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+func segmentPath(dir string, segment int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d%s", segmentPrefix, segment, segmentSuffix))
+}
+
+func listSegments(dir string) (segments []int64, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		var segment int64
+		if _, err := fmt.Sscanf(strings.TrimSuffix(name[len(segmentPrefix):], segmentSuffix), "%d", &segment); err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return
+}
+
+// Writer appends entries to rotating segment files, one JSON entry per line
+type Writer struct {
+	conf Config
+	dir  string
+
+	mutex    sync.Mutex
+	file     *os.File
+	segment  int64
+	size     int64
+	segments map[int64]int64 // size of each segment
+}
+
+// OpenWriter opens dead letter queue in directory dir for writing, dir is created if not exist
+func OpenWriter(dir string, conf Config) (writer *Writer, err error) {
+	if err = conf.Init(); err != nil {
+		return
+	}
+	if err = os.MkdirAll(dir, 0o750); err != nil {
+		return
+	}
+
+	writer = &Writer{
+		conf:     conf,
+		dir:      dir,
+		segments: map[int64]int64{},
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, segment := range segments {
+		info, err := os.Stat(segmentPath(dir, segment))
+		if err != nil {
+			return nil, err
+		}
+		writer.segments[segment] = info.Size()
+	}
+	// always start a new segment, the last one may end with a partial line
+	if len(segments) > 0 {
+		writer.segment = segments[len(segments)-1] + 1
+	}
+	if err = writer.openSegment(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (t *Writer) openSegment() (err error) {
+	t.file, err = os.OpenFile(segmentPath(t.dir, t.segment), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	t.size = 0
+	t.segments[t.segment] = 0
+	return
+}
+
+// Write appends entry to the dead letter queue
+func (t *Writer) Write(entry Entry) (err error) {
+	data, err := json.Marshal(entryRecord{
+		Entry:          entry,
+		EventTimestamp: entry.Event.Timestamp,
+		EventMessage:   entry.Event.Message,
+		EventTags:      entry.Event.Tags,
+		EventExtra:     entry.Event.Extra,
+		EventMetadata:  entry.Event.Metadata,
+	})
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	size := int64(len(data))
+	if size > t.conf.MaxFileBytes {
+		return ErrorEntryTooLarge2.New(nil, size, t.conf.MaxFileBytes)
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.size > 0 && t.size+size > t.conf.MaxFileBytes {
+		if err = t.file.Close(); err != nil {
+			return
+		}
+		t.segment++
+		if err = t.openSegment(); err != nil {
+			return
+		}
+	}
+
+	if _, err = t.file.Write(data); err != nil {
+		return
+	}
+	if err = t.file.Sync(); err != nil {
+		return
+	}
+	t.size += size
+	t.segments[t.segment] = t.size
+
+	t.removeOldSegments()
+	return nil
+}
+
+// removeOldSegments removes oldest segments until total size is under max_bytes
+func (t *Writer) removeOldSegments() {
+	var total int64
+	segments := make([]int64, 0, len(t.segments))
+	for segment, size := range t.segments {
+		total += size
+		segments = append(segments, segment)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	for _, segment := range segments {
+		if total <= t.conf.MaxBytes || segment == t.segment {
+			return
+		}
+		if err := os.Remove(segmentPath(t.dir, segment)); err != nil && !os.IsNotExist(err) {
+			goglog.Logger.Errorf("remove dead letter segment failed: %v", err)
+			return
+		}
+		goglog.Logger.Warnf("dead letter queue %q exceeds max_bytes, segment %d removed", t.dir, segment)
+		total -= t.segments[segment]
+		delete(t.segments, segment)
+	}
+}
+
+// Close closes the current segment file
+func (t *Writer) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.file.Close()
+}
+
+// Reader reads entries from segment files in order, following new entries
+type Reader struct {
+	dir      string
+	interval time.Duration
+	pos      Position
+	file     *os.File
+	reader   *bufio.Reader
+}
+
+// NewReader returns a reader of dead letter queue in directory dir starting from pos,
+// it checks for new entries every interval
+func NewReader(dir string, pos Position, interval time.Duration) *Reader {
+	return &Reader{
+		dir:      dir,
+		interval: interval,
+		pos:      pos,
+	}
+}
+
+// Next returns the next entry and the position after it, blocks until there is an entry
+func (t *Reader) Next(ctx context.Context) (entry Entry, pos Position, err error) {
+	for {
+		if t.file == nil {
+			if err = t.openSegment(); err != nil {
+				return
+			}
+		}
+		if t.file != nil {
+			line, err := t.reader.ReadBytes('\n')
+			if err == nil {
+				var record entryRecord
+				t.pos.Offset += int64(len(line))
+				if err = json.Unmarshal(line, &record); err != nil {
+					goglog.Logger.Errorf("invalid dead letter entry in %q: %v", t.file.Name(), err)
+					continue
+				}
+				entry = record.Entry
+				entry.Event = logevent.LogEvent{
+					Timestamp: record.EventTimestamp,
+					Message:   record.EventMessage,
+					Tags:      record.EventTags,
+					Extra:     record.EventExtra,
+					Metadata:  record.EventMetadata,
+				}
+				return entry, t.pos, nil
+			}
+			if err != io.EOF {
+				return entry, t.pos, err
+			}
+			// reread the partial line later
+			if _, err = t.file.Seek(t.pos.Offset, io.SeekStart); err != nil {
+				return entry, t.pos, err
+			}
+			t.reader.Reset(t.file)
+
+			next, err := t.nextSegment()
+			if err != nil {
+				return entry, t.pos, err
+			}
+			if next {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return entry, t.pos, ctx.Err()
+		case <-time.After(t.interval):
+		}
+	}
+}
+
+// openSegment opens the segment of current position, or the oldest segment after it
+func (t *Reader) openSegment() (err error) {
+	segments, err := listSegments(t.dir)
+	if err != nil {
+		return
+	}
+	for _, segment := range segments {
+		if segment < t.pos.Segment {
+			continue
+		}
+		if segment > t.pos.Segment {
+			t.pos = Position{Segment: segment}
+		}
+		if t.file, err = os.Open(segmentPath(t.dir, segment)); err != nil {
+			if os.IsNotExist(err) {
+				// removed by writer
+				continue
+			}
+			return err
+		}
+		if _, err = t.file.Seek(t.pos.Offset, io.SeekStart); err != nil {
+			return err
+		}
+		t.reader = bufio.NewReader(t.file)
+		return nil
+	}
+	return nil
+}
+
+// nextSegment switches to the next segment if current segment is complete
+func (t *Reader) nextSegment() (next bool, err error) {
+	segments, err := listSegments(t.dir)
+	if err != nil {
+		return
+	}
+	for _, segment := range segments {
+		if segment > t.pos.Segment {
+			t.Close()
+			t.pos = Position{Segment: segment}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Close closes the current segment file
+func (t *Reader) Close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
@@ -0,0 +1,120 @@
+package deadletter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func newEntry(i int) Entry {
+	return Entry{
+		Timestamp:  time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+		Pipeline:   "main",
+		PluginType: "elastic",
+		PluginID:   "es",
+		Reason:     fmt.Sprintf("reason %d", i),
+		Event: logevent.LogEvent{
+			Timestamp: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+			Message:   fmt.Sprintf("message %d", i),
+			Extra:     map[string]any{"index": float64(i)},
+			Metadata:  map[string]any{"index": fmt.Sprintf("logs-%d", i)},
+		},
+	}
+}
+
+func TestWriterReader(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	writer, err := OpenWriter(dir, Config{Path: dir, MaxFileBytes: 400})
+	require.NoError(err)
+	for i := 0; i < 5; i++ {
+		require.NoError(writer.Write(newEntry(i)))
+	}
+
+	segments, err := listSegments(dir)
+	require.NoError(err)
+	require.Greater(len(segments), 1, "entries should be written to more than one segment")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reader := NewReader(dir, Position{}, 10*time.Millisecond)
+	var pos Position
+	for i := 0; i < 3; i++ {
+		var entry Entry
+		entry, pos, err = reader.Next(ctx)
+		require.NoError(err)
+		require.Equal(newEntry(i), entry)
+	}
+	reader.Close()
+
+	// resume from position, following entries written later
+	reader = NewReader(dir, pos, 10*time.Millisecond)
+	defer reader.Close()
+	for i := 3; i < 5; i++ {
+		entry, _, err := reader.Next(ctx)
+		require.NoError(err)
+		require.Equal(newEntry(i), entry)
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = writer.Write(newEntry(5))
+	}()
+	entry, _, err := reader.Next(ctx)
+	require.NoError(err)
+	require.Equal(newEntry(5), entry)
+	require.NoError(writer.Close())
+
+	ctxTimeout, cancelTimeout := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelTimeout()
+	_, _, err = reader.Next(ctxTimeout)
+	require.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestWriterMaxBytes(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	writer, err := OpenWriter(dir, Config{Path: dir, MaxFileBytes: 300, MaxBytes: 600})
+	require.NoError(err)
+	for i := 0; i < 10; i++ {
+		require.NoError(writer.Write(newEntry(i)))
+	}
+	require.NoError(writer.Close())
+
+	var total int64
+	segments, err := listSegments(dir)
+	require.NoError(err)
+	for _, segment := range segments {
+		info, err := os.Stat(segmentPath(dir, segment))
+		require.NoError(err)
+		total += info.Size()
+	}
+	require.LessOrEqual(total, int64(600))
+
+	// oldest entries are removed, reader starts from the oldest segment
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reader := NewReader(dir, Position{}, 10*time.Millisecond)
+	defer reader.Close()
+	entry, _, err := reader.Next(ctx)
+	require.NoError(err)
+	require.NotEqual(newEntry(0), entry)
+
+	// reopen starts a new segment
+	writer, err = OpenWriter(dir, Config{Path: dir, MaxFileBytes: 300, MaxBytes: 600})
+	require.NoError(err)
+	require.Equal(segments[len(segments)-1]+1, writer.segment)
+	require.NoError(writer.Close())
+
+	_, err = OpenWriter(dir, Config{})
+	require.True(ErrorNoPath.Match(err))
+}
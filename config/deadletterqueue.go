@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/tsaikd/gogstash/config/deadletter"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+type pipelineContextKey struct{}
+
+// pipelineFromContext returns the pipeline running the plugin of ctx
+func pipelineFromContext(ctx context.Context) *PipelineConfig {
+	if ctx == nil {
+		return nil
+	}
+	pipeline, _ := ctx.Value(pipelineContextKey{}).(*PipelineConfig)
+	return pipeline
+}
+
+// startDeadLetterQueue opens the dead letter queue writer if configured
+func (t *PipelineConfig) startDeadLetterQueue() (err error) {
+	if t.DeadLetterQueue == nil {
+		return nil
+	}
+	t.deadLetter, err = deadletter.OpenWriter(filepath.Join(t.DeadLetterQueue.Path, t.Name), *t.DeadLetterQueue)
+	return err
+}
+
+// DeadLetter writes an event rejected by the output to the dead letter queue
+// of the pipeline, ctx is the context passed to the InitHandler or Output of the output.
+// Event is dropped if the dead letter queue is not enabled, written is false if the event
+// is not written to the dead letter queue.
+func DeadLetter(ctx context.Context, output TypeCommonConfig, event logevent.LogEvent, reason error) (written bool) {
+	pipeline := pipelineFromContext(ctx)
+	if pipeline == nil || pipeline.deadLetter == nil {
+		return false
+	}
+	if err := pipeline.deadLetter.Write(deadletter.Entry{
+		Timestamp:  time.Now(),
+		Pipeline:   pipeline.Name,
+		PluginType: output.GetType(),
+		PluginID:   GetPluginID(output),
+		Reason:     reason.Error(),
+		Event:      event,
+	}); err != nil {
+		goglog.Logger.Errorf("write dead letter of output %q failed: %v", GetPluginID(output), err)
+		return false
+	}
+	return true
+}
@@ -2,6 +2,9 @@ package config
 
 import (
 	"context"
+	"hash/fnv"
+	"sync"
+	"time"
 
 	"github.com/tsaikd/KDGoLib/errutil"
 
@@ -21,6 +24,27 @@ type TypeFilterConfig interface {
 	CommonFilter(context.Context, logevent.LogEvent) logevent.LogEvent
 }
 
+// TypeMultiFilterConfig is interface of filter module emitting zero, one or many events for an event,
+// e.g. split and clone filters, emitted events are passed through the following filters.
+// Events copied from the event share its acknowledgement, the event is acknowledged after all of them.
+type TypeMultiFilterConfig interface {
+	TypeFilterConfig
+	// Events returns events replacing the event, CommonFilter is applied to them if ok
+	Events(context.Context, logevent.LogEvent) ([]logevent.LogEvent, bool)
+}
+
+// TypeFlushFilterConfig is interface of filter module emitting events not triggered by events,
+// e.g. aggregations flushed by timeout, Flush is called every FilterFlushInterval concurrently with Event,
+// and with final set when filters stop. Flushed events are passed through CommonFilter and the following filters,
+// acknowledgements held by them, see logevent.ShareAck, are transferred with them.
+type TypeFlushFilterConfig interface {
+	TypeFilterConfig
+	Flush(ctx context.Context, final bool) []logevent.LogEvent
+}
+
+// FilterFlushInterval is the interval of calling Flush of filters
+var FilterFlushInterval = 5 * time.Second
+
 // FilterConfig is basic filter config struct
 type FilterConfig struct {
 	CommonConfig
@@ -71,74 +95,286 @@ func RegistFilterHandler(name string, handler FilterHandler) {
 	mapFilterHandler[name] = handler
 }
 
+// newFilter initializes the filter of raw config, filter is nil if disabled
+func newFilter(ctx context.Context, raw ConfigRaw, control Control) (filter TypeFilterConfig, err error) {
+	if isDisabled(raw) {
+		return nil, nil
+	}
+	filterName, ok := raw["type"].(string)
+	if !ok {
+		return nil, ErrorNoFilterName.New(nil, "filter")
+	}
+	handler, ok := mapFilterHandler[filterName]
+	if !ok {
+		return nil, ErrorUnknownFilterType1.New(nil, raw["type"])
+	}
+	filter, err = handler(ctx, raw, control)
+	checkBuilt(ctx, raw, filter, err)
+	if err != nil {
+		return nil, ErrorInitFilterFailed1.New(err, raw)
+	}
+	if filter, err = withFilterCondition(filter, raw); err != nil {
+		return nil, ErrorInitFilterFailed1.New(err, raw)
+	}
+	return filter, nil
+}
+
 // GetFilters get filters from config
 func GetFilters(
 	ctx context.Context,
 	filterRaw []ConfigRaw,
 	control Control,
 ) (filters []TypeFilterConfig, err error) {
-	var filter TypeFilterConfig
 	for _, raw := range filterRaw {
-		// check if filter is disabled
-		var disabled bool
-		if result, ok := raw["disabled"].(bool); ok {
-			disabled = result
-		}
-		// load filter if not disabled
-		if !disabled {
-			filterName, ok := raw["type"].(string)
-			if !ok {
-				return filters, ErrorNoFilterName.New(nil, "filter")
-			}
-			handler, ok := mapFilterHandler[filterName]
-			if !ok {
-				return filters, ErrorUnknownFilterType1.New(nil, raw["type"])
-			}
+		filter, err := newFilter(ctx, raw, control)
+		if err != nil {
+			return filters, err
+		}
+		if filter != nil {
+			filters = append(filters, filter)
+		}
+	}
+	return filters, nil
+}
 
-			if filter, err = handler(ctx, raw, control); err != nil {
-				return filters, ErrorInitFilterFailed1.New(err, raw)
-			}
+// ApplyFilter applies filter and its CommonFilter to event, returns events not dropped,
+// acknowledgements of events are not changed
+func ApplyFilter(ctx context.Context, filter TypeFilterConfig, event logevent.LogEvent) []logevent.LogEvent {
+	var events []logevent.LogEvent
+	var ok bool
+	if multi, isMulti := filter.(TypeMultiFilterConfig); isMulti {
+		events, ok = multi.Events(ctx, event)
+	} else {
+		event, ok = filter.Event(ctx, event)
+		events = []logevent.LogEvent{event}
+	}
+	result := make([]logevent.LogEvent, 0, len(events))
+	for _, event := range events {
+		if ok {
+			event = filter.CommonFilter(ctx, event)
+		}
+		if !event.Drop {
+			result = append(result, event)
+		}
+	}
+	return result
+}
 
-			filters = append(filters, filter)
+// ApplyFilters passes event through filters in order, events emitted by a filter are passed through
+// the following filters, returns events not dropped, acknowledgements of events are not changed
+func ApplyFilters(ctx context.Context, filters []TypeFilterConfig, event logevent.LogEvent) []logevent.LogEvent {
+	events := []logevent.LogEvent{event}
+	for _, filter := range filters {
+		var next []logevent.LogEvent
+		for _, event := range events {
+			next = append(next, ApplyFilter(ctx, filter, event)...)
+		}
+		if events = next; len(events) < 1 {
+			break
 		}
 	}
-	return filters, err
+	return events
 }
 
-func (t *Config) getFilters() (filters []TypeFilterConfig, err error) {
-	return GetFilters(t.ctx, t.FilterRaw, t)
+// FlushFilters flushes filters, flushed events are passed through CommonFilter and the following filters,
+// returns events not dropped
+func FlushFilters(ctx context.Context, filters []TypeFilterConfig, final bool) (events []logevent.LogEvent) {
+	for i, filter := range filters {
+		flusher, ok := filter.(TypeFlushFilterConfig)
+		if !ok {
+			continue
+		}
+		for _, event := range flusher.Flush(ctx, final) {
+			event = filter.CommonFilter(ctx, event)
+			var flushed []logevent.LogEvent
+			if !event.Drop {
+				flushed = ApplyFilters(ctx, filters[i+1:], event)
+			}
+			passAck(event, flushed)
+			events = append(events, flushed...)
+		}
+	}
+	return events
 }
 
-func (t *Config) startFilters() (err error) {
-	filters, err := t.getFilters()
-	if err != nil {
-		return err
+// passAck passes the acknowledgement held by event to events emitted for it, then releases it
+func passAck(event logevent.LogEvent, events []logevent.LogEvent) {
+	for i := range events {
+		events[i].ShareAck()
 	}
+	event.Ack()
+}
 
-	t.eg.Go(func() error {
-		for {
-			select {
-			case <-t.ctx.Done():
-				if len(t.chInFilter) < 1 {
-					return nil
-				}
-			case event := <-t.chInFilter:
-				var ok bool
-				for _, filter := range filters {
-					event, ok = filter.Event(t.ctx, event)
-					if ok {
-						event = filter.CommonFilter(t.ctx, event)
-					}
-					if event.Drop {
-						break
+func (t *PipelineConfig) getFilters(ctx context.Context, control Control) (filters []TypeFilterConfig, err error) {
+	return GetFilters(ctx, t.FilterRaw, control)
+}
+
+// newFilterInstance initializes the filter of raw config with its own context
+func (t *PipelineConfig) newFilterInstance(raw ConfigRaw, control Control) (instance *pluginInstance, err error) {
+	instance = t.newPluginInstance(raw)
+	if instance.filter, err = newFilter(instance.ctx, raw, control); err != nil {
+		instance.cancel()
+		return nil, err
+	}
+	instance.stats = t.stats.NewPlugin(instance.filter.GetType(), GetPluginID(instance.filter))
+	return instance, nil
+}
+
+// startFilters starts filter workers, passing events from chInFilter through
+// all filters to chFilterOut, workers stop without draining chInFilter when
+// stop is closed, the returned channel is closed when all workers returned
+func (t *PipelineConfig) startFilters(filters []*pluginInstance, stop <-chan struct{}) <-chan struct{} {
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+
+	if t.FilterOrderKey == "" || t.FilterWorkers < 2 {
+		for i := 0; i < t.FilterWorkers; i++ {
+			wg.Add(1)
+			t.eg.Go(func() error {
+				defer wg.Done()
+				return t.runFilters(filters, t.chInFilter, stop, false)
+			})
+		}
+	} else {
+		// dispatch events by order key, each worker owns a channel,
+		// which is drained after the dispatcher stopped
+		dispatcherDone := make(chan struct{})
+		chWorkers := make([]MsgChan, t.FilterWorkers)
+		for i := range chWorkers {
+			chWorker := make(MsgChan, t.ChannelSize)
+			chWorkers[i] = chWorker
+			wg.Add(1)
+			t.eg.Go(func() error {
+				defer wg.Done()
+				return t.runFilters(filters, chWorker, dispatcherDone, true)
+			})
+		}
+		t.eg.Go(func() error {
+			defer close(dispatcherDone)
+			for {
+				select {
+				case <-t.ctx.Done():
+					if len(t.chInFilter) < 1 {
+						return nil
 					}
+				case <-stop:
+					return nil
+				case event := <-t.chInFilter:
+					hash := fnv.New32a()
+					_, _ = hash.Write([]byte(event.Format(t.FilterOrderKey)))
+					chWorkers[hash.Sum32()%uint32(len(chWorkers))] <- event
 				}
-				if !event.Drop {
-					t.chFilterOut <- event
+			}
+		})
+	}
+
+	flushDone := make(chan struct{})
+	if hasFlushFilter(filters) {
+		t.eg.Go(func() error {
+			ticker := time.NewTicker(FilterFlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-t.ctx.Done():
+					return nil
+				case <-flushDone:
+					return nil
+				case <-ticker.C:
+					t.flushFilters(filters, false)
 				}
 			}
-		}
+		})
+	}
+
+	// the final flush runs before outputs stop taking events from chFilterOut
+	t.eg.Go(func() error {
+		defer close(done)
+		wg.Wait()
+		close(flushDone)
+		t.flushFilters(filters, true)
+		return nil
 	})
+	return done
+}
 
-	return err
+// runFilters pass events from chIn through all filters to chFilterOut,
+// until stop is closed, chIn is drained before return if drain is set
+func (t *PipelineConfig) runFilters(filters []*pluginInstance, chIn MsgChan, stop <-chan struct{}, drain bool) error {
+	for {
+		select {
+		case <-t.ctx.Done():
+			if len(chIn) < 1 {
+				return nil
+			}
+		case <-stop:
+			if !drain || len(chIn) < 1 {
+				return nil
+			}
+		case event := <-chIn:
+			t.filterEvent(filters, event)
+		}
+	}
+}
+
+// filterEvent passes event through filters to chFilterOut, events emitted by a filter
+// are passed through the following filters, events dropped are acknowledged
+func (t *PipelineConfig) filterEvent(filters []*pluginInstance, event logevent.LogEvent) {
+	for i, filter := range filters {
+		var start time.Time
+		if filter.stats != nil {
+			filter.stats.In()
+			start = time.Now()
+		}
+		events := ApplyFilter(t.ctx, filter.filter, event)
+		if filter.stats != nil {
+			filter.stats.ObserveDuration(time.Since(start))
+		}
+		if _, isMulti := filter.filter.(TypeMultiFilterConfig); isMulti || len(events) != 1 {
+			passAck(event, events)
+		}
+		switch len(events) {
+		case 0:
+			filter.stats.Dropped()
+			return
+		case 1:
+			filter.stats.Out()
+			event = events[0]
+		default:
+			for _, event := range events {
+				filter.stats.Out()
+				t.filterEvent(filters[i+1:], event)
+			}
+			return
+		}
+	}
+	t.chFilterOut <- event
+}
+
+// hasFlushFilter returns true if any filter implements TypeFlushFilterConfig
+func hasFlushFilter(filters []*pluginInstance) bool {
+	for _, filter := range filters {
+		if _, ok := filter.filter.(TypeFlushFilterConfig); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// flushFilters passes events flushed by filters through the following filters to chFilterOut
+func (t *PipelineConfig) flushFilters(filters []*pluginInstance, final bool) {
+	for i, filter := range filters {
+		flusher, ok := filter.filter.(TypeFlushFilterConfig)
+		if !ok {
+			continue
+		}
+		for _, event := range flusher.Flush(t.ctx, final) {
+			if event = filter.filter.CommonFilter(t.ctx, event); event.Drop {
+				filter.stats.Dropped()
+				event.Ack()
+				continue
+			}
+			filter.stats.Out()
+			t.filterEvent(filters[i+1:], event)
+		}
+	}
 }
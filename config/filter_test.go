@@ -2,10 +2,14 @@ package config
 
 import (
 	"context"
+	"math/rand"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/tsaikd/gogstash/config/logevent"
 )
@@ -176,3 +180,257 @@ type WhateverFilterConfig struct {
 func (f *WhateverFilterConfig) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
 	return event, true
 }
+
+type testSleepFilterConfig struct {
+	FilterConfig
+	running    int32
+	maxRunning int32
+}
+
+func (f *testSleepFilterConfig) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	running := atomic.AddInt32(&f.running, 1)
+	defer atomic.AddInt32(&f.running, -1)
+	for {
+		maxRunning := atomic.LoadInt32(&f.maxRunning)
+		if running <= maxRunning || atomic.CompareAndSwapInt32(&f.maxRunning, maxRunning, running) {
+			break
+		}
+	}
+	time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+	return event, false
+}
+
+func TestFilterWorkers(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	filter := &testSleepFilterConfig{}
+	RegistFilterHandler("test_sleep", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		return filter, nil
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+filter_workers: 4
+filter_order_key: "%{key}"
+filter:
+  - type: test_sleep
+pipelines:
+  - name: p1
+	`)))
+	require.NoError(err)
+	require.Equal(4, conf.FilterWorkers)
+	require.Equal(4, conf.GetPipeline("p1").FilterWorkers)
+	require.NoError(conf.Start(context.Background()))
+
+	const keys, count = 4, 50
+	go func() {
+		for i := 0; i < count; i++ {
+			for k := 0; k < keys; k++ {
+				conf.TestInputEvent(logevent.LogEvent{
+					Extra: map[string]any{"key": k, "seq": i},
+				})
+			}
+		}
+	}()
+
+	next := make([]int, keys)
+	for i := 0; i < keys*count; i++ {
+		event, err := conf.TestGetOutputEvent(time.Second)
+		require.NoError(err)
+		k := event.Get("key").(int)
+		require.Equal(next[k], event.Get("seq"), "events with the same key should keep order")
+		next[k]++
+	}
+	require.Greater(atomic.LoadInt32(&filter.maxRunning), int32(1))
+}
+
+type testSplitFilterConfig struct {
+	FilterConfig
+}
+
+func (f *testSplitFilterConfig) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	return event, false
+}
+
+func (f *testSplitFilterConfig) Events(ctx context.Context, event logevent.LogEvent) ([]logevent.LogEvent, bool) {
+	var events []logevent.LogEvent
+	for _, message := range strings.Split(event.Message, ",") {
+		if message != "" {
+			split := event.Clone()
+			split.Message = message
+			events = append(events, split)
+		}
+	}
+	return events, true
+}
+
+type testCountFilterConfig struct {
+	FilterConfig
+	count atomic.Int32
+}
+
+func (f *testCountFilterConfig) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	f.count.Add(1)
+	return event, true
+}
+
+func (f *testCountFilterConfig) Flush(ctx context.Context, final bool) []logevent.LogEvent {
+	count := f.count.Swap(0)
+	if count < 1 {
+		return nil
+	}
+	message := "count"
+	if final {
+		message = "final count"
+	}
+	return []logevent.LogEvent{{Message: message, Extra: map[string]any{"count": count}}}
+}
+
+func TestMultiFilter(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistFilterHandler("test_split", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		conf := &testSplitFilterConfig{}
+		return conf, ReflectConfig(raw, conf)
+	})
+	RegistFilterHandler("test_count", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		conf := &testCountFilterConfig{}
+		return conf, ReflectConfig(raw, conf)
+	})
+
+	defer func(interval time.Duration) {
+		FilterFlushInterval = interval
+	}(FilterFlushInterval)
+	FilterFlushInterval = 100 * time.Millisecond
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+filter:
+  - type: test_split
+    if: "message != 'skip'"
+    add_tag: ["split"]
+  - type: test_count
+    add_tag: ["counted"]
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+
+	results := make(chan error, 1)
+	send := func(message string) {
+		ack := logevent.NewAck(func(err error) {
+			results <- err
+		})
+		event := logevent.LogEvent{Message: message}
+		event.SetAck(ack)
+		conf.TestInputEvent(event)
+		ack.Done(nil)
+	}
+
+	send("a,b,c")
+	for _, message := range []string{"a", "b", "c"} {
+		event, err := conf.TestGetOutputEvent(time.Second)
+		require.NoError(err)
+		require.Equal(message, event.Message)
+		require.Equal([]string{"split", "counted"}, event.Tags)
+	}
+	require.NoError(<-results)
+
+	// no events emitted, the event is acknowledged
+	send(",")
+	require.NoError(<-results)
+
+	send("skip")
+	event, err := conf.TestGetOutputEvent(time.Second)
+	require.NoError(err)
+	require.Equal("skip", event.Message)
+	require.Equal([]string{"counted"}, event.Tags)
+	require.NoError(<-results)
+
+	// flushed events are passed through CommonFilter and the following filters
+	event, err = conf.TestGetOutputEvent(time.Second)
+	require.NoError(err)
+	require.Equal("count", event.Message)
+	require.Equal(int32(4), event.Get("count"))
+	require.Equal([]string{"counted"}, event.Tags)
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+func TestApplyFilters(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	split := &testSplitFilterConfig{FilterConfig: FilterConfig{AddTags: []string{"split"}}}
+	count := &testCountFilterConfig{}
+	filters := []TypeFilterConfig{split, count, split}
+
+	events := ApplyFilters(context.Background(), filters, logevent.LogEvent{Message: "a,b"})
+	require.Len(events, 2)
+	require.Equal("a", events[0].Message)
+	require.Equal([]string{"split"}, events[0].Tags)
+	require.Empty(ApplyFilters(context.Background(), filters, logevent.LogEvent{Message: ","}))
+
+	events = FlushFilters(context.Background(), filters, true)
+	require.Equal([]logevent.LogEvent{{
+		Message: "final count",
+		Tags:    []string{"split"},
+		Extra:   map[string]any{"count": int32(2)},
+	}}, events)
+	require.Empty(FlushFilters(context.Background(), filters, true))
+}
+
+func TestFilterFinalFlush(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistFilterHandler("test_count", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		conf := &testCountFilterConfig{}
+		return conf, ReflectConfig(raw, conf)
+	})
+	RegistFilterHandler("test_split", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		conf := &testSplitFilterConfig{}
+		return conf, ReflectConfig(raw, conf)
+	})
+	var output *testBatchOutput
+	RegistOutputHandler("test_batch", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		output = &testBatchOutput{}
+		return output, ReflectConfig(raw, output)
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+filter:
+  - type: test_split
+    if: "message != 'skip'"
+  - type: test_count
+    if: "message != 'skip'"
+output:
+  - type: test_batch
+    batch_size: 1
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+
+	// only filters implementing TypeFlushFilterConfig are flushed
+	filters := conf.getPipelines()[0].stage.filters
+	_, ok := filters[0].filter.(TypeFlushFilterConfig)
+	require.False(ok)
+	_, ok = filters[1].filter.(TypeFlushFilterConfig)
+	require.True(ok)
+
+	conf.TestInputEvent(logevent.LogEvent{Message: "a,b"})
+	require.Eventually(func() bool {
+		return len(output.getBatches()) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// events of the final flush are sent to outputs before Wait returns
+	cancel()
+	require.NoError(conf.Wait())
+	require.Equal([][]string{{"a"}, {"b"}, {"final count"}}, output.getBatches())
+}
@@ -44,6 +44,8 @@ func newLogger() *LoggerType {
 			Level:     logrus.InfoLevel,
 		},
 	}
+	logger.stdout.AddHook(maskHook{})
+	logger.stderr.AddHook(maskHook{})
 	logger.ConfigSentry(sentry.CurrentHub())
 	return logger
 }
@@ -64,22 +66,27 @@ func (t *LoggerType) ConfigSentry(hub *sentry.Hub) {
 	debugHub := hub.Clone()
 	debugHub.ConfigureScope(func(scope *sentry.Scope) {
 		scope.SetLevel(sentry.LevelDebug)
+		scope.AddEventProcessor(maskSentryEvent)
 	})
 	infoHub := hub.Clone()
 	infoHub.ConfigureScope(func(scope *sentry.Scope) {
 		scope.SetLevel(sentry.LevelInfo)
+		scope.AddEventProcessor(maskSentryEvent)
 	})
 	warnHub := hub.Clone()
 	warnHub.ConfigureScope(func(scope *sentry.Scope) {
 		scope.SetLevel(sentry.LevelWarning)
+		scope.AddEventProcessor(maskSentryEvent)
 	})
 	errorHub := hub.Clone()
 	errorHub.ConfigureScope(func(scope *sentry.Scope) {
 		scope.SetLevel(sentry.LevelError)
+		scope.AddEventProcessor(maskSentryEvent)
 	})
 	fatalHub := hub.Clone()
 	fatalHub.ConfigureScope(func(scope *sentry.Scope) {
 		scope.SetLevel(sentry.LevelFatal)
+		scope.AddEventProcessor(maskSentryEvent)
 	})
 
 	t.mutex.Lock()
@@ -82,3 +82,27 @@ func forTestFilterGoglogRuntimeCaller(callinfo runtimecaller.CallInfo) (valid bo
 	}
 	return filterGoglogRuntimeCaller(callinfo)
 }
+
+func TestMaskValue(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	stdoutBuffer := &bytes.Buffer{}
+	stderrBuffer := &bytes.Buffer{}
+	logger := newLogger()
+	logger.setDebugOutput(stdoutBuffer, stderrBuffer)
+	logger.setDebugFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+
+	require.True(MaskValue("s3cr3t"))
+	logger.Infof("connect with password %q", "s3cr3t")
+	logger.WithField("password", "s3cr3t").Info("connect")
+	require.NotContains(stdoutBuffer.String(), "s3cr3t")
+	require.Contains(stdoutBuffer.String(), `password \"******\"`)
+	require.Contains(stdoutBuffer.String(), `password="******"`)
+	require.Equal("a ****** b", Mask("a s3cr3t b"))
+
+	// short values are not masked, they would replace unrelated text of logs
+	require.False(MaskValue("abc"))
+	require.False(MaskValue(""))
+	require.Equal("abc ******", Mask("abc s3cr3t"))
+}
@@ -0,0 +1,73 @@
+package goglog
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/sirupsen/logrus"
+)
+
+// MaskText replaces masked values in logs
+const MaskText = "******"
+
+// MinMaskLength is the minimum length of masked values, shorter values are not masked,
+// otherwise every occurrence of them in logs would be replaced, e.g. every "a" of messages
+const MinMaskLength = 6
+
+var (
+	maskedMutex  sync.RWMutex
+	maskedValues = map[string]bool{}
+)
+
+// MaskValue hides value in logs and sentry events, used for secrets of config,
+// returns false if value is shorter than MinMaskLength and not masked
+func MaskValue(value string) bool {
+	if utf8.RuneCountInString(value) < MinMaskLength {
+		return false
+	}
+	maskedMutex.Lock()
+	defer maskedMutex.Unlock()
+	maskedValues[value] = true
+	return true
+}
+
+// Mask returns text with masked values replaced by MaskText
+func Mask(text string) string {
+	maskedMutex.RLock()
+	defer maskedMutex.RUnlock()
+	for value := range maskedValues {
+		text = strings.ReplaceAll(text, value, MaskText)
+	}
+	return text
+}
+
+// maskHook masks message and string fields of log entries
+type maskHook struct{}
+
+func (maskHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (maskHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Mask(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = Mask(v)
+		case error:
+			entry.Data[key] = Mask(v.Error())
+		}
+	}
+	return nil
+}
+
+// maskSentryEvent masks message and exceptions of sentry events
+func maskSentryEvent(event *sentry.Event, hint *sentry.EventHint) *sentry.Event {
+	event.Message = Mask(event.Message)
+	for i := range event.Exception {
+		event.Exception[i].Value = Mask(event.Exception[i].Value)
+	}
+	return event
+}
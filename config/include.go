@@ -0,0 +1,322 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/icza/dyno"
+	"github.com/tsaikd/KDGoLib/errutil"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/tsaikd/gogstash/config/logstash"
+)
+
+// errors
+var (
+	ErrorLoadConfigFile1   = errutil.NewFactory("load config file %q failed")
+	ErrorNoConfigFiles1    = errutil.NewFactory("no config files found in %q")
+	ErrorIncludeCycle1     = errutil.NewFactory("config file %q included recursively")
+	ErrorInvalidInclude1   = errutil.NewFactory("include expects a path or a list of paths, got %v")
+	ErrorMergeConfigFiles1 = errutil.NewFactory("merge config files of %q failed")
+)
+
+// includeKey is the key of config files to include other config files
+const includeKey = "include"
+
+// relativePathKeys are keys of plugin configs resolved relative to the included config file
+var relativePathKeys = map[string]bool{
+	"patterns_path": true,
+	"lookup_file":   true,
+	"db_path":       true,
+	"sincedb_path":  true,
+	"sincepath":     true,
+}
+
+// configFile is a parsed config file
+type configFile struct {
+	path    string
+	tagName string // struct tag of config keys, json or yaml
+	obj     map[string]any
+}
+
+// ConfigFiles returns config files of path, which is a file, a directory or a glob pattern,
+// followed by files included by them
+func ConfigFiles(path string) (paths []string, err error) {
+	files, err := loadConfigFiles(path)
+	for _, file := range files {
+		paths = append(paths, file.path)
+	}
+	return paths, err
+}
+
+// isConfigFiles returns whether path is a directory or a glob pattern of config files
+func isConfigFiles(path string) bool {
+	if strings.ContainsAny(path, "*?[") {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// expandConfigPath returns config files in lexical order of path, which is a file,
+// a directory or a glob pattern
+func expandConfigPath(path string) (paths []string, err error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, ErrorReadConfigFile1.New(err, path)
+		}
+		for _, entry := range entries {
+			switch strings.ToLower(filepath.Ext(entry.Name())) {
+			case ".json", ".yml", ".yaml", ".conf":
+				if !entry.IsDir() {
+					paths = append(paths, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+	} else if strings.ContainsAny(path, "*?[") {
+		if paths, err = filepath.Glob(path); err != nil {
+			return nil, ErrorReadConfigFile1.New(err, path)
+		}
+	} else {
+		return []string{path}, nil
+	}
+	if len(paths) < 1 {
+		return nil, ErrorNoConfigFiles1.New(nil, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// loadConfigFiles loads config files of path, files included are placed before the including file
+func loadConfigFiles(path string) (files []configFile, err error) {
+	paths, err := expandConfigPath(path)
+	if err != nil {
+		return nil, err
+	}
+	loading := map[string]bool{}
+	for _, path := range paths {
+		if files, err = loadConfigFileTree(files, loading, path, false); err != nil {
+			return files, err
+		}
+	}
+	return files, nil
+}
+
+func loadConfigFileTree(files []configFile, loading map[string]bool, path string, included bool) ([]configFile, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return files, ErrorLoadConfigFile1.New(err, path)
+	}
+	if loading[abs] {
+		return files, ErrorIncludeCycle1.New(nil, path)
+	}
+	loading[abs] = true
+	defer delete(loading, abs)
+
+	file, err := parseConfigFile(path)
+	if err != nil {
+		return files, err
+	}
+	includes, err := includePaths(file.obj[includeKey])
+	if err != nil {
+		return files, ErrorLoadConfigFile1.New(err, path)
+	}
+	delete(file.obj, includeKey)
+
+	dir := filepath.Dir(path)
+	if included {
+		resolvePaths(file.obj, dir)
+	}
+	for _, include := range includes {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(dir, include)
+		}
+		paths, err := expandConfigPath(include)
+		if err != nil {
+			return files, ErrorLoadConfigFile1.New(err, path)
+		}
+		for _, include := range paths {
+			if files, err = loadConfigFileTree(files, loading, include, true); err != nil {
+				return files, err
+			}
+		}
+	}
+	return append(files, file), nil
+}
+
+// parseConfigFile parses the config file of path in JSON, YAML or logstash config DSL
+func parseConfigFile(path string) (file configFile, err error) {
+	file = configFile{path: path, tagName: "json"}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return file, ErrorReadConfigFile1.New(err, path)
+	}
+
+	var obj any
+	switch {
+	case isLogstashPath(path):
+		file.tagName = "yaml"
+		if data, err = logstash.ToYAML(data); err == nil {
+			err = yaml.Unmarshal(data, &obj)
+		}
+	case isYAMLPath(path):
+		file.tagName = "yaml"
+		err = yaml.Unmarshal(data, &obj)
+	default:
+		if data, err = cleanComments(data); err == nil {
+			err = json.Unmarshal(data, &obj)
+		}
+	}
+	if err != nil {
+		return file, ErrorLoadConfigFile1.New(err, path)
+	}
+
+	file.obj, _ = dyno.ConvertMapI2MapS(obj).(map[string]any)
+	if file.obj == nil {
+		file.obj = map[string]any{}
+	}
+	return file, nil
+}
+
+func includePaths(value any) (paths []string, err error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []any:
+		for _, item := range v {
+			path, ok := item.(string)
+			if !ok {
+				return nil, ErrorInvalidInclude1.New(nil, value)
+			}
+			paths = append(paths, path)
+		}
+		return paths, nil
+	default:
+		return nil, ErrorInvalidInclude1.New(nil, value)
+	}
+}
+
+// resolvePaths resolves relative paths of plugin configs in value relative to dir
+func resolvePaths(value any, dir string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			path, ok := item.(string)
+			if ok && relativePathKeys[key] && path != "" && !filepath.IsAbs(path) && !strings.Contains(path, "://") {
+				v[key] = filepath.Join(dir, path)
+				continue
+			}
+			resolvePaths(item, dir)
+		}
+	case []any:
+		for _, item := range v {
+			resolvePaths(item, dir)
+		}
+	}
+}
+
+// mergeConfigFiles merges config files in order, lists are appended, maps are merged,
+// and other values are overridden by later files
+func mergeConfigFiles(files []configFile) (merged map[string]any, sources *configSources) {
+	merged = map[string]any{}
+	sources = &configSources{pipelines: map[string]string{}}
+	for _, file := range files {
+		for _, section := range []string{"input", "filter", "output"} {
+			if list, ok := file.obj[section].([]any); ok {
+				for range list {
+					sources.add(section, file.path)
+				}
+			}
+		}
+		if list, ok := file.obj["pipelines"].([]any); ok {
+			for _, item := range list {
+				if pipeline, ok := item.(map[string]any); ok {
+					if name, ok := pipeline["name"].(string); ok {
+						sources.pipelines[name] = file.path
+					}
+				}
+			}
+		}
+		mergeMap(merged, file.obj)
+	}
+	return merged, sources
+}
+
+func mergeMap(dst map[string]any, src map[string]any) {
+	for key, value := range src {
+		switch v := value.(type) {
+		case []any:
+			if list, ok := dst[key].([]any); ok {
+				dst[key] = append(list, v...)
+				continue
+			}
+		case map[string]any:
+			if m, ok := dst[key].(map[string]any); ok {
+				mergeMap(m, v)
+				continue
+			}
+		}
+		dst[key] = value
+	}
+}
+
+// configSources records config files of plugins when loaded from multiple config files
+type configSources struct {
+	input, filter, output []string
+	pipelines             map[string]string
+}
+
+func (t *configSources) add(section string, path string) {
+	switch section {
+	case "input":
+		t.input = append(t.input, path)
+	case "filter":
+		t.filter = append(t.filter, path)
+	case "output":
+		t.output = append(t.output, path)
+	}
+}
+
+// sourceOf returns the config file of the plugin at index of section of the main pipeline,
+// or of the named pipeline, empty if loaded from a single config file
+func (t *configSources) sourceOf(main bool, pipeline string, section string, index int) string {
+	if t == nil {
+		return ""
+	}
+	if !main {
+		return t.pipelines[pipeline]
+	}
+	var paths []string
+	switch section {
+	case "input":
+		paths = t.input
+	case "filter":
+		paths = t.filter
+	case "output":
+		paths = t.output
+	}
+	if index < len(paths) {
+		return paths[index]
+	}
+	return ""
+}
+
+// loadFromFiles loads config merged from files
+func loadFromFiles(path string, files []configFile) (config Config, err error) {
+	merged, sources := mergeConfigFiles(files)
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return config, ErrorMergeConfigFiles1.New(err, path)
+	}
+	if config, err = LoadFromYAML(data); err != nil {
+		return config, ErrorMergeConfigFiles1.New(err, path)
+	}
+	config.sources = sources
+	return config, nil
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFiles(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistOutputHandler("test_include", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		conf := testCheckOutput{}
+		return &conf, ReflectConfig(raw, &conf)
+	})
+
+	dir := t.TempDir()
+	write := func(name string, content string) {
+		path := filepath.Join(dir, name)
+		require.NoError(os.MkdirAll(filepath.Dir(path), 0o700))
+		require.NoError(os.WriteFile(path, []byte(strings.TrimSpace(content)), 0o600))
+	}
+	write("conf.d/20-output.json", `
+{
+	// outputs
+	"output": [{"type": "test_include", "port": 80}]
+}
+	`)
+	write("conf.d/10-main.yml", `
+chsize: 10
+include: ../filters/*.yml
+filter:
+  - type: add_tag
+    tags: [main]
+	`)
+	write("conf.d/README.md", `not a config file`)
+	write("filters/grok.yml", `
+filter:
+  - type: grok
+    patterns_path: patterns/nginx
+  - type: lookup_table
+    lookup_file: /etc/lookup.yml
+	`)
+
+	conf, err := LoadFromFile(filepath.Join(dir, "conf.d"))
+	require.NoError(err)
+	require.Equal(10, conf.ChannelSize)
+	require.Len(conf.FilterRaw, 3)
+	require.Equal(filepath.Join(dir, "filters", "patterns", "nginx"), conf.FilterRaw[0]["patterns_path"])
+	require.Equal("/etc/lookup.yml", conf.FilterRaw[1]["lookup_file"])
+	require.Equal("add_tag", conf.FilterRaw[2]["type"])
+	require.Len(conf.OutputRaw, 1)
+
+	paths, err := ConfigFiles(filepath.Join(dir, "conf.d", "*.json"))
+	require.NoError(err)
+	require.Equal([]string{filepath.Join(dir, "conf.d", "20-output.json")}, paths)
+
+	// errors name the file caused them
+	write("conf.d/20-output.json", `{"output": [{"type": "test_include", "prot": 80}], "outptu": []}`)
+	errs := CheckFile(context.Background(), filepath.Join(dir, "conf.d"))
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+	require.Contains(messages, filepath.Join(dir, "conf.d", "20-output.json")+`: unknown key "outptu"`)
+	require.Contains(messages, filepath.Join(dir, "conf.d", "20-output.json")+` pipeline "main" output[0] (test_include): unknown key "prot"`)
+
+	write("conf.d/30-broken.yml", `output: [`)
+	_, err = LoadFromFile(filepath.Join(dir, "conf.d"))
+	require.True(ErrorLoadConfigFile1.In(err))
+	require.Contains(err.Error(), "30-broken.yml")
+	require.NoError(os.Remove(filepath.Join(dir, "conf.d", "30-broken.yml")))
+
+	write("filters/grok.yml", `include: ../conf.d/10-main.yml`)
+	_, err = LoadFromFile(filepath.Join(dir, "conf.d"))
+	require.True(ErrorIncludeCycle1.In(err))
+
+	_, err = LoadFromFile(filepath.Join(dir, "empty", "*.yml"))
+	require.True(ErrorNoConfigFiles1.In(err))
+}
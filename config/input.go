@@ -5,7 +5,9 @@ import (
 
 	"github.com/tsaikd/KDGoLib/errutil"
 
+	"github.com/tsaikd/gogstash/config/goglog"
 	"github.com/tsaikd/gogstash/config/logevent"
+	"github.com/tsaikd/gogstash/config/monitor"
 )
 
 // errors
@@ -38,48 +40,93 @@ func RegistInputHandler(name string, handler InputHandler) {
 	mapInputHandler[name] = handler
 }
 
-func (t *Config) getInputs() (inputs []TypeInputConfig, err error) {
-	var input TypeInputConfig
+// newInput initializes the input of raw config, input is nil if disabled
+func newInput(ctx context.Context, raw ConfigRaw, control Control) (input TypeInputConfig, err error) {
+	if isDisabled(raw) {
+		return nil, nil
+	}
+	inputFilter, ok := raw["type"].(string)
+	if !ok {
+		return nil, ErrorNoFilterName.New(nil, "filter")
+	}
+	handler, ok := mapInputHandler[inputFilter]
+	if !ok {
+		return nil, ErrorUnknownInputType1.New(nil, raw["type"])
+	}
+	input, err = handler(ctx, raw, control)
+	checkBuilt(ctx, raw, input, err)
+	if err != nil {
+		return nil, ErrorInitInputFailed1.New(err, raw)
+	}
+	if input, err = withInputCondition(input, raw); err != nil {
+		return nil, ErrorInitInputFailed1.New(err, raw)
+	}
+	return input, nil
+}
+
+func (t *PipelineConfig) getInputs(ctx context.Context, control Control) (inputs []TypeInputConfig, err error) {
 	for _, raw := range t.InputRaw {
-		// check if input is disabled
-		var disabled bool
-		if result, ok := raw["disabled"].(bool); ok {
-			disabled = result
+		input, err := newInput(ctx, raw, control)
+		if err != nil {
+			return inputs, err
 		}
-		// load input if not disabled
-		if !disabled {
-			inputFilter, ok := raw["type"].(string)
-			if !ok {
-				return inputs, ErrorNoFilterName.New(nil, "filter")
-			}
-			handler, ok := mapInputHandler[inputFilter]
-			if !ok {
-				return inputs, ErrorUnknownInputType1.New(nil, raw["type"])
-			}
-
-			if input, err = handler(t.ctx, raw, t); err != nil {
-				return inputs, ErrorInitInputFailed1.New(err, raw)
-			}
-
+		if input != nil {
 			inputs = append(inputs, input)
 		}
 	}
 	return
 }
 
-func (t *Config) startInputs() (err error) {
-	inputs, err := t.getInputs()
-	if err != nil {
-		return
+// newInputInstance initializes the input of raw config with its own context
+func (t *PipelineConfig) newInputInstance(raw ConfigRaw, control Control) (instance *pluginInstance, err error) {
+	instance = t.newPluginInstance(raw)
+	if instance.input, err = newInput(instance.ctx, raw, control); err != nil {
+		instance.cancel()
+		return nil, err
 	}
+	instance.stats = t.stats.NewPlugin(instance.input.GetType(), GetPluginID(instance.input))
+	return instance, nil
+}
 
-	for _, input := range inputs {
-		func(input TypeInputConfig) {
-			t.eg.Go(func() error {
-				return input.Start(t.ctx, t.chInFilter)
-			})
-		}(input)
+func (t *PipelineConfig) startInputs(control Control) (err error) {
+	for _, raw := range enabledRaws(t.InputRaw) {
+		instance, err := t.newInputInstance(raw, control)
+		if err != nil {
+			return err
+		}
+		t.runInput(instance)
+		t.inputs = append(t.inputs, instance)
 	}
+	t.stats.SetPlugins(monitor.KindInput, pluginStats(t.inputs))
+	return nil
+}
 
-	return
+// runInput starts the input instance in a goroutine,
+// errors after the instance stopped by reload are ignored
+func (t *PipelineConfig) runInput(instance *pluginInstance) {
+	instance.done = make(chan struct{})
+	msgChan := t.chInput()
+	if instance.stats != nil {
+		msgChan = t.countInput(instance)
+	}
+	t.eg.Go(func() error {
+		defer close(instance.done)
+		err := instance.input.Start(instance.ctx, msgChan)
+		if err != nil && instance.ctx.Err() != nil && t.ctx.Err() == nil {
+			goglog.Logger.Debugf("input %q stopped: %v", GetPluginID(instance.input), err)
+			return nil
+		}
+		return err
+	})
+}
+
+// countInput returns a channel for the input instance, events sent to the channel
+// are counted and forwarded to the pipeline until the instance is stopped
+func (t *PipelineConfig) countInput(instance *pluginInstance) MsgChan {
+	msgChan := make(MsgChan)
+	go forwardEvents(instance.ctx, instance.done, msgChan, t.chInput(), func(event logevent.LogEvent) bool {
+		instance.stats.Out()
+		return true
+	})
+	return msgChan
 }
@@ -0,0 +1,202 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+)
+
+// errors
+var (
+	ErrorReadKeystore1      = errutil.NewFactory("read keystore %q failed")
+	ErrorWriteKeystore1     = errutil.NewFactory("write keystore %q failed")
+	ErrorDecryptKeystore1   = errutil.NewFactory("decrypt keystore %q failed, wrong password?")
+	ErrorUnknownVersion2    = errutil.NewFactory("keystore %q version %d not supported")
+	ErrorInvalidSecretName1 = errutil.NewFactory("invalid secret name %q, only letters, digits, '_', '-' and '.' are allowed")
+	ErrorSecretNotFound1    = errutil.NewFactory("secret %q not found in keystore")
+	ErrorEmptyPassword      = errutil.NewFactory("keystore password is empty, set it by environment variable " + PasswordEnv)
+)
+
+// PasswordEnv is the environment variable of the keystore password
+const PasswordEnv = "KEYSTORE_PASSWORD"
+
+const (
+	version    = 1
+	iterations = 100000
+	keyLength  = 32
+	saltLength = 16
+)
+
+var reSecretName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// file is the format of keystore file, secrets are encrypted by AES-GCM
+// with the key derived from the password by PBKDF2-SHA256
+type file struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+// Keystore is secrets stored in an encrypted file
+type Keystore struct {
+	path     string
+	password string
+	secrets  map[string]string
+}
+
+// Open loads the keystore of path encrypted by password, the keystore is empty if path not exists,
+// an empty password is refused
+func Open(path string, password string) (store *Keystore, err error) {
+	if password == "" {
+		return nil, ErrorEmptyPassword.New(nil)
+	}
+	store = &Keystore{path: path, password: password, secrets: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	} else if err != nil {
+		return nil, ErrorReadKeystore1.New(err, path)
+	}
+
+	var f file
+	if err = json.Unmarshal(data, &f); err != nil {
+		return nil, ErrorReadKeystore1.New(err, path)
+	}
+	if f.Version != version {
+		return nil, ErrorUnknownVersion2.New(nil, path, f.Version)
+	}
+	gcm, err := newGCM(password, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, ErrorReadKeystore1.New(err, path)
+	}
+	if len(f.Nonce) != gcm.NonceSize() {
+		return nil, ErrorDecryptKeystore1.New(nil, path)
+	}
+	plain, err := gcm.Open(nil, f.Nonce, f.Data, nil)
+	if err != nil {
+		return nil, ErrorDecryptKeystore1.New(err, path)
+	}
+	if err = json.Unmarshal(plain, &store.secrets); err != nil {
+		return nil, ErrorReadKeystore1.New(err, path)
+	}
+	return store, nil
+}
+
+func newGCM(password string, salt []byte, iter int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, password, salt, iter, keyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Path returns the path of keystore file
+func (t *Keystore) Path() string {
+	return t.path
+}
+
+// Get returns the value of secret name
+func (t *Keystore) Get(name string) (value string, ok bool) {
+	value, ok = t.secrets[name]
+	return
+}
+
+// Set sets the value of secret name, call Save to write the keystore file
+func (t *Keystore) Set(name string, value string) error {
+	if !reSecretName.MatchString(name) {
+		return ErrorInvalidSecretName1.New(nil, name)
+	}
+	t.secrets[name] = value
+	return nil
+}
+
+// Remove removes secret name, call Save to write the keystore file
+func (t *Keystore) Remove(name string) error {
+	if _, ok := t.secrets[name]; !ok {
+		return ErrorSecretNotFound1.New(nil, name)
+	}
+	delete(t.secrets, name)
+	return nil
+}
+
+// Names returns sorted names of secrets
+func (t *Keystore) Names() (names []string) {
+	for name := range t.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Values returns values of secrets
+func (t *Keystore) Values() (values []string) {
+	for _, value := range t.secrets {
+		values = append(values, value)
+	}
+	return values
+}
+
+// Save encrypts secrets and writes the keystore file, readable by owner only
+func (t *Keystore) Save() (err error) {
+	if t.password == "" {
+		return ErrorEmptyPassword.New(nil)
+	}
+	plain, err := json.Marshal(t.secrets)
+	if err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	f := file{
+		Version:    version,
+		Iterations: iterations,
+		Salt:       make([]byte, saltLength),
+	}
+	if _, err = rand.Read(f.Salt); err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	gcm, err := newGCM(t.password, f.Salt, f.Iterations)
+	if err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	f.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(f.Nonce); err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	f.Data = gcm.Seal(nil, f.Nonce, plain, nil)
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	// write to a temporary file then rename, so the keystore is never partially written
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), filepath.Base(t.path)+".*.tmp")
+	if err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	if err = tmp.Close(); err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	if err = os.Rename(tmp.Name(), t.path); err != nil {
+		return ErrorWriteKeystore1.New(err, t.path)
+	}
+	return nil
+}
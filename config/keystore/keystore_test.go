@@ -0,0 +1,50 @@
+package keystore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystore(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	path := filepath.Join(t.TempDir(), "gogstash.keystore")
+	store, err := Open(path, "pass")
+	require.NoError(err)
+	require.Empty(store.Names())
+
+	require.NoError(store.Set("es_password", "s3cr3t"))
+	require.NoError(store.Set("kafka.password", "k"))
+	require.True(ErrorInvalidSecretName1.In(store.Set("bad name", "x")))
+	require.NoError(store.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(err)
+	require.Equal(os.FileMode(0o600), info.Mode().Perm())
+	data, err := os.ReadFile(path)
+	require.NoError(err)
+	require.NotContains(string(data), "s3cr3t")
+
+	store, err = Open(path, "pass")
+	require.NoError(err)
+	require.Equal([]string{"es_password", "kafka.password"}, store.Names())
+	value, ok := store.Get("es_password")
+	require.True(ok)
+	require.Equal("s3cr3t", value)
+
+	require.NoError(store.Remove("kafka.password"))
+	require.True(ErrorSecretNotFound1.In(store.Remove("kafka.password")))
+	require.NoError(store.Save())
+	store, err = Open(path, "pass")
+	require.NoError(err)
+	require.Equal([]string{"es_password"}, store.Names())
+
+	_, err = Open(path, "wrong")
+	require.True(ErrorDecryptKeystore1.In(err))
+	_, err = Open(path, "")
+	require.True(ErrorEmptyPassword.In(err))
+}
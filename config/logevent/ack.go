@@ -0,0 +1,179 @@
+package logevent
+
+import (
+	"context"
+	"sync"
+)
+
+// Ack tracks the delivery of events created from the same input message,
+// the callback is called once all events are acknowledged or any is not.
+// Inputs create an Ack for every message and advance their checkpoint in the callback,
+// which gives at-least-once delivery.
+type Ack struct {
+	mutex    sync.Mutex
+	pending  int
+	err      error
+	callback func(err error)
+}
+
+// NewAck returns an Ack holding one reference of the creator,
+// release it by Done after all events of the message are sent to the pipeline.
+// callback is called with nil if all events are acknowledged,
+// otherwise with the error of the first negative acknowledgement.
+func NewAck(callback func(err error)) *Ack {
+	return &Ack{
+		pending:  1,
+		callback: callback,
+	}
+}
+
+// Add adds n references to the Ack
+func (t *Ack) Add(n int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pending += n
+}
+
+// Done releases one reference, err not nil is a negative acknowledgement
+func (t *Ack) Done(err error) {
+	t.mutex.Lock()
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+	t.pending--
+	if t.pending != 0 {
+		t.mutex.Unlock()
+		return
+	}
+	err = t.err
+	t.mutex.Unlock()
+
+	if t.callback != nil {
+		t.callback(err)
+	}
+}
+
+type ackContextKey struct{}
+
+// ContextWithAck returns a context carrying ack, codecs attach it to decoded events
+func ContextWithAck(ctx context.Context, ack *Ack) context.Context {
+	return context.WithValue(ctx, ackContextKey{}, ack)
+}
+
+// AckFromContext returns the Ack of ctx, or nil
+func AckFromContext(ctx context.Context) *Ack {
+	ack, _ := ctx.Value(ackContextKey{}).(*Ack)
+	return ack
+}
+
+// SetAck attaches the event to ack, the event must be acknowledged by Ack or Nack once,
+// nil ack detaches the event
+func (t *LogEvent) SetAck(ack *Ack) {
+	if ack != nil {
+		ack.Add(1)
+	}
+	t.ack = ack
+}
+
+// HasAck returns true if the event waits for acknowledgement
+func (t *LogEvent) HasAck() bool {
+	return t.ack != nil
+}
+
+// Ack acknowledges the event was delivered by all outputs
+func (t *LogEvent) Ack() {
+	t.done(nil)
+}
+
+// Nack acknowledges the event failed to deliver
+func (t *LogEvent) Nack(err error) {
+	t.done(err)
+}
+
+// HoldAck adds a reference to the Ack of the event, returns the function to release it,
+// outputs delivering events asynchronously use it to delay the acknowledgement
+func (t *LogEvent) HoldAck() func(err error) {
+	ack := t.ack
+	if ack == nil {
+		return func(error) {}
+	}
+	ack.Add(1)
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { ack.Done(err) })
+	}
+}
+
+func (t *LogEvent) done(err error) {
+	if t.ack == nil {
+		return
+	}
+	ack := t.ack
+	t.ack = nil
+	ack.Done(err)
+}
+
+// ShareAck adds a reference to the Ack of the event for a copy of the event,
+// which is acknowledged separately, e.g. forwarded to another pipeline
+func (t *LogEvent) ShareAck() {
+	if t.ack != nil {
+		t.ack.Add(1)
+	}
+}
+
+// AckOrder commits positions of messages in the order of NewAck, e.g. offsets of a partition,
+// a position is committed after its message and all messages before it are acknowledged.
+// A message not acknowledged stops committing, it is delivered again after restart.
+type AckOrder struct {
+	mutex   sync.Mutex
+	pending []*orderedAck
+	commit  func(position any)
+}
+
+type orderedAck struct {
+	position any
+	done     bool
+}
+
+// NewAckOrder returns an AckOrder calling commit with the last position acknowledged in order
+func NewAckOrder(commit func(position any)) *AckOrder {
+	return &AckOrder{commit: commit}
+}
+
+// NewAck returns an Ack of the message at position, callback is called with the
+// acknowledgement result before commit
+func (t *AckOrder) NewAck(position any, callback func(err error)) *Ack {
+	pending := &orderedAck{position: position}
+	t.mutex.Lock()
+	t.pending = append(t.pending, pending)
+	t.mutex.Unlock()
+
+	return NewAck(func(err error) {
+		if callback != nil {
+			callback(err)
+		}
+		if err != nil {
+			return
+		}
+
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		pending.done = true
+		var last *orderedAck
+		for len(t.pending) > 0 && t.pending[0].done {
+			last = t.pending[0]
+			t.pending[0] = nil
+			t.pending = t.pending[1:]
+		}
+		if last != nil && t.commit != nil {
+			t.commit(last.position)
+		}
+	})
+}
+
+// Len returns the number of messages waiting for acknowledgement
+func (t *AckOrder) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return len(t.pending)
+}
@@ -0,0 +1,103 @@
+package logevent
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAck(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	var results []error
+	ack := NewAck(func(err error) {
+		results = append(results, err)
+	})
+	ctx := ContextWithAck(context.Background(), ack)
+	require.Equal(ack, AckFromContext(ctx))
+	require.Nil(AckFromContext(context.Background()))
+
+	event1 := LogEvent{Message: "1"}
+	event1.SetAck(AckFromContext(ctx))
+	event2 := LogEvent{Message: "2"}
+	event2.SetAck(ack)
+	require.True(event1.HasAck())
+
+	// creator reference released
+	ack.Done(nil)
+	event1.Ack()
+	require.False(event1.HasAck())
+	// acknowledged once only
+	event1.Ack()
+	require.Empty(results)
+
+	release := event2.HoldAck()
+	event2.Ack()
+	require.Empty(results)
+	release(nil)
+	require.Equal([]error{nil}, results)
+
+	// event without Ack
+	event3 := LogEvent{}
+	event3.Nack(errors.New("ignored"))
+	event3.HoldAck()(nil)
+	require.Len(results, 1)
+}
+
+func TestNack(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	var result error
+	called := 0
+	ack := NewAck(func(err error) {
+		result = err
+		called++
+	})
+	event1 := LogEvent{}
+	event1.SetAck(ack)
+	event2 := event1
+	event2.ShareAck()
+	ack.Done(nil)
+
+	errReject := errors.New("rejected")
+	event1.Nack(errReject)
+	event2.Ack()
+	require.Equal(1, called)
+	require.Equal(errReject, result)
+}
+
+func TestAckOrder(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	var committed []any
+	order := NewAckOrder(func(position any) {
+		committed = append(committed, position)
+	})
+	ack1 := order.NewAck(int64(10), nil)
+	ack2 := order.NewAck(int64(20), nil)
+	ack3 := order.NewAck(int64(30), nil)
+	require.Equal(3, order.Len())
+
+	ack2.Done(nil)
+	require.Empty(committed)
+	ack1.Done(nil)
+	require.Equal([]any{int64(20)}, committed)
+
+	var nackErr error
+	ack4 := order.NewAck(int64(40), func(err error) {
+		nackErr = err
+	})
+	ack4.Done(errors.New("rejected"))
+	require.Error(nackErr)
+	ack3.Done(nil)
+	// not acknowledged message stops committing
+	require.Equal([]any{int64(20), int64(30)}, committed)
+	order.NewAck(int64(50), nil).Done(nil)
+	require.Equal([]any{int64(20), int64(30)}, committed)
+	require.Equal(2, order.Len())
+}
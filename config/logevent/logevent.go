@@ -2,8 +2,10 @@ package logevent
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,6 +19,13 @@ type LogEvent struct {
 	Tags      []string       `json:"tags,omitempty"`
 	Extra     map[string]any `json:"-"`
 	Drop      bool
+
+	// Metadata is addressed as @metadata.<field>, e.g. routing data of outputs,
+	// it is never serialized by MarshalJSON or codecs
+	Metadata map[string]any `json:"-"`
+
+	ack *Ack // acknowledges delivery to the input, see SetAck
+	cow bool // copy-on-write, see CopyOnWrite
 }
 
 type Config struct {
@@ -31,6 +40,7 @@ type Config struct {
 const TimestampField = "@timestamp"
 const MessageField = "message"
 const TagsField = "tags"
+const MetadataField = "@metadata"
 
 const timeFormat = `2006-01-02T15:04:05.999999999Z`
 
@@ -52,6 +62,60 @@ func init() {
 	SetConfig(&Config{SortMapKeys: false})
 }
 
+// Clone returns a deep copy of the event, maps and arrays of Extra, Metadata and Tags are copied,
+// the copy shares the acknowledgement of the event
+func (t LogEvent) Clone() LogEvent {
+	if t.Tags != nil {
+		t.Tags = slices.Clone(t.Tags)
+	}
+	if t.Extra != nil {
+		t.Extra = cloneValue(t.Extra).(map[string]any)
+	}
+	if t.Metadata != nil {
+		t.Metadata = cloneValue(t.Metadata).(map[string]any)
+	}
+	t.cow = false
+	return t
+}
+
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for key, val := range v {
+			m[key] = cloneValue(val)
+		}
+		return m
+	case []any:
+		s := make([]any, len(v))
+		for i, val := range v {
+			s[i] = cloneValue(val)
+		}
+		return s
+	case []string:
+		return slices.Clone(v)
+	case map[string]string:
+		return maps.Clone(v)
+	default:
+		return v
+	}
+}
+
+// CopyOnWrite returns a view of the event shared by concurrent readers, e.g. outputs,
+// the view is deep copied by the first modification of its methods, e.g. SetValue, Remove and AddTag,
+// Clone it before modifying Extra, Metadata or Tags directly
+func (t LogEvent) CopyOnWrite() LogEvent {
+	t.cow = true
+	return t
+}
+
+// own deep copies the event before modified if it is a copy-on-write view
+func (t *LogEvent) own() {
+	if t.cow {
+		*t = t.Clone()
+	}
+}
+
 func appendIfMissing(slice []string, s string) []string {
 	for _, ele := range slice {
 		if ele == s {
@@ -63,6 +127,7 @@ func appendIfMissing(slice []string, s string) []string {
 
 // AddTag add tags into event.Tags
 func (t *LogEvent) AddTag(tags ...string) {
+	t.own()
 	for _, tag := range tags {
 		ftag := t.Format(tag)
 		t.Tags = appendIfMissing(t.Tags, ftag)
@@ -131,7 +196,8 @@ func (t LogEvent) getJSONMap() map[string]any {
 		event[TagsField] = t.Tags
 	}
 	for _, field := range config.RemoveField {
-		removePathValue(event, field)
+		// nested objects are shared with the event
+		removePathValueFromTokens(event, compilePathWithCache(field), true)
 	}
 	return event
 }
@@ -146,8 +212,37 @@ func (t LogEvent) MarshalIndent() (data []byte, err error) {
 	return config.jsonMarshalIndent(event, "", "\t")
 }
 
+// metadataPath returns the path tokens in Metadata of field, ok is false if field is not in @metadata
+func metadataPath(field string) (tokens []pathtoken, ok bool) {
+	tokens = compilePathWithCache(field)
+	if tokens[0].isSlice || tokens[0].key != MetadataField {
+		return tokens, false
+	}
+	return tokens[1:], true
+}
+
+// tagsPath returns the path tokens in Tags of field, ok is false if field is not in tags
+func tagsPath(field string) (tokens []pathtoken, ok bool) {
+	tokens = compilePathWithCache(field)
+	if tokens[0].isSlice || tokens[0].key != TagsField {
+		return tokens, false
+	}
+	return tokens[1:], true
+}
+
+// fieldName returns the name of top level field, ex: "[message]" is "message"
+func fieldName(field string) string {
+	if !strings.ContainsAny(field, "[\\") {
+		return field
+	}
+	if tokens := compilePathWithCache(field); len(tokens) == 1 && !tokens[0].isSlice {
+		return tokens[0].key
+	}
+	return field
+}
+
 func (t LogEvent) Get(field string) (v any) {
-	switch field {
+	switch fieldName(field) {
 	case TimestampField:
 		v = t.Timestamp
 	case MessageField:
@@ -155,19 +250,19 @@ func (t LogEvent) Get(field string) (v any) {
 	case TagsField:
 		v = t.Tags
 	default:
-		v, _ = getPathValue(t.Extra, field)
+		v, _ = t.GetValue(field)
 	}
 	return
 }
 
 func (t LogEvent) GetString(field string) string {
-	switch field {
+	switch fieldName(field) {
 	case TimestampField:
 		return t.Timestamp.UTC().Format(timeFormat)
 	case MessageField:
 		return t.Message
 	default:
-		v, ok := getPathValue(t.Extra, field)
+		v, ok := t.GetValue(field)
 		if ok {
 			if s, ok := v.(string); ok {
 				return s
@@ -178,25 +273,129 @@ func (t LogEvent) GetString(field string) string {
 	}
 }
 
+// GetValue returns the value of field in Extra, Metadata or Tags, fields are dotted or bracketed paths,
+// ex: "nginx.status", "[nginx][status]", "tags[-1]", "[labels][app.kubernetes.io/name]"
 func (t LogEvent) GetValue(field string) (any, bool) {
-	return getPathValue(t.Extra, field)
+	if tokens, ok := tagsPath(field); ok {
+		if len(tokens) == 0 {
+			return t.Tags, t.Tags != nil
+		}
+		return getPathValueFromTokens(t.Tags, tokens)
+	}
+	if tokens, ok := metadataPath(field); ok {
+		if len(tokens) == 0 {
+			return t.Metadata, t.Metadata != nil
+		}
+		return getPathValueFromTokens(t.Metadata, tokens)
+	}
+	return getPathValueFromTokens(t.Extra, compilePathWithCache(field))
 }
 
 func (t *LogEvent) SetValue(field string, v any) bool {
-	if field == "message" {
+	if fieldName(field) == MessageField {
 		if value, ok := v.(string); ok {
 			t.Message = value
 			return false
 		}
 	}
+	t.own()
+	if tokens, ok := tagsPath(field); ok {
+		return t.setTag(tokens, v)
+	}
+	if tokens, ok := metadataPath(field); ok {
+		if len(tokens) == 0 {
+			metadata, ok := v.(map[string]any)
+			if ok {
+				t.Metadata = metadata
+			}
+			return ok
+		}
+		if t.Metadata == nil {
+			t.Metadata = map[string]any{}
+		}
+		return setPathValueFromTokens(t.Metadata, tokens, v)
+	}
 	if t.Extra == nil {
-		t.Extra = map[string]any{}
+		extra := map[string]any{}
+		if !setPathValueFromTokens(extra, compilePathWithCache(field), v) {
+			return false
+		}
+		t.Extra = extra
+		return true
+	}
+	return setPathValueFromTokens(t.Extra, compilePathWithCache(field), v)
+}
+
+// setTag sets v to tags, or the tag at the index of tokens, tags are strings
+func (t *LogEvent) setTag(tokens []pathtoken, v any) bool {
+	if len(tokens) == 0 {
+		switch tags := v.(type) {
+		case []string:
+			t.Tags = tags
+			return true
+		case []any:
+			result := make([]string, len(tags))
+			for i, tag := range tags {
+				s, ok := tag.(string)
+				if !ok {
+					return false
+				}
+				result[i] = s
+			}
+			t.Tags = result
+			return true
+		}
+		return false
+	}
+	tag, ok := v.(string)
+	if len(tokens) > 1 || !tokens[0].isSlice || !ok {
+		return false
+	}
+	index, ok := sliceIndex(tokens[0].index, len(t.Tags))
+	if !ok {
+		return false
+	}
+	t.Tags = slices.Clone(t.Tags)
+	t.Tags[index] = tag
+	return true
+}
+
+// SetMetadata sets key of Metadata to v, inputs use it to record source details
+func (t *LogEvent) SetMetadata(key string, v any) {
+	t.own()
+	if t.Metadata == nil {
+		t.Metadata = map[string]any{}
 	}
-	return setPathValue(t.Extra, field, v)
+	t.Metadata[key] = v
 }
 
 func (t *LogEvent) Remove(field string) bool {
-	return removePathValue(t.Extra, field)
+	t.own()
+	if tokens, ok := tagsPath(field); ok {
+		switch {
+		case len(tokens) == 0:
+			ok = t.Tags != nil
+			t.Tags = nil
+			return ok
+		case len(tokens) > 1 || !tokens[0].isSlice:
+			return false
+		}
+		index, ok := sliceIndex(tokens[0].index, len(t.Tags))
+		if !ok {
+			return false
+		}
+		t.Tags = slices.Delete(slices.Clone(t.Tags), index, index+1)
+		return true
+	}
+	if tokens, ok := metadataPath(field); ok {
+		if len(tokens) == 0 {
+			ok = t.Metadata != nil
+			t.Metadata = nil
+			return ok
+		}
+		return removePathValueFromTokens(t.Metadata, tokens, false)
+	}
+	return removePathValueFromTokens(t.Extra, compilePathWithCache(field), false)
 }
 
 var (
@@ -251,23 +450,17 @@ func FormatWithEventTime(text string, evevtTime time.Time) (result string) {
 	return
 }
 
-// Format return string with current time / LogEvent field / ENV, ex: %{hostname}
+// Format return string with current time / LogEvent field / ENV, ex: %{hostname},
+// see Template for the syntax, placeholders of fields not found are kept
 func (t LogEvent) Format(format string) (out string) {
-	out = format
-
-	out = FormatWithEventTime(out, t.Timestamp)
-	out = FormatWithCurrentTime(out)
+	return getTemplate(format).Format(t)
+}
 
-	matches := revar.FindAllStringSubmatch(out, -1)
-	for _, submatches := range matches {
-		field := submatches[1]
-		value := t.GetString(field)
-		if value != "" {
-			out = strings.ReplaceAll(out, submatches[0], value)
-		}
+// FormatStrict is like Format, but returns error if any field not found
+func (t LogEvent) FormatStrict(format string) (out string, err error) {
+	tmpl, err := NewTemplate(format)
+	if err != nil {
+		return "", err
 	}
-
-	out = FormatWithEnv(out)
-
-	return
+	return tmpl.FormatStrict(t)
 }
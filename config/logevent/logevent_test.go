@@ -1,8 +1,10 @@
 package logevent
 
 import (
+	"context"
 	"encoding/json"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -97,6 +99,58 @@ func Test_Format(t *testing.T) {
 	assert.Equal("%{null}", out)
 }
 
+func Test_Template(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	event := LogEvent{
+		Timestamp: time.Date(2017, time.April, 5, 17, 41, 12, 0, time.UTC),
+		Message:   "Test Message",
+		Tags:      []string{"a", "b"},
+		Extra: map[string]any{
+			"user":  "Alice Smith",
+			"empty": "",
+			"list":  []any{map[string]any{"name": "x"}, "y"},
+			"child": map[string]any{"code": 42},
+		},
+	}
+
+	for format, expected := range map[string]string{
+		"%{user|lowercase}":                  "alice smith",
+		"%{user|uppercase|truncate:3}":       "ALI",
+		"%{user|urlencode}":                  "Alice+Smith",
+		"%{child|json}":                      `{"code":42}`,
+		"%{tags|json}":                       `["a","b"]`,
+		"%{tags[1]}-%{list[0].name}":         "b-x",
+		"%{list[-1]}":                        "y",
+		"%{missing:-none}/%{empty:-blank}":   "none/blank",
+		"%{child.code:-0}":                   "42",
+		"%{user|hash:md5}":                   "77a65d508fa6f1f86a37e0acb7ca931d",
+		"logs-%{+@2006.01.02}-%{@timestamp}": "logs-2017.04.05-2017-04-05T17:41:12Z",
+		"%{missing}%{user":                   "%{missing}%{user",
+	} {
+		tmpl, err := NewTemplate(format)
+		require.NoError(err, format)
+		require.Equal(expected, tmpl.Format(event), format)
+		require.Equal(expected, event.Format(format), format)
+	}
+
+	tmpl, err := NewTemplate("logs-%{missing}")
+	require.NoError(err)
+	_, err = tmpl.FormatStrict(event)
+	require.True(ErrorMissingTemplateField1.In(err))
+	out, err := event.FormatStrict("logs-%{user|lowercase|truncate:5}")
+	require.NoError(err)
+	require.Equal("logs-alice", out)
+
+	_, err = NewTemplate("%{user|unknown}")
+	require.True(ErrorUnknownTemplateFilter1.In(err))
+	_, err = NewTemplate("%{user|truncate:x}")
+	require.True(ErrorInvalidTemplateFilter2.In(err))
+	// invalid placeholders are kept by Format
+	require.Equal("%{user|unknown}", event.Format("%{user|unknown}"))
+}
+
 func Test_Tags(t *testing.T) {
 	assert := assert.New(t)
 	assert.NotNil(assert)
@@ -231,6 +285,193 @@ func Test_Remove(t *testing.T) {
 	}, event)
 }
 
+func Test_FieldReference(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	event := LogEvent{
+		Message: "Test Message",
+		Tags:    []string{"foo", "bar"},
+		Extra: map[string]any{
+			"labels": map[string]any{
+				"app.kubernetes.io/name": "web",
+			},
+			"list": []any{
+				map[string]any{"id": 1},
+				map[string]any{"id": 2},
+				map[string]any{"id": 3},
+			},
+		},
+		Metadata: map[string]any{"index": "logs"},
+	}
+
+	require.Equal("Test Message", event.Get("[message]"))
+	require.Equal([]string{"foo", "bar"}, event.Get("[tags]"))
+	require.Equal("web", event.Get("[labels][app.kubernetes.io/name]"))
+	require.Equal("web", event.Get(`labels.app\.kubernetes\.io/name`))
+	require.Equal(3, event.Get("[list][-1][id]"))
+	require.Equal(2, event.Get("list[-2].id"))
+	require.Equal("logs", event.Get("[@metadata][index]"))
+	require.Nil(event.Get("[list][3][id]"))
+	require.Nil(event.Get("[labels][app]"))
+
+	require.True(event.SetValue("[labels][app.kubernetes.io/version]", "v1"))
+	require.Equal("v1", event.GetString("labels.app\\.kubernetes\\.io/version"))
+	require.True(event.SetValue("[list][-1][id]", 4))
+	require.Equal(4, event.Get("list[2].id"))
+	require.False(event.SetValue("[list][3][id]", 5))
+	require.True(event.SetValue("[@metadata][type]", "nginx"))
+	require.Equal("nginx", event.Metadata["type"])
+	event.SetValue("[message]", "new message")
+	require.Equal("new message", event.Message)
+
+	require.True(event.Remove("[labels][app.kubernetes.io/name]"))
+	require.Equal(map[string]any{"app.kubernetes.io/version": "v1"}, event.Extra["labels"])
+	require.True(event.Remove("[list][0]"))
+	require.Equal([]any{
+		map[string]any{"id": 2},
+		map[string]any{"id": 4},
+	}, event.Extra["list"])
+	require.True(event.Remove("list[-1].id"))
+	require.Equal([]any{
+		map[string]any{"id": 2},
+		map[string]any{},
+	}, event.Extra["list"])
+	require.False(event.Remove("[list][5]"))
+	require.True(event.Remove("[@metadata][index]"))
+	require.Equal(map[string]any{"type": "nginx"}, event.Metadata)
+}
+
+func Test_FieldReferenceTags(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	event := LogEvent{
+		Tags:  []string{"foo", "bar"},
+		Extra: map[string]any{"a": "b"},
+	}
+	require.Equal("foo", event.Get("[tags][0]"))
+	require.Equal("bar", event.Get("tags[-1]"))
+	require.Equal("bar", event.GetString("[tags][1]"))
+	require.Nil(event.Get("[tags][2]"))
+
+	require.True(event.SetValue("tags[-1]", "baz"))
+	require.Equal([]string{"foo", "baz"}, event.Tags)
+	require.False(event.SetValue("tags[2]", "x"))
+	require.False(event.SetValue("[tags][0][a]", "x"))
+	require.False(event.SetValue("[tags][0]", 1))
+	require.True(event.SetValue("tags", []any{"x", "y", "z"}))
+	require.Equal([]string{"x", "y", "z"}, event.Tags)
+
+	require.True(event.Remove("[tags][1]"))
+	require.Equal([]string{"x", "z"}, event.Tags)
+	require.False(event.Remove("[tags][5]"))
+	require.True(event.Remove("tags"))
+	require.Nil(event.Tags)
+	require.Equal(map[string]any{"a": "b"}, event.Extra)
+
+	// failed set does not change Extra
+	require.False(event.SetValue("x.y[0]", 1))
+	require.Equal(map[string]any{"a": "b"}, event.Extra)
+	event.Extra = nil
+	require.False(event.SetValue("x[0]", 1))
+	require.Nil(event.Extra)
+}
+
+func Test_MarshalJSON_RemoveField(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	defer SetConfig(config)
+	SetConfig(&Config{RemoveField: []string{"[nginx][password]", "list[0]"}})
+
+	eventTime := time.Date(2017, time.April, 5, 17, 41, 12, 345, time.UTC)
+	event := LogEvent{
+		Timestamp: eventTime,
+		Extra: map[string]any{
+			"nginx": map[string]any{"password": "secret", "user": "foo"},
+			"list":  []any{"a", "b"},
+		},
+	}
+
+	d, err := json.Marshal(event)
+	require.NoError(err)
+	require.JSONEq(`{"@timestamp":"2017-04-05T17:41:12.000000345Z","nginx":{"user":"foo"},"list":["b"]}`, string(d))
+
+	// fields are removed from the output only
+	require.Equal(map[string]any{"password": "secret", "user": "foo"}, event.Extra["nginx"])
+	require.Equal([]any{"a", "b"}, event.Extra["list"])
+}
+
+func Test_Clone(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	event := LogEvent{
+		Message: "Test Message",
+		Tags:    []string{"foo"},
+		Extra: map[string]any{
+			"nested": map[string]any{"list": []any{"a", map[string]any{"b": 1}}},
+			"names":  []string{"x"},
+		},
+		Metadata: map[string]any{"index": map[string]any{"name": "logs"}},
+	}
+	ack := NewAck(nil)
+	event.SetAck(ack)
+
+	clone := event.Clone()
+	require.Equal(event, clone)
+	require.True(clone.HasAck())
+
+	clone.Tags[0] = "bar"
+	clone.Extra["nested"].(map[string]any)["list"].([]any)[1].(map[string]any)["b"] = 2
+	clone.Extra["names"].([]string)[0] = "y"
+	clone.Metadata["index"].(map[string]any)["name"] = "other"
+	require.Equal([]string{"foo"}, event.Tags)
+	require.Equal(1, event.Get("nested.list[1].b"))
+	require.Equal([]string{"x"}, event.Extra["names"])
+	require.Equal("logs", event.Get("@metadata.index.name"))
+}
+
+func Test_CopyOnWrite(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	event := LogEvent{
+		Tags: make([]string, 1, 10),
+		Extra: map[string]any{
+			"nested": map[string]any{"value": 1},
+		},
+	}
+	event.Tags[0] = "foo"
+	expected := event.Clone()
+
+	view := event.CopyOnWrite()
+	require.Equal(1, view.Get("nested.value"))
+	view.AddTag("bar")
+	require.True(view.SetValue("nested.value", 2))
+	require.True(view.Remove("nested"))
+	require.Equal([]string{"foo", "bar"}, view.Tags)
+	require.Equal(expected, event)
+	// the event is owned after the first modification
+	require.Equal(map[string]any{}, view.Extra)
+	require.Equal(view, view.Clone())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(view LogEvent) {
+			defer wg.Done()
+			view.SetValue("nested.value", i)
+			view.SetMetadata("index", i)
+			view.AddTag("baz")
+			assert.Equal(t, i, view.Get("nested.value"))
+		}(event.CopyOnWrite())
+	}
+	wg.Wait()
+	require.Equal(expected, event)
+}
+
 func Test_MarshalJSON(t *testing.T) {
 	assert := assert.New(t)
 	assert.NotNil(assert)
@@ -324,3 +565,48 @@ func TestChangeMessage(t *testing.T) {
 	assert.Equal(newMessage, event.Get("message"))
 	assert.Equal(newMessage, event.GetString("message"))
 }
+
+func Test_Metadata(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	eventTime := time.Date(2017, time.April, 5, 17, 41, 12, 345, time.UTC)
+	event := LogEvent{
+		Timestamp: eventTime,
+		Message:   "Test Message",
+	}
+
+	assert.True(event.SetValue("@metadata.index", "logs"))
+	assert.True(event.SetValue("@metadata.kafka.partition", 3))
+	require.Equal(LogEvent{
+		Timestamp: eventTime,
+		Message:   "Test Message",
+		Metadata: map[string]any{
+			"index": "logs",
+			"kafka": map[string]any{
+				"partition": 3,
+			},
+		},
+	}, event)
+
+	partition, ok := event.GetValue("@metadata.kafka.partition")
+	assert.True(ok)
+	assert.Equal(3, partition)
+	assert.Equal("logs", event.Get("@metadata.index"))
+	assert.Equal("index-logs-3", event.Format("index-%{@metadata.index}-%{@metadata.kafka.partition}"))
+
+	data, err := event.MarshalJSON()
+	require.NoError(err)
+	assert.JSONEq(`{"@timestamp":"2017-04-05T17:41:12.000000345Z","message":"Test Message"}`, string(data))
+
+	assert.True(event.Remove("@metadata.kafka"))
+	require.Equal(map[string]any{"index": "logs"}, event.Metadata)
+	assert.True(event.Remove("@metadata"))
+	require.Nil(event.Metadata)
+
+	ctx := ContextWithMetadata(context.Background(), map[string]any{"path": "/var/log/syslog"})
+	event.SetMetadataFromContext(ctx)
+	require.Equal(map[string]any{"path": "/var/log/syslog"}, event.Metadata)
+}
@@ -0,0 +1,32 @@
+package logevent
+
+import "context"
+
+type metadataContextKey struct{}
+
+// ContextWithMetadata returns a context carrying metadata of the input message,
+// codecs attach it to decoded events
+func ContextWithMetadata(ctx context.Context, metadata map[string]any) context.Context {
+	return context.WithValue(ctx, metadataContextKey{}, metadata)
+}
+
+// MetadataFromContext returns a copy of the metadata of ctx, or nil
+func MetadataFromContext(ctx context.Context) map[string]any {
+	metadata, _ := ctx.Value(metadataContextKey{}).(map[string]any)
+	if metadata == nil {
+		return nil
+	}
+	result := make(map[string]any, len(metadata))
+	for key, value := range metadata {
+		result[key] = value
+	}
+	return result
+}
+
+// SetMetadataFromContext adds the metadata of ctx to the event
+func (t *LogEvent) SetMetadataFromContext(ctx context.Context) {
+	metadata, _ := ctx.Value(metadataContextKey{}).(map[string]any)
+	for key, value := range metadata {
+		t.SetMetadata(key, value)
+	}
+}
@@ -1,7 +1,9 @@
 package logevent
 
 import (
+	"maps"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -26,50 +28,91 @@ func init() {
 	}
 }
 
-func getPathArrayToken(path string) []pathtoken {
-	var tokens []pathtoken
-	for len(path) > 0 && path[len(path)-1] == ']' {
-		pos := strings.LastIndexByte(path, '[')
-		if pos < 0 {
-			break
-		}
-		indexStr := path[pos+1 : len(path)-1]
-		index, err := strconv.Atoi(indexStr)
-		if err != nil {
-			panic(err)
-		}
-		t := pathtoken{
-			isSlice: true,
-			index:   index,
-		}
-		tokens = append([]pathtoken{t}, tokens...)
-		path = path[:pos]
-	}
-	if len(tokens) > 0 && len(path) > 0 {
-		// object key
-		tokens = append([]pathtoken{{
-			isSlice: false,
-			key:     path,
-		}}, tokens...)
+// compilePath splits path into tokens, both dotted and bracketed references are supported:
+//
+//	a.b[0].c      key a, key b, index 0, key c
+//	[a][b][0][c]  the same as above, logstash style
+//	[a][-1]       the last element of a
+//	[labels][app.kubernetes.io/name]  keys containing dots in brackets
+//	labels.app\.kubernetes\.io/name   or escaped by backslash
+//
+// Backslash escapes the next character, ex: `\.`, `\[`, `\]` and `\\`.
+func compilePath(path string) []pathtoken {
+	tokens := make([]pathtoken, 0, strings.Count(path, ".")+strings.Count(path, "[")+1)
+	var key strings.Builder
+	hasKey := false
+	flush := func() {
+		if hasKey {
+			tokens = append(tokens, pathtoken{key: key.String()})
+			key.Reset()
+			hasKey = false
+		}
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; c {
+		case '\\':
+			if i+1 < len(path) {
+				i++
+			}
+			key.WriteByte(path[i])
+			hasKey = true
+		case '.':
+			flush()
+		case '[':
+			end := closingBracket(path, i+1)
+			if end < 0 {
+				// not a bracket reference, e.g. part of the key
+				key.WriteString(path[i:])
+				hasKey = true
+				i = len(path)
+				break
+			}
+			flush()
+			tokens = append(tokens, bracketToken(path[i+1:end]))
+			i = end
+		default:
+			key.WriteByte(c)
+			hasKey = true
+		}
+	}
+	flush()
+
+	if len(tokens) == 0 {
+		tokens = append(tokens, pathtoken{key: path})
 	}
 	return tokens
 }
 
-func compilePath(path string) []pathtoken {
-	fields := strings.Split(path, ".")
-	tokens := make([]pathtoken, 0, len(fields)+2)
-	for _, field := range fields {
-		atokens := getPathArrayToken(field)
-		if len(atokens) > 0 {
-			tokens = append(tokens, atokens...)
-		} else {
-			tokens = append(tokens, pathtoken{
-				isSlice: false,
-				key:     field,
-			})
+// closingBracket returns the position of the unescaped ']' from start, or -1 if not found
+func closingBracket(path string, start int) int {
+	for i := start; i < len(path); i++ {
+		switch path[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
 		}
 	}
-	return tokens
+	return -1
+}
+
+// bracketToken returns the token of bracket content, integers are array indexes
+func bracketToken(content string) pathtoken {
+	if index, err := strconv.Atoi(content); err == nil {
+		return pathtoken{isSlice: true, index: index}
+	}
+	if !strings.ContainsRune(content, '\\') {
+		return pathtoken{key: content}
+	}
+	var key strings.Builder
+	for i := 0; i < len(content); i++ {
+		if content[i] == '\\' && i+1 < len(content) {
+			i++
+		}
+		key.WriteByte(content[i])
+	}
+	return pathtoken{key: key.String()}
 }
 
 func compilePathWithCache(path string) []pathtoken {
@@ -84,11 +127,28 @@ func compilePathWithCache(path string) []pathtoken {
 	return tokens
 }
 
+// GetPathValue returns the value of path in obj, see compilePath for the path syntax
+func GetPathValue(obj any, path string) (any, bool) {
+	return getPathValue(obj, path)
+}
+
 func getPathValue(obj any, path string) (any, bool) {
 	tokens := compilePathWithCache(path)
 	return getPathValueFromTokens(obj, tokens)
 }
 
+// sliceIndex returns the index of slice with length size, negative index counts from the end
+func sliceIndex(index int, size int) (int, bool) {
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		// array index out of range
+		return 0, false
+	}
+	return index, true
+}
+
 func getPathValueFromTokens(obj any, tokens []pathtoken) (any, bool) {
 	for _, t := range tokens {
 		switch v := obj.(type) {
@@ -107,18 +167,11 @@ func getPathValueFromTokens(obj any, tokens []pathtoken) (any, bool) {
 				// invalid path
 				return nil, false
 			}
-			if t.index < 0 {
-				if -t.index > len(v) {
-					// array index out of range
-					return nil, false
-				}
-				obj = v[len(v)+t.index]
-			} else if t.index >= len(v) {
-				// array index out of range
+			index, ok := sliceIndex(t.index, len(v))
+			if !ok {
 				return nil, false
-			} else {
-				obj = v[t.index]
 			}
+			obj = v[index]
 		default:
 			s := reflect.ValueOf(obj)
 			if s.Kind() == reflect.Slice {
@@ -126,18 +179,11 @@ func getPathValueFromTokens(obj any, tokens []pathtoken) (any, bool) {
 					// invalid path
 					return nil, false
 				}
-				if t.index < 0 {
-					if -t.index > s.Len() {
-						// array index out of range
-						return nil, false
-					}
-					obj = s.Index(s.Len() + t.index).Interface()
-				} else if t.index >= s.Len() {
-					// array index out of range
+				index, ok := sliceIndex(t.index, s.Len())
+				if !ok {
 					return nil, false
-				} else {
-					obj = s.Index(t.index).Interface()
 				}
+				obj = s.Index(index).Interface()
 			} else {
 				// TODO: reflect struct
 				return nil, false
@@ -148,45 +194,166 @@ func getPathValueFromTokens(obj any, tokens []pathtoken) (any, bool) {
 }
 
 func setPathValue(obj map[string]any, path string, v any) bool {
-	fieldSplits := strings.Split(path, ".")
-	for i, key := range fieldSplits {
-		if i >= len(fieldSplits)-1 {
-			obj[key] = v
-			return true
-		} else if node, ok := obj[key]; ok {
-			switch v := node.(type) {
-			case map[string]any:
-				obj = v
-			case nil:
-				obj[key] = map[string]any{}
-				obj = obj[key].(map[string]any)
-			default:
+	return setPathValueFromTokens(obj, compilePathWithCache(path), v)
+}
+
+// setPathValueFromTokens sets v to the path of tokens, missing or nil objects are created as maps,
+// array elements can be replaced but not appended, obj is not changed if failed
+func setPathValueFromTokens(obj map[string]any, tokens []pathtoken, v any) bool {
+	if !canSetPath(obj, tokens) {
+		return false
+	}
+	var node any = obj
+	for i, t := range tokens {
+		last := i == len(tokens)-1
+		switch n := node.(type) {
+		case map[string]any:
+			if t.isSlice {
+				// invalid path
 				return false
 			}
-		} else {
-			obj[key] = map[string]any{}
-			obj = obj[key].(map[string]any)
+			if last {
+				n[t.key] = v
+				return true
+			}
+			if node = n[t.key]; node == nil {
+				node = map[string]any{}
+				n[t.key] = node
+			}
+		case []any:
+			if !t.isSlice {
+				// invalid path
+				return false
+			}
+			index, ok := sliceIndex(t.index, len(n))
+			if !ok {
+				return false
+			}
+			if last {
+				n[index] = v
+				return true
+			}
+			if node = n[index]; node == nil {
+				node = map[string]any{}
+				n[index] = node
+			}
+		default:
+			return false
 		}
 	}
 	return false
 }
 
-func removePathValue(obj map[string]any, field string) bool {
-	fieldSplits := strings.Split(field, ".")
-	for i, key := range fieldSplits {
-		if i >= len(fieldSplits)-1 {
-			delete(obj, key)
-			return true
-		} else if node, ok := obj[key]; ok {
-			switch v := node.(type) {
-			case map[string]any:
-				obj = v
-			default:
+// canSetPath returns true if setPathValueFromTokens can set the path of tokens in obj
+func canSetPath(obj map[string]any, tokens []pathtoken) bool {
+	var node any = obj
+	for _, t := range tokens {
+		switch n := node.(type) {
+		case nil:
+			// missing objects are created as maps
+			if t.isSlice {
+				return false
+			}
+		case map[string]any:
+			if t.isSlice {
+				return false
+			}
+			node = n[t.key]
+		case []any:
+			if !t.isSlice {
 				return false
 			}
+			index, ok := sliceIndex(t.index, len(n))
+			if !ok {
+				return false
+			}
+			node = n[index]
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func removePathValue(obj map[string]any, path string) bool {
+	return removePathValueFromTokens(obj, compilePathWithCache(path), false)
+}
+
+// removePathValueFromTokens removes the value of the path of tokens,
+// maps and arrays along the path are copied before modified if copyOnWrite,
+// so that objects shared with others are not changed
+func removePathValueFromTokens(obj map[string]any, tokens []pathtoken, copyOnWrite bool) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	t := tokens[0]
+	if t.isSlice {
+		// invalid path
+		return false
+	}
+	if len(tokens) == 1 {
+		delete(obj, t.key)
+		return true
+	}
+	child, ok := removePathValueFromNode(obj[t.key], tokens[1:], copyOnWrite)
+	if ok {
+		obj[t.key] = child
+	}
+	return ok
+}
+
+// removePathValueFromNode returns node with the path of tokens removed
+func removePathValueFromNode(node any, tokens []pathtoken, copyOnWrite bool) (any, bool) {
+	t := tokens[0]
+	switch n := node.(type) {
+	case map[string]any:
+		if t.isSlice {
+			// invalid path
+			return node, false
+		}
+		child, ok := n[t.key]
+		if !ok {
+			return node, len(tokens) == 1
+		}
+		if len(tokens) > 1 {
+			if child, ok = removePathValueFromNode(child, tokens[1:], copyOnWrite); !ok {
+				return node, false
+			}
+		}
+		if copyOnWrite {
+			n = maps.Clone(n)
+		}
+		if len(tokens) == 1 {
+			delete(n, t.key)
 		} else {
-			break
+			n[t.key] = child
+		}
+		return n, true
+	case []any:
+		if !t.isSlice {
+			// invalid path
+			return node, false
 		}
+		index, ok := sliceIndex(t.index, len(n))
+		if !ok {
+			return node, false
+		}
+		if len(tokens) == 1 {
+			// always a new array, the removed element is not kept in the backing array
+			removed := make([]any, 0, len(n)-1)
+			removed = append(removed, n[:index]...)
+			return append(removed, n[index+1:]...), true
+		}
+		child, ok := removePathValueFromNode(n[index], tokens[1:], copyOnWrite)
+		if !ok {
+			return node, false
+		}
+		if copyOnWrite {
+			n = slices.Clone(n)
+		}
+		n[index] = child
+		return n, true
+	default:
+		return node, false
 	}
-	return false
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func BenchmarkCompilePath(b *testing.B) {
@@ -60,6 +61,47 @@ func TestCompilePath(t *testing.T) {
 	}, tokens)
 }
 
+func TestCompilePathBracket(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	require.Equal([]pathtoken{
+		{isSlice: false, key: "a"},
+		{isSlice: false, key: "b"},
+		{isSlice: true, index: 0},
+		{isSlice: false, key: "c"},
+	}, compilePath("[a][b][0][c]"))
+
+	require.Equal([]pathtoken{
+		{isSlice: false, key: "labels"},
+		{isSlice: false, key: "app.kubernetes.io/name"},
+	}, compilePath("[labels][app.kubernetes.io/name]"))
+
+	require.Equal([]pathtoken{
+		{isSlice: false, key: "labels"},
+		{isSlice: false, key: "app.kubernetes.io/name"},
+	}, compilePath(`labels.app\.kubernetes\.io/name`))
+
+	require.Equal([]pathtoken{
+		{isSlice: false, key: "a"},
+		{isSlice: true, index: -1},
+		{isSlice: false, key: "b]c"},
+	}, compilePath(`a[-1][b\]c]`))
+
+	require.Equal([]pathtoken{
+		{isSlice: false, key: "a[0"},
+		{isSlice: false, key: `b\`},
+	}, compilePath(`a\[0.b\\`))
+
+	require.Equal([]pathtoken{
+		{isSlice: false, key: "a[b"},
+	}, compilePath("a[b"))
+
+	require.Equal([]pathtoken{
+		{isSlice: false, key: ""},
+	}, compilePath(""))
+}
+
 func TestGetPathValue(t *testing.T) {
 	assert := assert.New(t)
 	assert.NotNil(assert)
@@ -161,3 +203,54 @@ func TestGetPathValue(t *testing.T) {
 	assert.False(ok)
 	assert.Nil(r)
 }
+
+func TestSetPathValue(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	d := map[string]any{
+		"a": []any{"b", nil},
+		"c": "foo",
+	}
+
+	require.True(setPathValue(d, "[x][y.z]", 1))
+	require.True(setPathValue(d, "a[-2]", "B"))
+	require.True(setPathValue(d, "a[1].d", 2))
+	require.False(setPathValue(d, "a[2]", 3))
+	require.False(setPathValue(d, "c.d", 4))
+	require.False(setPathValue(d, "[x][0]", 5))
+	require.Equal(map[string]any{
+		"a": []any{"B", map[string]any{"d": 2}},
+		"c": "foo",
+		"x": map[string]any{"y.z": 1},
+	}, d)
+}
+
+func TestRemovePathValue(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	nested := map[string]any{"b": 1, "c": 2}
+	list := []any{"x", map[string]any{"y": 3}}
+	d := map[string]any{"a": nested, "l": list}
+
+	require.True(removePathValueFromTokens(d, compilePath("[a][b]"), true))
+	require.True(removePathValueFromTokens(d, compilePath("l[-1].y"), true))
+	require.Equal(map[string]any{
+		"a": map[string]any{"c": 2},
+		"l": []any{"x", map[string]any{}},
+	}, d)
+	// shared objects are not changed with copy on write
+	require.Equal(map[string]any{"b": 1, "c": 2}, nested)
+	require.Equal([]any{"x", map[string]any{"y": 3}}, list)
+
+	require.True(removePathValue(d, "l[0]"))
+	require.False(removePathValue(d, "l[1]"))
+	require.False(removePathValue(d, "[a][c][d]"))
+	require.False(removePathValue(d, "[x][y]"))
+	require.True(removePathValue(d, "[a][c]"))
+	require.Equal(map[string]any{
+		"a": map[string]any{},
+		"l": []any{map[string]any{}},
+	}, d)
+}
@@ -0,0 +1,309 @@
+package logevent
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/tsaikd/KDGoLib/errutil"
+)
+
+// errors
+var (
+	ErrorUnknownTemplateFilter1 = errutil.NewFactory("unknown template filter %q")
+	ErrorInvalidTemplateFilter2 = errutil.NewFactory("invalid argument of template filter %q: %q")
+	ErrorMissingTemplateField1  = errutil.NewFactory("field %q of template not found")
+)
+
+// templateFilter converts the value of a template field
+type templateFilter func(value any) (any, error)
+
+// templateFilters are filters of template fields, ex: %{user|lowercase}, created with the argument after ':'
+var templateFilters = map[string]func(arg string) (templateFilter, error){
+	"lowercase": func(arg string) (templateFilter, error) {
+		return func(value any) (any, error) {
+			return strings.ToLower(toString(value)), nil
+		}, nil
+	},
+	"uppercase": func(arg string) (templateFilter, error) {
+		return func(value any) (any, error) {
+			return strings.ToUpper(toString(value)), nil
+		}, nil
+	},
+	"json": func(arg string) (templateFilter, error) {
+		return func(value any) (any, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		}, nil
+	},
+	"urlencode": func(arg string) (templateFilter, error) {
+		return func(value any) (any, error) {
+			return url.QueryEscape(toString(value)), nil
+		}, nil
+	},
+	"truncate": func(arg string) (templateFilter, error) {
+		size, err := strconv.Atoi(arg)
+		if err != nil || size < 0 {
+			return nil, ErrorInvalidTemplateFilter2.New(err, "truncate", arg)
+		}
+		return func(value any) (any, error) {
+			runes := []rune(toString(value))
+			if len(runes) > size {
+				runes = runes[:size]
+			}
+			return string(runes), nil
+		}, nil
+	},
+	"hash": func(arg string) (templateFilter, error) {
+		var newHash func() hash.Hash
+		switch arg {
+		case "", "sha256":
+			newHash = sha256.New
+		case "sha1":
+			newHash = sha1.New
+		case "sha512":
+			newHash = sha512.New
+		case "md5":
+			newHash = md5.New
+		default:
+			return nil, ErrorInvalidTemplateFilter2.New(nil, "hash", arg)
+		}
+		return func(value any) (any, error) {
+			h := newHash()
+			_, _ = h.Write([]byte(toString(value)))
+			return hex.EncodeToString(h.Sum(nil)), nil
+		}, nil
+	},
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+type templatePartKind int
+
+const (
+	templateText templatePartKind = iota
+	templateField
+	templateEventTime
+	templateCurrentTime
+)
+
+type templatePart struct {
+	kind       templatePartKind
+	text       string // text, or the placeholder of field kept if not found
+	field      string
+	filters    []templateFilter
+	fallback   string
+	hasDefault bool
+}
+
+// Template is a precompiled format of event, placeholders are:
+//
+//	%{field}            value of field, nested fields and array elements, ex: %{nginx.status}, %{tags[0]}
+//	%{field:-default}   default value if the field not found
+//	%{field|filter}     filters applied to the value in order, ex: %{user|lowercase|truncate:8}
+//	%{+layout}          current time, ex: %{+2006.01.02}
+//	%{+@layout}         event time, ex: %{+@2006.01.02}
+//
+// Filters: lowercase, uppercase, json, urlencode, truncate:N, hash[:sha256|sha1|sha512|md5].
+// Fields not found are formatted by environment variables, ex: %{HOSTNAME}.
+type Template struct {
+	format string
+	parts  []templatePart
+}
+
+// NewTemplate compiles format into Template, returns error if any filter invalid
+func NewTemplate(format string) (*Template, error) {
+	return compileTemplate(format, true)
+}
+
+// compileTemplate compiles format, invalid placeholders are kept as text if not strict
+func compileTemplate(format string, strict bool) (*Template, error) {
+	tmpl := &Template{format: format}
+	text := format
+	for {
+		start := strings.Index(text, "%{")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		tmpl.addText(text[:start])
+		part, err := compilePlaceholder(text[start:end+1], text[start+2:end])
+		if err != nil {
+			if strict {
+				return nil, err
+			}
+			part = templatePart{kind: templateText, text: text[start : end+1]}
+		}
+		tmpl.parts = append(tmpl.parts, part)
+		text = text[end+1:]
+	}
+	tmpl.addText(text)
+	return tmpl, nil
+}
+
+func (t *Template) addText(text string) {
+	if text != "" {
+		t.parts = append(t.parts, templatePart{kind: templateText, text: text})
+	}
+}
+
+func compilePlaceholder(placeholder string, spec string) (part templatePart, err error) {
+	part.text = placeholder
+	if layout, ok := strings.CutPrefix(spec, "+@"); ok {
+		part.kind = templateEventTime
+		part.field = layout
+		return part, nil
+	}
+	if layout, ok := strings.CutPrefix(spec, "+"); ok {
+		part.kind = templateCurrentTime
+		part.field = layout
+		return part, nil
+	}
+
+	part.kind = templateField
+	if i := strings.Index(spec, ":-"); i >= 0 {
+		part.fallback = spec[i+2:]
+		part.hasDefault = true
+		spec = spec[:i]
+	}
+	names := strings.Split(spec, "|")
+	part.field = strings.TrimSpace(names[0])
+	for _, name := range names[1:] {
+		name, arg, _ := strings.Cut(strings.TrimSpace(name), ":")
+		newFilter, ok := templateFilters[name]
+		if !ok {
+			return part, ErrorUnknownTemplateFilter1.New(nil, name)
+		}
+		filter, err := newFilter(arg)
+		if err != nil {
+			return part, err
+		}
+		part.filters = append(part.filters, filter)
+	}
+	return part, nil
+}
+
+// String returns the format of template
+func (t *Template) String() string {
+	return t.format
+}
+
+// Format returns the template formatted by event, placeholders of fields not found are kept
+func (t *Template) Format(event LogEvent) string {
+	out, _ := t.Execute(event, false)
+	return out
+}
+
+// FormatStrict returns the template formatted by event, or error if any field not found
+func (t *Template) FormatStrict(event LogEvent) (string, error) {
+	return t.Execute(event, true)
+}
+
+// Execute returns the template formatted by event, like FormatStrict if strict, or Format otherwise,
+// used by plugins with the strict_format option
+func (t *Template) Execute(event LogEvent, strict bool) (string, error) {
+	if len(t.parts) == 1 && t.parts[0].kind == templateText {
+		return t.parts[0].text, nil
+	}
+	var buf strings.Builder
+	for _, part := range t.parts {
+		switch part.kind {
+		case templateText:
+			buf.WriteString(part.text)
+		case templateEventTime:
+			buf.WriteString(event.Timestamp.Format(part.field))
+		case templateCurrentTime:
+			buf.WriteString(time.Now().Format(part.field))
+		case templateField:
+			value, err := part.value(event)
+			if err != nil {
+				if strict {
+					return "", err
+				}
+				value = part.text
+			}
+			buf.WriteString(value)
+		}
+	}
+	return buf.String(), nil
+}
+
+func (t templatePart) value(event LogEvent) (string, error) {
+	value, ok := templateFieldValue(event, t.field)
+	if !ok {
+		if t.hasDefault {
+			return t.fallback, nil
+		}
+		if env := FormatWithEnv(t.text); env != t.text {
+			return env, nil
+		}
+		return "", ErrorMissingTemplateField1.New(nil, t.field)
+	}
+	var err error
+	for _, filter := range t.filters {
+		if value, err = filter(value); err != nil {
+			return "", err
+		}
+	}
+	return toString(value), nil
+}
+
+// templateFieldValue returns the value of field, empty strings are treated as not found
+func templateFieldValue(event LogEvent, field string) (value any, ok bool) {
+	switch name := fieldName(field); {
+	case name == TimestampField:
+		return event.Timestamp.UTC().Format(timeFormat), true
+	case name == MessageField:
+		return event.Message, event.Message != ""
+	case name == TagsField:
+		return event.Tags, len(event.Tags) > 0
+	default:
+		value, ok = event.GetValue(field)
+	}
+	if s, isString := value.(string); isString && s == "" {
+		return nil, false
+	}
+	return value, ok && value != nil
+}
+
+const templateCacheSize = 200
+
+var templateCache *lru.Cache
+
+func init() {
+	var err error
+	if templateCache, err = lru.New(templateCacheSize); err != nil {
+		panic(err)
+	}
+}
+
+// getTemplate returns the compiled template of format from cache, invalid placeholders are kept as text
+func getTemplate(format string) *Template {
+	if cached, ok := templateCache.Get(format); ok {
+		return cached.(*Template)
+	}
+	tmpl, _ := compileTemplate(format, false)
+	templateCache.Add(format, tmpl)
+	return tmpl
+}
@@ -0,0 +1,261 @@
+package logstash
+
+import (
+	"strings"
+)
+
+// parseCondition parses the condition of `if` into the expression of gogstash condition
+func (p *parser) parseCondition() (string, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (string, error) {
+	left, err := p.parseXor()
+	if err != nil {
+		return "", err
+	}
+	for p.acceptWord("or") {
+		right, err := p.parseXor()
+		if err != nil {
+			return "", err
+		}
+		left = left + " || " + right
+	}
+	return left, nil
+}
+
+func (p *parser) parseXor() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.acceptWord("xor") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + ") != (" + right + ")"
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (string, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return "", err
+	}
+	for {
+		switch {
+		case p.acceptWord("and"):
+			right, err := p.parseNot()
+			if err != nil {
+				return "", err
+			}
+			left = left + " && " + right
+		case p.acceptWord("nand"):
+			right, err := p.parseNot()
+			if err != nil {
+				return "", err
+			}
+			left = "!(" + left + " && " + right + ")"
+		default:
+			return left, nil
+		}
+	}
+}
+
+func (p *parser) parseNot() (string, error) {
+	p.skipSpace()
+	if p.peek() == '!' && !p.hasPrefix("!=") && !p.hasPrefix("!~") {
+		p.pos++
+		expr, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		return "!(" + expr + ")", nil
+	}
+	if p.accept("(") {
+		expr, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if err = p.expect(")"); err != nil {
+			return "", err
+		}
+		return "(" + expr + ")", nil
+	}
+	return p.parseComparison()
+}
+
+// comparison operators, the same in gogstash condition
+var comparators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseComparison parses `rvalue op rvalue`, `rvalue =~ /regexp/`, `rvalue [not] in rvalue`,
+// or a single rvalue which is true if the field exists
+func (p *parser) parseComparison() (string, error) {
+	left, isField, err := p.parseRValue()
+	if err != nil {
+		return "", err
+	}
+
+	p.skipSpace()
+	for _, op := range []string{"=~", "!~"} {
+		if p.accept(op) {
+			regexp, err := p.parseRegexp()
+			if err != nil {
+				return "", err
+			}
+			return left + " " + op + " " + quote(regexp), nil
+		}
+	}
+	for _, op := range comparators {
+		if p.accept(op) {
+			right, _, err := p.parseRValue()
+			if err != nil {
+				return "", err
+			}
+			return left + " " + op + " " + right, nil
+		}
+	}
+	not := p.acceptWord("not")
+	if p.acceptWord("in") {
+		right, err := p.parseCollection()
+		if err != nil {
+			return "", err
+		}
+		expr := left + " IN " + right
+		if not {
+			expr = "!(" + expr + ")"
+		}
+		return expr, nil
+	} else if not {
+		return "", p.errorf("expect \"in\"")
+	}
+
+	if !isField {
+		return "", p.errorf("expect comparison operator")
+	}
+	return "!empty(" + left + ")", nil
+}
+
+// parseRValue parses a string, number or field reference
+func (p *parser) parseRValue() (expr string, isField bool, err error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		s, err := p.parseString()
+		return quote(s), false, err
+	case c == '[':
+		field, err := p.parseFieldReference()
+		return field, true, err
+	case c == '-' || ('0' <= c && c <= '9'):
+		number, err := p.parseBareword()
+		return number, false, err
+	default:
+		return "", false, p.errorf("expect string, number or field reference")
+	}
+}
+
+// parseCollection parses the right side of `in`, a list of values or a field reference
+func (p *parser) parseCollection() (string, error) {
+	p.skipSpace()
+	if !p.isListStart() {
+		field, err := p.parseFieldReference()
+		if err != nil {
+			return "", err
+		}
+		return "map(" + field + ")", nil
+	}
+
+	p.pos++
+	values := []string{}
+	for !p.accept("]") {
+		if len(values) > 0 {
+			if err := p.expect(","); err != nil {
+				return "", err
+			}
+		}
+		value, _, err := p.parseRValue()
+		if err != nil {
+			return "", err
+		}
+		values = append(values, value)
+	}
+	return "(" + strings.Join(values, ", ") + ")", nil
+}
+
+// isListStart returns true if the next `[` begins a list of values instead of a field reference
+func (p *parser) isListStart() bool {
+	if p.peek() != '[' {
+		return false
+	}
+	for i := p.pos + 1; i < len(p.data); i++ {
+		switch c := p.data[i]; {
+		case c == ' ' || c == '\t':
+			continue
+		case c == '"' || c == '\'' || c == ']' || c == '-' || ('0' <= c && c <= '9'):
+			return true
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// parseFieldReference parses `[a][b]` into the gogstash condition parameter `[a.b]`,
+// dots in names are escaped, ex: `[labels][app.name]` into `[labels.app\\.name]`
+func (p *parser) parseFieldReference() (string, error) {
+	p.skipSpace()
+	var names []string
+	for p.peek() == '[' {
+		end := strings.IndexByte(string(p.data[p.pos:]), ']')
+		if end < 0 {
+			return "", p.errorf("unterminated field reference")
+		}
+		name := strings.TrimSpace(string(p.data[p.pos+1 : p.pos+end]))
+		if name == "" || strings.ContainsAny(name, "[\n") {
+			return "", p.errorf("invalid field reference")
+		}
+		names = append(names, fieldNameEscaper.Replace(name))
+		p.pos += end + 1
+	}
+	if len(names) < 1 {
+		return "", p.errorf("expect field reference")
+	}
+	return "[" + strings.Join(names, ".") + "]", nil
+}
+
+// fieldNameEscaper escapes names of field paths, then escapes backslashes again for condition parameters
+var fieldNameEscaper = strings.NewReplacer(`\`, `\\\\`, `.`, `\\.`)
+
+// parseRegexp parses `/regexp/` or a quoted string
+func (p *parser) parseRegexp() (string, error) {
+	p.skipSpace()
+	if p.peek() != '/' {
+		return p.parseString()
+	}
+	p.pos++
+	var buf strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == '\\' && p.pos+1 < len(p.data) && p.data[p.pos+1] == '/':
+			buf.WriteByte('/')
+			p.pos += 2
+		case c == '/':
+			p.pos++
+			return buf.String(), nil
+		default:
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated regexp")
+}
+
+// quote returns s as a string literal of gogstash condition, which escapes characters by backslash
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `'`, `\'`)
+	return "'" + s + "'"
+}
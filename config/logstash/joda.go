@@ -0,0 +1,115 @@
+package logstash
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// jodaLayouts are Go layouts of Joda-Time pattern letters by count, the last one is used for longer counts
+var jodaLayouts = map[byte][]string{
+	'y': {"2006", "06", "2006"},
+	'Y': {"2006", "06", "2006"},
+	'M': {"1", "01", "Jan", "January"},
+	'd': {"2", "02"},
+	'D': {"002"},
+	'H': {"15"},
+	'h': {"3", "03"},
+	'm': {"4", "04"},
+	's': {"5", "05"},
+	'a': {"PM"},
+	'E': {"Mon", "Mon", "Mon", "Monday"},
+	'Z': {"-0700", "-07:00"},
+	'z': {"MST"},
+}
+
+// jodaLayout converts a Joda-Time pattern used by logstash into a Go time layout
+func jodaLayout(pattern string) (layout string, err error) {
+	var buf strings.Builder
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+		switch {
+		case c == '\'':
+			// quoted literal text, '' is a single quote
+			var text strings.Builder
+			j, closed := i+1, false
+			for j < len(pattern) {
+				if pattern[j] == '\'' {
+					if j+1 < len(pattern) && pattern[j+1] == '\'' {
+						text.WriteByte('\'')
+						j += 2
+						continue
+					}
+					closed = true
+					break
+				}
+				text.WriteByte(pattern[j])
+				j++
+			}
+			if !closed {
+				return "", ErrorDatePattern2.New(nil, pattern, "unterminated quote")
+			}
+			if j == i+1 {
+				text.WriteByte('\'')
+			}
+			if err = writeLiteral(&buf, text.String(), pattern); err != nil {
+				return "", err
+			}
+			i = j + 1
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+			count := 1
+			for i+count < len(pattern) && pattern[i+count] == c {
+				count++
+			}
+			if c == 'S' {
+				// fraction of second must follow a dot or comma in Go layout
+				prev := buf.String()
+				if !strings.HasSuffix(prev, ".") && !strings.HasSuffix(prev, ",") {
+					return "", ErrorDatePattern2.New(nil, pattern, "fraction of second must follow '.' or ','")
+				}
+				buf.WriteString(strings.Repeat("0", count))
+			} else {
+				layouts, ok := jodaLayouts[c]
+				if !ok || (c == 'Z' && count > len(layouts)) {
+					return "", ErrorDatePattern2.New(nil, pattern, fmt.Sprintf("unsupported %q", strings.Repeat(string(c), count)))
+				}
+				buf.WriteString(layouts[min(count, len(layouts))-1])
+			}
+			i += count
+		default:
+			if err = writeLiteral(&buf, string(c), pattern); err != nil {
+				return "", err
+			}
+			i++
+		}
+	}
+	return buf.String(), nil
+}
+
+// writeLiteral writes literal text of a date pattern, digits are layout elements in Go
+func writeLiteral(buf *strings.Builder, text string, pattern string) error {
+	if strings.ContainsAny(text, "0123456789") {
+		return ErrorDatePattern2.New(nil, pattern, fmt.Sprintf("literal %q is ambiguous in Go layout", text))
+	}
+	buf.WriteString(text)
+	return nil
+}
+
+var sprintfTimeRegexp = regexp.MustCompile(`%\{\+([^}]*)\}`)
+
+// convertSprintfTime converts `%{+joda}` of logstash sprintf format, which formats the event
+// timestamp, into `%{+@layout}` of gogstash templates
+func convertSprintfTime(value string) (string, error) {
+	var err error
+	converted := sprintfTimeRegexp.ReplaceAllStringFunc(value, func(match string) string {
+		if err != nil {
+			return match
+		}
+		var layout string
+		if layout, err = jodaLayout(sprintfTimeRegexp.FindStringSubmatch(match)[1]); err != nil {
+			return match
+		}
+		return "%{+@" + layout + "}"
+	})
+	return converted, err
+}
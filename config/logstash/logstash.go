@@ -0,0 +1,391 @@
+package logstash
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+	"gopkg.in/yaml.v2"
+)
+
+// errors
+var (
+	ErrorParse3      = errutil.NewFactory("line %d column %d: %s")
+	ErrorMarshalYAML = errutil.NewFactory("marshal converted config to YAML failed")
+
+	ErrorDatePattern2 = errutil.NewFactory("date pattern %q: %s")
+)
+
+// sections of logstash config, in the order of gogstash config
+var sections = []string{"input", "filter", "output"}
+
+// Parse parses the logstash config DSL into gogstash config, plugins are converted to
+// `type` and their settings, conditionals of filter and output sections are converted
+// to `cond` filters and outputs.
+func Parse(data []byte) (config yaml.MapSlice, err error) {
+	p := &parser{data: data}
+	plugins := map[string][]any{}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		section, err := p.parseBareword()
+		if err != nil {
+			return nil, err
+		}
+		if !contains(sections, section) {
+			return nil, p.errorf("unknown section %q, expect one of %v", section, sections)
+		}
+		if err = p.expect("{"); err != nil {
+			return nil, err
+		}
+		list, err := p.parsePlugins(section)
+		if err != nil {
+			return nil, err
+		}
+		plugins[section] = append(plugins[section], list...)
+	}
+
+	for _, section := range sections {
+		if list, ok := plugins[section]; ok {
+			config = append(config, yaml.MapItem{Key: section, Value: list})
+		}
+	}
+	return config, nil
+}
+
+// ToYAML converts the logstash config DSL into gogstash config in YAML format
+func ToYAML(data []byte) ([]byte, error) {
+	config, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = yaml.Marshal(config); err != nil {
+		return nil, ErrorMarshalYAML.New(err)
+	}
+	return data, nil
+}
+
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return bytes.HasPrefix(p.data[p.pos:], []byte(s))
+}
+
+// errorf returns a parse error at the current position
+func (p *parser) errorf(format string, args ...any) error {
+	return p.errorAt(p.pos, nil, format, args...)
+}
+
+// errorAt returns a parse error at pos caused by parent
+func (p *parser) errorAt(pos int, parent error, format string, args ...any) error {
+	line := bytes.Count(p.data[:pos], []byte("\n")) + 1
+	column := pos - bytes.LastIndexByte(p.data[:pos], '\n')
+	return ErrorParse3.New(parent, line, column, fmt.Sprintf(format, args...))
+}
+
+// skipSpace skips whitespaces and comments
+func (p *parser) skipSpace() {
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == '#':
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		case unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) expect(token string) error {
+	p.skipSpace()
+	if !p.hasPrefix(token) {
+		return p.errorf("expect %q", token)
+	}
+	p.pos += len(token)
+	return nil
+}
+
+// accept consumes token if it is next
+func (p *parser) accept(token string) bool {
+	p.skipSpace()
+	if p.hasPrefix(token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+// acceptWord consumes the bareword if it is next
+func (p *parser) acceptWord(word string) bool {
+	p.skipSpace()
+	pos := p.pos
+	if s, err := p.parseBareword(); err == nil && s == word {
+		return true
+	}
+	p.pos = pos
+	return false
+}
+
+func isBarewordChar(c byte) bool {
+	return c == '_' || c == '-' || c == '.' || c == '@' ||
+		('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func (p *parser) parseBareword() (string, error) {
+	p.skipSpace()
+	start := p.pos
+	for !p.eof() && isBarewordChar(p.peek()) {
+		p.pos++
+	}
+	if start == p.pos {
+		return "", p.errorf("expect name")
+	}
+	return string(p.data[start:p.pos]), nil
+}
+
+// parseString parses a quoted string, only the quote character can be escaped
+func (p *parser) parseString() (string, error) {
+	p.skipSpace()
+	quote := p.peek()
+	if quote != '"' && quote != '\'' {
+		return "", p.errorf("expect string")
+	}
+	p.pos++
+	var buf strings.Builder
+	for !p.eof() {
+		c := p.peek()
+		switch {
+		case c == '\\' && p.pos+1 < len(p.data) && p.data[p.pos+1] == quote:
+			buf.WriteByte(quote)
+			p.pos += 2
+		case c == quote:
+			p.pos++
+			return buf.String(), nil
+		default:
+			buf.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parsePlugins parses plugins and conditionals until the closing brace of section
+func (p *parser) parsePlugins(section string) (plugins []any, err error) {
+	for {
+		if p.accept("}") {
+			return plugins, nil
+		}
+		if p.eof() {
+			return nil, p.errorf("expect \"}\"")
+		}
+		p.skipSpace()
+		pos := p.pos
+		name, err := p.parseBareword()
+		if err != nil {
+			return nil, err
+		}
+		var plugin yaml.MapSlice
+		if name == "if" {
+			plugin, err = p.parseConditional(section)
+		} else {
+			plugin, err = p.parsePlugin(section, name, pos)
+		}
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, plugin)
+	}
+}
+
+// parsePlugin parses settings of plugin as `key => value`, then converts it into
+// the gogstash plugin, pos is the position of the plugin name for conversion errors
+func (p *parser) parsePlugin(section string, name string, pos int) (plugin yaml.MapSlice, err error) {
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+	var settings yaml.MapSlice
+	for !p.accept("}") {
+		var key string
+		if c := p.peek(); c == '"' || c == '\'' {
+			key, err = p.parseString()
+		} else {
+			key, err = p.parseBareword()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("=>"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, yaml.MapItem{Key: key, Value: value})
+	}
+	if plugin, err = convertPlugin(section, name, settings); err != nil {
+		return nil, p.errorAt(pos, err, "convert %s plugin %q failed", section, name)
+	}
+	return plugin, nil
+}
+
+// parseConditional parses `if cond {} else if cond {} else {}` after `if` into a cond plugin
+func (p *parser) parseConditional(section string) (plugin yaml.MapSlice, err error) {
+	if section == "input" {
+		return nil, p.errorf("conditionals are not supported in %s section", section)
+	}
+	condition, err := p.parseCondition()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+	plugins, err := p.parsePlugins(section)
+	if err != nil {
+		return nil, err
+	}
+	plugin = yaml.MapSlice{
+		{Key: "type", Value: "cond"},
+		{Key: "condition", Value: condition},
+		{Key: section, Value: plugins},
+	}
+
+	if !p.acceptWord("else") {
+		return plugin, nil
+	}
+	var elsePlugins []any
+	if p.acceptWord("if") {
+		elif, err := p.parseConditional(section)
+		if err != nil {
+			return nil, err
+		}
+		elsePlugins = []any{elif}
+	} else {
+		if err = p.expect("{"); err != nil {
+			return nil, err
+		}
+		if elsePlugins, err = p.parsePlugins(section); err != nil {
+			return nil, err
+		}
+	}
+	return append(plugin, yaml.MapItem{Key: "else_" + section, Value: elsePlugins}), nil
+}
+
+// parseValue parses a string, number, bareword, array or hash
+func (p *parser) parseValue() (any, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.parseString()
+	case c == '[':
+		return p.parseArray()
+	case c == '{':
+		return p.parseHash()
+	case c == '-' || ('0' <= c && c <= '9'):
+		return p.parseNumber()
+	default:
+		word, err := p.parseBareword()
+		if err != nil {
+			return nil, err
+		}
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return word, nil
+	}
+}
+
+// parseNumber parses a number, or a bareword beginning with digits, ex: 10s
+func (p *parser) parseNumber() (any, error) {
+	word, err := p.parseBareword()
+	if err != nil {
+		return nil, err
+	}
+	if i, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, nil
+	}
+	return word, nil
+}
+
+func (p *parser) parseArray() (list []any, err error) {
+	if err = p.expect("["); err != nil {
+		return nil, err
+	}
+	list = []any{}
+	for !p.accept("]") {
+		if len(list) > 0 {
+			if err = p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// parseHash parses `{ key => value }`, entries are separated by spaces or commas
+func (p *parser) parseHash() (hash yaml.MapSlice, err error) {
+	if err = p.expect("{"); err != nil {
+		return nil, err
+	}
+	hash = yaml.MapSlice{}
+	for !p.accept("}") {
+		key, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("=>"); err != nil {
+			return nil, err
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		hash = append(hash, yaml.MapItem{Key: key, Value: value})
+		p.accept(",")
+	}
+	return hash, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
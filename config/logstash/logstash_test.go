@@ -0,0 +1,148 @@
+package logstash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/condition"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func Test_ToYAML(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	data, err := ToYAML([]byte(`
+# nginx access logs
+input {
+  file {
+    path => ["/var/log/nginx/access.log"]
+    codec => json
+    start_position => "beginning"
+  }
+}
+
+filter {
+  if [type] == "nginx" and "error" not in [tags] {
+    grok { match => { "message" => "%{IP:client} \"%{WORD:method}\"" } }
+  } else if [status] >= 500 or [path] =~ /^\/api\/v[0-9]/ {
+    add_field { key => 'level' value => 'it\'s error' }
+  } else {
+    drop {}
+  }
+  if ![user] or [level] in ["debug", "trace"] {
+    drop {}
+  }
+}
+
+output {
+  if [@metadata][index] {
+    elasticsearch { hosts => ["127.0.0.1:9200"] index => "logs-%{+YYYY.MM.dd}" bulk_actions => 1000 }
+  }
+  stdout { codec => json }
+}
+`))
+	require.NoError(err)
+	require.Equal(strings.TrimLeft(`
+input:
+- type: file
+  path: /var/log/nginx/access.log
+  codec: json
+  start_position: beginning
+filter:
+- type: cond
+  condition: '[type] == ''nginx'' && !(''error'' IN map([tags]))'
+  filter:
+  - type: grok
+    match:
+    - '%{IP:client} "%{WORD:method}"'
+    source: message
+  else_filter:
+  - type: cond
+    condition: '[status] >= 500 || [path] =~ ''^/api/v[0-9]'''
+    filter:
+    - type: add_field
+      key: level
+      value: it's error
+    else_filter:
+    - type: drop
+- type: cond
+  condition: '!(!empty([user])) || [level] IN (''debug'', ''trace'')'
+  filter:
+  - type: drop
+output:
+- type: cond
+  condition: '!empty([@metadata.index])'
+  output:
+  - type: elastic
+    url:
+    - http://127.0.0.1:9200
+    index: logs-%{+@2006.01.02}
+    bulk_actions: 1000
+- type: stdout
+  codec: json
+`, "\n"), string(data))
+}
+
+func Test_Parse_error(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	_, err := Parse([]byte("input {\n  if [a] { stdin {} }\n}"))
+	require.True(ErrorParse3.In(err))
+	require.Contains(err.Error(), "line 2 column 5")
+
+	_, err = Parse([]byte("filter {\n  mutate { add_tag => [\"a\" }\n}"))
+	require.True(ErrorParse3.In(err))
+	require.Contains(err.Error(), "line 2")
+
+	_, err = Parse([]byte("codec {}"))
+	require.True(ErrorParse3.In(err))
+
+	_, err = Parse([]byte("filter { if \"a\" { drop {} } }"))
+	require.True(ErrorParse3.In(err))
+}
+
+func Test_parseCondition(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	event := logevent.LogEvent{
+		Tags: []string{"error"},
+		Extra: map[string]any{
+			"type":   "nginx",
+			"status": 502,
+			"path":   "/api/v1/users",
+			"nginx":  map[string]any{"method": "GET"},
+			"labels": map[string]any{"app.kubernetes.io/name": "web"},
+		},
+		Metadata: map[string]any{"index": "logs"},
+	}
+	for expression, expected := range map[string]bool{
+		`[type] == "nginx"`:                         true,
+		`[type] != 'nginx'`:                         false,
+		`[status] >= 500 and [status] < 600`:        true,
+		`[path] =~ /^\/api\/v[0-9]/`:                true,
+		`[path] !~ /^\/api/`:                        false,
+		`"error" in [tags]`:                         true,
+		`"error" not in [tags]`:                     false,
+		`[nginx][method] in ["GET", "HEAD"]`:        true,
+		`[@metadata][index]`:                        true,
+		`[labels][app.kubernetes.io/name] == "web"`: true,
+		`![user]`: true,
+		`[user] or ([type] == "nginx" xor [status])`: false,
+		`[type] == "nginx" nand [status] == 502`:     false,
+	} {
+		p := &parser{data: []byte(expression)}
+		expr, err := p.parseCondition()
+		require.NoError(err, expression)
+		require.True(p.eof(), expression)
+		cond, err := condition.New(expr)
+		require.NoError(err, expr)
+		matched, err := cond.Match(event)
+		require.NoError(err, expr)
+		require.Equal(expected, matched, "%s => %s", expression, expr)
+	}
+}
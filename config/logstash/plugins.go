@@ -0,0 +1,515 @@
+package logstash
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+	"gopkg.in/yaml.v2"
+)
+
+// errors
+var (
+	ErrorPluginNotSupported   = errutil.NewFactory("no gogstash plugin supports it")
+	ErrorPluginNotRegistered1 = errutil.NewFactory("gogstash plugin %q is not registered")
+	ErrorSetting2             = errutil.NewFactory("setting %q: %s")
+)
+
+// Registered reports whether the gogstash plugin name of section is registered, section is one
+// of input, filter, output and codec. It is set by package config, plugins are not checked if nil.
+var Registered func(section string, name string) bool
+
+// pluginMapping maps a logstash plugin to a gogstash plugin
+type pluginMapping struct {
+	name     string      // name of the gogstash plugin
+	converts []converter // converters of settings, settings not converted are kept
+}
+
+// converter converts settings of a logstash plugin into settings of the gogstash plugin
+type converter func(s *settings) error
+
+// pluginMappings are logstash plugins supported by gogstash plugins, by section
+var pluginMappings = map[string]map[string]pluginMapping{
+	"input": {
+		"beats": {name: "beats", converts: []converter{convertCodec}},
+		"exec":  {name: "exec", converts: []converter{execCommand, unsupported("schedule"), convertCodec}},
+		"file":  {name: "file", converts: []converter{scalar("path"), convertCodec}},
+		"kafka": {name: "kafka", converts: []converter{
+			rename("bootstrap_servers", "brokers"), splitList("brokers"),
+			rename("group_id", "group"), kafkaOffsetReset, convertCodec,
+		}},
+		"pipeline": {name: "pipeline"},
+		"redis": {name: "redis", converts: []converter{
+			only("data_type", "list"), address("host", "localhost", 6379, false), convertCodec,
+		}},
+		"syslog": {name: "syslog", converts: []converter{address("address", "0.0.0.0", 514, false), convertCodec}},
+		"tcp": {name: "socket", converts: []converter{
+			only("mode", "server"), fixed("socket", "tcp"), address("address", "0.0.0.0", 0, false), convertCodec,
+		}},
+		"udp": {name: "socket", converts: []converter{
+			fixed("socket", "udp"), address("address", "0.0.0.0", 0, false), convertCodec,
+		}},
+	},
+	"filter": {
+		"date":  {name: "date", converts: []converter{dateMatch}},
+		"drop":  {name: "drop"},
+		"geoip": {name: "geoip2", converts: []converter{rename("source", "ip_field"), rename("target", "key"), rename("database", "db_path")}},
+		"grok":  {name: "grok", converts: []converter{grokMatch, rename("pattern_definitions", "patterns")}},
+		"json":  {name: "json", converts: []converter{rename("target", "appendkey")}},
+		"kv":    {name: "kv"},
+		"mutate": {name: "mutate", converts: []converter{
+			pair("rename"), pair("split"), scalar("uppercase"), scalar("lowercase"),
+			unsupported("coerce", "convert", "copy", "gsub", "join", "merge", "replace", "strip", "update"),
+		}},
+		"useragent": {name: "useragent"},
+	},
+	"output": {
+		"elasticsearch": {name: "elastic", converts: []converter{
+			elasticHosts, rename("user", "username"), rename("action", "op_type"),
+			rename("ssl_certificate_verification", "ssl_certificate_validation"),
+		}},
+		"file": {name: "file", converts: []converter{fileCodec}},
+		"gelf": {name: "gelf", converts: []converter{address("hosts", "localhost", 12201, true)}},
+		"http": {name: "http", converts: []converter{rename("url", "urls"), list("urls"), convertCodec}},
+		"kafka": {name: "kafka", converts: []converter{
+			rename("bootstrap_servers", "brokers"), splitList("brokers"),
+			rename("topic_id", "topics"), list("topics"), convertCodec,
+		}},
+		"pipeline": {name: "pipeline", converts: []converter{list("send_to")}},
+		"redis":    {name: "redis", converts: []converter{address("host", "localhost", 6379, true), convertCodec}},
+		"statsd":   {name: "statsd", converts: []converter{address("host", "localhost", 8125, false), rename("namespace", "prefix")}},
+		"stdout":   {name: "stdout", converts: []converter{convertCodec}},
+		"tcp": {name: "socket", converts: []converter{
+			only("mode", "client"), fixed("socket", "tcp"), address("address", "localhost", 0, false), convertCodec,
+		}},
+	},
+}
+
+// sectionConverters convert the common settings of all mapped plugins of section
+var sectionConverters = map[string][]converter{
+	"input":  {remove("enable_metric"), unsupported("type", "tags", "add_field")},
+	"filter": {remove("enable_metric", "periodic_flush"), fieldList("add_field"), list("add_tag"), list("remove_tag"), list("remove_field")},
+	"output": {remove("enable_metric")},
+}
+
+// convertPlugin converts the logstash plugin name and settings of section into the gogstash plugin,
+// sprintf times `%{+joda}` of mapped plugins are converted into `%{+@layout}`.
+// Plugins not mapped are kept if registered in gogstash.
+func convertPlugin(section string, name string, items yaml.MapSlice) (plugin yaml.MapSlice, err error) {
+	mapping, ok := pluginMappings[section][name]
+	if !ok {
+		if Registered != nil && !Registered(section, name) {
+			return nil, ErrorPluginNotSupported.New(nil)
+		}
+		return append(yaml.MapSlice{{Key: "type", Value: name}}, items...), nil
+	}
+	if Registered != nil && !Registered(section, mapping.name) {
+		return nil, ErrorPluginNotRegistered1.New(nil, mapping.name)
+	}
+
+	s := &settings{items: items}
+	for _, converts := range [][]converter{mapping.converts, sectionConverters[section]} {
+		for _, convert := range converts {
+			if err = convert(s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, item := range s.items {
+		if s.items[i].Value, err = convertSprintf(item.Value); err != nil {
+			return nil, ErrorSetting2.New(err, item.Key, "convert sprintf time failed")
+		}
+	}
+	return append(yaml.MapSlice{{Key: "type", Value: mapping.name}}, s.items...), nil
+}
+
+// convertSprintf converts sprintf times of strings in value
+func convertSprintf(value any) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return convertSprintfTime(value)
+	case []any:
+		list := make([]any, len(value))
+		for i, v := range value {
+			var err error
+			if list[i], err = convertSprintf(v); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case yaml.MapSlice:
+		hash := make(yaml.MapSlice, len(value))
+		for i, item := range value {
+			v, err := convertSprintf(item.Value)
+			if err != nil {
+				return nil, err
+			}
+			hash[i] = yaml.MapItem{Key: item.Key, Value: v}
+		}
+		return hash, nil
+	}
+	return value, nil
+}
+
+// settings of a plugin in the order of config
+type settings struct {
+	items yaml.MapSlice
+}
+
+func (t *settings) get(key string) (value any, ok bool) {
+	for _, item := range t.items {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// set replaces the value of key, or appends it if not set
+func (t *settings) set(key string, value any) {
+	for i, item := range t.items {
+		if item.Key == key {
+			t.items[i].Value = value
+			return
+		}
+	}
+	t.items = append(t.items, yaml.MapItem{Key: key, Value: value})
+}
+
+func (t *settings) remove(key string) (value any, ok bool) {
+	for i, item := range t.items {
+		if item.Key == key {
+			t.items = append(t.items[:i], t.items[i+1:]...)
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// rename renames setting from to to
+func rename(from string, to string) converter {
+	return func(s *settings) error {
+		for i, item := range s.items {
+			if item.Key == from {
+				s.items[i].Key = to
+			}
+		}
+		return nil
+	}
+}
+
+// fixed sets key to value
+func fixed(key string, value any) converter {
+	return func(s *settings) error {
+		s.set(key, value)
+		return nil
+	}
+}
+
+// remove removes settings not affecting events
+func remove(keys ...string) converter {
+	return func(s *settings) error {
+		for _, key := range keys {
+			s.remove(key)
+		}
+		return nil
+	}
+}
+
+// unsupported returns error if any of keys is set
+func unsupported(keys ...string) converter {
+	return func(s *settings) error {
+		for _, key := range keys {
+			if _, ok := s.get(key); ok {
+				return ErrorSetting2.New(nil, key, "not supported by gogstash")
+			}
+		}
+		return nil
+	}
+}
+
+// only returns error if key is set to other than value, the setting is removed
+func only(key string, value string) converter {
+	return func(s *settings) error {
+		if v, ok := s.remove(key); ok && fmt.Sprint(v) != value {
+			return ErrorSetting2.New(nil, key, fmt.Sprintf("only %q is supported by gogstash", value))
+		}
+		return nil
+	}
+}
+
+// scalar converts a list of single value of key into the value
+func scalar(key string) converter {
+	return func(s *settings) error {
+		value, ok := s.get(key)
+		if !ok {
+			return nil
+		}
+		if list, ok := value.([]any); ok {
+			if len(list) != 1 {
+				return ErrorSetting2.New(nil, key, "only one value is supported by gogstash")
+			}
+			s.set(key, list[0])
+		}
+		return nil
+	}
+}
+
+// list converts a single value of key into a list
+func list(key string) converter {
+	return func(s *settings) error {
+		if value, ok := s.get(key); ok {
+			if _, ok := value.([]any); !ok {
+				s.set(key, []any{value})
+			}
+		}
+		return nil
+	}
+}
+
+// splitList converts a comma separated string of key into a list
+func splitList(key string) converter {
+	return func(s *settings) error {
+		if value, ok := s.get(key); ok {
+			value, ok := value.(string)
+			if !ok {
+				return nil
+			}
+			var list []any
+			for _, v := range strings.Split(value, ",") {
+				list = append(list, strings.TrimSpace(v))
+			}
+			s.set(key, list)
+		}
+		return nil
+	}
+}
+
+// pair converts a hash of single pair of key into a list of the key and value
+func pair(key string) converter {
+	return func(s *settings) error {
+		value, ok := s.get(key)
+		if !ok {
+			return nil
+		}
+		hash, ok := value.(yaml.MapSlice)
+		if !ok {
+			return nil
+		}
+		if len(hash) != 1 {
+			return ErrorSetting2.New(nil, key, "only one pair is supported by gogstash, split into multiple plugins")
+		}
+		s.set(key, []any{hash[0].Key, hash[0].Value})
+		return nil
+	}
+}
+
+// fieldList converts a hash of fields into a list of key and value
+func fieldList(key string) converter {
+	return func(s *settings) error {
+		value, ok := s.get(key)
+		if !ok {
+			return nil
+		}
+		hash, ok := value.(yaml.MapSlice)
+		if !ok {
+			return nil
+		}
+		fields := make([]any, 0, len(hash))
+		for _, item := range hash {
+			fields = append(fields, yaml.MapSlice{{Key: "key", Value: item.Key}, {Key: "value", Value: item.Value}})
+		}
+		s.set(key, fields)
+		return nil
+	}
+}
+
+// address joins settings host and port into to, hosts with port are kept,
+// defaultPort 0 requires the port setting, hosts are a list if asList
+func address(to string, defaultHost string, defaultPort int64, asList bool) converter {
+	return func(s *settings) error {
+		hostValue, hasHost := s.remove("host")
+		portValue, hasPort := s.remove("port")
+		if !hasHost && !hasPort {
+			if _, ok := s.get(to); ok || defaultPort != 0 {
+				// keep gogstash settings, or use the default address of gogstash
+				return nil
+			}
+		}
+		port := fmt.Sprint(portValue)
+		if !hasPort {
+			if defaultPort == 0 {
+				return ErrorSetting2.New(nil, "port", "required")
+			}
+			port = fmt.Sprint(defaultPort)
+		}
+		hosts, ok := hostValue.([]any)
+		if !ok {
+			if !hasHost {
+				hostValue = defaultHost
+			}
+			hosts = []any{hostValue}
+		}
+		addresses := make([]any, len(hosts))
+		for i, host := range hosts {
+			host := fmt.Sprint(host)
+			if !strings.Contains(host, ":") {
+				host += ":" + port
+			}
+			addresses[i] = host
+		}
+		if asList {
+			s.set(to, addresses)
+			return nil
+		}
+		if len(addresses) != 1 {
+			return ErrorSetting2.New(nil, "host", "only one host is supported by gogstash")
+		}
+		s.set(to, addresses[0])
+		return nil
+	}
+}
+
+// convertCodec converts codec names of logstash into gogstash codecs
+func convertCodec(s *settings) error {
+	value, ok := s.get("codec")
+	if !ok {
+		return nil
+	}
+	switch value {
+	case "plain", "line", "rubydebug":
+		s.remove("codec")
+	case "json", "json_lines":
+		s.set("codec", "json")
+	default:
+		name, ok := value.(string)
+		if !ok {
+			return ErrorSetting2.New(nil, "codec", "codec settings are not supported")
+		}
+		if Registered != nil && !Registered("codec", name) {
+			return ErrorSetting2.New(nil, "codec", fmt.Sprintf("codec %q is not supported by gogstash", name))
+		}
+	}
+	return nil
+}
+
+// fileCodec converts the line codec of file output into the format template of gogstash
+func fileCodec(s *settings) error {
+	value, _ := s.get("codec")
+	switch value {
+	case "plain", "line":
+		s.set("codec", "%{message}")
+		return nil
+	}
+	return ErrorSetting2.New(nil, "codec", "only line codec is supported by gogstash file output")
+}
+
+// execCommand converts the shell command of exec input into command and args
+func execCommand(s *settings) error {
+	if command, ok := s.get("command"); ok {
+		s.set("command", "sh")
+		s.set("args", []any{"-c", command})
+	}
+	return nil
+}
+
+// kafkaOffsetReset converts auto_offset_reset of kafka input into offset_oldest
+func kafkaOffsetReset(s *settings) error {
+	value, ok := s.remove("auto_offset_reset")
+	if !ok {
+		return nil
+	}
+	switch value {
+	case "earliest":
+		s.set("offset_oldest", true)
+	case "latest":
+	default:
+		return ErrorSetting2.New(nil, "auto_offset_reset", "only earliest and latest are supported by gogstash")
+	}
+	return nil
+}
+
+// grokMatch converts match hash of a source field of grok filter into source and patterns
+func grokMatch(s *settings) error {
+	value, ok := s.get("match")
+	if !ok {
+		return nil
+	}
+	hash, ok := value.(yaml.MapSlice)
+	if list, isList := value.([]any); isList && len(list) == 2 {
+		// deprecated form: match => ["message", "pattern"]
+		hash, ok = yaml.MapSlice{{Key: list[0], Value: list[1]}}, true
+	}
+	if !ok || len(hash) != 1 {
+		return ErrorSetting2.New(nil, "match", "only one source field is supported by gogstash, split into multiple plugins")
+	}
+	patterns, ok := hash[0].Value.([]any)
+	if !ok {
+		patterns = []any{hash[0].Value}
+	}
+	s.set("match", patterns)
+	s.set("source", hash[0].Key)
+	return nil
+}
+
+// dateMatch converts match of date filter into source and Go layouts
+func dateMatch(s *settings) error {
+	value, ok := s.remove("match")
+	if !ok {
+		return nil
+	}
+	list, ok := value.([]any)
+	if !ok || len(list) < 2 {
+		return ErrorSetting2.New(nil, "match", "expect [field, formats...]")
+	}
+	formats := make([]any, 0, len(list)-1)
+	for _, format := range list[1:] {
+		switch format := fmt.Sprint(format); format {
+		case "ISO8601":
+			formats = append(formats, time.RFC3339Nano)
+		case "UNIX":
+			formats = append(formats, format)
+		case "UNIX_MS", "TAI64N":
+			return ErrorSetting2.New(nil, "match", fmt.Sprintf("format %q is not supported by gogstash", format))
+		default:
+			layout, err := jodaLayout(format)
+			if err != nil {
+				return ErrorSetting2.New(err, "match", "convert date pattern failed")
+			}
+			formats = append(formats, layout)
+		}
+	}
+	s.set("source", list[0])
+	s.set("format", formats)
+	return nil
+}
+
+// elasticHosts converts hosts of elasticsearch output into urls
+func elasticHosts(s *settings) error {
+	value, ok := s.get("hosts")
+	if !ok {
+		return nil
+	}
+	scheme := "http://"
+	if ssl, _ := s.remove("ssl"); ssl == true {
+		scheme = "https://"
+	}
+	hosts, ok := value.([]any)
+	if !ok {
+		hosts = []any{value}
+	}
+	urls := make([]any, len(hosts))
+	for i, host := range hosts {
+		url := fmt.Sprint(host)
+		if !strings.Contains(url, "://") {
+			url = scheme + url
+		}
+		urls[i] = url
+	}
+	if err := rename("hosts", "url")(s); err != nil {
+		return err
+	}
+	s.set("url", urls)
+	return nil
+}
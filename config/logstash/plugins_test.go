@@ -0,0 +1,130 @@
+package logstash
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ToYAML_plugins(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	data, err := ToYAML([]byte(`
+input {
+  kafka { bootstrap_servers => "k1:9092, k2:9092" topics => ["logs"] group_id => "gogstash" auto_offset_reset => "earliest" codec => json }
+  tcp { port => 5000 }
+}
+filter {
+  date { match => ["time", "dd/MMM/yyyy:HH:mm:ss Z", "ISO8601"] target => "@timestamp" }
+  mutate { rename => { "host" => "hostname" } add_field => { "env" => "prod" } }
+}
+output {
+  elasticsearch { hosts => "es:9200" ssl => true user => "elastic" }
+  redis { host => ["r1", "r2:6380"] key => "logs-%{+YYYY.MM}" data_type => "list" }
+}
+`))
+	require.NoError(err)
+	require.Equal(strings.TrimLeft(`
+input:
+- type: kafka
+  brokers:
+  - k1:9092
+  - k2:9092
+  topics:
+  - logs
+  group: gogstash
+  codec: json
+  offset_oldest: true
+- type: socket
+  socket: tcp
+  address: 0.0.0.0:5000
+filter:
+- type: date
+  target: '@timestamp'
+  source: time
+  format:
+  - 02/Jan/2006:15:04:05 -0700
+  - 2006-01-02T15:04:05.999999999Z07:00
+- type: mutate
+  rename:
+  - host
+  - hostname
+  add_field:
+  - key: env
+    value: prod
+output:
+- type: elastic
+  url:
+  - https://es:9200
+  username: elastic
+- type: redis
+  key: logs-%{+@2006.01}
+  data_type: list
+  host:
+  - r1:6379
+  - r2:6380
+`, "\n"), string(data))
+}
+
+func Test_ToYAML_unsupported(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	Registered = func(section string, name string) bool {
+		return name != "ruby"
+	}
+	defer func() { Registered = nil }()
+
+	_, err := ToYAML([]byte("filter {\n  ruby { code => \"event.cancel\" }\n}"))
+	require.True(ErrorPluginNotSupported.In(err))
+	require.Contains(err.Error(), `convert filter plugin "ruby" failed`)
+	require.Contains(err.Error(), "line 2 column 3")
+
+	_, err = ToYAML([]byte("output {\n  elasticsearch { hosts => [\"es\"] }\n  ruby {}\n}"))
+	require.True(ErrorPluginNotSupported.In(err))
+	require.Contains(err.Error(), "line 3 column 3")
+
+	_, err = ToYAML([]byte("input { tcp { mode => \"client\" port => 5000 } }"))
+	require.True(ErrorSetting2.In(err))
+
+	_, err = ToYAML([]byte("filter { mutate { gsub => [\"message\", \"a\", \"b\"] } }"))
+	require.True(ErrorSetting2.In(err))
+
+	_, err = ToYAML([]byte("output { file { path => \"/tmp/out.log\" } }"))
+	require.True(ErrorSetting2.In(err))
+
+	_, err = ToYAML([]byte("output { file { path => \"/tmp/%{+yyyy-ww}.log\" codec => line } }"))
+	require.True(ErrorDatePattern2.In(err))
+
+	Registered = func(section string, name string) bool {
+		return name != "elastic"
+	}
+	_, err = ToYAML([]byte("output { elasticsearch {} }"))
+	require.True(ErrorPluginNotRegistered1.In(err))
+}
+
+func Test_jodaLayout(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	for pattern, expected := range map[string]string{
+		"YYYY.MM.dd":                   "2006.01.02",
+		"yyyy-MM-dd'T'HH:mm:ss.SSSZZ":  "2006-01-02T15:04:05.000-07:00",
+		"dd/MMM/yyyy:HH:mm:ss Z":       "02/Jan/2006:15:04:05 -0700",
+		"EEE, d MMMM yy hh:mm a z":     "Mon, 2 January 06 03:04 PM MST",
+		"yyyy.DDD 'o''clock' H":        "2006.002 o'clock 15",
+		"MMM  d HH:mm:ss,SSS":          "Jan  2 15:04:05,000",
+		"yyyy-MM-dd'T'HH:mm:ss.SSSSSS": "2006-01-02T15:04:05.000000",
+	} {
+		layout, err := jodaLayout(pattern)
+		require.NoError(err, pattern)
+		require.Equal(expected, layout, pattern)
+	}
+
+	for _, pattern := range []string{"yyyy'", "HH:mm:ssSSS", "yyyy 'W'ww", "yyyy'1'", "ZZZ"} {
+		_, err := jodaLayout(pattern)
+		require.True(ErrorDatePattern2.In(err), pattern)
+	}
+}
@@ -0,0 +1,402 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/goglog"
+)
+
+// errors
+var (
+	ErrorNoAddress = errutil.NewFactory("no address for monitor")
+)
+
+// Config is the monitoring server config
+type Config struct {
+	Address string `json:"address" yaml:"address"` // listen address, ex: 127.0.0.1:9600, required
+}
+
+// Init validates config
+func (t *Config) Init() (err error) {
+	if t.Address == "" {
+		return ErrorNoAddress.New(nil)
+	}
+	return nil
+}
+
+// plugin kinds
+const (
+	KindInput  = "input"
+	KindFilter = "filter"
+	KindOutput = "output"
+)
+
+// durationBuckets are upper bounds in seconds of filter duration histogram, 10µs to ~2.6s
+var durationBuckets = prometheus.ExponentialBuckets(0.00001, 4, 10)
+
+// PluginStats counts events of a running plugin, methods of nil PluginStats do nothing
+type PluginStats struct {
+	Type string
+	ID   string
+
+	in      atomic.Int64
+	out     atomic.Int64
+	dropped atomic.Int64
+	errors  atomic.Int64
+
+	// filter duration, counts of durationBuckets and +Inf, not cumulative
+	durationCount   atomic.Uint64
+	durationNanos   atomic.Int64
+	durationBuckets []atomic.Uint64
+}
+
+// In counts an event received by the plugin
+func (t *PluginStats) In() {
+	if t != nil {
+		t.in.Add(1)
+	}
+}
+
+// Out counts an event emitted by the plugin, or delivered by the output
+func (t *PluginStats) Out() {
+	if t != nil {
+		t.out.Add(1)
+	}
+}
+
+// Dropped counts an event dropped by the filter
+func (t *PluginStats) Dropped() {
+	if t != nil {
+		t.dropped.Add(1)
+	}
+}
+
+// Error counts an event failed in the plugin
+func (t *PluginStats) Error() {
+	if t != nil {
+		t.errors.Add(1)
+	}
+}
+
+// ObserveDuration records the duration of the filter processing an event
+func (t *PluginStats) ObserveDuration(duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.durationCount.Add(1)
+	t.durationNanos.Add(int64(duration))
+	seconds := duration.Seconds()
+	i := 0
+	for i < len(durationBuckets) && seconds > durationBuckets[i] {
+		i++
+	}
+	t.durationBuckets[i].Add(1)
+}
+
+// PluginSnapshot is the statistics of a plugin in the node stats API
+type PluginSnapshot struct {
+	Index  int    `json:"index"`
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	Events struct {
+		In      int64 `json:"in"`
+		Out     int64 `json:"out"`
+		Dropped int64 `json:"dropped"`
+		Errors  int64 `json:"errors"`
+	} `json:"events"`
+	DurationInMillis float64 `json:"duration_in_millis,omitempty"`
+}
+
+func (t *PluginStats) snapshot(index int) (snapshot PluginSnapshot) {
+	snapshot.Index = index
+	snapshot.Type = t.Type
+	snapshot.ID = t.ID
+	snapshot.Events.In = t.in.Load()
+	snapshot.Events.Out = t.out.Load()
+	snapshot.Events.Dropped = t.dropped.Load()
+	snapshot.Events.Errors = t.errors.Load()
+	snapshot.DurationInMillis = float64(t.durationNanos.Load()) / float64(time.Millisecond)
+	return snapshot
+}
+
+// ChannelSnapshot is the fill level of a pipeline channel
+type ChannelSnapshot struct {
+	Length   int `json:"length"`
+	Capacity int `json:"capacity"`
+}
+
+// PipelineStats holds statistics of plugins running in a pipeline,
+// methods of nil PipelineStats do nothing
+type PipelineStats struct {
+	Name string
+
+	mutex    sync.Mutex
+	plugins  map[string][]*PluginStats // running plugins by kind
+	channels map[string]func() ChannelSnapshot
+}
+
+// NewPlugin returns statistics of a plugin in the pipeline, nil if pipeline stats is nil
+func (t *PipelineStats) NewPlugin(pluginType string, id string) *PluginStats {
+	if t == nil {
+		return nil
+	}
+	return &PluginStats{
+		Type:            pluginType,
+		ID:              id,
+		durationBuckets: make([]atomic.Uint64, len(durationBuckets)+1),
+	}
+}
+
+// SetPlugins sets the running plugins of kind, in config order
+func (t *PipelineStats) SetPlugins(kind string, plugins []*PluginStats) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.plugins[kind] = plugins
+}
+
+// SetChannel sets the function returning the fill level of channel name
+func (t *PipelineStats) SetChannel(name string, channel func() ChannelSnapshot) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.channels[name] = channel
+}
+
+// PipelineSnapshot is the statistics of a pipeline in the node stats API
+type PipelineSnapshot struct {
+	Channels map[string]ChannelSnapshot `json:"channels"`
+	Plugins  struct {
+		Inputs  []PluginSnapshot `json:"inputs"`
+		Filters []PluginSnapshot `json:"filters"`
+		Outputs []PluginSnapshot `json:"outputs"`
+	} `json:"plugins"`
+}
+
+func (t *PipelineStats) snapshot() (snapshot PipelineSnapshot) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	snapshot.Channels = map[string]ChannelSnapshot{}
+	for name, channel := range t.channels {
+		snapshot.Channels[name] = channel()
+	}
+	plugins := func(kind string) []PluginSnapshot {
+		snapshots := make([]PluginSnapshot, len(t.plugins[kind]))
+		for i, plugin := range t.plugins[kind] {
+			snapshots[i] = plugin.snapshot(i)
+		}
+		return snapshots
+	}
+	snapshot.Plugins.Inputs = plugins(KindInput)
+	snapshot.Plugins.Filters = plugins(KindFilter)
+	snapshot.Plugins.Outputs = plugins(KindOutput)
+	return snapshot
+}
+
+// Registry holds statistics of all running pipelines, it is a prometheus.Collector,
+// methods of nil Registry do nothing
+type Registry struct {
+	mutex     sync.Mutex
+	pipelines map[string]*PipelineStats
+	paused    func() bool
+}
+
+// NewRegistry returns a Registry, paused returns the current pause state
+func NewRegistry(paused func() bool) *Registry {
+	return &Registry{
+		pipelines: map[string]*PipelineStats{},
+		paused:    paused,
+	}
+}
+
+// Pipeline returns new statistics of pipeline name, replacing the previous one of the same name,
+// nil if registry is nil
+func (t *Registry) Pipeline(name string) *PipelineStats {
+	if t == nil {
+		return nil
+	}
+	stats := &PipelineStats{
+		Name:     name,
+		plugins:  map[string][]*PluginStats{},
+		channels: map[string]func() ChannelSnapshot{},
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pipelines[name] = stats
+	return stats
+}
+
+// RemovePipeline removes statistics of pipeline name
+func (t *Registry) RemovePipeline(name string) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.pipelines, name)
+}
+
+// Snapshot is the response of the node stats API
+type Snapshot struct {
+	Paused    bool                        `json:"paused"`
+	Pipelines map[string]PipelineSnapshot `json:"pipelines"`
+}
+
+// Snapshot returns current statistics of all pipelines
+func (t *Registry) Snapshot() (snapshot Snapshot) {
+	t.mutex.Lock()
+	pipelines := make([]*PipelineStats, 0, len(t.pipelines))
+	for _, pipeline := range t.pipelines {
+		pipelines = append(pipelines, pipeline)
+	}
+	t.mutex.Unlock()
+
+	snapshot.Paused = t.paused != nil && t.paused()
+	snapshot.Pipelines = make(map[string]PipelineSnapshot, len(pipelines))
+	for _, pipeline := range pipelines {
+		snapshot.Pipelines[pipeline.Name] = pipeline.snapshot()
+	}
+	return snapshot
+}
+
+var (
+	pluginLabels         = []string{"pipeline", "kind", "index", "type", "id"}
+	descPluginEventsIn   = prometheus.NewDesc("gogstash_plugin_events_in_total", "Number of events received by the plugin", pluginLabels, nil)
+	descPluginEventsOut  = prometheus.NewDesc("gogstash_plugin_events_out_total", "Number of events emitted by the plugin, or delivered by the output", pluginLabels, nil)
+	descPluginDropped    = prometheus.NewDesc("gogstash_plugin_events_dropped_total", "Number of events dropped by the filter", pluginLabels, nil)
+	descPluginErrors     = prometheus.NewDesc("gogstash_plugin_errors_total", "Number of events failed in the plugin", pluginLabels, nil)
+	descFilterDuration   = prometheus.NewDesc("gogstash_filter_duration_seconds", "Duration of the filter processing an event", pluginLabels, nil)
+	descChannelLength    = prometheus.NewDesc("gogstash_pipeline_channel_length", "Number of events in the pipeline channel", []string{"pipeline", "channel"}, nil)
+	descChannelCapacity  = prometheus.NewDesc("gogstash_pipeline_channel_capacity", "Capacity of the pipeline channel", []string{"pipeline", "channel"}, nil)
+	descPaused           = prometheus.NewDesc("gogstash_paused", "1 if inputs are requested to pause, otherwise 0", nil, nil)
+	descPipelineRunning  = prometheus.NewDesc("gogstash_pipeline_running", "1 for each running pipeline", []string{"pipeline"}, nil)
+	descPluginCollectors = []*prometheus.Desc{descPluginEventsIn, descPluginEventsOut, descPluginDropped, descPluginErrors}
+)
+
+// Describe implements prometheus.Collector
+func (t *Registry) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range descPluginCollectors {
+		ch <- desc
+	}
+	ch <- descFilterDuration
+	ch <- descChannelLength
+	ch <- descChannelCapacity
+	ch <- descPaused
+	ch <- descPipelineRunning
+}
+
+// Collect implements prometheus.Collector
+func (t *Registry) Collect(ch chan<- prometheus.Metric) {
+	snapshot := t.Snapshot()
+	paused := 0.0
+	if snapshot.Paused {
+		paused = 1
+	}
+	ch <- prometheus.MustNewConstMetric(descPaused, prometheus.GaugeValue, paused)
+
+	t.mutex.Lock()
+	pipelines := make([]*PipelineStats, 0, len(t.pipelines))
+	for _, pipeline := range t.pipelines {
+		pipelines = append(pipelines, pipeline)
+	}
+	t.mutex.Unlock()
+
+	for _, pipeline := range pipelines {
+		ch <- prometheus.MustNewConstMetric(descPipelineRunning, prometheus.GaugeValue, 1, pipeline.Name)
+		for name, channel := range snapshot.Pipelines[pipeline.Name].Channels {
+			ch <- prometheus.MustNewConstMetric(descChannelLength, prometheus.GaugeValue, float64(channel.Length), pipeline.Name, name)
+			ch <- prometheus.MustNewConstMetric(descChannelCapacity, prometheus.GaugeValue, float64(channel.Capacity), pipeline.Name, name)
+		}
+
+		pipeline.mutex.Lock()
+		for _, kind := range []string{KindInput, KindFilter, KindOutput} {
+			for i, plugin := range pipeline.plugins[kind] {
+				labels := []string{pipeline.Name, kind, strconv.Itoa(i), plugin.Type, plugin.ID}
+				ch <- prometheus.MustNewConstMetric(descPluginEventsIn, prometheus.CounterValue, float64(plugin.in.Load()), labels...)
+				ch <- prometheus.MustNewConstMetric(descPluginEventsOut, prometheus.CounterValue, float64(plugin.out.Load()), labels...)
+				ch <- prometheus.MustNewConstMetric(descPluginDropped, prometheus.CounterValue, float64(plugin.dropped.Load()), labels...)
+				ch <- prometheus.MustNewConstMetric(descPluginErrors, prometheus.CounterValue, float64(plugin.errors.Load()), labels...)
+				if kind == KindFilter {
+					ch <- plugin.durationHistogram(labels)
+				}
+			}
+		}
+		pipeline.mutex.Unlock()
+	}
+}
+
+func (t *PluginStats) durationHistogram(labels []string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(durationBuckets))
+	var cumulative uint64
+	for i, upper := range durationBuckets {
+		cumulative += t.durationBuckets[i].Load()
+		buckets[upper] = cumulative
+	}
+	count := cumulative + t.durationBuckets[len(durationBuckets)].Load()
+	sum := time.Duration(t.durationNanos.Load()).Seconds()
+	return prometheus.MustNewConstHistogram(descFilterDuration, count, sum, buckets, labels...)
+}
+
+// Handler returns the HTTP handler of the monitoring API:
+// /metrics for Prometheus and /_node/stats for JSON node stats
+func (t *Registry) Handler() http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		t,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/_node/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		if _, ok := r.URL.Query()["pretty"]; ok {
+			encoder.SetIndent("", "  ")
+		}
+		if err := encoder.Encode(t.Snapshot()); err != nil {
+			goglog.Logger.Errorf("monitor: write node stats failed: %v", err)
+		}
+	})
+	return mux
+}
+
+// Serve listens on address and serves the monitoring API in a goroutine until ctx is done
+func (t *Registry) Serve(ctx context.Context, address string) (err error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           t.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		goglog.Logger.Infof("monitor: listening on %s", listener.Addr())
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			goglog.Logger.Errorf("monitor: serve failed: %v", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	var nilPipeline *PipelineStats
+	require.Nil(nilPipeline.NewPlugin("grok", "grok"))
+	var nilPlugin *PluginStats
+	nilPlugin.In()
+	nilPlugin.ObserveDuration(time.Second)
+	var nilRegistry *Registry
+	require.Nil(nilRegistry.Pipeline("main"))
+
+	registry := NewRegistry(func() bool { return true })
+	pipeline := registry.Pipeline("main")
+	pipeline.SetChannel("in_filter", func() ChannelSnapshot {
+		return ChannelSnapshot{Length: 3, Capacity: 100}
+	})
+	input := pipeline.NewPlugin("beats", "beats")
+	input.Out()
+	filter := pipeline.NewPlugin("grok", "nginx")
+	filter.In()
+	filter.Out()
+	filter.ObserveDuration(2 * time.Millisecond)
+	filter.In()
+	filter.Dropped()
+	filter.ObserveDuration(10 * time.Second)
+	pipeline.SetPlugins(KindInput, []*PluginStats{input})
+	pipeline.SetPlugins(KindFilter, []*PluginStats{filter})
+
+	server := httptest.NewServer(registry.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/_node/stats")
+	require.NoError(err)
+	defer resp.Body.Close()
+	var snapshot Snapshot
+	require.NoError(json.NewDecoder(resp.Body).Decode(&snapshot))
+	require.True(snapshot.Paused)
+	main := snapshot.Pipelines["main"]
+	require.Equal(ChannelSnapshot{Length: 3, Capacity: 100}, main.Channels["in_filter"])
+	require.EqualValues(1, main.Plugins.Inputs[0].Events.Out)
+	require.Equal("nginx", main.Plugins.Filters[0].ID)
+	require.EqualValues(2, main.Plugins.Filters[0].Events.In)
+	require.EqualValues(1, main.Plugins.Filters[0].Events.Dropped)
+	require.InDelta(10002, main.Plugins.Filters[0].DurationInMillis, 0.001)
+	require.Empty(main.Plugins.Outputs)
+
+	resp, err = server.Client().Get(server.URL + "/metrics")
+	require.NoError(err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(err)
+	metrics := string(body)
+	require.Contains(metrics, `gogstash_paused 1`)
+	require.Contains(metrics, `gogstash_pipeline_channel_length{channel="in_filter",pipeline="main"} 3`)
+	require.Contains(metrics, `gogstash_plugin_events_out_total{id="beats",index="0",kind="input",pipeline="main",type="beats"} 1`)
+	require.Contains(metrics, `gogstash_filter_duration_seconds_count{id="nginx",index="0",kind="filter",pipeline="main",type="grok"} 2`)
+	require.Contains(metrics, `gogstash_filter_duration_seconds_bucket{id="nginx",index="0",kind="filter",pipeline="main",type="grok",le="+Inf"} 2`)
+	require.True(strings.Contains(metrics, "go_goroutines"))
+
+	registry.RemovePipeline("main")
+	require.Empty(registry.Snapshot().Pipelines)
+}
@@ -2,11 +2,12 @@ package config
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/tsaikd/KDGoLib/errutil"
-	"golang.org/x/sync/errgroup"
 
-	"github.com/tsaikd/gogstash/config/goglog"
 	"github.com/tsaikd/gogstash/config/logevent"
 )
 
@@ -14,6 +15,12 @@ import (
 var (
 	ErrorUnknownOutputType1 = errutil.NewFactory("unknown output config type: %q")
 	ErrorInitOutputFailed1  = errutil.NewFactory("initialize output module failed: %v")
+	// ErrorOutputRetrying should be the parent of errors returned by outputs
+	// which queued the event for retry, the event is not sent to the dead letter queue
+	ErrorOutputRetrying   = errutil.NewFactory("output queued the event for retry")
+	ErrorUnknownOverflow1 = errutil.NewFactory("unknown output overflow policy: %q")
+	ErrorOutputQueueFull1 = errutil.NewFactory("queue of output %q is full")
+	ErrorBatchInterval1   = errutil.NewFactory("invalid batch_flush_interval: %q")
 )
 
 // TypeOutputConfig is interface of output module
@@ -22,17 +29,61 @@ type TypeOutputConfig interface {
 	Output(ctx context.Context, event logevent.LogEvent) (err error)
 }
 
+// TypeBatchOutputConfig is interface of output module sending events in batches,
+// the output worker buffers events by batch_size, batch_bytes and batch_flush_interval,
+// and calls OutputBatch instead of Output. The returned error applies to all events of the batch.
+type TypeBatchOutputConfig interface {
+	TypeOutputConfig
+	OutputBatch(ctx context.Context, events []logevent.LogEvent) (err error)
+}
+
 // OutputConfig is basic output config struct
 type OutputConfig struct {
 	CommonConfig
 	Codec TypeCodecConfig `json:"-"` // name of codec to load
+
+	// number of events buffered for the output worker, defaults to chsize of the pipeline
+	QueueSize int `json:"queue_size,omitempty" yaml:"queue_size"`
+	// policy when the queue is full: block, drop_oldest or dead_letter, defaults to block
+	Overflow string `json:"overflow,omitempty" yaml:"overflow"`
+
+	// max number of events in a batch of batch outputs, defaults to DefaultBatchSize
+	BatchSize int `json:"batch_size,omitempty" yaml:"batch_size"`
+	// max bytes of events in JSON in a batch of batch outputs, 0 is unlimited
+	BatchBytes int `json:"batch_bytes,omitempty" yaml:"batch_bytes"`
+	// max duration to buffer a batch of batch outputs, e.g. "500ms", defaults to DefaultBatchFlushInterval
+	BatchFlushInterval string `json:"batch_flush_interval,omitempty" yaml:"batch_flush_interval"`
+}
+
+// default batch config of batch outputs
+const (
+	DefaultBatchSize          = 125
+	DefaultBatchFlushInterval = time.Second
+)
+
+// output queue overflow policies
+const (
+	OverflowBlock      = "block"
+	OverflowDropOldest = "drop_oldest"
+	OverflowDeadLetter = "dead_letter"
+)
+
+// getOutputQueue returns queue size and overflow policy of the output worker
+func (t OutputConfig) getOutputQueue() (size int, overflow string) {
+	return t.QueueSize, t.Overflow
+}
+
+// getOutputBatch returns batch config of the output worker
+func (t OutputConfig) getOutputBatch() (size int, bytes int, interval string) {
+	return t.BatchSize, t.BatchBytes, t.BatchFlushInterval
 }
 
 // OutputHandler is a handler to regist output module
 type OutputHandler func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error)
 
 var (
-	mapOutputHandler = map[string]OutputHandler{}
+	mapOutputHandler         = map[string]OutputHandler{}
+	mapOutputRestartRequired = map[string]bool{}
 )
 
 // RegistOutputHandler regist a output handler
@@ -40,78 +91,145 @@ func RegistOutputHandler(name string, handler OutputHandler) {
 	mapOutputHandler[name] = handler
 }
 
+// RegistOutputRestartRequired marks outputs of type name as holding process global state,
+// ex: registered metrics or http handlers, running outputs of the type can not be
+// stopped or replaced by Config.Reload, a restart is required
+func RegistOutputRestartRequired(name string) {
+	mapOutputRestartRequired[name] = true
+}
+
+// newOutput initializes the output of raw config, output is nil if disabled
+func newOutput(ctx context.Context, raw ConfigRaw, control Control) (output TypeOutputConfig, err error) {
+	if isDisabled(raw) {
+		return nil, nil
+	}
+	outputFilter, ok := raw["type"].(string)
+	if !ok {
+		return nil, ErrorNoFilterName.New(nil, "output")
+	}
+	handler, ok := mapOutputHandler[outputFilter]
+	if !ok {
+		return nil, ErrorUnknownOutputType1.New(nil, raw["type"])
+	}
+	output, err = handler(ctx, raw, control)
+	checkBuilt(ctx, raw, output, err)
+	if err != nil {
+		return nil, ErrorInitOutputFailed1.New(err, raw)
+	}
+	if output, err = withOutputCondition(output, raw); err != nil {
+		return nil, ErrorInitOutputFailed1.New(err, raw)
+	}
+	if _, overflow := getOutputQueue(output); !isOverflowPolicy(overflow) {
+		return nil, ErrorInitOutputFailed1.New(ErrorUnknownOverflow1.New(nil, overflow), raw)
+	}
+	if _, ok := output.(TypeBatchOutputConfig); ok {
+		if _, _, _, err = getOutputBatch(output); err != nil {
+			return nil, ErrorInitOutputFailed1.New(err, raw)
+		}
+	}
+	return output, nil
+}
+
 // GetOutputs get outputs from config
 func GetOutputs(
 	ctx context.Context,
 	outputRaw []ConfigRaw,
 	control Control,
 ) (outputs []TypeOutputConfig, err error) {
-	var output TypeOutputConfig
 	for _, raw := range outputRaw {
-		// check if output is disabled
-		var disabled bool
-		if result, ok := raw["disabled"].(bool); ok {
-			disabled = result
+		output, err := newOutput(ctx, raw, control)
+		if err != nil {
+			return outputs, err
 		}
-		// load input if not disabled
-		if !disabled {
-			outputFilter, ok := raw["type"].(string)
-			if !ok {
-				return outputs, ErrorNoFilterName.New(nil, "output")
-			}
-			handler, ok := mapOutputHandler[outputFilter]
-			if !ok {
-				return outputs, ErrorUnknownOutputType1.New(nil, raw["type"])
-			}
-
-			if output, err = handler(ctx, raw, control); err != nil {
-				return outputs, ErrorInitOutputFailed1.New(err, raw)
-			}
-
+		if output != nil {
 			outputs = append(outputs, output)
 		}
 	}
-	return outputs, err
+	return outputs, nil
 }
 
-func (t *Config) getOutputs() (outputs []TypeOutputConfig, err error) {
-	return GetOutputs(t.ctx, t.OutputRaw, t)
+func (t *PipelineConfig) getOutputs(ctx context.Context, control Control) (outputs []TypeOutputConfig, err error) {
+	return GetOutputs(ctx, t.OutputRaw, control)
 }
 
-func (t *Config) startOutputs() (err error) {
-	outputs, err := t.getOutputs()
-	if err != nil {
-		return err
+// newOutputInstance initializes the output of raw config with its own context
+func (t *PipelineConfig) newOutputInstance(raw ConfigRaw, control Control) (instance *pluginInstance, err error) {
+	instance = t.newPluginInstance(raw)
+	if instance.output, err = newOutput(instance.ctx, raw, control); err != nil {
+		instance.cancel()
+		return nil, err
 	}
+	instance.stats = t.stats.NewPlugin(instance.output.GetType(), GetPluginID(instance.output))
+	return instance, nil
+}
 
+// startOutputs sends events from chFilterOut to the queues of all output workers, until
+// filtersDone is closed and chFilterOut is drained, the returned channel is closed after
+// all output workers drained their queues
+func (t *PipelineConfig) startOutputs(outputs []*pluginInstance, filtersDone <-chan struct{}) <-chan struct{} {
+	workers := make([]*outputWorker, len(outputs))
+	for i, instance := range outputs {
+		workers[i] = t.newOutputWorker(instance)
+	}
+	var debugMutex sync.Mutex
+
+	done := make(chan struct{})
 	t.eg.Go(func() error {
+		var wg sync.WaitGroup
+		for _, worker := range workers {
+			wg.Add(1)
+			t.eg.Go(func() error {
+				defer wg.Done()
+				worker.run()
+				return nil
+			})
+		}
+		defer func() {
+			for _, worker := range workers {
+				close(worker.queue)
+			}
+			wg.Wait()
+			close(done)
+		}()
+
+		// filters return after ctx done, events flushed by filters are still sent to outputs
 		for {
 			select {
-			case <-t.ctx.Done():
+			case <-filtersDone:
 				if len(t.chFilterOut) < 1 {
 					return nil
 				}
 			case event := <-t.chFilterOut:
-				eg, ctx := errgroup.WithContext(t.ctx)
-				for _, output := range outputs {
-					func(output TypeOutputConfig) {
-						eg.Go(func() error {
-							if err2 := output.Output(ctx, event); err2 != nil {
-								goglog.Logger.Errorf("output module %q failed: %v", output.GetType(), err2)
-							}
-							return nil
-						})
-					}(output)
+				if len(workers) < 1 {
+					event.Ack()
+					if t.chOutDebug != nil {
+						t.chOutDebug <- event
+					}
+					continue
 				}
-				if err := eg.Wait(); err != nil {
-					return err
+
+				// the event is acknowledged after acknowledged by all outputs,
+				// and sent to chOutDebug after processed by all outputs,
+				// outputs run concurrently on copy-on-write views of the event
+				pending := int32(len(workers))
+				processed := func() {
+					if t.chOutDebug == nil {
+						return
+					}
+					debugMutex.Lock()
+					defer debugMutex.Unlock()
+					if atomic.AddInt32(&pending, -1) == 0 {
+						t.chOutDebug <- event
+					}
 				}
-				if t.chOutDebug != nil {
-					t.chOutDebug <- event
+				for _, worker := range workers {
+					item := outputItem{event: event.CopyOnWrite(), queued: time.Now(), processed: processed}
+					item.event.ShareAck()
+					worker.push(item)
 				}
+				event.Ack()
 			}
 		}
 	})
-
-	return err
+	return done
 }
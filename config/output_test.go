@@ -0,0 +1,363 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+type testAckOutput struct {
+	OutputConfig
+}
+
+func (t *testAckOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	if event.Message == "reject" {
+		return errors.New("rejected")
+	}
+	return nil
+}
+
+type testAckFilter struct {
+	FilterConfig
+}
+
+func (f *testAckFilter) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	event.Drop = event.Message == "drop"
+	return event, false
+}
+
+func TestOutputAck(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistFilterHandler("test_ack", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		return &testAckFilter{FilterConfig: FilterConfig{CommonConfig: CommonConfig{Type: "test_ack"}}}, nil
+	})
+	RegistOutputHandler("test_ack", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		return &testAckOutput{OutputConfig: OutputConfig{CommonConfig: CommonConfig{Type: "test_ack"}}}, nil
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+filter:
+  - type: test_ack
+output:
+  - type: test_ack
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+
+	results := make(chan error, 1)
+	send := func(message string) error {
+		ack := logevent.NewAck(func(err error) {
+			results <- err
+		})
+		event := logevent.LogEvent{Message: message}
+		event.SetAck(ack)
+		conf.TestInputEvent(event)
+		ack.Done(nil)
+		select {
+		case err := <-results:
+			return err
+		case <-time.After(time.Second):
+			require.FailNow("event not acknowledged", message)
+			return nil
+		}
+	}
+
+	require.NoError(send("accept"))
+	event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+	require.NoError(err)
+	require.False(event.HasAck())
+	require.NoError(send("drop"))
+	require.Error(send("reject"))
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+type testSlowOutput struct {
+	OutputConfig
+	Block bool `json:"block"`
+
+	release  chan struct{}
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (t *testSlowOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	t.mutex.Lock()
+	t.messages = append(t.messages, event.Message)
+	t.mutex.Unlock()
+	if t.Block {
+		<-t.release
+	}
+	return nil
+}
+
+func (t *testSlowOutput) getMessages() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.messages...)
+}
+
+func TestOutputWorkers(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	release := make(chan struct{})
+	var outputs []*testSlowOutput
+	RegistOutputHandler("test_slow", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		conf := &testSlowOutput{release: release}
+		outputs = append(outputs, conf)
+		return conf, ReflectConfig(raw, conf)
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+output:
+  - type: test_slow
+    block: true
+    queue_size: 1
+    overflow: drop_oldest
+  - type: test_slow
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+	require.Len(outputs, 2)
+	slow, fast := outputs[0], outputs[1]
+
+	conf.TestInputEvent(logevent.LogEvent{Message: "a"})
+	require.Eventually(func() bool {
+		return len(slow.getMessages()) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// slow output does not block the fast one, "b" is dropped from the queue of slow output
+	conf.TestInputEvent(logevent.LogEvent{Message: "b"})
+	conf.TestInputEvent(logevent.LogEvent{Message: "c"})
+	require.Eventually(func() bool {
+		return len(fast.getMessages()) == 3
+	}, time.Second, 10*time.Millisecond)
+	require.Equal([]string{"a", "b", "c"}, fast.getMessages())
+
+	close(release)
+	// events are sent to debug channel after processed or dropped by all outputs
+	var messages []string
+	for range 3 {
+		event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+		require.NoError(err)
+		messages = append(messages, event.Message)
+	}
+	require.ElementsMatch([]string{"a", "b", "c"}, messages)
+	require.Equal([]string{"a", "c"}, slow.getMessages())
+
+	cancel()
+	require.NoError(conf.Wait())
+
+	conf, err = LoadFromYAML([]byte(strings.TrimSpace(`
+output:
+  - type: test_slow
+    overflow: drop_newest
+	`)))
+	require.NoError(err)
+	errs := conf.Check(context.Background())
+	require.Len(errs, 1)
+	require.True(ErrorUnknownOverflow1.In(errs[0].(*CheckError).Err))
+}
+
+type testBatchOutput struct {
+	OutputConfig
+
+	mutex   sync.Mutex
+	batches [][]string
+}
+
+func (t *testBatchOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	return t.OutputBatch(ctx, []logevent.LogEvent{event})
+}
+
+func (t *testBatchOutput) OutputBatch(ctx context.Context, events []logevent.LogEvent) error {
+	var messages []string
+	for _, event := range events {
+		messages = append(messages, event.Message)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.batches = append(t.batches, messages)
+	return nil
+}
+
+func (t *testBatchOutput) getBatches() [][]string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([][]string(nil), t.batches...)
+}
+
+func TestOutputBatch(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	var output *testBatchOutput
+	RegistOutputHandler("test_batch", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		output = &testBatchOutput{}
+		return output, ReflectConfig(raw, output)
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+output:
+  - type: test_batch
+    batch_size: 2
+    batch_flush_interval: 200ms
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+
+	// flush by batch size
+	conf.TestInputEvent(logevent.LogEvent{Message: "a"})
+	conf.TestInputEvent(logevent.LogEvent{Message: "b"})
+	require.Eventually(func() bool {
+		return len(output.getBatches()) == 1
+	}, time.Second, 10*time.Millisecond)
+	require.Equal([][]string{{"a", "b"}}, output.getBatches())
+
+	// flush by interval
+	conf.TestInputEvent(logevent.LogEvent{Message: "c"})
+	time.Sleep(50 * time.Millisecond)
+	require.Len(output.getBatches(), 1)
+	require.Eventually(func() bool {
+		return len(output.getBatches()) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Equal([][]string{{"a", "b"}, {"c"}}, output.getBatches())
+
+	for _, message := range []string{"a", "b", "c"} {
+		event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+		require.NoError(err)
+		require.Equal(message, event.Message)
+	}
+
+	cancel()
+	require.NoError(conf.Wait())
+
+	// flush by bytes
+	conf, err = LoadFromYAML([]byte(strings.TrimSpace(`
+output:
+  - type: test_batch
+    batch_bytes: 1
+	`)))
+	require.NoError(err)
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+	conf.TestInputEvent(logevent.LogEvent{Message: "a"})
+	conf.TestInputEvent(logevent.LogEvent{Message: "b"})
+	require.Eventually(func() bool {
+		return len(output.getBatches()) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.Equal([][]string{{"a"}, {"b"}}, output.getBatches())
+	cancel()
+	require.NoError(conf.Wait())
+
+	conf, err = LoadFromYAML([]byte(strings.TrimSpace(`
+output:
+  - type: test_batch
+    batch_flush_interval: soon
+	`)))
+	require.NoError(err)
+	errs := conf.Check(context.Background())
+	require.Len(errs, 1)
+	require.True(ErrorBatchInterval1.In(errs[0].(*CheckError).Err))
+}
+
+type testMutateOutput struct {
+	OutputConfig
+}
+
+func (t *testMutateOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	event.SetValue("nested.value", event.Get("nested.value").(int)+1)
+	event.AddTag("mutated")
+	event.Remove("list[0]")
+	return nil
+}
+
+type testReadOutput struct {
+	OutputConfig
+}
+
+func (t *testReadOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	if event.Get("nested.value") != 1 || len(event.Tags) != 1 || event.Get("list[0]") != "a" {
+		return errors.New("event modified by other outputs")
+	}
+	_, err := event.MarshalJSON()
+	return err
+}
+
+func TestOutputCopyOnWrite(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistOutputHandler("test_mutate", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		return &testMutateOutput{OutputConfig: OutputConfig{CommonConfig: CommonConfig{Type: "test_mutate"}}}, nil
+	})
+	RegistOutputHandler("test_read", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		return &testReadOutput{OutputConfig: OutputConfig{CommonConfig: CommonConfig{Type: "test_read"}}}, nil
+	})
+
+	conf, err := LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+output:
+  - type: test_mutate
+  - type: test_read
+  - type: test_mutate
+  - type: test_read
+	`)))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+
+	newEvent := func() logevent.LogEvent {
+		return logevent.LogEvent{
+			Message: "copy on write",
+			Tags:    append(make([]string, 0, 10), "foo"),
+			Extra: map[string]any{
+				"nested": map[string]any{"value": 1},
+				"list":   []any{"a", "b"},
+			},
+		}
+	}
+	results := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		event := newEvent()
+		ack := logevent.NewAck(func(err error) {
+			results <- err
+		})
+		event.SetAck(ack)
+		conf.TestInputEvent(event)
+		ack.Done(nil)
+	}
+	for i := 0; i < 100; i++ {
+		event, err := conf.TestGetOutputEvent(time.Second)
+		require.NoError(err)
+		expected := newEvent()
+		require.Equal(expected.Tags, event.Tags)
+		require.Equal(expected.Extra, event.Extra)
+		require.NoError(<-results)
+	}
+
+	cancel()
+	require.NoError(conf.Wait())
+}
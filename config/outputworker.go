@@ -0,0 +1,276 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"github.com/tsaikd/gogstash/config/monitor"
+)
+
+// outputLagLogInterval is the interval to log lagging output workers
+var outputLagLogInterval = 10 * time.Second
+
+// getOutputQueue returns queue size and overflow policy of output,
+// outputs not embedding OutputConfig use the defaults
+func getOutputQueue(output TypeOutputConfig) (size int, overflow string) {
+	if conf, ok := output.(interface{ getOutputQueue() (int, string) }); ok {
+		size, overflow = conf.getOutputQueue()
+	}
+	if overflow == "" {
+		overflow = OverflowBlock
+	}
+	return size, overflow
+}
+
+// getOutputBatch returns batch config of output with defaults applied
+func getOutputBatch(output TypeOutputConfig) (size int, bytes int, interval time.Duration, err error) {
+	var intervalRaw string
+	if conf, ok := output.(interface{ getOutputBatch() (int, int, string) }); ok {
+		size, bytes, intervalRaw = conf.getOutputBatch()
+	}
+	if size < 1 {
+		size = DefaultBatchSize
+	}
+	interval = DefaultBatchFlushInterval
+	if intervalRaw != "" {
+		if interval, err = time.ParseDuration(intervalRaw); err != nil || interval <= 0 {
+			return 0, 0, 0, ErrorBatchInterval1.New(err, intervalRaw)
+		}
+	}
+	return size, bytes, interval, nil
+}
+
+func isOverflowPolicy(overflow string) bool {
+	switch overflow {
+	case OverflowBlock, OverflowDropOldest, OverflowDeadLetter:
+		return true
+	}
+	return false
+}
+
+// outputItem is an event queued for an output worker
+type outputItem struct {
+	event     logevent.LogEvent
+	queued    time.Time
+	processed func() // called after the output processed, buffered in a batch or dropped the event
+}
+
+// outputWorker sends events in its queue to one output, so a slow output
+// does not block other outputs until its queue is full
+type outputWorker struct {
+	pipeline *PipelineConfig
+	output   TypeOutputConfig
+	stats    *monitor.PluginStats
+	queue    chan outputItem
+	overflow string
+
+	// batch config of batch outputs
+	batchSize     int
+	batchBytes    int
+	batchInterval time.Duration
+
+	lagMutex sync.Mutex
+	sending  time.Time // queued time of the event sending to output, zero if idle
+	dropped  int64     // events overflowed since last lag log, atomic
+}
+
+func (t *PipelineConfig) newOutputWorker(instance *pluginInstance) *outputWorker {
+	size, overflow := getOutputQueue(instance.output)
+	if size < 1 {
+		size = t.ChannelSize
+	}
+	worker := &outputWorker{
+		pipeline: t,
+		output:   instance.output,
+		stats:    instance.stats,
+		queue:    make(chan outputItem, size),
+		overflow: overflow,
+	}
+	if _, ok := instance.output.(TypeBatchOutputConfig); ok {
+		// batch config is validated in newOutput
+		worker.batchSize, worker.batchBytes, worker.batchInterval, _ = getOutputBatch(instance.output)
+	}
+	return worker
+}
+
+// push queues item by the overflow policy when the queue is full
+func (t *outputWorker) push(item outputItem) {
+	if t.overflow == OverflowBlock {
+		t.queue <- item
+		return
+	}
+	for {
+		select {
+		case t.queue <- item:
+			return
+		default:
+		}
+
+		atomic.AddInt64(&t.dropped, 1)
+		t.stats.Dropped()
+		if t.overflow == OverflowDeadLetter {
+			t.deadLetter(item, ErrorOutputQueueFull1.New(nil, GetPluginID(t.output)))
+			return
+		}
+		// drop the oldest event to queue the new one
+		select {
+		case old := <-t.queue:
+			old.event.Ack()
+			old.processed()
+		default:
+		}
+	}
+}
+
+// run sends queued events to the output until the queue is closed and drained
+func (t *outputWorker) run() {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		ticker := time.NewTicker(outputLagLogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				t.logLag()
+			}
+		}
+	}()
+
+	if output, ok := t.output.(TypeBatchOutputConfig); ok {
+		t.runBatch(output)
+		return
+	}
+	for item := range t.queue {
+		t.setSending(item.queued)
+		t.send(item)
+		t.setSending(time.Time{})
+	}
+}
+
+// runBatch buffers queued events and sends them to the output in batches,
+// a batch is sent when it is full or batchInterval passed since its first event
+func (t *outputWorker) runBatch(output TypeBatchOutputConfig) {
+	var (
+		batch []outputItem
+		bytes int
+	)
+	timer := time.NewTimer(t.batchInterval)
+	timer.Stop()
+	flush := func() {
+		timer.Stop()
+		if len(batch) < 1 {
+			return
+		}
+		t.setSending(batch[0].queued)
+		t.sendBatch(output, batch)
+		t.setSending(time.Time{})
+		batch, bytes = nil, 0
+	}
+
+	for {
+		select {
+		case item, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) < 1 {
+				timer.Reset(t.batchInterval)
+			}
+			batch = append(batch, item)
+			// debug output does not wait for the batch to flush
+			item.processed()
+			if t.batchBytes > 0 {
+				raw, _ := item.event.MarshalJSON()
+				bytes += len(raw)
+			}
+			if len(batch) >= t.batchSize || (t.batchBytes > 0 && bytes >= t.batchBytes) {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+func (t *outputWorker) send(item outputItem) {
+	defer item.processed()
+	t.stats.In()
+	err := t.output.Output(t.pipeline.ctx, item.event)
+	if err != nil {
+		t.stats.Error()
+		goglog.Logger.Errorf("output module %q failed: %v", t.output.GetType(), err)
+	}
+	t.done(item.event, err)
+}
+
+func (t *outputWorker) sendBatch(output TypeBatchOutputConfig, batch []outputItem) {
+	events := make([]logevent.LogEvent, len(batch))
+	for i, item := range batch {
+		t.stats.In()
+		events[i] = item.event
+	}
+	err := output.OutputBatch(t.pipeline.ctx, events)
+	if err != nil {
+		t.stats.Error()
+		goglog.Logger.Errorf("output module %q failed to send %d events: %v", t.output.GetType(), len(events), err)
+	}
+	for _, item := range batch {
+		t.done(item.event, err)
+	}
+}
+
+// done acknowledges the event by the result of the output
+func (t *outputWorker) done(event logevent.LogEvent, err error) {
+	if err == nil {
+		t.stats.Out()
+		event.Ack()
+		return
+	}
+	// event rejected and not written to the dead letter queue
+	// is not acknowledged, so the input can deliver it again
+	if !ErrorOutputRetrying.In(err) && !DeadLetter(t.pipeline.ctx, t.output, event, err) {
+		event.Nack(err)
+		return
+	}
+	event.Ack()
+}
+
+// deadLetter writes the event not queued to the dead letter queue
+func (t *outputWorker) deadLetter(item outputItem, reason error) {
+	defer item.processed()
+	if !DeadLetter(t.pipeline.ctx, t.output, item.event, reason) {
+		item.event.Nack(reason)
+		return
+	}
+	item.event.Ack()
+}
+
+func (t *outputWorker) setSending(queued time.Time) {
+	t.lagMutex.Lock()
+	defer t.lagMutex.Unlock()
+	t.sending = queued
+}
+
+// logLag logs the output falling behind, if events are queued or overflowed
+func (t *outputWorker) logLag() {
+	queued := len(t.queue)
+	dropped := atomic.SwapInt64(&t.dropped, 0)
+	if queued < 1 && dropped < 1 {
+		return
+	}
+	var lag time.Duration
+	t.lagMutex.Lock()
+	if !t.sending.IsZero() {
+		lag = time.Since(t.sending)
+	}
+	t.lagMutex.Unlock()
+	goglog.Logger.Warnf("pipeline %q output %q lagging: %d/%d events queued, oldest event queued %v ago, %d events overflowed (%s)",
+		t.pipeline.Name, GetPluginID(t.output), queued, cap(t.queue), lag.Round(time.Millisecond), dropped, t.overflow)
+}
@@ -0,0 +1,654 @@
+package persistqueue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// queue types
+const (
+	TypeMemory    = "memory"
+	TypePersisted = "persisted"
+)
+
+// fsync policies
+const (
+	FsyncAlways   = "always"   // fsync after every event
+	FsyncInterval = "interval" // fsync every fsync_interval
+	FsyncNever    = "never"    // leave it to the OS
+)
+
+const (
+	pageFilePrefix = "page."
+	checkpointFile = "checkpoint"
+	recordHeader   = 8 // length and crc32 of payload, both uint32
+)
+
+// errors
+var (
+	ErrorInvalidType1     = errutil.NewFactory("invalid queue type: %q")
+	ErrorInvalidFsync1    = errutil.NewFactory("invalid queue fsync policy: %q")
+	ErrorNoPath           = errutil.NewFactory("no path for persisted queue")
+	ErrorEventTooLarge2   = errutil.NewFactory("event size %d exceeds queue max_bytes %d")
+	ErrorCorruptedRecord2 = errutil.NewFactory("corrupted record in page %d at offset %d")
+	ErrorReadCheckpoint1  = errutil.NewFactory("failed to read queue checkpoint %q")
+	ErrClosed             = errors.New("queue closed")
+)
+
+// Config is the queue config of a pipeline
+type Config struct {
+	Type           string `json:"type" yaml:"type"`                       // memory or persisted, default: memory
+	Path           string `json:"path" yaml:"path"`                       // directory of page files, required for persisted queue
+	PageCapacity   int64  `json:"page_capacity" yaml:"page_capacity"`     // max bytes of a page file, default: 64MiB
+	MaxBytes       int64  `json:"max_bytes" yaml:"max_bytes"`             // max bytes of all page files, inputs are blocked when reached, default: 1GiB
+	Fsync          string `json:"fsync" yaml:"fsync"`                     // always, interval or never, default: interval
+	FsyncInterval  string `json:"fsync_interval" yaml:"fsync_interval"`   // default: 1s
+	CheckpointAcks int    `json:"checkpoint_acks" yaml:"checkpoint_acks"` // write checkpoint after number of acknowledged events, default: 1024
+
+	fsyncInterval time.Duration
+}
+
+// IsPersisted returns whether the config asks for a persisted queue
+func (t *Config) IsPersisted() bool {
+	return t != nil && t.Type == TypePersisted
+}
+
+// Init validates config and fills default values
+func (t *Config) Init() (err error) {
+	switch t.Type {
+	case "":
+		t.Type = TypeMemory
+	case TypeMemory, TypePersisted:
+	default:
+		return ErrorInvalidType1.New(nil, t.Type)
+	}
+	if t.Type == TypePersisted && t.Path == "" {
+		return ErrorNoPath.New(nil)
+	}
+	if t.PageCapacity < 1 {
+		t.PageCapacity = 64 * 1024 * 1024
+	}
+	if t.MaxBytes < 1 {
+		t.MaxBytes = 1024 * 1024 * 1024
+	}
+	switch t.Fsync {
+	case "":
+		t.Fsync = FsyncInterval
+	case FsyncAlways, FsyncInterval, FsyncNever:
+	default:
+		return ErrorInvalidFsync1.New(nil, t.Fsync)
+	}
+	if t.FsyncInterval == "" {
+		t.FsyncInterval = "1s"
+	}
+	if t.fsyncInterval, err = time.ParseDuration(t.FsyncInterval); err != nil {
+		return err
+	}
+	if t.CheckpointAcks < 1 {
+		t.CheckpointAcks = 1024
+	}
+	return nil
+}
+
+// position of a record in page files
+type position struct {
+	Page   int64 `json:"page"`
+	Offset int64 `json:"offset"`
+}
+
+// record is the serialized form of an event
+type record struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Message   string         `json:"message,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Extra     map[string]any `json:"extra,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+}
+
+// Queue is a FIFO queue of events backed by append-only page files.
+// Events are kept on disk until acknowledged, unacknowledged events
+// are read again after the queue is reopened.
+type Queue struct {
+	conf Config
+	dir  string
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	closed bool
+
+	writeFile *os.File
+	writePos  position
+	readFile  *os.File
+	readPage  int64
+	readPos   position
+	ackPos    position // position of the first unacknowledged event
+
+	nextSeq  uint64              // sequence of the next read event
+	ackSeq   uint64              // sequence of the first unacknowledged event
+	pending  map[uint64]position // position after each read event
+	acked    map[uint64]bool     // acknowledged events after ackSeq
+	acks     int                 // acknowledged events since last checkpoint
+	count    int                 // unacknowledged events
+	dirty    bool                // written but not synced
+	bytes    int64               // bytes of all page files
+	sealed   map[int64]int64     // size of pages before the write page
+	stopSync chan struct{}
+}
+
+// Open opens or creates a queue in directory dir, dir is created if not exist
+func Open(dir string, conf Config) (queue *Queue, err error) {
+	if err = conf.Init(); err != nil {
+		return
+	}
+	if err = os.MkdirAll(dir, 0o750); err != nil {
+		return
+	}
+
+	queue = &Queue{
+		conf:     conf,
+		dir:      dir,
+		pending:  map[uint64]position{},
+		acked:    map[uint64]bool{},
+		sealed:   map[int64]int64{},
+		readPage: -1,
+		stopSync: make(chan struct{}),
+	}
+	queue.cond = sync.NewCond(&queue.mutex)
+
+	if err = queue.load(); err != nil {
+		return nil, err
+	}
+
+	if conf.Fsync == FsyncInterval {
+		go queue.syncLoop()
+	}
+
+	return queue, nil
+}
+
+func (t *Queue) pagePath(page int64) string {
+	return filepath.Join(t.dir, fmt.Sprintf("%s%020d", pageFilePrefix, page))
+}
+
+func (t *Queue) listPages() (pages []int64, err error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, pageFilePrefix) {
+			continue
+		}
+		var page int64
+		if _, err := fmt.Sscanf(name[len(pageFilePrefix):], "%d", &page); err != nil {
+			continue
+		}
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i] < pages[j] })
+	return
+}
+
+// load restores queue state from page files and checkpoint
+func (t *Queue) load() (err error) {
+	data, err := os.ReadFile(filepath.Join(t.dir, checkpointFile))
+	switch {
+	case err == nil:
+		if err = json.Unmarshal(data, &t.ackPos); err != nil {
+			return ErrorReadCheckpoint1.New(err, t.dir)
+		}
+	case os.IsNotExist(err):
+		err = nil
+	default:
+		return ErrorReadCheckpoint1.New(err, t.dir)
+	}
+
+	pages, err := t.listPages()
+	if err != nil {
+		return
+	}
+
+	// remove pages acknowledged before last shutdown
+	var remains []int64
+	for _, page := range pages {
+		if page < t.ackPos.Page {
+			if err = os.Remove(t.pagePath(page)); err != nil {
+				return
+			}
+			continue
+		}
+		remains = append(remains, page)
+	}
+
+	if len(remains) < 1 {
+		t.ackPos = position{Page: t.ackPos.Page}
+		t.readPos = t.ackPos
+		t.writePos = t.ackPos
+		return t.openWritePage(t.ackPos.Page)
+	}
+	if remains[0] > t.ackPos.Page {
+		t.ackPos = position{Page: remains[0]}
+	}
+
+	for _, page := range remains {
+		info, err := os.Stat(t.pagePath(page))
+		if err != nil {
+			return err
+		}
+		t.bytes += info.Size()
+		t.sealed[page] = info.Size()
+	}
+
+	// drop the incomplete tail of the last page, written before a crash
+	last := remains[len(remains)-1]
+	delete(t.sealed, last)
+	end, err := t.validEnd(last)
+	if err != nil {
+		return
+	}
+	if err = t.openWritePage(last); err != nil {
+		return
+	}
+	info, err := t.writeFile.Stat()
+	if err != nil {
+		return
+	}
+	if info.Size() > end {
+		if err = t.writeFile.Truncate(end); err != nil {
+			return
+		}
+		t.bytes -= info.Size() - end
+	}
+	t.writePos = position{Page: last, Offset: end}
+	t.readPos = t.ackPos
+	t.count, err = t.countRecords(t.ackPos, t.writePos)
+	return err
+}
+
+// countRecords returns number of records between from and to
+func (t *Queue) countRecords(from position, to position) (count int, err error) {
+	for page := from.Page; page <= to.Page; page++ {
+		file, err := os.Open(t.pagePath(page))
+		if err != nil {
+			return count, err
+		}
+		var offset int64
+		if page == from.Page {
+			offset = from.Offset
+		}
+		for page < to.Page || offset < to.Offset {
+			_, size, err := readRecord(file, offset)
+			if err != nil {
+				break
+			}
+			offset += size
+			count++
+		}
+		file.Close()
+	}
+	return count, nil
+}
+
+// validEnd returns the offset after the last complete record of page
+func (t *Queue) validEnd(page int64) (end int64, err error) {
+	file, err := os.Open(t.pagePath(page))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	for {
+		_, size, err := readRecord(file, end)
+		if err != nil {
+			return end, nil
+		}
+		end += size
+	}
+}
+
+func (t *Queue) openWritePage(page int64) (err error) {
+	t.writeFile, err = os.OpenFile(t.pagePath(page), os.O_CREATE|os.O_WRONLY, 0o640)
+	return
+}
+
+// readRecord reads the record at offset, returns payload and total size of record
+func readRecord(file *os.File, offset int64) (payload []byte, size int64, err error) {
+	header := make([]byte, recordHeader)
+	if _, err = file.ReadAt(header, offset); err != nil {
+		return
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	sum := binary.BigEndian.Uint32(header[4:8])
+	payload = make([]byte, length)
+	if _, err = file.ReadAt(payload, offset+recordHeader); err != nil {
+		return
+	}
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	return payload, recordHeader + int64(length), nil
+}
+
+// Push appends event to the queue, blocks while the queue is full
+func (t *Queue) Push(ctx context.Context, event logevent.LogEvent) (err error) {
+	payload, err := json.Marshal(record{
+		Timestamp: event.Timestamp,
+		Message:   event.Message,
+		Tags:      event.Tags,
+		Extra:     event.Extra,
+		Metadata:  event.Metadata,
+	})
+	if err != nil {
+		return
+	}
+	size := recordHeader + int64(len(payload))
+	if size > t.conf.MaxBytes {
+		return ErrorEventTooLarge2.New(nil, size, t.conf.MaxBytes)
+	}
+
+	stop := context.AfterFunc(ctx, t.broadcast)
+	defer stop()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for !t.closed && ctx.Err() == nil && t.bytes+size > t.conf.MaxBytes {
+		t.cond.Wait()
+	}
+	if t.closed {
+		return ErrClosed
+	}
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	if t.writePos.Offset > 0 && t.writePos.Offset+size > t.conf.PageCapacity {
+		if err = t.writeFile.Sync(); err != nil {
+			return
+		}
+		if err = t.writeFile.Close(); err != nil {
+			return
+		}
+		t.sealed[t.writePos.Page] = t.writePos.Offset
+		t.writePos = position{Page: t.writePos.Page + 1}
+		if err = t.openWritePage(t.writePos.Page); err != nil {
+			return
+		}
+	}
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeader:], payload)
+	if _, err = t.writeFile.WriteAt(buf, t.writePos.Offset); err != nil {
+		return
+	}
+	t.writePos.Offset += size
+	t.bytes += size
+	t.count++
+	t.dirty = true
+
+	if t.conf.Fsync == FsyncAlways {
+		if err = t.sync(); err != nil {
+			return
+		}
+	}
+
+	t.cond.Broadcast()
+	return nil
+}
+
+// Pop returns the next unread event and its sequence number for Ack,
+// blocks until there is an event, the rest of a page is skipped after
+// a corrupted record, so the queue does not fail on it after every restart
+func (t *Queue) Pop(ctx context.Context) (event logevent.LogEvent, seq uint64, err error) {
+	stop := context.AfterFunc(ctx, t.broadcast)
+	defer stop()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var rec record
+	for {
+		for !t.closed && ctx.Err() == nil && t.readPos == t.writePos {
+			t.cond.Wait()
+		}
+		if t.closed {
+			return event, 0, ErrClosed
+		}
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		if err = t.openReadPage(); err != nil {
+			return
+		}
+		if next := t.nextPage(t.readPos); next != t.readPos {
+			t.readPos = next
+			if err = t.openReadPage(); err != nil {
+				return
+			}
+		}
+
+		payload, size, readErr := readRecord(t.readFile, t.readPos.Offset)
+		if readErr == nil {
+			rec = record{}
+			readErr = json.Unmarshal(payload, &rec)
+		}
+		if readErr == nil {
+			t.readPos = t.nextPage(position{Page: t.readPos.Page, Offset: t.readPos.Offset + size})
+			break
+		}
+		if err = t.skipCorrupted(readErr); err != nil {
+			return
+		}
+	}
+
+	seq = t.nextSeq
+	t.nextSeq++
+	t.pending[seq] = t.readPos
+
+	event = logevent.LogEvent{
+		Timestamp: rec.Timestamp,
+		Message:   rec.Message,
+		Tags:      rec.Tags,
+		Extra:     rec.Extra,
+		Metadata:  rec.Metadata,
+	}
+	return event, seq, nil
+}
+
+// skipCorrupted moves readPos after the corrupted record to the next page,
+// or to the end of written records of the write page, skipped records are
+// removed with the page after later events acknowledged
+func (t *Queue) skipCorrupted(cause error) (err error) {
+	goglog.Logger.Errorf("%v, skip the rest of the page",
+		ErrorCorruptedRecord2.New(cause, t.readPos.Page, t.readPos.Offset))
+	if t.readPos.Page < t.writePos.Page {
+		t.readPos = t.nextPage(position{Page: t.readPos.Page, Offset: t.sealed[t.readPos.Page]})
+	} else {
+		t.readPos = t.writePos
+	}
+	unread, err := t.countRecords(t.readPos, t.writePos)
+	if err != nil {
+		return err
+	}
+	t.count = len(t.pending) + unread
+	return nil
+}
+
+// nextPage returns the start of the next page if pos is at the end of a sealed page
+func (t *Queue) nextPage(pos position) position {
+	for pos.Page < t.writePos.Page && pos.Offset >= t.sealed[pos.Page] {
+		pos = position{Page: pos.Page + 1}
+	}
+	return pos
+}
+
+func (t *Queue) openReadPage() (err error) {
+	if t.readPage == t.readPos.Page {
+		return nil
+	}
+	if t.readFile != nil {
+		t.readFile.Close()
+	}
+	if t.readFile, err = os.Open(t.pagePath(t.readPos.Page)); err != nil {
+		return
+	}
+	t.readPage = t.readPos.Page
+	return nil
+}
+
+// Ack acknowledges the event of seq returned by Pop, acknowledged events
+// will not be read again after the queue is reopened.
+// Events can be acknowledged in any order.
+func (t *Queue) Ack(seq uint64) (err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if seq < t.ackSeq {
+		return nil
+	}
+	t.acked[seq] = true
+
+	ackPage := t.ackPos.Page
+	for t.acked[t.ackSeq] {
+		t.ackPos = t.nextPage(t.pending[t.ackSeq])
+		delete(t.acked, t.ackSeq)
+		delete(t.pending, t.ackSeq)
+		t.ackSeq++
+		t.acks++
+		t.count--
+	}
+
+	if t.ackPos.Page > ackPage {
+		// pages before ackPos are fully acknowledged
+		if err = t.checkpoint(); err != nil {
+			return
+		}
+		for page := ackPage; page < t.ackPos.Page; page++ {
+			t.bytes -= t.sealed[page]
+			delete(t.sealed, page)
+			if err = os.Remove(t.pagePath(page)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		t.cond.Broadcast()
+	} else if t.acks >= t.conf.CheckpointAcks {
+		return t.checkpoint()
+	}
+	return nil
+}
+
+// Len returns number of unacknowledged events, including unread events
+func (t *Queue) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.count
+}
+
+// checkpoint saves position of the first unacknowledged event
+func (t *Queue) checkpoint() (err error) {
+	if err = t.sync(); err != nil {
+		return
+	}
+	data, err := json.Marshal(t.ackPos)
+	if err != nil {
+		return
+	}
+	tmp := filepath.Join(t.dir, checkpointFile+".tmp")
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return
+	}
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return
+	}
+	if t.conf.Fsync != FsyncNever {
+		if err = file.Sync(); err != nil {
+			file.Close()
+			return
+		}
+	}
+	if err = file.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(tmp, filepath.Join(t.dir, checkpointFile)); err != nil {
+		return
+	}
+	t.acks = 0
+	return nil
+}
+
+func (t *Queue) sync() (err error) {
+	if !t.dirty || t.conf.Fsync == FsyncNever {
+		return nil
+	}
+	if err = t.writeFile.Sync(); err != nil {
+		return
+	}
+	t.dirty = false
+	return nil
+}
+
+func (t *Queue) syncLoop() {
+	ticker := time.NewTicker(t.conf.fsyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stopSync:
+			return
+		case <-ticker.C:
+			t.mutex.Lock()
+			_ = t.sync()
+			t.mutex.Unlock()
+		}
+	}
+}
+
+func (t *Queue) broadcast() {
+	t.mutex.Lock()
+	t.cond.Broadcast()
+	t.mutex.Unlock()
+}
+
+// Close writes the checkpoint and closes page files,
+// blocked Push and Pop return ErrClosed
+func (t *Queue) Close() (err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.cond.Broadcast()
+	close(t.stopSync)
+
+	err = t.checkpoint()
+	if t.readFile != nil {
+		t.readFile.Close()
+	}
+	if err2 := t.writeFile.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
@@ -0,0 +1,241 @@
+package persistqueue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func newEvent(i int) logevent.LogEvent {
+	return logevent.LogEvent{
+		Timestamp: time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+		Message:   fmt.Sprintf("message %d", i),
+		Tags:      []string{"tag"},
+		Extra:     map[string]any{"index": float64(i)},
+	}
+}
+
+func TestQueueReopen(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	conf := Config{Type: TypePersisted, Path: dir, PageCapacity: 256, Fsync: FsyncAlways}
+
+	queue, err := Open(dir, conf)
+	require.NoError(err)
+	for i := 0; i < 10; i++ {
+		require.NoError(queue.Push(ctx, newEvent(i)))
+	}
+	require.Equal(10, queue.Len())
+
+	// acknowledge out of order, only the contiguous acknowledged events are checkpointed
+	seqs := make([]uint64, 4)
+	for i := range seqs {
+		event, seq, err := queue.Pop(ctx)
+		require.NoError(err)
+		require.Equal(newEvent(i), event)
+		seqs[i] = seq
+	}
+	require.NoError(queue.Ack(seqs[1]))
+	require.NoError(queue.Ack(seqs[0]))
+	require.NoError(queue.Ack(seqs[3]))
+	require.Equal(8, queue.Len())
+	require.NoError(queue.Close())
+
+	pages, err := os.ReadDir(dir)
+	require.NoError(err)
+	require.Greater(len(pages), 2, "events should be written to more than one page")
+
+	queue, err = Open(dir, conf)
+	require.NoError(err)
+	require.Equal(8, queue.Len())
+	for i := 2; i < 10; i++ {
+		event, seq, err := queue.Pop(ctx)
+		require.NoError(err)
+		require.Equal(newEvent(i), event)
+		require.NoError(queue.Ack(seq))
+	}
+	require.Equal(0, queue.Len())
+	require.NoError(queue.Close())
+
+	queue, err = Open(dir, conf)
+	require.NoError(err)
+	require.Equal(0, queue.Len())
+	require.NoError(queue.Close())
+
+	pages, err = os.ReadDir(dir)
+	require.NoError(err)
+	require.Len(pages, 2, "only the checkpoint and the write page should be kept")
+}
+
+func TestQueueMaxBytes(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	queue, err := Open(dir, Config{Type: TypePersisted, Path: dir, PageCapacity: 100, MaxBytes: 300})
+	require.NoError(err)
+	defer queue.Close()
+
+	ctx := context.Background()
+	pushed := 0
+	for {
+		ctxTimeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		err := queue.Push(ctxTimeout, newEvent(pushed))
+		cancel()
+		if err != nil {
+			require.ErrorIs(err, context.DeadlineExceeded)
+			break
+		}
+		pushed++
+	}
+	require.Greater(pushed, 0)
+
+	// acknowledge the first page to release space for blocked push
+	done := make(chan error)
+	go func() {
+		done <- queue.Push(ctx, newEvent(pushed))
+	}()
+	_, seq, err := queue.Pop(ctx)
+	require.NoError(err)
+	require.NoError(queue.Ack(seq))
+	select {
+	case err := <-done:
+		require.NoError(err)
+	case <-time.After(time.Second):
+		require.Fail("push should not be blocked after acknowledging")
+	}
+
+	err = queue.Push(ctx, logevent.LogEvent{Message: string(make([]byte, 400))})
+	require.True(ErrorEventTooLarge2.Match(err))
+}
+
+func TestQueueCorruptedTail(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	conf := Config{Type: TypePersisted, Path: dir}
+
+	queue, err := Open(dir, conf)
+	require.NoError(err)
+	require.NoError(queue.Push(ctx, newEvent(0)))
+	require.NoError(queue.Push(ctx, newEvent(1)))
+	require.NoError(queue.Close())
+
+	// simulate a crash while writing the second event
+	path := queue.pagePath(0)
+	info, err := os.Stat(path)
+	require.NoError(err)
+	require.NoError(os.Truncate(path, info.Size()-3))
+
+	queue, err = Open(dir, conf)
+	require.NoError(err)
+	require.Equal(1, queue.Len())
+	event, _, err := queue.Pop(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(0), event)
+	require.NoError(queue.Push(ctx, newEvent(2)))
+	event, _, err = queue.Pop(ctx)
+	require.NoError(err)
+	require.Equal(newEvent(2), event)
+	require.NoError(queue.Close())
+}
+
+func TestQueueCorruptedRecord(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	conf := Config{Type: TypePersisted, Path: dir, PageCapacity: 256, Fsync: FsyncAlways}
+
+	queue, err := Open(dir, conf)
+	require.NoError(err)
+	for i := 0; i < 6; i++ {
+		require.NoError(queue.Push(ctx, newEvent(i)))
+	}
+	require.NoError(queue.Close())
+
+	// flip a byte in the payload of the second record of the first page
+	file, err := os.OpenFile(queue.pagePath(0), os.O_RDWR, 0o640)
+	require.NoError(err)
+	_, size, err := readRecord(file, 0)
+	require.NoError(err)
+	_, err = file.WriteAt([]byte("#"), size+recordHeader+1)
+	require.NoError(err)
+	require.NoError(file.Close())
+
+	// the rest of the corrupted page is skipped, on every reopen until acknowledged
+	for range 2 {
+		queue, err = Open(dir, conf)
+		require.NoError(err)
+		event, _, err := queue.Pop(ctx)
+		require.NoError(err)
+		require.Equal(newEvent(0), event)
+		event, _, err = queue.Pop(ctx)
+		require.NoError(err)
+		require.Equal(newEvent(2), event)
+		require.NoError(queue.Close())
+	}
+
+	queue, err = Open(dir, conf)
+	require.NoError(err)
+	for _, i := range []int{0, 2, 3, 4, 5} {
+		event, seq, err := queue.Pop(ctx)
+		require.NoError(err)
+		require.Equal(newEvent(i), event)
+		require.NoError(queue.Ack(seq))
+	}
+	require.Equal(0, queue.Len())
+	require.NoError(queue.Close())
+	_, err = os.Stat(queue.pagePath(0))
+	require.True(os.IsNotExist(err), "the corrupted page should be removed after acknowledged")
+}
+
+func TestQueuePopCanceled(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	queue, err := Open(dir, Config{Type: TypePersisted, Path: dir})
+	require.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = queue.Pop(ctx)
+	require.ErrorIs(err, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		queue.Close()
+	}()
+	_, _, err = queue.Pop(context.Background())
+	require.ErrorIs(err, ErrClosed)
+}
+
+func TestConfigInit(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	conf := Config{}
+	require.NoError(conf.Init())
+	require.Equal(TypeMemory, conf.Type)
+	require.False(conf.IsPersisted())
+
+	conf = Config{Type: TypePersisted}
+	require.True(ErrorNoPath.Match(conf.Init()))
+	conf = Config{Type: "unknown"}
+	require.True(ErrorInvalidType1.Match(conf.Init()))
+	conf = Config{Type: TypePersisted, Path: "queue", Fsync: "unknown"}
+	require.True(ErrorInvalidFsync1.Match(conf.Init()))
+}
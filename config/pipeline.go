@@ -0,0 +1,355 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/tsaikd/gogstash/config/deadletter"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"github.com/tsaikd/gogstash/config/monitor"
+	"github.com/tsaikd/gogstash/config/persistqueue"
+)
+
+// DefaultPipelineName is the name of the pipeline configured by the top level sections
+const DefaultPipelineName = "main"
+
+// PipelineConfig contains inputs, filters and outputs of one pipeline,
+// each pipeline owns its channels and stops independently of the others
+type PipelineConfig struct {
+	Name      string      `json:"name,omitempty" yaml:"name"`
+	InputRaw  []ConfigRaw `json:"input,omitempty" yaml:"input"`
+	FilterRaw []ConfigRaw `json:"filter,omitempty" yaml:"filter"`
+	OutputRaw []ConfigRaw `json:"output,omitempty" yaml:"output"`
+
+	// channel size: chInFilter, chFilterOut, chOutDebug
+	// defaults to the chsize of the main pipeline
+	ChannelSize int `json:"chsize,omitempty" yaml:"chsize"`
+
+	// number of goroutines running the filter chain, filters are shared by all workers
+	// defaults to the filter_workers of the main pipeline
+	FilterWorkers int `json:"filter_workers,omitempty" yaml:"filter_workers"`
+
+	// events with the same formatted key are always processed by the same
+	// filter worker, so they keep their order, ex: %{host}
+	// events are not ordered by default
+	FilterOrderKey string `json:"filter_order_key,omitempty" yaml:"filter_order_key"`
+
+	// queue between inputs and filters, defaults to the queue of the main pipeline
+	Queue *persistqueue.Config `json:"queue,omitempty" yaml:"queue"`
+
+	// store events rejected by outputs, defaults to the dead letter queue of the main pipeline
+	DeadLetterQueue *deadletter.Config `json:"dead_letter_queue,omitempty" yaml:"dead_letter_queue"`
+
+	chInQueue   MsgChan // channel from input to persisted queue
+	chInFilter  MsgChan // channel from input or persisted queue to filter
+	chFilterOut MsgChan // channel from filter to output
+	chOutDebug  MsgChan // channel from output to debug
+	ctx         context.Context
+	cancel      context.CancelFunc
+	eg          *errgroup.Group
+	done        chan struct{} // closed when all modules of pipeline returned
+	stopped     int32         // set to 1 if stopped by reload
+	queue       *persistqueue.Queue
+	deadLetter  *deadletter.Writer
+	stats       *monitor.PipelineStats // nil if monitor disabled
+
+	inputs []*pluginInstance // running inputs
+	stage  *pipelineStage    // running filters and outputs
+}
+
+// pluginInstance is a plugin built from raw config, running with its own
+// context, so it can be stopped on reload while the pipeline keeps running
+type pluginInstance struct {
+	raw    ConfigRaw
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{} // closed when the input returned, nil for filters and outputs
+	input  TypeInputConfig
+	filter TypeFilterConfig
+	output TypeOutputConfig
+	stats  *monitor.PluginStats // nil if monitor disabled
+}
+
+func (t *PipelineConfig) newPluginInstance(raw ConfigRaw) *pluginInstance {
+	ctx, cancel := context.WithCancel(t.ctx)
+	return &pluginInstance{
+		raw:    raw,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// stop cancels the context of plugin and waits for the input returned
+func (t *pluginInstance) stop() {
+	t.cancel()
+	if t.done != nil {
+		<-t.done
+	}
+}
+
+// pipelineStage is the running filters and outputs of a pipeline
+type pipelineStage struct {
+	filters []*pluginInstance
+	outputs []*pluginInstance
+	stop    chan struct{}   // closed to stop filter workers
+	done    <-chan struct{} // closed when outputs sent all filtered events
+}
+
+// startStage starts filter workers and outputs
+func (t *PipelineConfig) startStage(filters []*pluginInstance, outputs []*pluginInstance) {
+	t.stats.SetPlugins(monitor.KindFilter, pluginStats(filters))
+	t.stats.SetPlugins(monitor.KindOutput, pluginStats(outputs))
+	stop := make(chan struct{})
+	filtersDone := t.startFilters(filters, stop)
+	t.stage = &pipelineStage{
+		filters: filters,
+		outputs: outputs,
+		stop:    stop,
+		done:    t.startOutputs(outputs, filtersDone),
+	}
+}
+
+// drain stops filter workers and waits for outputs sent all filtered events,
+// events not taken by filter workers remain in chInFilter
+func (t *pipelineStage) drain() {
+	close(t.stop)
+	<-t.done
+}
+
+// pluginStats returns statistics of instances
+func pluginStats(instances []*pluginInstance) []*monitor.PluginStats {
+	stats := make([]*monitor.PluginStats, len(instances))
+	for i, instance := range instances {
+		stats[i] = instance.stats
+	}
+	return stats
+}
+
+// setStats sets statistics of the pipeline and its channels
+func (t *PipelineConfig) setStats(stats *monitor.PipelineStats) {
+	t.stats = stats
+	channel := func(ch MsgChan) func() monitor.ChannelSnapshot {
+		return func() monitor.ChannelSnapshot {
+			return monitor.ChannelSnapshot{Length: len(ch), Capacity: cap(ch)}
+		}
+	}
+	stats.SetChannel("in_filter", channel(t.chInFilter))
+	stats.SetChannel("filter_out", channel(t.chFilterOut))
+}
+
+func isDisabled(raw ConfigRaw) bool {
+	disabled, _ := raw["disabled"].(bool)
+	return disabled
+}
+
+// enabledRaws returns raw configs not disabled
+func enabledRaws(raws []ConfigRaw) (enabled []ConfigRaw) {
+	for _, raw := range raws {
+		if !isDisabled(raw) {
+			enabled = append(enabled, raw)
+		}
+	}
+	return enabled
+}
+
+func initPipeline(pipeline *PipelineConfig, defaults PipelineConfig, debug bool) (err error) {
+	if pipeline.ChannelSize < 1 {
+		pipeline.ChannelSize = defaults.ChannelSize
+	}
+	if pipeline.FilterWorkers < 1 {
+		pipeline.FilterWorkers = defaults.FilterWorkers
+	}
+	if pipeline.Queue == nil && defaults.Queue != nil {
+		queue := *defaults.Queue
+		pipeline.Queue = &queue
+	}
+
+	if pipeline.DeadLetterQueue == nil && defaults.DeadLetterQueue != nil {
+		dlq := *defaults.DeadLetterQueue
+		pipeline.DeadLetterQueue = &dlq
+	}
+	if pipeline.DeadLetterQueue != nil {
+		if err = pipeline.DeadLetterQueue.Init(); err != nil {
+			return err
+		}
+	}
+
+	if pipeline.Queue.IsPersisted() {
+		if err = pipeline.Queue.Init(); err != nil {
+			return err
+		}
+		// unbuffered, so events are only kept in memory until persisted,
+		// and acknowledged only after taken by a filter worker
+		pipeline.chInQueue = make(MsgChan)
+		pipeline.chInFilter = make(MsgChan)
+	} else {
+		pipeline.chInFilter = make(MsgChan, pipeline.ChannelSize)
+	}
+	pipeline.chFilterOut = make(MsgChan, pipeline.ChannelSize)
+	if debug {
+		pipeline.chOutDebug = make(MsgChan, pipeline.ChannelSize)
+	}
+	return nil
+}
+
+// chInput returns the channel inputs send events to
+func (t *PipelineConfig) chInput() MsgChan {
+	if t.chInQueue != nil {
+		return t.chInQueue
+	}
+	return t.chInFilter
+}
+
+// startQueue opens the persisted queue if configured, events remaining
+// in the queue since last run are passed to filters before new events
+func (t *PipelineConfig) startQueue() (err error) {
+	if !t.Queue.IsPersisted() {
+		return nil
+	}
+	if t.queue, err = persistqueue.Open(filepath.Join(t.Queue.Path, t.Name), *t.Queue); err != nil {
+		return err
+	}
+	if count := t.queue.Len(); count > 0 {
+		goglog.Logger.Infof("pipeline %q replaying %d events from persisted queue", t.Name, count)
+	}
+
+	t.eg.Go(func() error {
+		for {
+			select {
+			case <-t.ctx.Done():
+				return nil
+			case event := <-t.chInQueue:
+				if err := t.queue.Push(t.ctx, event); err != nil {
+					event.Nack(err)
+					if t.ctx.Err() != nil {
+						return nil
+					}
+					return err
+				}
+				// the persisted queue takes over the delivery
+				event.Ack()
+			}
+		}
+	})
+
+	t.eg.Go(func() error {
+		for {
+			event, seq, err := t.queue.Pop(t.ctx)
+			if err != nil {
+				if t.ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			// acknowledge the queue after outputs delivered the event,
+			// events not acknowledged are replayed on next start
+			ack := logevent.NewAck(func(err error) {
+				if err != nil {
+					return
+				}
+				if err = t.queue.Ack(seq); err != nil {
+					goglog.Logger.Errorf("pipeline %q acknowledge persisted queue failed: %v", t.Name, err)
+				}
+			})
+			event.SetAck(ack)
+			ack.Done(nil)
+			select {
+			case <-t.ctx.Done():
+				return nil
+			case t.chInFilter <- event:
+			}
+		}
+	})
+
+	return nil
+}
+
+// startPipelines starts all modules of pipelines in goroutines,
+// inputs of all pipelines are started before any filter or output,
+// so pipeline addresses are listening before events are sent to them
+func startPipelines(ctx context.Context, control Control, registry *monitor.Registry, pipelines []*PipelineConfig) (err error) {
+	for _, pipeline := range pipelines {
+		pipeline.setStats(registry.Pipeline(pipeline.Name))
+		pipelineCtx, cancel := context.WithCancel(context.WithValue(ctx, pipelineContextKey{}, pipeline))
+		pipeline.eg, pipeline.ctx = errgroup.WithContext(pipelineCtx)
+		pipeline.cancel = cancel
+		pipeline.done = make(chan struct{})
+		if err = pipeline.startQueue(); err != nil {
+			return err
+		}
+		if err = pipeline.startDeadLetterQueue(); err != nil {
+			return err
+		}
+	}
+	for _, pipeline := range pipelines {
+		if err = pipeline.startInputs(control); err != nil {
+			return err
+		}
+	}
+	for _, pipeline := range pipelines {
+		if err = pipeline.startFilterOutputs(control); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startFilterOutputs initializes filters and outputs, then starts them
+func (t *PipelineConfig) startFilterOutputs(control Control) (err error) {
+	var filters, outputs []*pluginInstance
+	for _, raw := range enabledRaws(t.FilterRaw) {
+		instance, err := t.newFilterInstance(raw, control)
+		if err != nil {
+			return err
+		}
+		filters = append(filters, instance)
+	}
+	for _, raw := range enabledRaws(t.OutputRaw) {
+		instance, err := t.newOutputInstance(raw, control)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, instance)
+	}
+	t.startStage(filters, outputs)
+	return nil
+}
+
+// wait blocks until all modules of pipeline returned
+func (t *PipelineConfig) wait() (err error) {
+	err = t.eg.Wait()
+	if t.queue != nil {
+		if err2 := t.queue.Close(); err == nil {
+			err = err2
+		}
+	}
+	if t.deadLetter != nil {
+		if err2 := t.deadLetter.Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+// TestInputEvent send an event to the input channel, used for testing
+func (t *PipelineConfig) TestInputEvent(event logevent.LogEvent) {
+	t.chInput() <- event
+}
+
+// TestGetOutputEvent get an event from chOutDebug, used for testing
+func (t *PipelineConfig) TestGetOutputEvent(timeout time.Duration) (event logevent.LogEvent, err error) {
+	ctx, cancel := context.WithTimeout(t.ctx, timeout)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		return
+	case ev := <-t.chOutDebug:
+		return ev, nil
+	case <-time.After(timeout + 10*time.Millisecond):
+		return event, ErrorTimeout1.New(nil, timeout)
+	}
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// errors
+var (
+	ErrorPipelineAddressInUse1    = errutil.NewFactory("pipeline address already in use: %q")
+	ErrorPipelineAddressNotFound1 = errutil.NewFactory("pipeline address not found: %q")
+)
+
+type pipelineListener struct {
+	ctx     context.Context
+	msgChan chan<- logevent.LogEvent
+}
+
+var (
+	pipelineBusMutex   sync.RWMutex
+	mapPipelineAddress = map[string]pipelineListener{}
+)
+
+// ListenPipelineAddress registers a virtual address, events sent to the
+// address by SendToPipelineAddress will be pushed to msgChan.
+// The address is released when ctx is done, an address of a done listener
+// can be listened again before released, ex: an input restarted on reload.
+func ListenPipelineAddress(ctx context.Context, address string, msgChan chan<- logevent.LogEvent) (err error) {
+	pipelineBusMutex.Lock()
+	defer pipelineBusMutex.Unlock()
+
+	if listener, ok := mapPipelineAddress[address]; ok && listener.ctx.Err() == nil {
+		return ErrorPipelineAddressInUse1.New(nil, address)
+	}
+	mapPipelineAddress[address] = pipelineListener{ctx: ctx, msgChan: msgChan}
+
+	go func() {
+		<-ctx.Done()
+		pipelineBusMutex.Lock()
+		defer pipelineBusMutex.Unlock()
+		if mapPipelineAddress[address].msgChan == msgChan {
+			delete(mapPipelineAddress, address)
+		}
+	}()
+
+	return nil
+}
+
+// SendToPipelineAddress sends event to the pipeline listening on address,
+// it blocks until the receiving pipeline accepts the event or ctx is done.
+// If the listener is done before accepting, event is sent to the next listener of address.
+// The event sent shares the acknowledgement of event, it is acknowledged by the receiving pipeline,
+// the acknowledgement of event is not failed by an error returned, the caller decides by the error.
+func SendToPipelineAddress(ctx context.Context, address string, event logevent.LogEvent) (err error) {
+	event.ShareAck()
+	defer func() {
+		if err != nil {
+			event.Ack()
+		}
+	}()
+	for {
+		pipelineBusMutex.RLock()
+		listener, ok := mapPipelineAddress[address]
+		pipelineBusMutex.RUnlock()
+		if !ok {
+			return ErrorPipelineAddressNotFound1.New(nil, address)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case listener.msgChan <- event:
+			return nil
+		case <-listener.ctx.Done():
+			// wait for the address released or listened again
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+}
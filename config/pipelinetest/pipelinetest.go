@@ -0,0 +1,324 @@
+package pipelinetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/icza/dyno"
+	"github.com/tsaikd/KDGoLib/errutil"
+	"gopkg.in/yaml.v2"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// errors
+var (
+	ErrorReadFixture1     = errutil.NewFactory("read fixture %q failed")
+	ErrorParseFixture1    = errutil.NewFactory("parse fixture %q failed")
+	ErrorNoCases1         = errutil.NewFactory("no cases in fixture %q")
+	ErrorPipelineNotFound = errutil.NewFactory("pipeline %q not found")
+	ErrorInvalidEvent1    = errutil.NewFactory("invalid event: %v")
+	ErrorCaseFailed2      = errutil.NewFactory("%s: run case %q failed")
+)
+
+// Fixture is a file of test cases, in YAML or JSON format
+type Fixture struct {
+	// pipeline to test, defaults to the main pipeline
+	Pipeline string `json:"pipeline,omitempty" yaml:"pipeline"`
+	// fields not compared in all cases, e.g. "geoip" ignores all fields under geoip
+	IgnoreFields []string `json:"ignore_fields,omitempty" yaml:"ignore_fields"`
+	Cases        []Case   `json:"cases" yaml:"cases"`
+}
+
+// Case is input events and the events expected after filters
+type Case struct {
+	Name string `json:"name" yaml:"name"`
+	// pipeline to test, defaults to the pipeline of the fixture
+	Pipeline     string           `json:"pipeline,omitempty" yaml:"pipeline"`
+	IgnoreFields []string         `json:"ignore_fields,omitempty" yaml:"ignore_fields"`
+	Input        []map[string]any `json:"input" yaml:"input"`
+	Expected     []map[string]any `json:"expected" yaml:"expected"`
+}
+
+// Diff is a difference between an expected and an actual event
+type Diff struct {
+	Event    int    // index of the event
+	Field    string // empty if the number of events differ
+	Expected any
+	Actual   any
+	Missing  bool // field expected but not found
+	Extra    bool // field found but not expected
+}
+
+func (t Diff) String() string {
+	switch {
+	case t.Field == "":
+		return fmt.Sprintf("expected %v events, actual %v events", t.Expected, t.Actual)
+	case t.Missing:
+		return fmt.Sprintf("event[%d] %s: missing, expected %s", t.Event, t.Field, formatValue(t.Expected))
+	case t.Extra:
+		return fmt.Sprintf("event[%d] %s: unexpected %s", t.Event, t.Field, formatValue(t.Actual))
+	default:
+		return fmt.Sprintf("event[%d] %s: expected %s, actual %s", t.Event, t.Field, formatValue(t.Expected), formatValue(t.Actual))
+	}
+}
+
+// Result is the result of a case
+type Result struct {
+	File  string
+	Case  string
+	Diffs []Diff
+}
+
+// Passed returns true if the actual events equal the expected events
+func (t Result) Passed() bool {
+	return len(t.Diffs) < 1
+}
+
+// LoadFixture loads the fixture file of path
+func LoadFixture(path string) (fixture Fixture, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fixture, ErrorReadFixture1.New(err, path)
+	}
+	// YAML is a superset of JSON, convert maps for encoding/json after parsing
+	var obj any
+	if err = yaml.Unmarshal(data, &obj); err != nil {
+		return fixture, ErrorParseFixture1.New(err, path)
+	}
+	if data, err = json.Marshal(dyno.ConvertMapI2MapS(obj)); err != nil {
+		return fixture, ErrorParseFixture1.New(err, path)
+	}
+	if err = json.Unmarshal(data, &fixture); err != nil {
+		return fixture, ErrorParseFixture1.New(err, path)
+	}
+	if len(fixture.Cases) < 1 {
+		return fixture, ErrorNoCases1.New(nil, path)
+	}
+	return fixture, nil
+}
+
+// Run runs the cases of fixture through the filters of conf, file is the name in results
+func Run(ctx context.Context, conf *config.Config, file string, fixture Fixture) (results []Result, err error) {
+	if conf.Event != nil {
+		logevent.SetConfig(conf.Event)
+	}
+	for i, testCase := range fixture.Cases {
+		name := testCase.Name
+		if name == "" {
+			name = fmt.Sprintf("case[%d]", i)
+		}
+		pipelineName := testCase.Pipeline
+		if pipelineName == "" {
+			pipelineName = fixture.Pipeline
+		}
+		ignoreFields := append(append([]string{}, fixture.IgnoreFields...), testCase.IgnoreFields...)
+
+		actual, err := runCase(ctx, conf, pipelineName, testCase.Input)
+		if err != nil {
+			return results, ErrorCaseFailed2.New(err, file, name)
+		}
+		expected, err := normalize(testCase.Expected)
+		if err != nil {
+			return results, ErrorCaseFailed2.New(err, file, name)
+		}
+		results = append(results, Result{
+			File:  file,
+			Case:  name,
+			Diffs: diffEvents(expected, actual, ignoreFields),
+		})
+	}
+	return results, nil
+}
+
+// runCase passes input events through new instances of the pipeline filters
+func runCase(ctx context.Context, conf *config.Config, pipelineName string, input []map[string]any) (events []logevent.LogEvent, err error) {
+	if pipelineName == "" {
+		pipelineName = config.DefaultPipelineName
+	}
+	pipeline := conf.GetPipeline(pipelineName)
+	if pipeline == nil {
+		return nil, ErrorPipelineNotFound.New(nil, pipelineName)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	// stop goroutines started by filters
+	defer cancel()
+	filters, err := config.GetFilters(ctx, pipeline.FilterRaw, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, raw := range input {
+		event, err := newEvent(raw)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, config.ApplyFilters(ctx, filters, event)...)
+	}
+	// events held by filters, e.g. aggregations, are flushed at the end of the case
+	events = append(events, config.FlushFilters(ctx, filters, true)...)
+	return events, nil
+}
+
+// newEvent returns the event of raw, which is in the format of the json codec
+func newEvent(raw map[string]any) (event logevent.LogEvent, err error) {
+	event.Timestamp = time.Now()
+	for key, value := range raw {
+		switch key {
+		case logevent.TimestampField:
+			s, _ := value.(string)
+			if event.Timestamp, err = time.Parse(time.RFC3339Nano, s); err != nil {
+				return event, ErrorInvalidEvent1.New(err, raw)
+			}
+		case logevent.MessageField:
+			event.Message = fmt.Sprint(value)
+		case logevent.TagsField:
+			if !event.ParseTags(value) {
+				return event, ErrorInvalidEvent1.New(nil, raw)
+			}
+		case logevent.MetadataField:
+			metadata, ok := value.(map[string]any)
+			if !ok {
+				return event, ErrorInvalidEvent1.New(nil, raw)
+			}
+			event.Metadata = metadata
+		default:
+			event.SetValue(key, value)
+		}
+	}
+	return event, nil
+}
+
+// normalize converts values of events to the types decoded from JSON
+func normalize(events []map[string]any) (result []map[string]any, err error) {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// eventMap returns the event as written by outputs, with @metadata
+func eventMap(event logevent.LogEvent) (result map[string]any, err error) {
+	data, err := event.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	if event.Metadata != nil {
+		metadata, err := normalize([]map[string]any{event.Metadata})
+		if err != nil {
+			return nil, err
+		}
+		result[logevent.MetadataField] = metadata[0]
+	}
+	return result, nil
+}
+
+// diffEvents compares events field by field, @timestamp and @metadata are compared only if expected
+func diffEvents(expected []map[string]any, actual []logevent.LogEvent, ignoreFields []string) (diffs []Diff) {
+	if len(expected) != len(actual) {
+		diffs = append(diffs, Diff{Expected: len(expected), Actual: len(actual)})
+	}
+	for i := 0; i < len(expected) && i < len(actual); i++ {
+		actualMap, err := eventMap(actual[i])
+		if err != nil {
+			diffs = append(diffs, Diff{Event: i, Field: "*", Expected: expected[i], Actual: err.Error()})
+			continue
+		}
+		for _, field := range []string{logevent.TimestampField, logevent.MetadataField} {
+			if _, ok := expected[i][field]; !ok {
+				delete(actualMap, field)
+			}
+		}
+
+		expectedFields := map[string]any{}
+		flatten(expectedFields, "", expected[i])
+		actualFields := map[string]any{}
+		flatten(actualFields, "", actualMap)
+
+		for _, field := range sortedKeys(expectedFields, actualFields) {
+			if isIgnored(field, ignoreFields) {
+				continue
+			}
+			expectedValue, expectedOK := expectedFields[field]
+			actualValue, actualOK := actualFields[field]
+			switch {
+			case !actualOK:
+				diffs = append(diffs, Diff{Event: i, Field: field, Expected: expectedValue, Missing: true})
+			case !expectedOK:
+				diffs = append(diffs, Diff{Event: i, Field: field, Actual: actualValue, Extra: true})
+			case !reflect.DeepEqual(expectedValue, actualValue):
+				diffs = append(diffs, Diff{Event: i, Field: field, Expected: expectedValue, Actual: actualValue})
+			}
+		}
+	}
+	return diffs
+}
+
+// flatten sets leaf values of value into fields by path, e.g. "nginx.status", "tags[0]"
+func flatten(fields map[string]any, path string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) > 0 || path == "" {
+			for key, val := range v {
+				if path != "" {
+					key = path + "." + key
+				}
+				flatten(fields, key, val)
+			}
+			return
+		}
+	case []any:
+		if len(v) > 0 {
+			for i, val := range v {
+				flatten(fields, fmt.Sprintf("%s[%d]", path, i), val)
+			}
+			return
+		}
+	}
+	fields[path] = value
+}
+
+func isIgnored(field string, ignoreFields []string) bool {
+	for _, ignore := range ignoreFields {
+		if field == ignore || strings.HasPrefix(field, ignore+".") || strings.HasPrefix(field, ignore+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(maps ...map[string]any) []string {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, m := range maps {
+		for key := range m {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatValue(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,110 @@
+package pipelinetest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config"
+	filteraddfield "github.com/tsaikd/gogstash/filter/addfield"
+	filterdrop "github.com/tsaikd/gogstash/filter/drop"
+	filterjson "github.com/tsaikd/gogstash/filter/json"
+)
+
+func init() {
+	config.RegistFilterHandler(filteraddfield.ModuleName, filteraddfield.InitHandler)
+	config.RegistFilterHandler(filterdrop.ModuleName, filterdrop.InitHandler)
+	config.RegistFilterHandler(filterjson.ModuleName, filterjson.InitHandler)
+}
+
+func Test_pipelinetest(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+filter:
+  - type: json
+  - type: add_field
+    key: env
+    value: prod
+  - type: drop
+    if: 'level == "debug"'
+pipelines:
+  - name: other
+    filter:
+      - type: add_field
+        key: env
+        value: test
+	`)))
+	require.NoError(err)
+
+	path := filepath.Join(t.TempDir(), "fixture.yml")
+	require.NoError(os.WriteFile(path, []byte(strings.TrimSpace(`
+ignore_fields:
+  - host
+cases:
+  - name: parse json
+    input:
+      - message: '{"level":"info","user":{"id":1},"host":"a"}'
+    expected:
+      - message: '{"level":"info","user":{"id":1},"host":"a"}'
+        level: info
+        user:
+          id: 1
+        env: prod
+  - name: drop debug
+    input:
+      - message: '{"level":"debug"}'
+    expected: []
+  - name: wrong
+    input:
+      - message: '{"level":"info","tags":["a"]}'
+        "@timestamp": "2024-01-02T03:04:05Z"
+    expected:
+      - level: warn
+        env: prod
+        tags: ["a", "b"]
+        "@timestamp": "2024-01-02T03:04:05Z"
+  - name: other pipeline
+    pipeline: other
+    input:
+      - message: hello
+    expected:
+      - message: hello
+        env: test
+	`)), 0o600))
+
+	fixture, err := LoadFixture(path)
+	require.NoError(err)
+	require.Len(fixture.Cases, 4)
+
+	results, err := Run(context.Background(), &conf, path, fixture)
+	require.NoError(err)
+	require.Len(results, 4)
+	require.True(results[0].Passed(), "%v", results[0].Diffs)
+	require.True(results[1].Passed(), "%v", results[1].Diffs)
+	require.True(results[3].Passed(), "%v", results[3].Diffs)
+
+	require.False(results[2].Passed())
+	var diffs []string
+	for _, diff := range results[2].Diffs {
+		diffs = append(diffs, diff.String())
+	}
+	require.Equal([]string{
+		`event[0] level: expected "warn", actual "info"`,
+		`event[0] message: unexpected "{\"level\":\"info\",\"tags\":[\"a\"]}"`,
+		`event[0] tags[1]: missing, expected "b"`,
+	}, diffs)
+
+	fixture.Cases[0].Pipeline = "missing"
+	_, err = Run(context.Background(), &conf, path, fixture)
+	require.True(ErrorPipelineNotFound.In(err))
+
+	require.NoError(os.WriteFile(path, []byte("cases: []"), 0o600))
+	_, err = LoadFixture(path)
+	require.True(ErrorNoCases1.In(err))
+}
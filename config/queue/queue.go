@@ -25,6 +25,7 @@ type Queue interface {
 	Output(ctx context.Context, event logevent.LogEvent) error // has to be here to be a supported TypeOutputConfig.
 	Queue(ctx context.Context, event any) error                // allows the output to queue an event, also pausing the input if needed. Thread safe.
 	Resume(ctx context.Context) error                          // informs that the output is working again - can be called multiple times and is thread safe.
+	Paused() bool                                              // returns true if the output requested pause and queues events instead of sending them.
 }
 
 const (
@@ -34,4 +35,5 @@ const (
 
 var (
 	ErrContextCancelled = errutil.NewFactory("context canceled")
+	ErrQueueFull        = errutil.NewFactory("queue full, event dropped")
 )
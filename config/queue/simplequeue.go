@@ -24,6 +24,38 @@ type simpleQueue struct {
 	codecCh   chan []byte // channel to push a coded message onto
 }
 
+// queuedEvent is an event waiting for retry, it holds the acknowledgement of the event
+// until the retry delivered it, so the input does not commit an event only kept in memory
+type queuedEvent struct {
+	event   logevent.LogEvent
+	release func(err error)
+}
+
+// hold wraps an event to queue with a hold of its acknowledgement
+func hold(event any) any {
+	if v, ok := event.(logevent.LogEvent); ok {
+		return queuedEvent{event: v, release: v.HoldAck()}
+	}
+	return event
+}
+
+// releaseQueued releases the acknowledgement held by a queued event, if any
+func releaseQueued(event any, err error) {
+	if v, ok := event.(queuedEvent); ok {
+		v.release(err)
+	}
+}
+
+// retried releases the acknowledgement of a retried event by the result of the retry,
+// an event queued again by the output holds a new acknowledgement
+func retried(v queuedEvent, err error) {
+	if err != nil && !config.ErrorOutputRetrying.In(err) {
+		v.release(err)
+		return
+	}
+	v.release(nil)
+}
+
 // Resume informs that the output is working again - can be called multiple times and is thread safe.
 // Should be called after each successfully delivery by the output.
 func (t *simpleQueue) Resume(ctx context.Context) error {
@@ -34,8 +66,14 @@ func (t *simpleQueue) Resume(ctx context.Context) error {
 	return nil
 }
 
+// Paused returns true if the output requested pause and events are queued for retry
+func (t *simpleQueue) Paused() bool {
+	return atomic.LoadUint32(&t.isInPause) == StatusPaused
+}
+
 // Queue queues an event into the queue, blocking if necessary until canceled. Queue is used from the output to put something into the queue.
 // A call to add an event onto the queue will also pause the input.
+// A queued logevent.LogEvent is not acknowledged until it is delivered by a retry.
 func (t *simpleQueue) Queue(ctx context.Context, event any) error {
 	if atomic.CompareAndSwapUint32(&t.isInPause, StatusDelivering, StatusPaused) {
 		goglog.Logger.Debugf("queue %s is requesting pause", t.GetType())
@@ -44,11 +82,14 @@ func (t *simpleQueue) Queue(ctx context.Context, event any) error {
 			goglog.Logger.Errorf("queue %s: %s", t.GetType(), err.Error())
 		}
 	}
+	event = hold(event)
 	select {
 	case t.queue <- event:
 		return nil
 	case <-ctx.Done():
-		return ErrContextCancelled.New(nil)
+		err := ErrContextCancelled.New(nil)
+		releaseQueued(event, err)
+		return err
 	}
 }
 
@@ -79,18 +120,25 @@ func (t *simpleQueue) GetType() string {
 	return t.output.GetType()
 }
 
+// PluginConfig returns the config of the output, used by the config check
+func (t *simpleQueue) PluginConfig() any {
+	return t.output
+}
+
 // Output satisfies TypeOutputConfig and is handling incoming events
 func (t *simpleQueue) Output(ctx context.Context, event logevent.LogEvent) (err error) {
 	// see if output has requested pause and if so just queue the event instead of trying
 	if atomic.LoadUint32(&t.isInPause) == StatusPaused {
+		queued := hold(event)
 		select {
-		case t.queue <- event:
+		case t.queue <- queued:
 			return nil
 		case <-ctx.Done():
-			return ErrContextCancelled.New(nil)
 		case <-t.ctx.Done():
-			return ErrContextCancelled.New(nil)
 		}
+		err = ErrContextCancelled.New(nil)
+		releaseQueued(queued, err)
+		return err
 	}
 	// If we are not in pause mode then call the sender method
 	return t.output.OutputEvent(ctx, event)
@@ -109,9 +157,15 @@ func (t *simpleQueue) backgroundtask() {
 		case event := <-t.queue:
 			if (retryqueue.Len() < t.MaxQueueSize) || t.MaxQueueSize == -1 {
 				retryqueue.PushBack(event)
+			} else {
+				releaseQueued(event, ErrQueueFull.New(nil))
 			}
 		case <-t.ctx.Done():
 			goglog.Logger.Debugf("queue %s closing", t.GetType())
+			// events not retried are delivered again by inputs after restart
+			for e := retryqueue.Front(); e != nil; e = e.Next() {
+				releaseQueued(e.Value, ErrContextCancelled.New(nil))
+			}
 			return
 		case <-ticker.C:
 			// We have reached a RetryInterval. If there are any events in the queue, lets send one back.
@@ -122,13 +176,14 @@ func (t *simpleQueue) backgroundtask() {
 					msg := e.Value
 					retryqueue.Remove(e)
 					switch v := msg.(type) {
-					case logevent.LogEvent:
+					case queuedEvent:
 						go func() {
 							ctx, cancel := context.WithTimeout(context.Background(), dur)
-							err := t.output.OutputEvent(ctx, v)
+							err := t.output.OutputEvent(ctx, v.event)
 							if err != nil {
 								goglog.Logger.Errorf("queue: %ssendone %s", t.GetType(), err.Error())
 							}
+							retried(v, err)
 							cancel()
 						}()
 					case []byte:
@@ -168,11 +223,12 @@ func (t *simpleQueue) backgroundtask() {
 									return
 								case t.codecCh <- v:
 								}
-							case logevent.LogEvent:
-								err := t.Output(ctx, v)
+							case queuedEvent:
+								err := t.Output(ctx, v.event)
 								if err != nil {
 									goglog.Logger.Errorf("queue: %s sendall %s", t.GetType(), err.Error())
 								}
+								retried(v, err)
 							default:
 								goglog.Logger.Errorf("Invalid type %T", v)
 							}
@@ -132,3 +132,42 @@ func TestNewSimpleQueue1(t *testing.T) {
 		t.Error("control got no resumes, expected at least 1")
 	}
 }
+
+// check that a queued event is acknowledged after the retry delivered it
+func TestSimpleQueueHoldAck(t *testing.T) {
+	control := newControlCounter()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	o := &sampleOutput{doneCh: make(chan struct{}), target: 1, FailMsgID: []uint32{1}}
+	q := NewSimpleQueue(ctx, control, o, nil, 1, 1)
+	o.queue = q
+
+	acked := make(chan error, 1)
+	ack := logevent.NewAck(func(err error) { acked <- err })
+	event := logevent.LogEvent{Message: "retry"}
+	event.SetAck(ack)
+	ack.Done(nil)
+
+	if err := q.Output(ctx, event); err != nil {
+		t.Fatal(err)
+	}
+	// the output worker acknowledges its copy of the event
+	event.Ack()
+	select {
+	case err := <-acked:
+		t.Fatalf("event acknowledged before retry: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("test timed out")
+	case err := <-acked:
+		if err != nil {
+			t.Errorf("event acknowledged with error: %v", err)
+		}
+	}
+	if atomic.LoadUint32(&o.numSent) != 1 {
+		t.Errorf("Received %v messages, expected 1 message", o.numSent)
+	}
+}
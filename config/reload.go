@@ -0,0 +1,443 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+	"github.com/tsaikd/gogstash/config/monitor"
+)
+
+// errors
+var (
+	ErrorReloadRestartRequired1 = errutil.NewFactory("config %q changed, restart required")
+	ErrorReloadNotStarted       = errutil.NewFactory("config not started")
+	ErrorReloadPipelineFailed1  = errutil.NewFactory("reload pipeline %q failed")
+
+	ErrorReloadOutputRestartRequired2 = errutil.NewFactory("output %q of pipeline %q holds process global state, restart required")
+)
+
+// Reload applies conf to the running pipelines, restarting only the plugins whose raw config changed.
+//
+// Pipelines added are started and pipelines removed are stopped. Pipelines with changed
+// name, chsize, queue or dead_letter_queue are restarted. For other pipelines,
+// filters and outputs are drained and restarted if any of them changed, unchanged plugin
+// instances are reused. Inputs with changed raw config are restarted, unchanged inputs keep running.
+//
+// Changed filters and outputs of running pipelines are initialized, and other changed plugins
+// are validated in config check mode, before anything running is stopped. If any of them failed,
+// the error is returned and all pipelines keep running with the current config. Plugins failed
+// to start after validated, ex: connection refused, are reported by the first error returned
+// after all pipelines are reloaded. The event config of conf is applied if reload succeeded.
+func (t *Config) Reload(conf *Config) (err error) {
+	t.reloadMutex.Lock()
+	defer t.reloadMutex.Unlock()
+
+	if t.ctx == nil {
+		return ErrorReloadNotStarted.New(nil)
+	}
+	if err = t.ctx.Err(); err != nil {
+		return err
+	}
+	if conf.Worker != t.Worker {
+		return ErrorReloadRestartRequired1.New(nil, "worker")
+	}
+	if conf.DebugChannel != t.DebugChannel {
+		return ErrorReloadRestartRequired1.New(nil, "debugch")
+	}
+	if !reflect.DeepEqual(conf.Monitor, t.Monitor) {
+		return ErrorReloadRestartRequired1.New(nil, "monitor")
+	}
+
+	removed := map[string]*PipelineConfig{}
+	for _, pipeline := range t.Pipelines {
+		removed[pipeline.Name] = pipeline
+	}
+	for _, pipeline := range conf.Pipelines {
+		delete(removed, pipeline.Name)
+	}
+
+	plans, err := t.planReload(conf, removed)
+	if err != nil {
+		return err
+	}
+
+	// stop removed pipelines first, so their addresses can be listened by others
+	for _, pipeline := range removed {
+		goglog.Logger.Infof("pipeline %q removed", pipeline.Name)
+		pipeline.stop()
+		t.monitor.RemovePipeline(pipeline.Name)
+	}
+
+	pipelines := make([]*PipelineConfig, 0, len(conf.Pipelines))
+	for _, plan := range plans {
+		name := plan.conf.Name
+		pipeline, err2 := t.applyReload(plan)
+		if err2 != nil {
+			goglog.Logger.Errorf("reload pipeline %q failed: %v", name, err2)
+			if err == nil {
+				err = ErrorReloadPipelineFailed1.New(err2, name)
+			}
+		}
+		if pipeline != nil && pipeline != &t.PipelineConfig {
+			pipelines = append(pipelines, pipeline)
+		}
+	}
+	t.Pipelines = pipelines
+
+	if err == nil && conf.Event != nil {
+		t.Event = conf.Event
+		logevent.SetConfig(conf.Event)
+	}
+	return err
+}
+
+// pipelineReload is the change of a pipeline planned by Reload
+type pipelineReload struct {
+	running *PipelineConfig // nil if the pipeline is added
+	conf    *PipelineConfig
+	restart bool         // the pipeline is started with conf
+	stage   *stageReload // nil if filters and outputs are unchanged
+}
+
+// stageReload is the filters and outputs of conf built for a running pipeline
+type stageReload struct {
+	filters        []*pluginInstance
+	outputs        []*pluginInstance
+	createdFilters []*pluginInstance
+	createdOutputs []*pluginInstance
+	removed        []*pluginInstance
+}
+
+// stopCreated stops the instances built for reload
+func (t *stageReload) stopCreated() {
+	for _, instance := range append(t.createdFilters, t.createdOutputs...) {
+		instance.stop()
+	}
+}
+
+// planReload plans the change of every pipeline of conf, without changing anything running.
+// Changed filters and outputs of running pipelines are built, plugins of pipelines to be
+// started and changed inputs are validated in config check mode, so they do not conflict
+// with the running plugins. Instances built are stopped on error.
+func (t *Config) planReload(conf *Config, removed map[string]*PipelineConfig) (plans []*pipelineReload, err error) {
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, plan := range plans {
+			if plan.stage != nil {
+				plan.stage.stopCreated()
+			}
+		}
+	}()
+
+	for _, pipeline := range removed {
+		if err = checkReloadOutputs(pipeline.Name, pipeline.runningOutputs()); err != nil {
+			return plans, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(t.ctx)
+	// stop goroutines started by plugins on validation
+	defer cancel()
+
+	for _, pipeline := range conf.getPipelines() {
+		plan := &pipelineReload{conf: pipeline}
+		if pipeline == &conf.PipelineConfig {
+			plan.running = &t.PipelineConfig
+		} else {
+			plan.running = t.getNamedPipeline(pipeline.Name)
+		}
+		// instances built for the plan are stopped even if failed to plan
+		plans = append(plans, plan)
+		if err = t.planPipeline(ctx, plan); err != nil {
+			return plans, ErrorReloadPipelineFailed1.New(err, pipeline.Name)
+		}
+	}
+	return plans, nil
+}
+
+// planPipeline plans the change of a pipeline, the pipeline is restarted
+// if the channels or queues changed, or if the pipeline stopped
+func (t *Config) planPipeline(ctx context.Context, plan *pipelineReload) (err error) {
+	running, conf := plan.running, plan.conf
+	plan.restart = running == nil ||
+		running.ctx.Err() != nil ||
+		running.Name != conf.Name ||
+		running.ChannelSize != conf.ChannelSize ||
+		!reflect.DeepEqual(running.Queue, conf.Queue) ||
+		!reflect.DeepEqual(running.DeadLetterQueue, conf.DeadLetterQueue)
+	if plan.restart {
+		if running != nil {
+			if err = checkReloadOutputs(running.Name, running.runningOutputs()); err != nil {
+				return err
+			}
+		}
+		return t.validatePlugins(ctx, conf.InputRaw, conf.FilterRaw, conf.OutputRaw)
+	}
+
+	if running.FilterWorkers != conf.FilterWorkers ||
+		running.FilterOrderKey != conf.FilterOrderKey ||
+		!reflect.DeepEqual(running.FilterRaw, conf.FilterRaw) ||
+		!reflect.DeepEqual(running.OutputRaw, conf.OutputRaw) {
+		if plan.stage, err = running.buildStage(conf, t); err != nil {
+			return err
+		}
+	}
+
+	raws := enabledRaws(conf.InputRaw)
+	matched, _ := matchPlugins(raws, running.inputs)
+	var changed []ConfigRaw
+	for i, raw := range raws {
+		if matched[i] == nil {
+			changed = append(changed, raw)
+		}
+	}
+	return t.validatePlugins(ctx, changed, nil, nil)
+}
+
+// validatePlugins initializes plugins of raw configs in config check mode,
+// returns the first initialization error
+func (t *Config) validatePlugins(ctx context.Context, inputs, filters, outputs []ConfigRaw) (err error) {
+	for _, raw := range enabledRaws(inputs) {
+		if _, err = newInput(contextWithConfigChecker(ctx, &configChecker{raw: raw}), raw, t); err != nil {
+			return err
+		}
+	}
+	for _, raw := range enabledRaws(filters) {
+		if _, err = newFilter(contextWithConfigChecker(ctx, &configChecker{raw: raw}), raw, t); err != nil {
+			return err
+		}
+	}
+	for _, raw := range enabledRaws(outputs) {
+		if _, err = newOutput(contextWithConfigChecker(ctx, &configChecker{raw: raw}), raw, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReloadOutputs returns error if any of the outputs to be stopped
+// holds process global state, see RegistOutputRestartRequired
+func checkReloadOutputs(pipelineName string, outputs []*pluginInstance) error {
+	for _, instance := range outputs {
+		name, _ := instance.raw["type"].(string)
+		if mapOutputRestartRequired[name] {
+			return ErrorReloadOutputRestartRequired2.New(nil, name, pipelineName)
+		}
+	}
+	return nil
+}
+
+// applyReload applies the planned change to the pipeline,
+// returns the running pipeline after reload, or nil if failed to start
+func (t *Config) applyReload(plan *pipelineReload) (running *PipelineConfig, err error) {
+	pipeline, conf := plan.running, plan.conf
+	if plan.restart {
+		if pipeline == nil {
+			goglog.Logger.Infof("pipeline %q added", conf.Name)
+		} else {
+			goglog.Logger.Infof("pipeline %q restarting", pipeline.Name)
+			pipeline.stop()
+			if pipeline == &t.PipelineConfig {
+				// the main pipeline is embedded in config
+				t.PipelineConfig = *conf
+				conf = &t.PipelineConfig
+			}
+		}
+		if err = t.startPipeline(conf); err != nil {
+			return nil, err
+		}
+		return conf, nil
+	}
+
+	if plan.stage != nil {
+		pipeline.applyStage(plan.stage, conf)
+	}
+	return pipeline, pipeline.reloadInputs(conf, t)
+}
+
+// getNamedPipeline returns the running named pipeline, or nil if not found
+func (t *Config) getNamedPipeline(name string) *PipelineConfig {
+	for _, pipeline := range t.Pipelines {
+		if pipeline.Name == name {
+			return pipeline
+		}
+	}
+	return nil
+}
+
+// startPipeline starts the pipeline, the pipeline is stopped if failed
+func (t *Config) startPipeline(pipeline *PipelineConfig) (err error) {
+	if err = startPipelines(t.ctx, t, t.monitor, []*PipelineConfig{pipeline}); err != nil {
+		atomic.StoreInt32(&pipeline.stopped, 1)
+		pipeline.cancel()
+		_ = pipeline.wait()
+		close(pipeline.done)
+		t.monitor.RemovePipeline(pipeline.Name)
+		return err
+	}
+	t.runPipeline(pipeline)
+	return nil
+}
+
+// stop stops all modules of the running pipeline
+func (t *PipelineConfig) stop() {
+	atomic.StoreInt32(&t.stopped, 1)
+	t.cancel()
+	<-t.done
+}
+
+// runningOutputs returns the outputs of the running stage
+func (t *PipelineConfig) runningOutputs() []*pluginInstance {
+	if t.stage == nil {
+		return nil
+	}
+	return t.stage.outputs
+}
+
+// buildStage initializes changed filters and outputs of conf, the running stage keeps
+// running, initialized instances are stopped if any filter or output failed to initialize
+func (t *PipelineConfig) buildStage(conf *PipelineConfig, control Control) (stage *stageReload, err error) {
+	_, removedOutputs := matchPlugins(enabledRaws(conf.OutputRaw), t.stage.outputs)
+	if err = checkReloadOutputs(t.Name, removedOutputs); err != nil {
+		return nil, err
+	}
+
+	stage = &stageReload{}
+	var removedFilters []*pluginInstance
+	stage.filters, stage.createdFilters, removedFilters, err = t.buildPlugins(conf.FilterRaw, t.stage.filters, t.newFilterInstance, control)
+	if err != nil {
+		return nil, err
+	}
+	stage.outputs, stage.createdOutputs, removedOutputs, err = t.buildPlugins(conf.OutputRaw, t.stage.outputs, t.newOutputInstance, control)
+	if err != nil {
+		stage.stopCreated()
+		return nil, err
+	}
+	stage.removed = append(removedFilters, removedOutputs...)
+	return stage, nil
+}
+
+// applyStage drains the running stage and starts filters and outputs built for conf
+func (t *PipelineConfig) applyStage(stage *stageReload, conf *PipelineConfig) {
+	// the context of the pipeline errgroup is canceled once all goroutines returned,
+	// keep the pipeline running while switching stages, ex: pipeline without inputs
+	started := make(chan struct{})
+	t.eg.Go(func() error {
+		<-started
+		return nil
+	})
+	defer close(started)
+
+	t.stage.drain()
+	for _, instance := range stage.removed {
+		instance.stop()
+	}
+
+	t.FilterRaw = conf.FilterRaw
+	t.OutputRaw = conf.OutputRaw
+	t.FilterWorkers = conf.FilterWorkers
+	t.FilterOrderKey = conf.FilterOrderKey
+	t.startStage(stage.filters, stage.outputs)
+
+	goglog.Logger.Infof("pipeline %q reloaded filters and outputs, %d filters and %d outputs restarted",
+		t.Name, len(stage.createdFilters), len(stage.createdOutputs))
+}
+
+// reloadInputs restarts inputs with changed raw config, inputs are stopped
+// before the new ones initialized, so they can listen on the same address
+func (t *PipelineConfig) reloadInputs(conf *PipelineConfig, control Control) (err error) {
+	raws := enabledRaws(conf.InputRaw)
+	matched, removed := matchPlugins(raws, t.inputs)
+	if len(removed) < 1 && len(t.inputs) == len(raws) {
+		t.InputRaw = conf.InputRaw
+		return nil
+	}
+
+	for _, instance := range removed {
+		instance.stop()
+	}
+
+	inputs := make([]*pluginInstance, 0, len(raws))
+	var created int
+	for i, raw := range raws {
+		if matched[i] != nil {
+			inputs = append(inputs, matched[i])
+			continue
+		}
+		instance, err2 := t.newInputInstance(raw, control)
+		if err2 != nil {
+			// keep starting other inputs, the failed input is retried on next reload
+			if err == nil {
+				err = err2
+			}
+			continue
+		}
+		t.runInput(instance)
+		inputs = append(inputs, instance)
+		created++
+	}
+	t.inputs = inputs
+	t.InputRaw = conf.InputRaw
+	t.stats.SetPlugins(monitor.KindInput, pluginStats(t.inputs))
+
+	goglog.Logger.Infof("pipeline %q reloaded inputs, %d inputs stopped and %d inputs started",
+		t.Name, len(removed), created)
+	return err
+}
+
+// buildPlugins returns instances of enabled raw configs, running instances with the same
+// raw config are reused, others are initialized by newInstance. Running instances not reused
+// are returned in removed. Initialized instances are stopped on error.
+func (t *PipelineConfig) buildPlugins(
+	raws []ConfigRaw,
+	running []*pluginInstance,
+	newInstance func(ConfigRaw, Control) (*pluginInstance, error),
+	control Control,
+) (instances, created, removed []*pluginInstance, err error) {
+	raws = enabledRaws(raws)
+	matched, removed := matchPlugins(raws, running)
+	for i, raw := range raws {
+		instance := matched[i]
+		if instance == nil {
+			if instance, err = newInstance(raw, control); err != nil {
+				for _, instance := range created {
+					instance.stop()
+				}
+				return nil, nil, nil, err
+			}
+			created = append(created, instance)
+		}
+		instances = append(instances, instance)
+	}
+	return instances, created, removed, nil
+}
+
+// matchPlugins pairs raw configs with running instances of the same raw config,
+// matched[i] is nil if no instance of raws[i] is running,
+// removed are the running instances not paired
+func matchPlugins(raws []ConfigRaw, running []*pluginInstance) (matched, removed []*pluginInstance) {
+	unused := append([]*pluginInstance(nil), running...)
+	matched = make([]*pluginInstance, len(raws))
+	for i, raw := range raws {
+		for j, instance := range unused {
+			if instance != nil && reflect.DeepEqual(instance.raw, raw) {
+				matched[i] = instance
+				unused[j] = nil
+				break
+			}
+		}
+	}
+	for _, instance := range unused {
+		if instance != nil {
+			removed = append(removed, instance)
+		}
+	}
+	return matched, removed
+}
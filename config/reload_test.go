@@ -0,0 +1,301 @@
+package config
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+var (
+	testReloadInputStarted int32
+	testReloadInputRunning int32
+)
+
+type testReloadInput struct {
+	InputConfig
+}
+
+func (t *testReloadInput) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) error {
+	atomic.AddInt32(&testReloadInputStarted, 1)
+	atomic.AddInt32(&testReloadInputRunning, 1)
+	defer atomic.AddInt32(&testReloadInputRunning, -1)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type testReloadFilter struct {
+	FilterConfig
+	Value string `json:"value"`
+}
+
+func (f *testReloadFilter) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	event.SetValue("value", f.Value)
+	return event, false
+}
+
+type testReloadOutput struct {
+	OutputConfig
+}
+
+func (t *testReloadOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	atomic.StoreInt32(&testReloadInputStarted, 0)
+	RegistInputHandler("test_reload", func(ctx context.Context, raw ConfigRaw, control Control) (TypeInputConfig, error) {
+		return &testReloadInput{}, nil
+	})
+	RegistFilterHandler("test_reload", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		conf := testReloadFilter{}
+		return &conf, ReflectConfig(raw, &conf)
+	})
+
+	load := func(yaml string) *Config {
+		conf, err := LoadFromYAML([]byte(strings.TrimSpace(yaml)))
+		require.NoError(err)
+		return &conf
+	}
+	requireValue := func(conf *Config, value string) {
+		conf.TestInputEvent(logevent.LogEvent{Message: "reload"})
+		event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+		require.NoError(err)
+		require.Equal(value, event.GetString("value"))
+	}
+
+	conf := load(`
+debugch: true
+input:
+  - type: test_reload
+    name: a
+filter:
+  - type: test_reload
+    value: v1
+	`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+	requireValue(conf, "v1")
+
+	// event in chInFilter before reload is processed by new filters
+	conf.TestInputEvent(logevent.LogEvent{Message: "pending"})
+	require.NoError(conf.Reload(load(`
+debugch: true
+input:
+  - type: test_reload
+    name: a
+filter:
+  - type: test_reload
+    value: v2
+	`)))
+	event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+	require.NoError(err)
+	require.Equal("pending", event.Message)
+	requireValue(conf, "v2")
+	// unchanged input keeps running
+	require.EqualValues(1, atomic.LoadInt32(&testReloadInputStarted))
+	require.EqualValues(1, atomic.LoadInt32(&testReloadInputRunning))
+
+	// invalid config keeps current filters
+	require.Error(conf.Reload(load(`
+debugch: true
+input:
+  - type: test_reload
+    name: a
+filter:
+  - type: test_reload_not_found
+	`)))
+	requireValue(conf, "v2")
+
+	// changed input is restarted
+	require.NoError(conf.Reload(load(`
+debugch: true
+input:
+  - type: test_reload
+    name: b
+filter:
+  - type: test_reload
+    value: v2
+pipelines:
+  - name: p1
+    input:
+      - type: test_reload
+	`)))
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&testReloadInputStarted) == 3 && atomic.LoadInt32(&testReloadInputRunning) == 2
+	}, time.Second, 10*time.Millisecond)
+	require.NotNil(conf.GetPipeline("p1"))
+
+	// removed pipeline is stopped
+	require.NoError(conf.Reload(load(`
+debugch: true
+input:
+  - type: test_reload
+    name: b
+filter:
+  - type: test_reload
+    value: v2
+	`)))
+	require.EqualValues(1, atomic.LoadInt32(&testReloadInputRunning))
+	require.Nil(conf.GetPipeline("p1"))
+
+	// pipeline is restarted if chsize changed
+	require.NoError(conf.Reload(load(`
+debugch: true
+chsize: 10
+filter:
+  - type: test_reload
+    value: v3
+	`)))
+	require.EqualValues(0, atomic.LoadInt32(&testReloadInputRunning))
+	require.Equal(10, cap(conf.chInFilter))
+	requireValue(conf, "v3")
+
+	require.True(ErrorReloadRestartRequired1.Match(conf.Reload(load(`
+debugch: false
+	`))))
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+func TestReloadAtomic(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	RegistInputHandler("test_reload", func(ctx context.Context, raw ConfigRaw, control Control) (TypeInputConfig, error) {
+		return &testReloadInput{}, nil
+	})
+	RegistFilterHandler("test_reload", func(ctx context.Context, raw ConfigRaw, control Control) (TypeFilterConfig, error) {
+		conf := testReloadFilter{}
+		return &conf, ReflectConfig(raw, &conf)
+	})
+	RegistOutputHandler("test_reload_global", func(ctx context.Context, raw ConfigRaw, control Control) (TypeOutputConfig, error) {
+		return &testReloadOutput{}, nil
+	})
+	RegistOutputRestartRequired("test_reload_global")
+	defer logevent.SetConfig(&logevent.Config{SortMapKeys: false})
+
+	load := func(yaml string) *Config {
+		conf, err := LoadFromYAML([]byte(strings.TrimSpace(yaml)))
+		require.NoError(err)
+		return &conf
+	}
+	requireValue := func(conf *Config, value string) {
+		conf.TestInputEvent(logevent.LogEvent{Message: "reload"})
+		event, err := conf.TestGetOutputEvent(300 * time.Millisecond)
+		require.NoError(err)
+		require.Equal(value, event.GetString("value"))
+	}
+
+	conf := load(`
+debugch: true
+filter:
+  - type: test_reload
+    value: v1
+pipelines:
+  - name: p1
+    input:
+      - type: test_reload
+    output:
+      - type: test_reload_global
+  - name: p2
+    input:
+      - type: test_reload
+	`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+	requireValue(conf, "v1")
+	require.Eventually(func() bool {
+		return atomic.LoadInt32(&testReloadInputRunning) == 2
+	}, time.Second, 10*time.Millisecond)
+
+	// invalid plugin of a later pipeline keeps all pipelines running with current config
+	err := conf.Reload(load(`
+debugch: true
+event:
+  sort_map_keys: true
+filter:
+  - type: test_reload
+    value: v2
+pipelines:
+  - name: p1
+    input:
+      - type: test_reload
+    output:
+      - type: test_reload_global
+    filter:
+      - type: test_reload_not_found
+	`))
+	require.True(ErrorReloadPipelineFailed1.Match(err))
+	requireValue(conf, "v1")
+	require.NotNil(conf.GetPipeline("p1"))
+	require.NotNil(conf.GetPipeline("p2"))
+	require.EqualValues(2, atomic.LoadInt32(&testReloadInputRunning))
+	require.Nil(conf.Event)
+
+	// output holding global state is not replaced
+	err = conf.Reload(load(`
+debugch: true
+filter:
+  - type: test_reload
+    value: v2
+pipelines:
+  - name: p1
+    input:
+      - type: test_reload
+  - name: p2
+    input:
+      - type: test_reload
+	`))
+	require.True(errutil.ContainErrorFunc(err, ErrorReloadOutputRestartRequired2.Match))
+	requireValue(conf, "v1")
+
+	// pipeline removed with output holding global state
+	err = conf.Reload(load(`
+debugch: true
+pipelines:
+  - name: p2
+    input:
+      - type: test_reload
+	`))
+	require.True(errutil.ContainErrorFunc(err, ErrorReloadOutputRestartRequired2.Match))
+	require.NotNil(conf.GetPipeline("p1"))
+
+	// event config is applied after reload succeeded
+	require.NoError(conf.Reload(load(`
+debugch: true
+event:
+  sort_map_keys: true
+filter:
+  - type: test_reload
+    value: v2
+pipelines:
+  - name: p1
+    input:
+      - type: test_reload
+    output:
+      - type: test_reload_global
+  - name: p2
+    input:
+      - type: test_reload
+	`)))
+	requireValue(conf, "v2")
+	require.NotNil(conf.Event)
+	require.True(conf.Event.SortMapKeys)
+
+	cancel()
+	// test inputs return the context error
+	_ = conf.Wait()
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/keystore"
+)
+
+// errors
+var (
+	ErrorSecretNotFound1 = errutil.NewFactory("secret %q referenced by config not found in keystore")
+	ErrorNoKeystore1     = errutil.NewFactory("secret %q referenced by config but no keystore loaded")
+)
+
+// reSecret matches secret references of config, ex: ${secret:es_password}
+var reSecret = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.-]+)\}`)
+
+var (
+	secretMutex    sync.RWMutex
+	secretKeystore *keystore.Keystore
+)
+
+// SetKeystore sets the keystore resolving secret references `${secret:name}` of config,
+// values of secrets are masked in logs, except secrets shorter than goglog.MinMaskLength
+func SetKeystore(store *keystore.Keystore) {
+	secretMutex.Lock()
+	defer secretMutex.Unlock()
+	secretKeystore = store
+	if store == nil {
+		return
+	}
+	for _, name := range store.Names() {
+		value, _ := store.Get(name)
+		if value != "" && !goglog.MaskValue(value) {
+			goglog.Logger.Warnf("secret %q is shorter than %d characters and not masked in logs", name, goglog.MinMaskLength)
+		}
+	}
+}
+
+// resolveSecrets replaces secret references in text with values of secrets,
+// references not found are kept and reported by checkSecrets on loading config
+func resolveSecrets(text string) string {
+	secretMutex.RLock()
+	defer secretMutex.RUnlock()
+	if secretKeystore == nil {
+		return text
+	}
+	return reSecret.ReplaceAllStringFunc(text, func(ref string) string {
+		name := reSecret.FindStringSubmatch(ref)[1]
+		if value, ok := secretKeystore.Get(name); ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// checkSecrets returns an error if any secret referenced by config values not found
+func checkSecrets(value any) (err error) {
+	switch v := value.(type) {
+	case string:
+		for _, submatches := range reSecret.FindAllStringSubmatch(v, -1) {
+			if err = checkSecret(submatches[1]); err != nil {
+				return err
+			}
+		}
+	case ConfigRaw:
+		return checkSecrets(map[string]any(v))
+	case map[string]any:
+		for _, item := range v {
+			if err = checkSecrets(item); err != nil {
+				return err
+			}
+		}
+	case map[any]any:
+		for _, item := range v {
+			if err = checkSecrets(item); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if err = checkSecrets(item); err != nil {
+				return err
+			}
+		}
+	case []ConfigRaw:
+		for _, item := range v {
+			if err = checkSecrets(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkSecret(name string) error {
+	secretMutex.RLock()
+	defer secretMutex.RUnlock()
+	if secretKeystore == nil {
+		return ErrorNoKeystore1.New(nil, name)
+	}
+	if _, ok := secretKeystore.Get(name); !ok {
+		return ErrorSecretNotFound1.New(nil, name)
+	}
+	return nil
+}
@@ -8,7 +8,6 @@ import (
 	"os/signal"
 	"reflect"
 	"regexp"
-	"strings"
 
 	"github.com/icza/dyno"
 	"github.com/tsaikd/KDGoLib/logutil"
@@ -18,12 +17,25 @@ import (
 
 // ReflectConfig set conf from confraw
 func ReflectConfig(confraw ConfigRaw, conf any) (err error) {
-	data, err := json.Marshal(dyno.ConvertMapI2MapS(map[string]any(confraw)))
+	return ReflectConfigContext(context.Background(), confraw, conf)
+}
+
+// ReflectConfigContext set conf from confraw like ReflectConfig,
+// problems of confraw are reported to the config check carried by ctx
+func ReflectConfigContext(ctx context.Context, confraw ConfigRaw, conf any) (err error) {
+	obj := dyno.ConvertMapI2MapS(map[string]any(confraw))
+	data, err := json.Marshal(obj)
 	if err != nil {
 		return
 	}
 
-	if err = json.Unmarshal(data, conf); err != nil {
+	err = json.Unmarshal(data, conf)
+	if checker := configCheckerFromContext(ctx); checker != nil {
+		if obj, ok := obj.(map[string]any); ok {
+			checker.reflected(confraw, obj, conf, err)
+		}
+	}
+	if err != nil {
 		return
 	}
 
@@ -33,27 +45,11 @@ func ReflectConfig(confraw ConfigRaw, conf any) (err error) {
 	return
 }
 
-// GetFromObject obtaining value from specified field recursively
+// GetFromObject obtaining value from specified field recursively, field is a dotted or bracketed path,
+// ex: "a.b[0]" or "[a][b][0]", returns nil if not found
 func GetFromObject(obj map[string]any, field string) any {
-	fieldSplits := strings.Split(field, ".")
-	for i, key := range fieldSplits {
-		if i >= len(fieldSplits)-1 {
-			if v, ok := obj[key]; ok {
-				return v
-			}
-			return nil
-		} else if node, ok := obj[key]; ok {
-			switch v := node.(type) {
-			case map[string]any:
-				obj = v
-			default:
-				return nil
-			}
-		} else {
-			break
-		}
-	}
-	return nil
+	v, _ := logevent.GetPathValue(obj, field)
+	return v
 }
 
 func formatReflect(rv reflect.Value) {
@@ -61,22 +57,58 @@ func formatReflect(rv reflect.Value) {
 		return
 	}
 
+	if rv.Type() == reflect.TypeOf(ConfigRaw{}) {
+		// raw configs of plugins are formatted by ReflectConfig of plugins,
+		// they keep secret references which are printed in errors
+		return
+	}
+
 	switch rv.Kind() {
 	case reflect.Ptr:
 		if !rv.IsNil() {
 			formatReflect(rv.Elem())
 		}
+	case reflect.Interface:
+		if rv.IsNil() || !rv.CanSet() {
+			return
+		}
+		// values in interfaces are not settable, format a copy
+		elem := reflect.New(rv.Elem().Type()).Elem()
+		elem.Set(rv.Elem())
+		formatReflect(elem)
+		rv.Set(elem)
 	case reflect.Struct:
 		for i := 0; i < rv.NumField(); i++ {
+			if !rv.Type().Field(i).IsExported() {
+				// values of unexported fields are not settable
+				continue
+			}
 			field := rv.Field(i)
 			formatReflect(field)
 		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			formatReflect(rv.Index(i))
+		}
+	case reflect.Map:
+		if rv.IsNil() || !rv.CanSet() {
+			return
+		}
+		// map values are not settable, format copies and put them back
+		iter := rv.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			formatReflect(elem)
+			rv.SetMapIndex(iter.Key(), elem)
+		}
 	case reflect.String:
 		if !rv.CanSet() {
 			return
 		}
 		value := rv.Interface().(string)
 		value = logevent.FormatWithEnv(value)
+		value = resolveSecrets(value)
 		rv.SetString(value)
 	}
 }
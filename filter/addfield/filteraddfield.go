@@ -16,6 +16,7 @@ type FilterConfig struct {
 	Key       string `json:"key" yaml:"key"`
 	Value     string `json:"value" yaml:"value"`
 	Overwrite bool   `json:"overwrite" yaml:"overwrite"`
+	value     *logevent.Template
 }
 
 // DefaultFilterConfig returns an FilterConfig struct with default values
@@ -39,6 +40,11 @@ func InitHandler(
 	if err := config.ReflectConfig(raw, &conf); err != nil {
 		return nil, err
 	}
+	value, err := logevent.NewTemplate(conf.Value)
+	if err != nil {
+		return nil, err
+	}
+	conf.value = value
 
 	return &conf, nil
 }
@@ -51,6 +57,6 @@ func (f *FilterConfig) Event(
 	if _, ok := event.Extra[f.Key]; ok && !f.Overwrite {
 		return event, false
 	}
-	event.SetValue(f.Key, event.Format(f.Value))
+	event.SetValue(f.Key, f.value.Format(event))
 	return event, true
 }
@@ -2,14 +2,11 @@ package filtercond
 
 import (
 	"context"
-	"math/rand"
-	"reflect"
-	"strings"
 
 	"github.com/Knetic/govaluate"
-	"github.com/tsaikd/KDGoLib/errutil"
 
 	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/condition"
 	"github.com/tsaikd/gogstash/config/goglog"
 	"github.com/tsaikd/gogstash/config/logevent"
 )
@@ -20,54 +17,10 @@ const ModuleName = "cond"
 // ErrorTag tag added to event when process geoip2 failed
 const ErrorTag = "gogstash_filter_cond_error"
 
-// built-in functions
+// built-in functions, see config/condition
 var (
-	ErrorBuiltInFunctionParameters1 = errutil.NewFactory("Built-in function '%s' parameters error")
-	BuiltInFunctions                = map[string]govaluate.ExpressionFunction{
-		"empty": func(args ...any) (any, error) {
-			if len(args) > 1 {
-				return nil, ErrorBuiltInFunctionParameters1.New(nil, "empty")
-			} else if len(args) == 0 {
-				return true, nil
-			}
-			return args[0] == nil, nil
-		},
-		"strlen": func(args ...any) (any, error) {
-			if len(args) > 1 {
-				return nil, ErrorBuiltInFunctionParameters1.New(nil, "strlen")
-			} else if len(args) == 0 {
-				return float64(0), nil
-			}
-			length := len(args[0].(string))
-			return float64(length), nil
-		},
-		"map": func(args ...any) (any, error) {
-			if len(args) > 1 {
-				return nil, ErrorBuiltInFunctionParameters1.New(nil, "map")
-			} else if len(args) == 0 {
-				return []any{}, nil
-			}
-
-			s := reflect.ValueOf(args[0])
-			if s.Kind() != reflect.Slice {
-				return nil, ErrorBuiltInFunctionParameters1.New(nil, "map")
-			}
-
-			ret := make([]any, s.Len())
-
-			for i := 0; i < s.Len(); i++ {
-				ret[i] = s.Index(i).Interface()
-			}
-
-			return ret, nil
-		},
-		"rand": func(args ...any) (any, error) {
-			if len(args) > 0 {
-				return nil, ErrorBuiltInFunctionParameters1.New(nil, "rand")
-			}
-			return rand.Float64(), nil
-		},
-	}
+	ErrorBuiltInFunctionParameters1 = condition.ErrorBuiltInFunctionParameters1
+	BuiltInFunctions                = condition.BuiltInFunctions
 )
 
 // FilterConfig holds the configuration json fields and internal objects
@@ -83,19 +36,7 @@ type FilterConfig struct {
 }
 
 // EventParameters pack event's parameters by member function `Get` access
-type EventParameters struct {
-	Event *logevent.LogEvent
-}
-
-// Get obtaining value from event's specified field recursively
-func (ep *EventParameters) Get(field string) (any, error) {
-	if !strings.ContainsRune(field, '.') {
-		// no nest fields
-		return ep.Event.Get(field), nil
-	}
-	v, _ := ep.Event.GetValue(field)
-	return v, nil
-}
+type EventParameters = condition.EventParameters
 
 // DefaultFilterConfig returns an FilterConfig struct with default values
 func DefaultFilterConfig() FilterConfig {
@@ -141,38 +82,45 @@ func InitHandler(
 	return &conf, err
 }
 
-// Event the main filter event
+// Event the main filter event, only the first event is returned if filters emit many events
 func (f *FilterConfig) Event(
 	ctx context.Context,
 	event logevent.LogEvent,
 ) (logevent.LogEvent, bool) {
+	events, ok := f.Events(ctx, event)
+	if len(events) < 1 {
+		event.Drop = true
+		return event, ok
+	}
+	return events[0], ok
+}
+
+// Events passes the event through filters of the satisfied branch,
+// events emitted by them are passed through the following filters
+func (f *FilterConfig) Events(
+	ctx context.Context,
+	event logevent.LogEvent,
+) ([]logevent.LogEvent, bool) {
 	if f.expression != nil {
 		ep := EventParameters{Event: &event}
 		ret, err := f.expression.Eval(&ep)
 		if err != nil {
 			goglog.Logger.Error(err)
 			event.AddTag(ErrorTag)
-			return event, false
+			return []logevent.LogEvent{event}, false
 		}
 		if r, ok := ret.(bool); ok {
 			if r {
-				for _, filter := range f.filters {
-					event, ok = filter.Event(ctx, event)
-					if ok {
-						event = filter.CommonFilter(ctx, event)
-					}
-				}
-			} else {
-				for _, filter := range f.elseFilters {
-					event, ok = filter.Event(ctx, event)
-					if ok {
-						event = filter.CommonFilter(ctx, event)
-					}
-				}
+				return config.ApplyFilters(ctx, f.filters, event), true
 			}
-			return event, true
+			return config.ApplyFilters(ctx, f.elseFilters, event), true
 		}
 		goglog.Logger.Warn("filter cond condition returns not a boolean, ignored")
 	}
-	return event, false
+	return []logevent.LogEvent{event}, false
+}
+
+// Flush flushes filters of both branches
+func (f *FilterConfig) Flush(ctx context.Context, final bool) []logevent.LogEvent {
+	return append(config.FlushFilters(ctx, f.filters, final), config.FlushFilters(ctx, f.elseFilters, final)...)
 }
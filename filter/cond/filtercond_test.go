@@ -151,3 +151,63 @@ filter:
 		require.Equal([]string{"added"}, output.Tags)
 	}
 }
+
+type testCloneFilterConfig struct {
+	config.FilterConfig
+}
+
+func (f *testCloneFilterConfig) Event(ctx context.Context, event logevent.LogEvent) (logevent.LogEvent, bool) {
+	return event, true
+}
+
+func (f *testCloneFilterConfig) Events(ctx context.Context, event logevent.LogEvent) ([]logevent.LogEvent, bool) {
+	clone := event.Clone()
+	clone.SetValue("clone", true)
+	return []logevent.LogEvent{event, clone}, true
+}
+
+func (f *testCloneFilterConfig) Flush(ctx context.Context, final bool) []logevent.LogEvent {
+	if !final {
+		return nil
+	}
+	return []logevent.LogEvent{{Message: "flushed"}}
+}
+
+func Test_filter_cond_module_multi(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	config.RegistFilterHandler("test_clone", func(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeFilterConfig, error) {
+		return &testCloneFilterConfig{}, nil
+	})
+
+	ctx := context.Background()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+filter:
+  - type: cond
+    condition: "level == 'ERROR'"
+    filter:
+      - type: test_clone
+      - type: add_field
+        key: foo
+        value: bar
+	`)))
+	require.NoError(err)
+	filters, err := config.GetFilters(ctx, conf.FilterRaw, &conf)
+	require.NoError(err)
+
+	events := config.ApplyFilters(ctx, filters, logevent.LogEvent{Extra: map[string]any{"level": "ERROR"}})
+	require.Len(events, 2)
+	require.Equal(map[string]any{"level": "ERROR", "foo": "bar"}, events[0].Extra)
+	require.Equal(map[string]any{"level": "ERROR", "foo": "bar", "clone": true}, events[1].Extra)
+
+	events = config.ApplyFilters(ctx, filters, logevent.LogEvent{Extra: map[string]any{"level": "INFO"}})
+	require.Len(events, 1)
+	require.Equal(map[string]any{"level": "INFO"}, events[0].Extra)
+
+	require.Empty(config.FlushFilters(ctx, filters, false))
+	events = config.FlushFilters(ctx, filters, true)
+	require.Len(events, 1)
+	require.Equal("flushed", events[0].Message)
+	require.Equal("bar", events[0].Get("foo"))
+}
@@ -3,6 +3,7 @@ package filtergrok
 import (
 	"context"
 
+	"github.com/tsaikd/KDGoLib/errutil"
 	"github.com/vjeantet/grok"
 
 	"github.com/tsaikd/gogstash/config"
@@ -16,6 +17,11 @@ const ModuleName = "grok"
 // ErrorTag tag added to event when process module failed
 const ErrorTag = "gogstash_filter_grok_error"
 
+// errors
+var (
+	ErrorInvalidMatch1 = errutil.NewFactory("invalid grok match: %q")
+)
+
 // FilterConfig holds the configuration json fields and internal objects
 type FilterConfig struct {
 	config.FilterConfig
@@ -77,6 +83,13 @@ func InitHandler(
 		}
 	}
 
+	// compile patterns on initialization, so invalid patterns are reported before events come
+	for _, match := range conf.Match {
+		if _, err = g.Match(match, ""); err != nil {
+			return nil, ErrorInvalidMatch1.New(err, match)
+		}
+	}
+
 	conf.grk = g
 
 	return &conf, nil
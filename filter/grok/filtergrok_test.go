@@ -157,3 +157,20 @@ filter:
 		require.Equal(expectedEvent, event)
 	}
 }
+
+func Test_filter_grok_module_invalid_match(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+filter:
+  - type: grok
+    match: ["%{NOTEXIST}"]
+	`)))
+	require.NoError(err)
+	err = conf.Start(ctx)
+	require.Error(err)
+	require.True(ErrorInvalidMatch1.In(err))
+}
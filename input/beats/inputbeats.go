@@ -138,10 +138,21 @@ func (t *InputConfig) Start(ctx context.Context, msgChan chan<- logevent.LogEven
 			goglog.Logger.Info("input beats stopped")
 			return nil
 		case data := <-s.ReceiveChan():
+			// the batch is acknowledged to the client after all events are delivered by outputs,
+			// otherwise the client sends the batch again after timeout
+			ack := logevent.NewAck(func(err error) {
+				if err != nil {
+					goglog.Logger.Errorf("beats input: batch of %d events not delivered: %v", len(data.Events), err)
+					return
+				}
+				data.ACK()
+			})
 			for _, e := range data.Events {
-				msgChan <- e.(logevent.LogEvent)
+				event := e.(logevent.LogEvent)
+				event.SetAck(ack)
+				msgChan <- event
 			}
-			data.ACK()
+			ack.Done(nil)
 		}
 	}
 }
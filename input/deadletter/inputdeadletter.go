@@ -0,0 +1,152 @@
+package inputdeadletter
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/tsaikd/KDGoLib/errutil"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/deadletter"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "dead_letter"
+
+// errors
+var (
+	ErrorNoPath = errutil.NewFactory("no path for dead_letter input")
+)
+
+// InputConfig holds the configuration json fields and internal objects
+type InputConfig struct {
+	config.InputConfig
+	Path          string `json:"path"`           // path of dead letter queue, same as dead_letter_queue.path
+	Pipeline      string `json:"pipeline"`       // pipeline name whose dead letters to read, default: main
+	CommitOffsets bool   `json:"commit_offsets"` // save read position to sincedb, default: true
+	SinceDBPath   string `json:"sincedb_path"`   // default: <path>/<pipeline>/sincedb
+	Interval      string `json:"interval"`       // interval to check new dead letters, default: 1s
+	Field         string `json:"field"`          // field to store dead letter info, empty to skip, default: dead_letter
+
+	interval time.Duration
+	dir      string
+}
+
+// DefaultInputConfig returns an InputConfig struct with default values
+func DefaultInputConfig() InputConfig {
+	return InputConfig{
+		InputConfig: config.InputConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+		Pipeline:      config.DefaultPipelineName,
+		CommitOffsets: true,
+		Interval:      "1s",
+		Field:         "dead_letter",
+	}
+}
+
+// InitHandler initialize the input plugin
+func InitHandler(
+	ctx context.Context,
+	raw config.ConfigRaw,
+	control config.Control,
+) (config.TypeInputConfig, error) {
+	conf := DefaultInputConfig()
+	err := config.ReflectConfig(raw, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.Path == "" {
+		return nil, ErrorNoPath.New(nil)
+	}
+	if conf.interval, err = time.ParseDuration(conf.Interval); err != nil {
+		return nil, err
+	}
+	conf.dir = filepath.Join(conf.Path, conf.Pipeline)
+	if conf.SinceDBPath == "" {
+		conf.SinceDBPath = filepath.Join(conf.dir, "sincedb")
+	}
+
+	return &conf, nil
+}
+
+// Start wraps the actual function starting the plugin
+func (t *InputConfig) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) (err error) {
+	var pos deadletter.Position
+	if t.CommitOffsets {
+		if pos, err = t.loadSinceDB(); err != nil {
+			return err
+		}
+	}
+
+	reader := deadletter.NewReader(t.dir, pos, t.interval)
+	defer reader.Close()
+
+	for {
+		entry, pos, err := reader.Next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		event := entry.Event
+		if t.Field != "" {
+			event.SetValue(t.Field, map[string]any{
+				"timestamp":   entry.Timestamp,
+				"pipeline":    entry.Pipeline,
+				"plugin_type": entry.PluginType,
+				"plugin_id":   entry.PluginID,
+				"reason":      entry.Reason,
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case msgChan <- event:
+		}
+
+		if t.CommitOffsets {
+			if err = t.saveSinceDB(pos); err != nil {
+				goglog.Logger.Errorf("%s: save sincedb failed: %v", ModuleName, err)
+			}
+		}
+	}
+}
+
+func (t *InputConfig) loadSinceDB() (pos deadletter.Position, err error) {
+	data, err := os.ReadFile(t.SinceDBPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pos, nil
+		}
+		return
+	}
+	err = json.Unmarshal(data, &pos)
+	return
+}
+
+func (t *InputConfig) saveSinceDB(pos deadletter.Position) (err error) {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(t.SinceDBPath), 0o750); err != nil {
+		return
+	}
+	tmp := t.SinceDBPath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o640); err != nil {
+		return
+	}
+	return os.Rename(tmp, t.SinceDBPath)
+}
@@ -0,0 +1,116 @@
+package inputdeadletter
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func init() {
+	goglog.Logger.SetLevel(logrus.DebugLevel)
+	config.RegistInputHandler(ModuleName, InitHandler)
+	config.RegistOutputHandler("test_reject", func(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeOutputConfig, error) {
+		conf := &testRejectOutput{}
+		return conf, config.ReflectConfig(raw, conf)
+	})
+}
+
+type testRejectOutput struct {
+	config.OutputConfig
+}
+
+func (t *testRejectOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	return errors.New("mapping error")
+}
+
+func Test_input_dead_letter_module(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+
+	// events rejected by outputs are written to dead letter queue
+	ctx, cancel := context.WithCancel(context.Background())
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+dead_letter_queue:
+  path: ` + dir + `
+output:
+  - type: test_reject
+    id: reject1
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+	for _, message := range []string{"message 1", "message 2"} {
+		conf.TestInputEvent(logevent.LogEvent{
+			Timestamp: time.Now(),
+			Message:   message,
+			Extra:     map[string]any{"foo": "bar"},
+			Metadata:  map[string]any{"index": "logs"},
+		})
+		_, err = conf.TestGetOutputEvent(300 * time.Millisecond)
+		require.NoError(err)
+	}
+	cancel()
+	require.NoError(conf.Wait())
+
+	// replay dead letters
+	readConf := func() config.Config {
+		conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+input:
+  - type: dead_letter
+    path: ` + dir + `
+    interval: 10ms
+		`)))
+		require.NoError(err)
+		return conf
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	conf = readConf()
+	require.NoError(conf.Start(ctx))
+	if event, err := conf.TestGetOutputEvent(300 * time.Millisecond); assert.NoError(err) {
+		require.Equal("message 1", event.Message)
+		require.Equal("bar", event.GetString("foo"))
+		require.Equal("logs", event.GetString("@metadata.index"))
+		require.Equal("test_reject", event.GetString("dead_letter.plugin_type"))
+		require.Equal("reject1", event.GetString("dead_letter.plugin_id"))
+		require.Equal("main", event.GetString("dead_letter.pipeline"))
+		require.Equal("mapping error", event.GetString("dead_letter.reason"))
+	}
+	if event, err := conf.TestGetOutputEvent(300 * time.Millisecond); assert.NoError(err) {
+		require.Equal("message 2", event.Message)
+	}
+	cancel()
+	require.NoError(conf.Wait())
+	require.FileExists(filepath.Join(dir, "main", "sincedb"))
+
+	// offsets are committed, nothing to replay
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	conf = readConf()
+	require.NoError(conf.Start(ctx))
+	event, _ := conf.TestGetOutputEvent(100 * time.Millisecond)
+	require.Empty(event.Message)
+}
+
+func Test_input_dead_letter_module_no_path(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	_, err := InitHandler(context.TODO(), config.ConfigRaw{"type": ModuleName}, nil)
+	require.True(ErrorNoPath.Match(err))
+}
@@ -100,8 +100,11 @@ func InitHandler(
 			return nil, err
 		}
 	}
-	if err = conf.client.Ping(); err != nil {
-		return nil, ErrorPingFailed.New(err)
+	// the docker daemon is not connected by config check
+	if !config.IsCheck(ctx) {
+		if err = conf.client.Ping(); err != nil {
+			return nil, ErrorPingFailed.New(err)
+		}
 	}
 
 	// This is really a "reference" codec instance, with each Stream getting their own copy.
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package inputfile
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileKey returns the identity of the file in sincedb, device and inode of the file,
+// which are not changed after the file is renamed
+func fileKey(fpath string, fi os.FileInfo) string {
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", stat.Dev, stat.Ino)
+	}
+	return fpath
+}
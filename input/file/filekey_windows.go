@@ -0,0 +1,12 @@
+//go:build windows
+
+package inputfile
+
+import (
+	"os"
+)
+
+// fileKey returns the identity of the file in sincedb, files are identified by path on windows
+func fileKey(fpath string, fi os.FileInfo) string {
+	return fpath
+}
@@ -0,0 +1,94 @@
+package inputfile
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// globFiles returns paths matching pattern, "**" in pattern matches zero or more directories
+func globFiles(pattern string) (matches []string, err error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+	for _, segment := range splitPath(pattern) {
+		if _, err = filepath.Match(segment, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	patterns := splitPath(pattern)
+	err = filepath.WalkDir(globRoot(pattern), func(path string, d fs.DirEntry, err error) error {
+		// unreadable or removed directories are skipped
+		if err == nil && matchSegments(patterns, splitPath(path)) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	return matches, err
+}
+
+// globRoot returns the directory of pattern before the first segment with wildcards
+func globRoot(pattern string) string {
+	segments := splitPath(pattern)
+	static := []string{}
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.ContainsAny(segment, `*?[\`) {
+			break
+		}
+		static = append(static, segment)
+	}
+	switch root := strings.Join(static, string(filepath.Separator)); {
+	case root != "":
+		return root
+	case filepath.IsAbs(pattern):
+		return string(filepath.Separator)
+	default:
+		return "."
+	}
+}
+
+// matchPath returns true if path matches pattern, "**" in pattern matches zero or more directories
+func matchPath(pattern string, path string) bool {
+	return matchSegments(splitPath(pattern), splitPath(path))
+}
+
+func matchSegments(patterns []string, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) < 1 {
+			return false
+		}
+		if ok, _ := filepath.Match(patterns[0], names[0]); !ok {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) < 1
+}
+
+func splitPath(path string) []string {
+	return strings.Split(filepath.Clean(path), string(filepath.Separator))
+}
+
+// isExcluded returns true if path matches any of excludes, patterns without
+// path separators are matched against the file name
+func isExcluded(path string, excludes []string) bool {
+	for _, exclude := range excludes {
+		if strings.ContainsRune(exclude, filepath.Separator) {
+			if matchPath(exclude, path) {
+				return true
+			}
+		} else if ok, _ := filepath.Match(exclude, filepath.Base(path)); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package inputfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_globFiles(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.log", "b.txt", "x/c.log", "x/y/d.log", "x/y/e.txt"} {
+		fpath := filepath.Join(dir, name)
+		require.NoError(os.MkdirAll(filepath.Dir(fpath), 0o755))
+		require.NoError(os.WriteFile(fpath, nil, 0o644))
+	}
+
+	matches, err := globFiles(filepath.Join(dir, "**", "*.log"))
+	require.NoError(err)
+	require.Equal([]string{
+		filepath.Join(dir, "a.log"),
+		filepath.Join(dir, "x", "c.log"),
+		filepath.Join(dir, "x", "y", "d.log"),
+	}, matches)
+
+	matches, err = globFiles(filepath.Join(dir, "x", "**", "*.txt"))
+	require.NoError(err)
+	require.Equal([]string{filepath.Join(dir, "x", "y", "e.txt")}, matches)
+
+	matches, err = globFiles(filepath.Join(dir, "*", "*.log"))
+	require.NoError(err)
+	require.Equal([]string{filepath.Join(dir, "x", "c.log")}, matches)
+
+	matches, err = globFiles(filepath.Join(dir, "missing", "**"))
+	require.NoError(err)
+	require.Empty(matches)
+
+	_, err = globFiles(filepath.Join(dir, "**", "[.log"))
+	require.ErrorIs(err, filepath.ErrBadPattern)
+}
+
+func Test_globRoot(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	require.Equal("/var/log", globRoot("/var/log/**/*.log"))
+	require.Equal("/var/log", globRoot("/var/log/*/app.log"))
+	require.Equal("/", globRoot("/**/*.log"))
+	require.Equal("logs", globRoot("logs/*.log"))
+	require.Equal("logs", globRoot("./logs/**"))
+	require.Equal(".", globRoot("*.log"))
+}
+
+func Test_isExcluded(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	excludes := []string{"*.gz", "/var/log/**/debug/*"}
+	require.True(isExcluded("/var/log/app.log.1.gz", excludes))
+	require.True(isExcluded("/var/log/app/debug/app.log", excludes))
+	require.True(isExcluded("/var/log/debug/app.log", excludes))
+	require.False(isExcluded("/var/log/app.log", excludes))
+	require.False(isExcluded("/var/log/debug.log", excludes))
+}
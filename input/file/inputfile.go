@@ -8,11 +8,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/tsaikd/KDGoLib/errutil"
-	"github.com/tsaikd/KDGoLib/futil"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/tsaikd/gogstash/config"
@@ -26,15 +26,74 @@ const ModuleName = "file"
 // InputConfig holds the configuration json fields and internal objects
 type InputConfig struct {
 	config.InputConfig
-	Path                 string `json:"path"`
-	StartPos             string `json:"start_position,omitempty"` // one of ["beginning", "end"]
-	SinceDBPath          string `json:"sincedb_path,omitempty"`
-	SinceDBWriteInterval int    `json:"sincedb_write_interval,omitempty"`
+	Path                 string   `json:"path"`
+	Exclude              []string `json:"exclude,omitempty"`
+	Mode                 string   `json:"mode,omitempty"`                    // one of ["tail", "read"]
+	FileCompletedAction  string   `json:"file_completed_action,omitempty"`   // one of ["delete", "move", "log"]
+	FileCompletedDir     string   `json:"file_completed_dir,omitempty"`      // for action "move"
+	FileCompletedLogPath string   `json:"file_completed_log_path,omitempty"` // for action "log"
+	StartPos             string   `json:"start_position,omitempty"`          // one of ["beginning", "end"]
+	SinceDBPath          string   `json:"sincedb_path,omitempty"`
+	SinceDBWriteInterval int      `json:"sincedb_write_interval,omitempty"`
+	SinceDBCleanAfter    int      `json:"sincedb_clean_after,omitempty"` // in seconds, 0 to disable
+	FingerprintSize      int      `json:"fingerprint_size,omitempty"`
+	DiscoverInterval     int      `json:"discover_interval,omitempty"` // in seconds
+	MaxOpenFiles         int      `json:"max_open_files,omitempty"`
+	CloseOlder           int      `json:"close_older,omitempty"` // in seconds, 0 to disable
 
 	hostname            string
 	SinceDBInfos        map[string]*SinceDBInfo `json:"-"`
 	sinceDBLastInfosRaw []byte
-	SinceDBLastSaveTime time.Time `json:"-"`
+	SinceDBLastSaveTime time.Time  `json:"-"`
+	sinceDBMutex        sync.Mutex // guards SinceDBInfos
+	sinceDBSaveMutex    sync.Mutex // serializes saving SinceDBInfos
+
+	startTime   time.Time
+	watcher     *fsnotify.Watcher
+	chDiscover  chan struct{}
+	files       map[string]*tailedFile // tailed files by file key
+	paths       map[string]*tailedFile // tailed files by real path
+	inactive    map[string]fileState   // files closed by close_older by real path
+	watchedDirs map[string]bool
+	filesMutex  sync.Mutex // guards files, paths, inactive, watchedDirs and path of tailed files
+
+	completedLogMutex sync.Mutex // serializes writing file_completed_log_path
+}
+
+// modes of reading files
+const (
+	ModeTail = "tail"
+	ModeRead = "read"
+)
+
+// actions on files read to EOF in read mode
+const (
+	CompletedActionDelete = "delete"
+	CompletedActionMove   = "move"
+	CompletedActionLog    = "log"
+)
+
+// tailedFile is a file read by tailFile
+type tailedFile struct {
+	key        string // see fileKey
+	path       string // real path, updated when the file is renamed
+	startAtEnd bool
+	notify     chan struct{} // signaled on file system events of the file
+}
+
+// fileState is the state of an inactive file, the file is reopened after changed
+type fileState struct {
+	modTime time.Time
+	size    int64
+	retryAt time.Time // reopened after the time even if not changed, zero to wait for changes
+}
+
+// skip returns true if the inactive file of fi is not reopened yet
+func (s fileState) skip(fi os.FileInfo) bool {
+	if !s.modTime.Equal(fi.ModTime()) || s.size != fi.Size() {
+		return false
+	}
+	return s.retryAt.IsZero() || time.Now().Before(s.retryAt)
 }
 
 // DefaultInputConfig returns an InputConfig struct with default values
@@ -45,9 +104,16 @@ func DefaultInputConfig() InputConfig {
 				Type: ModuleName,
 			},
 		},
+		Mode:                 ModeTail,
+		FileCompletedAction:  CompletedActionDelete,
 		StartPos:             "end",
 		SinceDBPath:          ".sincedb.json",
 		SinceDBWriteInterval: 15,
+		SinceDBCleanAfter:    14 * 24 * 3600,
+		FingerprintSize:      1024,
+		DiscoverInterval:     15,
+		MaxOpenFiles:         4095,
+		CloseOlder:           3600,
 
 		SinceDBInfos: map[string]*SinceDBInfo{},
 	}
@@ -55,7 +121,16 @@ func DefaultInputConfig() InputConfig {
 
 // errors
 var (
-	ErrorGlobFailed1 = errutil.NewFactory("glob(%q) failed")
+	ErrorGlobFailed1     = errutil.NewFactory("glob(%q) failed")
+	ErrorCreateWatcher   = errutil.NewFactory("create file watcher failed")
+	ErrorOpenFile1       = errutil.NewFactory("open file failed: %q")
+	ErrorReadFile1       = errutil.NewFactory("read file failed: %q")
+	ErrorInvalidExclude1 = errutil.NewFactory("invalid exclude pattern: %q")
+	ErrorInvalidMode1    = errutil.NewFactory("invalid mode: %q")
+	ErrorInvalidAction1  = errutil.NewFactory("invalid file_completed_action: %q")
+	ErrorNoCompletedDir  = errutil.NewFactory("file_completed_dir is required by file_completed_action move")
+	ErrorNoCompletedLog  = errutil.NewFactory("file_completed_log_path is required by file_completed_action log")
+	ErrorCompleteFile1   = errutil.NewFactory("complete file failed: %q")
 )
 
 // InitHandler initialize the input plugin
@@ -70,6 +145,32 @@ func InitHandler(
 		return nil, err
 	}
 
+	switch conf.Mode {
+	case ModeTail:
+	case ModeRead:
+		switch conf.FileCompletedAction {
+		case CompletedActionDelete:
+		case CompletedActionMove:
+			if conf.FileCompletedDir == "" {
+				return nil, ErrorNoCompletedDir.New(nil)
+			}
+		case CompletedActionLog:
+			if conf.FileCompletedLogPath == "" {
+				return nil, ErrorNoCompletedLog.New(nil)
+			}
+		default:
+			return nil, ErrorInvalidAction1.New(nil, conf.FileCompletedAction)
+		}
+	default:
+		return nil, ErrorInvalidMode1.New(nil, conf.Mode)
+	}
+
+	for _, exclude := range conf.Exclude {
+		if _, err = filepath.Match(exclude, ""); err != nil {
+			return nil, ErrorInvalidExclude1.New(err, exclude)
+		}
+	}
+
 	if conf.hostname, err = os.Hostname(); err != nil {
 		return nil, err
 	}
@@ -84,332 +185,446 @@ func InitHandler(
 
 // Start wraps the actual function starting the plugin
 func (t *InputConfig) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) (err error) {
-	logger := goglog.Logger
-
-	if err := t.LoadSinceDBInfos(); err != nil {
+	if err = t.LoadSinceDBInfos(); err != nil {
 		return err
 	}
 
-	matches, err := filepath.Glob(t.Path)
-	if err != nil {
+	if _, err = globFiles(t.Path); err != nil {
 		return ErrorGlobFailed1.New(err, t.Path)
 	}
 
+	if t.watcher, err = fsnotify.NewWatcher(); err != nil {
+		return ErrorCreateWatcher.New(err)
+	}
+	defer t.watcher.Close()
+	t.chDiscover = make(chan struct{}, 1)
+	t.files = map[string]*tailedFile{}
+	t.paths = map[string]*tailedFile{}
+	t.inactive = map[string]fileState{}
+	t.watchedDirs = map[string]bool{}
+	t.startTime = time.Now()
+
 	eg, ctx := errgroup.WithContext(ctx)
 
 	eg.Go(func() error {
 		return t.CheckSaveSinceDBInfosLoop(ctx)
 	})
 
-	for _, fpath := range matches {
-		if fpath, err = evalSymlinks(ctx, fpath); err != nil {
-			logger.Errorf("Get symlinks failed: %q\n%v", fpath, err)
-			continue
-		}
-
-		var fi os.FileInfo
-		if fi, err = os.Stat(fpath); err != nil {
-			logger.Errorf("stat(%q) failed\n%s", t.Path, err)
-			continue
-		}
-
-		if fi.IsDir() {
-			logger.Infof("Skipping directory: %q", t.Path)
-			continue
-		}
+	eg.Go(func() error {
+		return t.watchLoop(ctx)
+	})
 
-		func(fpath string) {
-			readEventChan := make(chan fsnotify.Event, 10)
-			eg.Go(func() error {
-				return t.fileReadLoop(ctx, readEventChan, fpath, msgChan)
-			})
-			eg.Go(func() error {
-				return t.fileWatchLoop(ctx, readEventChan, fpath, fsnotify.Create|fsnotify.Write)
-			})
-		}(fpath)
-	}
+	eg.Go(func() error {
+		return t.discoverLoop(ctx, msgChan)
+	})
 
 	return eg.Wait()
 }
 
-func (t *InputConfig) fileReadLoop(
-	ctx context.Context,
-	readEventChan chan fsnotify.Event,
-	fpath string,
-	msgChan chan<- logevent.LogEvent,
-) (err error) {
-	var (
-		since     *SinceDBInfo
-		fp        *os.File
-		truncated bool
-		ok        bool
-		whence    int
-		reader    *bufio.Reader
-		line      string
-		size      int
-
-		buffer = &bytes.Buffer{}
-		logger = goglog.Logger
-	)
+// discoverLoop starts tailing files matching path, on start, every discover_interval
+// and when files are created in watched directories
+func (t *InputConfig) discoverLoop(ctx context.Context, msgChan chan<- logevent.LogEvent) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
 
-	if fpath, err = evalSymlinks(ctx, fpath); err != nil {
-		logger.Errorf("Get symlinks failed: %q\n%v", fpath, err)
-		return err
-	}
+	t.discover(ctx, msgChan, &wg)
 
-	if since, ok = t.SinceDBInfos[fpath]; !ok {
-		t.SinceDBInfos[fpath] = &SinceDBInfo{}
-		since = t.SinceDBInfos[fpath]
-	}
+	ticker := time.NewTicker(time.Duration(t.DiscoverInterval) * time.Second)
+	defer ticker.Stop()
 
-	if since.Offset == 0 {
-		if t.StartPos == "end" {
-			whence = io.SeekEnd
-		} else {
-			whence = io.SeekStart
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-t.chDiscover:
 		}
-	} else {
-		whence = io.SeekStart
+		t.discover(ctx, msgChan, &wg)
 	}
+}
 
-	if fp, reader, err = openfile(fpath, since.Offset, whence); err != nil {
-		return err
+// triggerDiscover requests discoverLoop to discover files
+func (t *InputConfig) triggerDiscover() {
+	select {
+	case t.chDiscover <- struct{}{}:
+	default:
 	}
-	defer fp.Close()
+}
 
-	if truncated, err = isFileTruncated(fp, since); err != nil {
-		return err
+// discover starts tailing files matching path not tailed yet,
+// start_position is applied to files last modified before the input started,
+// files created later are read from the beginning
+func (t *InputConfig) discover(ctx context.Context, msgChan chan<- logevent.LogEvent, wg *sync.WaitGroup) {
+	logger := goglog.Logger
+
+	matches, err := globFiles(t.Path)
+	if err != nil {
+		logger.Errorf("glob(%q) failed\n%s", t.Path, err)
+		return
 	}
-	if truncated {
-		logger.Warnf("File truncated, seeking to beginning: %q", fpath)
-		since.Offset = 0
-		if _, err = fp.Seek(since.Offset, io.SeekStart); err != nil {
-			logger.Errorf("seek file failed: %q", fpath)
-			return err
+	t.watchDir(globRoot(t.Path))
+
+	seen := map[string]bool{}
+	full := false
+	for _, match := range matches {
+		if isExcluded(match, t.Exclude) {
+			continue
 		}
-	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return err
-		default:
+		// the file may be removed after glob, or be a broken symlink
+		fpath, err := filepath.EvalSymlinks(match)
+		if err != nil {
+			logger.Debugf("Get symlinks failed: %q\n%v", match, err)
+			continue
 		}
+		fi, err := os.Stat(fpath)
+		if err != nil {
+			logger.Debugf("stat(%q) failed\n%s", fpath, err)
+			continue
+		}
+		if fi.IsDir() {
+			continue
+		}
+		seen[fpath] = true
 
-		if line, size, err = readline(ctx, reader, buffer); err != nil {
-			if err == io.EOF {
-				watchev := <-readEventChan
-				logger.Debug("fileReadLoop recv:", watchev)
-				if watchev.Op&fsnotify.Create == fsnotify.Create {
-					logger.Warnf("File recreated, seeking to beginning: %q", fpath)
-					fp.Close()
-					since.Offset = 0
-					if fp, reader, err = openfile(fpath, since.Offset, io.SeekStart); err != nil {
-						return err
-					}
-				}
-				if truncated, err = isFileTruncated(fp, since); err != nil {
-					return err
-				}
-				if truncated {
-					logger.Warnf("File truncated, seeking to beginning: %q", fpath)
-					since.Offset = 0
-					if _, err = fp.Seek(since.Offset, io.SeekStart); err != nil {
-						logger.Errorf("seek file failed: %q", fpath)
-						return err
-					}
-					continue
-				}
-				logger.Debugf("watch %q %q %v", watchev.Name, fpath, watchev)
-				continue
-			} else {
-				return err
-			}
+		t.watchDir(filepath.Dir(match))
+		t.watchDir(filepath.Dir(fpath))
+
+		key := fileKey(fpath, fi)
+		t.filesMutex.Lock()
+		if tailed, ok := t.files[key]; ok {
+			t.followRename(tailed, fpath, fi)
+			t.filesMutex.Unlock()
+			continue
 		}
+		if state, ok := t.inactive[fpath]; ok && state.skip(fi) {
+			t.filesMutex.Unlock()
+			continue
+		}
+		if t.MaxOpenFiles > 0 && len(t.files) >= t.MaxOpenFiles {
+			t.filesMutex.Unlock()
+			full = true
+			continue
+		}
+		delete(t.inactive, fpath)
+		tailed := &tailedFile{
+			key:        key,
+			path:       fpath,
+			startAtEnd: t.Mode == ModeTail && t.StartPos == "end" && !fi.ModTime().After(t.startTime),
+			notify:     make(chan struct{}, 1),
+		}
+		t.files[key] = tailed
+		t.paths[fpath] = tailed
+		t.filesMutex.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.runTailFile(ctx, tailed, msgChan)
+		}()
+	}
 
-		_, err := t.Codec.Decode(ctx, []byte(line),
-			map[string]any{
-				"host":   t.hostname,
-				"path":   fpath,
-				"offset": since.Offset,
-			},
-			[]string{},
-			msgChan)
+	if full {
+		logger.Warnf("max_open_files %d reached, files matching %q are not tailed until other files are closed", t.MaxOpenFiles, t.Path)
+	}
 
-		if err == nil {
-			since.Offset += int64(size)
-			if err := t.CheckSaveSinceDBInfos(); err != nil {
-				return err
-			}
-		} else {
-			logger.Errorf("Failed to decode %v using codec %v", line, t.Codec)
+	// forget inactive files not found anymore
+	t.filesMutex.Lock()
+	for fpath := range t.inactive {
+		if !seen[fpath] {
+			delete(t.inactive, fpath)
 		}
 	}
+	t.filesMutex.Unlock()
 }
 
-func (t *InputConfig) fileWatchLoop(ctx context.Context, readEventChan chan fsnotify.Event, fpath string, op fsnotify.Op) (err error) {
-	var (
-		event fsnotify.Event
-	)
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
+// runTailFile tails or reads the file until it is closed, files failed to read
+// are not retried until they are changed
+func (t *InputConfig) runTailFile(ctx context.Context, tailed *tailedFile, msgChan chan<- logevent.LogEvent) {
+	var err error
+	if t.Mode == ModeRead {
+		err = t.readFile(ctx, tailed, msgChan)
+	} else {
+		err = t.tailFile(ctx, tailed, msgChan)
+	}
+	if err != nil {
+		goglog.Logger.Error(err)
+	}
 
-		if event, err = waitWatchEvent(ctx, fpath, op); err != nil {
-			return
+	t.filesMutex.Lock()
+	delete(t.files, tailed.key)
+	if t.paths[tailed.path] == tailed {
+		delete(t.paths, tailed.path)
+	}
+	if err != nil {
+		if fi, statErr := os.Stat(tailed.path); statErr == nil {
+			t.inactive[tailed.path] = fileState{modTime: fi.ModTime(), size: fi.Size()}
 		}
-		readEventChan <- event
 	}
+	t.filesMutex.Unlock()
+
+	// files not tailed because of max_open_files can be tailed now
+	t.triggerDiscover()
 }
 
-func isFileTruncated(fp *os.File, since *SinceDBInfo) (truncated bool, err error) {
-	var (
-		fi os.FileInfo
-	)
-	if fi, err = fp.Stat(); err != nil {
-		err = errutil.New("stat file failed: "+fp.Name(), err)
+// followRename updates the path of the tailed file found as fpath, if the file is not found as its path anymore,
+// e.g. renamed by rotation, filesMutex must be held
+func (t *InputConfig) followRename(tailed *tailedFile, fpath string, fi os.FileInfo) {
+	if tailed.path == fpath {
 		return
 	}
-	if fi.Size() < since.Offset {
-		truncated = true
-	} else {
-		truncated = false
+	if pathInfo, err := os.Stat(tailed.path); err == nil && os.SameFile(fi, pathInfo) {
+		return
 	}
-	return
+	goglog.Logger.Infof("File renamed: %q -> %q", tailed.path, fpath)
+	if t.paths[tailed.path] == tailed {
+		delete(t.paths, tailed.path)
+	}
+	tailed.path = fpath
+	t.paths[fpath] = tailed
 }
 
-func openfile(fpath string, offset int64, whence int) (fp *os.File, reader *bufio.Reader, err error) {
-	if fp, err = os.Open(fpath); err != nil {
-		err = errutil.New("open file failed: "+fpath, err)
+// tailedPath returns the current path of the tailed file
+func (t *InputConfig) tailedPath(tailed *tailedFile) string {
+	t.filesMutex.Lock()
+	defer t.filesMutex.Unlock()
+	return tailed.path
+}
+
+// setInactive records the state of the file closed by close_older
+func (t *InputConfig) setInactive(fpath string, fi os.FileInfo) {
+	t.filesMutex.Lock()
+	defer t.filesMutex.Unlock()
+	t.inactive[fpath] = fileState{modTime: fi.ModTime(), size: fi.Size()}
+}
+
+// watchDir watches file system events of dir, failures are retried on next discovery
+func (t *InputConfig) watchDir(dir string) {
+	t.filesMutex.Lock()
+	defer t.filesMutex.Unlock()
+	if t.watchedDirs[dir] {
 		return
 	}
-
-	if _, err = fp.Seek(offset, whence); err != nil {
-		err = errutil.New("seek file failed: " + fpath)
+	if err := t.watcher.Add(dir); err != nil {
+		goglog.Logger.Debugf("watch directory failed: %q\n%s", dir, err)
 		return
 	}
-
-	reader = bufio.NewReaderSize(fp, 16*1024)
-	return
+	t.watchedDirs[dir] = true
 }
 
-func readline(ctx context.Context, reader *bufio.Reader, buffer *bytes.Buffer) (line string, size int, err error) {
-	var (
-		segment []byte
-	)
-
+// watchLoop dispatches file system events to tailed files, and triggers
+// discovery when files are created or inactive files are changed
+func (t *InputConfig) watchLoop(ctx context.Context) error {
+	logger := goglog.Logger
 	for {
 		select {
 		case <-ctx.Done():
-			return line, size, err
-		default:
-		}
-
-		if segment, err = reader.ReadBytes('\n'); err != nil {
-			if err != io.EOF {
-				err = errutil.New("read line failed", err)
+			return nil
+		case event, ok := <-t.watcher.Events:
+			if !ok {
+				return nil
 			}
-			return line, size, err
-		}
-
-		if _, err = buffer.Write(segment); err != nil {
-			err = errutil.New("write buffer failed", err)
-			return line, size, err
-		}
+			logger.Debug("watchLoop recv:", event)
+			name := filepath.Clean(event.Name)
+
+			t.filesMutex.Lock()
+			tailed := t.paths[name]
+			_, inactive := t.inactive[name]
+			if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+				// watches of removed directories are removed by fsnotify
+				delete(t.watchedDirs, name)
+			}
+			t.filesMutex.Unlock()
 
-		if isPartialLine(segment) {
-			time.Sleep(1 * time.Second)
-		} else {
-			size = buffer.Len()
-			line = buffer.String()
-			buffer.Reset()
-			line = strings.TrimRight(line, "\r\n")
-			return line, size, err
+			if tailed != nil {
+				select {
+				case tailed.notify <- struct{}{}:
+				default:
+				}
+			}
+			if event.Has(fsnotify.Create) || (inactive && event.Has(fsnotify.Write)) {
+				t.triggerDiscover()
+			}
+		case err, ok := <-t.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Errorf("watcher error: %s", err)
 		}
 	}
 }
 
-func isPartialLine(segment []byte) bool {
-	if len(segment) < 1 {
-		return true
-	}
-	if segment[len(segment)-1] != '\n' {
-		return true
-	}
-	return false
-}
-
-var (
-	mapWatcher = map[string]*fsnotify.Watcher{}
-)
-
-func waitWatchEvent(ctx context.Context, fpath string, op fsnotify.Op) (event fsnotify.Event, err error) {
+// tailFile reads lines of the file from the sincedb offset, until ctx is done,
+// the file is removed, renamed to a path not matched, or is not modified in close_older
+func (t *InputConfig) tailFile(ctx context.Context, tailed *tailedFile, msgChan chan<- logevent.LogEvent) (err error) {
 	var (
-		fdir    string
-		watcher *fsnotify.Watcher
-		ok      bool
+		fpath   = t.tailedPath(tailed)
+		offset  int64 // offset of next line read, committed to since after delivered
+		acks    *logevent.AckOrder
+		rotated bool // file not found as its path, read to EOF before closed
+		buffer  = &bytes.Buffer{}
+		logger  = goglog.Logger
 	)
 
-	if fpath, err = evalSymlinks(ctx, fpath); err != nil {
-		err = errutil.New("Get symlinks failed: "+fpath, err)
-		return event, err
+	fp, fi, since, err := t.openFile(tailed, fpath)
+	if fp == nil {
+		return err
 	}
+	defer fp.Close()
+	offset = t.getOffset(since)
 
-	fdir = filepath.Dir(fpath)
-
-	if watcher, ok = mapWatcher[fdir]; !ok {
-		if watcher, err = fsnotify.NewWatcher(); err != nil {
-			err = errutil.New("create new watcher failed: "+fdir, err)
-			return event, err
-		}
-		mapWatcher[fdir] = watcher
-		if err = watcher.Add(fdir); err != nil {
-			err = errutil.New("add new watch path failed: "+fdir, err)
-			return event, err
+	switch {
+	case fi.Size() < offset:
+		logger.Warnf("File truncated, seeking to beginning: %q", fpath)
+		offset = 0
+		t.resetOffset(since)
+	case offset == 0 && tailed.startAtEnd:
+		if offset, err = fp.Seek(0, io.SeekEnd); err != nil {
+			return ErrorReadFile1.New(err, fpath)
 		}
+		t.setOffset(since, offset)
+	}
+	if _, err = fp.Seek(offset, io.SeekStart); err != nil {
+		return ErrorReadFile1.New(err, fpath)
 	}
+	acks = t.newOffsetAckOrder(since)
+	reader := bufio.NewReaderSize(fp, 16*1024)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 
 	for {
-		select {
-		case <-ctx.Done():
-			return event, err
-		case event = <-watcher.Events:
-			if event.Name == fpath {
-				if op > 0 {
-					if event.Op&op > 0 {
-						return event, err
-					}
-				} else {
-					return event, err
+		line, size, err := readline(reader, buffer)
+		if err == io.EOF {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-tailed.notify:
+			case <-ticker.C:
+			}
+
+			if fi, err = fp.Stat(); err != nil {
+				return ErrorReadFile1.New(err, fpath)
+			}
+			fpath = t.tailedPath(tailed)
+			pathInfo, err := os.Stat(fpath)
+			switch {
+			case err != nil && !os.IsNotExist(err):
+				return ErrorReadFile1.New(err, fpath)
+			case err != nil || !os.SameFile(fi, pathInfo):
+				// renamed files are followed if found by discovery, lines written
+				// before the file was removed or renamed are read before closed
+				if !rotated {
+					rotated = true
+					t.triggerDiscover()
+					continue
+				}
+				logger.Infof("File removed or renamed, closing: %q", fpath)
+				return nil
+			case fi.Size() < offset+int64(buffer.Len()):
+				logger.Warnf("File truncated, seeking to beginning: %q", fpath)
+				if _, err = fp.Seek(0, io.SeekStart); err != nil {
+					return ErrorReadFile1.New(err, fpath)
 				}
+				offset = 0
+				acks = t.resetOffset(since)
+				reader.Reset(fp)
+				buffer.Reset()
+			case t.CloseOlder > 0 && time.Since(fi.ModTime()) > time.Duration(t.CloseOlder)*time.Second:
+				logger.Infof("File inactive, closing: %q", fpath)
+				t.setInactive(fpath, fi)
+				return nil
 			}
-		case err = <-watcher.Errors:
-			err = errutil.New("watcher error", err)
-			return event, err
+			rotated = false
+			continue
 		}
+		if err != nil {
+			return ErrorReadFile1.New(err, fpath)
+		}
+
+		t.sendLine(ctx, acks, nil, fpath, offset, line, size, msgChan)
+		offset += int64(size)
 	}
 }
 
-func evalSymlinks(ctx context.Context, path string) (string, error) {
-	// https://github.com/tsaikd/gogstash/issues/30
-	for retry := 5; retry > 0; retry-- {
-		if futil.IsExist(path) {
-			break
-		}
+// openFile opens the file of tailed found as fpath and returns its SinceDBInfo,
+// fp is nil if failed or the file is replaced after discovered, which is tailed on next discovery
+func (t *InputConfig) openFile(tailed *tailedFile, fpath string) (fp *os.File, fi os.FileInfo, since *SinceDBInfo, err error) {
+	if fp, err = os.Open(fpath); err != nil {
+		return nil, nil, nil, ErrorOpenFile1.New(err, fpath)
+	}
+	if fi, err = fp.Stat(); err != nil {
+		fp.Close()
+		return nil, nil, nil, ErrorReadFile1.New(err, fpath)
+	}
+	if fileKey(fpath, fi) != tailed.key {
+		fp.Close()
+		return nil, nil, nil, nil
+	}
+	head, err := readHead(fp, t.FingerprintSize)
+	if err != nil {
+		fp.Close()
+		return nil, nil, nil, ErrorReadFile1.New(err, fpath)
+	}
+	return fp, fi, t.getSinceDBInfo(tailed.key, fpath, head), nil
+}
 
-		select {
-		case <-ctx.Done():
-			return path, nil
-		case <-time.After(500 * time.Millisecond):
-		}
+// sendLine decodes the line at offset to msgChan, sincedb offset is committed
+// after events of the line are delivered by outputs
+func (t *InputConfig) sendLine(
+	ctx context.Context,
+	acks *logevent.AckOrder,
+	callback func(err error),
+	fpath string,
+	offset int64,
+	line string,
+	size int,
+	msgChan chan<- logevent.LogEvent,
+) {
+	ack := acks.NewAck(offset+int64(size), callback)
+	metadata := map[string]any{
+		"path":   fpath,
+		"offset": offset,
 	}
+	_, err := t.Codec.Decode(logevent.ContextWithMetadata(logevent.ContextWithAck(ctx, ack), metadata), []byte(line),
+		map[string]any{
+			"host":   t.hostname,
+			"path":   fpath,
+			"offset": offset,
+		},
+		[]string{},
+		msgChan)
+	ack.Done(nil)
+
+	if err != nil {
+		goglog.Logger.Errorf("Failed to decode %v using codec %v", line, t.Codec)
+	}
+}
 
-	if futil.IsNotExist(path) {
-		return path, os.ErrNotExist
+// readHead returns the first bytes of the file up to size for fingerprint
+func readHead(fp *os.File, size int) ([]byte, error) {
+	if size < 1 {
+		return nil, nil
+	}
+	head := make([]byte, size)
+	n, err := fp.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// readline returns the next line without line endings and its size in bytes,
+// data of partial lines is kept in buffer and io.EOF is returned until the line is completed
+func readline(reader *bufio.Reader, buffer *bytes.Buffer) (line string, size int, err error) {
+	segment, err := reader.ReadBytes('\n')
+	buffer.Write(segment)
+	if err != nil {
+		return "", 0, err
 	}
 
-	return filepath.EvalSymlinks(path)
+	size = buffer.Len()
+	line = strings.TrimRight(buffer.String(), "\r\n")
+	buffer.Reset()
+	return line, size, nil
 }
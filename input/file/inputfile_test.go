@@ -2,6 +2,9 @@ package inputfile
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -40,6 +43,8 @@ input:
 	time.Sleep(500 * time.Millisecond)
 	if event, err := conf.TestGetOutputEvent(100 * time.Millisecond); assert.NoError(err) {
 		require.Equal("gogstash input file", event.Message)
+		require.Equal(int64(0), event.Get("@metadata.offset"))
+		require.Contains(event.GetString("@metadata.path"), "README.md")
 	}
 }
 
@@ -68,3 +73,158 @@ input:
 		require.Equal("gogstash input file", event.Message)
 	}
 }
+
+func Test_input_file_module_discover(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "old.log"), []byte("old line\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+input:
+  - type: file
+    path: %q
+    exclude: ["*.skip.log"]
+    sincedb_path: ""
+    discover_interval: 1
+	`, filepath.Join(dir, "**", "*.log")))))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+	time.Sleep(500 * time.Millisecond)
+
+	// lines of files created after start are read from the beginning with start_position end
+	require.NoError(os.WriteFile(filepath.Join(dir, "skip.skip.log"), []byte("skipped\n"), 0o644))
+	require.NoError(os.MkdirAll(filepath.Join(dir, "sub"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(dir, "sub", "new.log"), []byte("first line\npartial"), 0o644))
+	if event, err := conf.TestGetOutputEvent(3 * time.Second); assert.NoError(err) {
+		require.Equal("first line", event.Message)
+		require.Equal(filepath.Join(dir, "sub", "new.log"), event.GetString("path"))
+	}
+
+	fp, err := os.OpenFile(filepath.Join(dir, "sub", "new.log"), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(err)
+	_, err = fp.WriteString(" line\n")
+	require.NoError(err)
+	require.NoError(fp.Close())
+	if event, err := conf.TestGetOutputEvent(3 * time.Second); assert.NoError(err) {
+		require.Equal("partial line", event.Message)
+		require.Equal(int64(11), event.Get("offset"))
+	}
+
+	// excluded files are not read
+	event, _ := conf.TestGetOutputEvent(1500 * time.Millisecond)
+	require.Empty(event.Message)
+}
+
+func Test_input_file_module_close_older(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	past := time.Now().Add(-time.Hour)
+	for _, name := range []string{"a.log", "b.log"} {
+		fpath := filepath.Join(dir, name)
+		require.NoError(os.WriteFile(fpath, []byte(name+"\n"), 0o644))
+		require.NoError(os.Chtimes(fpath, past, past))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+input:
+  - type: file
+    path: %q
+    start_position: beginning
+    sincedb_path: ""
+    discover_interval: 1
+    max_open_files: 1
+    close_older: 60
+	`, filepath.Join(dir, "*.log")))))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	// the second file is tailed after the first one is closed
+	messages := []string{}
+	for range 2 {
+		if event, err := conf.TestGetOutputEvent(5 * time.Second); assert.NoError(err) {
+			messages = append(messages, event.Message)
+		}
+	}
+	require.ElementsMatch([]string{"a.log", "b.log"}, messages)
+
+	// inactive files are reopened from the offset after changed
+	fp, err := os.OpenFile(filepath.Join(dir, "a.log"), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(err)
+	_, err = fp.WriteString("a.log again\n")
+	require.NoError(err)
+	require.NoError(fp.Close())
+	if event, err := conf.TestGetOutputEvent(5 * time.Second); assert.NoError(err) {
+		require.Equal("a.log again", event.Message)
+		require.Equal(int64(6), event.Get("offset"))
+	}
+}
+
+func Test_input_file_module_rotate(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "app.log")
+	require.NoError(os.WriteFile(fpath, []byte("line 1\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+input:
+  - type: file
+    path: %q
+    start_position: beginning
+    sincedb_path: %q
+    sincedb_write_interval: 1
+    discover_interval: 1
+	`, fpath+"*", filepath.Join(dir, "sincedb.json")))))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+	if event, err := conf.TestGetOutputEvent(3 * time.Second); assert.NoError(err) {
+		require.Equal("line 1", event.Message)
+	}
+
+	// lines written to the rotated file are read under its new name
+	require.NoError(os.Rename(fpath, fpath+".1"))
+	require.NoError(os.WriteFile(fpath, []byte("new line 1\n"), 0o644))
+	time.Sleep(1500 * time.Millisecond)
+	fp, err := os.OpenFile(fpath+".1", os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(err)
+	_, err = fp.WriteString("line 2\n")
+	require.NoError(err)
+	require.NoError(fp.Close())
+
+	events := map[string]string{}
+	for range 2 {
+		if event, err := conf.TestGetOutputEvent(3 * time.Second); assert.NoError(err) {
+			events[event.Message] = event.GetString("path")
+		}
+	}
+	require.Equal(map[string]string{
+		"new line 1": fpath,
+		"line 2":     fpath + ".1",
+	}, events)
+	event, _ := conf.TestGetOutputEvent(1500 * time.Millisecond)
+	require.Empty(event.Message)
+
+	// sincedb is written to the temp dir until stopped
+	cancel()
+	require.NoError(conf.Wait())
+}
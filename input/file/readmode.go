@@ -0,0 +1,169 @@
+package inputfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// readFile reads lines of the file from the sincedb offset to EOF, and completes the file
+// after all lines are delivered, gzip files are decompressed, offsets of gzip files are
+// offsets in decompressed data. The file is read again from the sincedb offset on the
+// next discovery if any line failed to deliver.
+func (t *InputConfig) readFile(ctx context.Context, tailed *tailedFile, msgChan chan<- logevent.LogEvent) (err error) {
+	var (
+		fpath  = t.tailedPath(tailed)
+		offset int64 // offset of next line read, committed to since after delivered
+		buffer = &bytes.Buffer{}
+		logger = goglog.Logger
+	)
+
+	fp, fi, since, err := t.openFile(tailed, fpath)
+	if fp == nil {
+		return err
+	}
+	defer fp.Close()
+	if t.isCompleted(since) {
+		t.setInactive(fpath, fi)
+		return nil
+	}
+	offset = t.getOffset(since)
+
+	var src io.Reader = fp
+	if strings.HasSuffix(fpath, ".gz") {
+		gz, err := gzip.NewReader(fp)
+		if err != nil {
+			return ErrorReadFile1.New(err, fpath)
+		}
+		defer gz.Close()
+		if _, err = io.CopyN(io.Discard, gz, offset); err == io.EOF {
+			logger.Warnf("File truncated, seeking to beginning: %q", fpath)
+			offset = 0
+			t.resetOffset(since)
+			if _, err = fp.Seek(0, io.SeekStart); err != nil {
+				return ErrorReadFile1.New(err, fpath)
+			}
+			if err = gz.Reset(fp); err != nil {
+				return ErrorReadFile1.New(err, fpath)
+			}
+		} else if err != nil {
+			return ErrorReadFile1.New(err, fpath)
+		}
+		src = gz
+	} else {
+		if fi.Size() < offset {
+			logger.Warnf("File truncated, seeking to beginning: %q", fpath)
+			offset = 0
+			t.resetOffset(since)
+		}
+		if _, err = fp.Seek(offset, io.SeekStart); err != nil {
+			return ErrorReadFile1.New(err, fpath)
+		}
+	}
+	acks := t.newOffsetAckOrder(since)
+	reader := bufio.NewReaderSize(src, 16*1024)
+	failed := make(chan struct{})
+	var failedOnce sync.Once
+	nacked := func(err error) {
+		if err != nil {
+			failedOnce.Do(func() { close(failed) })
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-failed:
+			t.retryFile(fpath, fi)
+			return nil
+		default:
+		}
+
+		line, size, err := readline(reader, buffer)
+		if err == io.EOF {
+			if buffer.Len() < 1 {
+				break
+			}
+			// the last line without line ending
+			size = buffer.Len()
+			line = strings.TrimRight(buffer.String(), "\r\n")
+			buffer.Reset()
+		} else if err != nil {
+			return ErrorReadFile1.New(err, fpath)
+		}
+
+		t.sendLine(ctx, acks, nacked, fpath, offset, line, size, msgChan)
+		offset += int64(size)
+	}
+
+	// lines not delivered are read again after restart
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for acks.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-failed:
+			t.retryFile(fpath, fi)
+			return nil
+		case <-ticker.C:
+		}
+	}
+
+	if err = t.completeFile(fpath); err != nil {
+		return ErrorCompleteFile1.New(err, fpath)
+	}
+	t.setCompleted(since)
+	t.setInactive(fpath, fi)
+	logger.Infof("File completed: %q", fpath)
+	return nil
+}
+
+// retryFile closes the file failed to deliver, it is read again from the sincedb offset on the next discovery
+func (t *InputConfig) retryFile(fpath string, fi os.FileInfo) {
+	goglog.Logger.Warnf("File not delivered, read again on next discovery: %q", fpath)
+	t.filesMutex.Lock()
+	defer t.filesMutex.Unlock()
+	t.inactive[fpath] = fileState{
+		modTime: fi.ModTime(),
+		size:    fi.Size(),
+		retryAt: time.Now().Add(time.Duration(t.DiscoverInterval) * time.Second),
+	}
+}
+
+// completeFile applies file_completed_action to the file read to EOF
+func (t *InputConfig) completeFile(fpath string) error {
+	switch t.FileCompletedAction {
+	case CompletedActionDelete:
+		return os.Remove(fpath)
+	case CompletedActionMove:
+		if err := os.MkdirAll(t.FileCompletedDir, 0o755); err != nil {
+			return err
+		}
+		return os.Rename(fpath, filepath.Join(t.FileCompletedDir, filepath.Base(fpath)))
+	case CompletedActionLog:
+		t.completedLogMutex.Lock()
+		defer t.completedLogMutex.Unlock()
+		fp, err := os.OpenFile(t.FileCompletedLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		if _, err = fp.WriteString(fpath + "\n"); err != nil {
+			fp.Close()
+			return err
+		}
+		return fp.Close()
+	}
+	return nil
+}
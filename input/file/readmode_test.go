@@ -0,0 +1,258 @@
+package inputfile
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	codecmultiline "github.com/tsaikd/gogstash/codec/multiline"
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func writeGzip(t *testing.T, fpath string, data string) {
+	fp, err := os.Create(fpath)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(fp)
+	_, err = gz.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, fp.Close())
+}
+
+func Test_input_file_module_read(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	require.NoError(os.Mkdir(filepath.Join(dir, "logs"), 0o755))
+	plainPath := filepath.Join(dir, "logs", "a.log")
+	gzipPath := filepath.Join(dir, "logs", "b.log.gz")
+	truncatedPath := filepath.Join(dir, "logs", "c.log.gz")
+	require.NoError(os.WriteFile(plainPath, []byte("a1\na2\na3"), 0o644))
+	writeGzip(t, gzipPath, "b1\nb2\n")
+	writeGzip(t, truncatedPath, "c1\n")
+	completedPath := filepath.Join(dir, "completed.log")
+
+	// reading is resumed from sincedb
+	sincedbPath := filepath.Join(dir, "sincedb.json")
+	require.NoError(os.WriteFile(sincedbPath, []byte(fmt.Sprintf(`{%q:{"offset":3},%q:{"offset":3},%q:{"offset":30}}`, plainPath, gzipPath, truncatedPath)), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+input:
+  - type: file
+    path: %q
+    mode: read
+    file_completed_action: log
+    file_completed_log_path: %q
+    sincedb_path: %q
+	`, filepath.Join(dir, "logs", "*"), completedPath, sincedbPath))))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	events := map[string]int64{}
+	for range 4 {
+		if event, err := conf.TestGetOutputEvent(3 * time.Second); assert.NoError(err) {
+			events[event.Message] = event.Get("offset").(int64)
+		}
+	}
+	// gzip file shorter than the sincedb offset is read from the beginning
+	require.Equal(map[string]int64{"a2": 3, "a3": 6, "b2": 3, "c1": 0}, events)
+
+	require.Eventually(func() bool {
+		data, _ := os.ReadFile(completedPath)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		slices.Sort(lines)
+		return slices.Equal([]string{plainPath, gzipPath, truncatedPath}, lines)
+	}, 3*time.Second, 50*time.Millisecond)
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+func Test_input_file_module_read_multiline(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	config.RegistCodecHandler(codecmultiline.ModuleName, codecmultiline.InitHandler)
+
+	dir := t.TempDir()
+	require.NoError(os.Mkdir(filepath.Join(dir, "logs"), 0o755))
+	require.NoError(os.WriteFile(filepath.Join(dir, "logs", "a.log"), []byte("E1\n  at x\n  at y\nE2\n  at z\n"), 0o644))
+	require.NoError(os.WriteFile(filepath.Join(dir, "logs", "b.log"), []byte("F1\n  at w\n"), 0o644))
+	completedPath := filepath.Join(dir, "completed.log")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+input:
+  - type: file
+    path: %q
+    mode: read
+    file_completed_action: log
+    file_completed_log_path: %q
+    sincedb_path: ""
+    codec:
+      type: multiline
+      pattern: "^\\s"
+      flush_timeout: "100ms"
+	`, filepath.Join(dir, "logs", "*"), completedPath))))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	events := []string{}
+	for range 3 {
+		if event, err := conf.TestGetOutputEvent(3 * time.Second); assert.NoError(err) {
+			events = append(events, event.Message)
+		}
+	}
+	require.ElementsMatch([]string{"E1\n  at x\n  at y", "E2\n  at z", "F1\n  at w"}, events)
+
+	// files are completed after the joined events are delivered
+	require.Eventually(func() bool {
+		data, _ := os.ReadFile(completedPath)
+		return len(strings.Split(strings.TrimSpace(string(data)), "\n")) == 2
+	}, 3*time.Second, 50*time.Millisecond)
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+type testNackOutput struct {
+	config.OutputConfig
+	failed   bool
+	messages chan string
+}
+
+func (t *testNackOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	t.messages <- event.Message
+	if !t.failed {
+		t.failed = true
+		return errors.New("output failed")
+	}
+	return nil
+}
+
+func Test_input_file_module_read_nack(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	output := &testNackOutput{messages: make(chan string, 10)}
+	config.RegistOutputHandler("test_read_nack", func(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeOutputConfig, error) {
+		return output, config.ReflectConfig(raw, output)
+	})
+
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "app.log")
+	require.NoError(os.WriteFile(fpath, []byte("l1\nl2\n"), 0o644))
+	completedPath := filepath.Join(dir, "completed.txt")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+input:
+  - type: file
+    path: %q
+    mode: read
+    discover_interval: 1
+    file_completed_action: log
+    file_completed_log_path: %q
+    sincedb_path: ""
+output:
+  - type: test_read_nack
+	`, filepath.Join(dir, "*.log"), completedPath))))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	// the file failed to deliver is read again on the next discovery, then completed
+	require.Eventually(func() bool {
+		data, _ := os.ReadFile(completedPath)
+		return strings.TrimSpace(string(data)) == fpath
+	}, 5*time.Second, 50*time.Millisecond)
+	messages := []string{}
+	for len(output.messages) > 0 {
+		messages = append(messages, <-output.messages)
+	}
+	require.GreaterOrEqual(len(messages), 3)
+	require.Equal("l1", messages[0])
+	require.Equal([]string{"l1", "l2"}, messages[len(messages)-2:])
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+func Test_input_file_module_read_completed_action(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	for _, action := range []string{CompletedActionDelete, CompletedActionMove} {
+		dir := t.TempDir()
+		fpath := filepath.Join(dir, "app.log")
+		archiveDir := filepath.Join(dir, "archive")
+		require.NoError(os.WriteFile(fpath, []byte("line\n"), 0o644))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+input:
+  - type: file
+    path: %q
+    mode: read
+    file_completed_action: %s
+    file_completed_dir: %q
+    sincedb_path: ""
+		`, filepath.Join(dir, "*.log"), action, archiveDir))))
+		require.NoError(err)
+		require.NoError(conf.Start(ctx))
+
+		event, err := conf.TestGetOutputEvent(3 * time.Second)
+		require.NoError(err)
+		require.Equal("line", event.Message)
+		require.Eventually(func() bool {
+			_, err := os.Stat(fpath)
+			return os.IsNotExist(err)
+		}, 3*time.Second, 50*time.Millisecond)
+		if action == CompletedActionMove {
+			require.FileExists(filepath.Join(archiveDir, "app.log"))
+		}
+
+		cancel()
+		require.NoError(conf.Wait())
+	}
+}
+
+func Test_input_file_module_read_config(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	for _, raw := range []string{
+		`{"type": "file", "path": "*.log", "mode": "batch"}`,
+		`{"type": "file", "path": "*.log", "mode": "read", "file_completed_action": "keep"}`,
+		`{"type": "file", "path": "*.log", "mode": "read", "file_completed_action": "move"}`,
+		`{"type": "file", "path": "*.log", "mode": "read", "file_completed_action": "log"}`,
+	} {
+		conf := config.ConfigRaw{}
+		require.NoError(json.Unmarshal([]byte(raw), &conf))
+		_, err := InitHandler(context.Background(), conf, nil)
+		require.Error(err, raw)
+	}
+}
@@ -3,6 +3,8 @@ package inputfile
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"os"
 	"time"
@@ -10,12 +12,155 @@ import (
 	jsoniter "github.com/json-iterator/go"
 	log "github.com/sirupsen/logrus"
 	"github.com/tsaikd/KDGoLib/futil"
+
+	"github.com/tsaikd/gogstash/config/logevent"
 )
 
 const devNull = "/dev/null"
 
+// SinceDBInfo is the read offset of a file, keyed by fileKey in sincedb
 type SinceDBInfo struct {
 	Offset int64 `json:"offset,omitempty"`
+	// last known path of the file
+	Path string `json:"path,omitempty"`
+	// hash of the first FingerprintSize bytes of the file, to tell files with reused inodes
+	Fingerprint     string    `json:"fingerprint,omitempty"`
+	FingerprintSize int       `json:"fingerprint_size,omitempty"`
+	LastActive      time.Time `json:"last_active"`
+	// file read to EOF and completed in read mode
+	Completed bool `json:"completed,omitempty"`
+
+	// reset is increased when the file is truncated or recreated,
+	// offsets acknowledged before reset are not committed
+	reset int
+}
+
+// matchFingerprint returns true if head, the first bytes of a file, matches the fingerprint of since
+func (t *SinceDBInfo) matchFingerprint(head []byte) bool {
+	if t.FingerprintSize < 1 {
+		return true
+	}
+	return len(head) >= t.FingerprintSize && fingerprint(head[:t.FingerprintSize]) == t.Fingerprint
+}
+
+func fingerprint(head []byte) string {
+	sum := sha256.Sum256(head)
+	return hex.EncodeToString(sum[:])
+}
+
+// getSinceDBInfo returns the SinceDBInfo of the file of key, created if not found,
+// head is the first bytes of the file, entries of other files with the same key,
+// e.g. reused inodes, are replaced
+func (t *InputConfig) getSinceDBInfo(key string, fpath string, head []byte) *SinceDBInfo {
+	t.sinceDBMutex.Lock()
+	defer t.sinceDBMutex.Unlock()
+	since, ok := t.SinceDBInfos[key]
+	if !ok {
+		// entries of previous versions are keyed by path
+		if legacy, found := t.SinceDBInfos[fpath]; found && legacy.Path == "" {
+			delete(t.SinceDBInfos, fpath)
+			since, ok = legacy, true
+		}
+	}
+	if !ok || !since.matchFingerprint(head) {
+		since = &SinceDBInfo{}
+	}
+	t.SinceDBInfos[key] = since
+	since.Path = fpath
+	if len(head) > since.FingerprintSize {
+		since.Fingerprint = fingerprint(head)
+		since.FingerprintSize = len(head)
+	}
+	since.LastActive = time.Now()
+	return since
+}
+
+// getOffset returns the committed offset of since
+func (t *InputConfig) getOffset(since *SinceDBInfo) int64 {
+	t.sinceDBMutex.Lock()
+	defer t.sinceDBMutex.Unlock()
+	return since.Offset
+}
+
+// setOffset sets the offset of since, e.g. the end of the file read from the end
+func (t *InputConfig) setOffset(since *SinceDBInfo, offset int64) {
+	t.sinceDBMutex.Lock()
+	defer t.sinceDBMutex.Unlock()
+	since.Offset = offset
+}
+
+// isCompleted returns true if the file of since is completed in read mode
+func (t *InputConfig) isCompleted(since *SinceDBInfo) bool {
+	t.sinceDBMutex.Lock()
+	defer t.sinceDBMutex.Unlock()
+	return since.Completed
+}
+
+// setCompleted marks the file of since completed in read mode
+func (t *InputConfig) setCompleted(since *SinceDBInfo) {
+	t.sinceDBMutex.Lock()
+	defer t.sinceDBMutex.Unlock()
+	since.Completed = true
+}
+
+// resetOffset sets the offset of since to 0, offsets acknowledged before are discarded,
+// returns the AckOrder to commit offsets after reset
+func (t *InputConfig) resetOffset(since *SinceDBInfo) *logevent.AckOrder {
+	t.sinceDBMutex.Lock()
+	since.Offset = 0
+	since.Completed = false
+	since.reset++
+	t.sinceDBMutex.Unlock()
+	return t.newOffsetAckOrder(since)
+}
+
+// newOffsetAckOrder returns an AckOrder to commit offsets of since in order,
+// after events of lines are delivered by outputs
+func (t *InputConfig) newOffsetAckOrder(since *SinceDBInfo) *logevent.AckOrder {
+	t.sinceDBMutex.Lock()
+	reset := since.reset
+	t.sinceDBMutex.Unlock()
+	return logevent.NewAckOrder(func(position any) {
+		t.sinceDBMutex.Lock()
+		if since.reset == reset {
+			since.Offset = position.(int64)
+			since.LastActive = time.Now()
+		}
+		t.sinceDBMutex.Unlock()
+		if err := t.CheckSaveSinceDBInfos(); err != nil {
+			log.Errorf("Save sincedb failed: %s", err)
+		}
+	})
+}
+
+// cleanSinceDBInfos removes entries of files not tailed and not active in sincedb_clean_after
+func (t *InputConfig) cleanSinceDBInfos() {
+	if t.SinceDBCleanAfter < 1 {
+		return
+	}
+
+	t.filesMutex.Lock()
+	tailed := make(map[string]bool, len(t.files))
+	for key := range t.files {
+		tailed[key] = true
+	}
+	t.filesMutex.Unlock()
+
+	expire := time.Now().Add(-time.Duration(t.SinceDBCleanAfter) * time.Second)
+	t.sinceDBMutex.Lock()
+	defer t.sinceDBMutex.Unlock()
+	for key, since := range t.SinceDBInfos {
+		if !tailed[key] && since.LastActive.Before(expire) {
+			log.Debugf("Clean sincedb of inactive file: %q", since.Path)
+			delete(t.SinceDBInfos, key)
+		}
+	}
+}
+
+func (t *InputConfig) marshalSinceDBInfos() ([]byte, error) {
+	t.sinceDBMutex.Lock()
+	defer t.sinceDBMutex.Unlock()
+	return json.Marshal(t.SinceDBInfos)
 }
 
 func (t *InputConfig) LoadSinceDBInfos() (err error) {
@@ -45,10 +190,24 @@ func (t *InputConfig) LoadSinceDBInfos() (err error) {
 		return
 	}
 
+	// entries of previous versions are cleaned after sincedb_clean_after from now
+	now := time.Now()
+	for _, since := range t.SinceDBInfos {
+		if since.LastActive.IsZero() {
+			since.LastActive = now
+		}
+	}
+
 	return
 }
 
 func (t *InputConfig) SaveSinceDBInfos() (err error) {
+	t.sinceDBSaveMutex.Lock()
+	defer t.sinceDBSaveMutex.Unlock()
+	return t.saveSinceDBInfos()
+}
+
+func (t *InputConfig) saveSinceDBInfos() (err error) {
 	var (
 		raw []byte
 	)
@@ -60,7 +219,7 @@ func (t *InputConfig) SaveSinceDBInfos() (err error) {
 		return
 	}
 
-	if raw, err = json.Marshal(t.SinceDBInfos); err != nil {
+	if raw, err = t.marshalSinceDBInfos(); err != nil {
 		log.Errorf("Marshal sincedb failed: %s", err)
 		return
 	}
@@ -78,13 +237,15 @@ func (t *InputConfig) CheckSaveSinceDBInfos() (err error) {
 	var (
 		raw []byte
 	)
+	t.sinceDBSaveMutex.Lock()
+	defer t.sinceDBSaveMutex.Unlock()
 	if time.Since(t.SinceDBLastSaveTime) > time.Duration(t.SinceDBWriteInterval)*time.Second {
-		if raw, err = json.Marshal(t.SinceDBInfos); err != nil {
+		if raw, err = t.marshalSinceDBInfos(); err != nil {
 			log.Errorf("Marshal sincedb failed: %s", err)
 			return
 		}
 		if !bytes.Equal(raw, t.sinceDBLastInfosRaw) {
-			err = t.SaveSinceDBInfos()
+			err = t.saveSinceDBInfos()
 		}
 	}
 	return
@@ -99,6 +260,7 @@ func (t *InputConfig) CheckSaveSinceDBInfosLoop(ctx context.Context) (err error)
 		case <-ctx.Done():
 			return nil
 		case <-ticker.C:
+			t.cleanSinceDBInfos()
 			if err = t.CheckSaveSinceDBInfos(); err != nil {
 				return
 			}
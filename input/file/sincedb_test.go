@@ -0,0 +1,83 @@
+package inputfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_getSinceDBInfo(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	conf := DefaultInputConfig()
+
+	// entries of previous versions keyed by path are migrated
+	conf.SinceDBInfos["app.log"] = &SinceDBInfo{Offset: 10}
+	since := conf.getSinceDBInfo("1:2", "app.log", []byte("first line\n"))
+	require.Equal(int64(10), since.Offset)
+	require.Equal("app.log", since.Path)
+	require.Equal(11, since.FingerprintSize)
+	require.NotContains(conf.SinceDBInfos, "app.log")
+
+	// renamed files are identified by key
+	since = conf.getSinceDBInfo("1:2", "app.log.1", []byte("first line\nsecond line\n"))
+	require.Equal(int64(10), since.Offset)
+	require.Equal("app.log.1", since.Path)
+	require.Equal(23, since.FingerprintSize)
+	require.Same(since, conf.SinceDBInfos["1:2"])
+
+	// files with reused inodes are not matched by fingerprint
+	since = conf.getSinceDBInfo("1:2", "app.log", []byte("other file\n"))
+	require.Equal(int64(0), since.Offset)
+	require.Equal(11, since.FingerprintSize)
+	require.Len(conf.SinceDBInfos, 1)
+
+	// files shorter than the fingerprint are other files
+	since.Offset = 11
+	since = conf.getSinceDBInfo("1:2", "app.log", []byte("other"))
+	require.Equal(int64(0), since.Offset)
+}
+
+func Test_cleanSinceDBInfos(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	conf := DefaultInputConfig()
+	conf.SinceDBCleanAfter = 60
+	conf.files = map[string]*tailedFile{"1:3": {key: "1:3"}}
+	expired := time.Now().Add(-2 * time.Minute)
+	conf.SinceDBInfos = map[string]*SinceDBInfo{
+		"1:1": {Offset: 1, LastActive: time.Now()},
+		"1:2": {Offset: 2, LastActive: expired},
+		"1:3": {Offset: 3, LastActive: expired},
+	}
+
+	conf.cleanSinceDBInfos()
+	require.Contains(conf.SinceDBInfos, "1:1")
+	require.NotContains(conf.SinceDBInfos, "1:2")
+	// entries of tailed files are kept
+	require.Contains(conf.SinceDBInfos, "1:3")
+}
+
+func Test_LoadSinceDBInfos(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	conf := DefaultInputConfig()
+	conf.SinceDBPath = filepath.Join(t.TempDir(), "sincedb.json")
+	require.NoError(os.WriteFile(conf.SinceDBPath, []byte(`{"/var/log/app.log":{"offset":10}}`), 0o644))
+	require.NoError(conf.LoadSinceDBInfos())
+	require.Equal(int64(10), conf.SinceDBInfos["/var/log/app.log"].Offset)
+	require.WithinDuration(time.Now(), conf.SinceDBInfos["/var/log/app.log"].LastActive, time.Minute)
+
+	conf.getSinceDBInfo("1:2", "/var/log/app.log", []byte("line\n"))
+	require.NoError(conf.SaveSinceDBInfos())
+	require.NoError(conf.LoadSinceDBInfos())
+	require.Equal(int64(10), conf.SinceDBInfos["1:2"].Offset)
+	require.Equal("/var/log/app.log", conf.SinceDBInfos["1:2"].Path)
+	require.Equal(fingerprint([]byte("line\n")), conf.SinceDBInfos["1:2"].Fingerprint)
+}
@@ -111,7 +111,8 @@ func (t *InputConfig) Request(ctx context.Context, msgChan chan<- logevent.LogEv
 	if err != nil {
 		tags = append(tags, ErrorTag)
 	}
-	_, err = t.Codec.Decode(ctx, []byte(data),
+	metadata := map[string]any{"url": t.URL}
+	_, err = t.Codec.Decode(logevent.ContextWithMetadata(ctx, metadata), []byte(data),
 		extra,
 		tags,
 		msgChan)
@@ -155,7 +155,11 @@ func (i *InputConfig) postHandler(msgChan chan<- logevent.LogEvent, rw http.Resp
 		return
 	}
 
-	ok, err := i.Codec.Decode(context.TODO(), data, nil, []string{}, msgChan)
+	metadata := map[string]any{
+		"remote_address": req.RemoteAddr,
+		"path":           req.URL.Path,
+	}
+	ok, err := i.Codec.Decode(logevent.ContextWithMetadata(context.TODO(), metadata), data, nil, []string{}, msgChan)
 	if err != nil {
 		logger.Errorf("decode request body error: %v", err)
 	}
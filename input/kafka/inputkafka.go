@@ -219,17 +219,45 @@ func (c *consumerHandle) ConsumeClaim(session sarama.ConsumerGroupSession, claim
 	// Do not move the code below to a goroutine.
 	// The `ConsumeClaim` itself is called within a goroutine, see:
 	// https://github.com/Shopify/sarama/blob/master/consumer_group.go#L27-L29
-	for message := range claim.Messages() {
+	// offsets are marked after events of the message are delivered by outputs,
+	// a message not delivered ends the session, the new session of the partition
+	// consumes again from the message, as offsets after it are not marked
+	acks := logevent.NewAckOrder(func(position any) {
+		session.MarkMessage(position.(*sarama.ConsumerMessage), "")
+	})
+	nacked := make(chan struct{})
+	var nackOnce sync.Once
+	for {
+		var message *sarama.ConsumerMessage
+		select {
+		case <-nacked:
+			return nil
+		case message = <-claim.Messages():
+		}
+		if message == nil {
+			return nil
+		}
 		var extra = map[string]any{
 			"topic":     message.Topic,
 			"timestamp": message.Timestamp,
 		}
-		ok, err := c.i.Codec.Decode(c.ctx, string(message.Value), extra, []string{}, c.ch)
+		ack := acks.NewAck(message, func(err error) {
+			if err != nil {
+				goglog.Logger.Errorf("kafka message %s/%d offset %d not delivered, consume again from the offset: %v", message.Topic, message.Partition, message.Offset, err)
+				nackOnce.Do(func() { close(nacked) })
+			}
+		})
+		metadata := map[string]any{
+			"topic":     message.Topic,
+			"partition": message.Partition,
+			"offset":    message.Offset,
+			"key":       string(message.Key),
+		}
+		ctx := logevent.ContextWithMetadata(logevent.ContextWithAck(c.ctx, ack), metadata)
+		ok, err := c.i.Codec.Decode(ctx, string(message.Value), extra, []string{}, c.ch)
 		if !ok {
 			goglog.Logger.Errorf("decode message to msg chan error : %v", err)
 		}
-		session.MarkMessage(message, "")
+		ack.Done(nil)
 	}
-
-	return nil
 }
@@ -2,6 +2,7 @@ package inputkafka
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -14,6 +15,7 @@ import (
 
 	"github.com/tsaikd/gogstash/config"
 	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
 )
 
 func init() {
@@ -80,3 +82,65 @@ input:
 		}
 	}
 }
+
+type testSession struct {
+	sarama.ConsumerGroupSession
+	marked chan int64
+}
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked <- msg.Offset
+}
+
+type testClaim struct {
+	sarama.ConsumerGroupClaim
+	messages chan *sarama.ConsumerMessage
+}
+
+func (c *testClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func Test_input_kafka_module_nack(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf := DefaultInputConfig()
+	codec, err := config.GetCodecOrDefault(ctx, nil)
+	require.NoError(err)
+	conf.Codec = codec
+
+	msgChan := make(chan logevent.LogEvent, 10)
+	session := &testSession{marked: make(chan int64, 10)}
+	claim := &testClaim{messages: make(chan *sarama.ConsumerMessage, 10)}
+	for i := int64(0); i < 3; i++ {
+		claim.messages <- &sarama.ConsumerMessage{Topic: "testTopic", Offset: i, Value: []byte(fmt.Sprint(i))}
+	}
+	consumed := make(chan error, 1)
+	go func() {
+		handle := &consumerHandle{i: &conf, ch: msgChan, ctx: ctx}
+		consumed <- handle.ConsumeClaim(session, claim)
+	}()
+
+	events := make([]logevent.LogEvent, 3)
+	for i := range events {
+		events[i] = <-msgChan
+	}
+	events[0].Ack()
+	require.EqualValues(0, <-session.marked)
+	events[2].Ack()
+	events[1].Nack(errors.New("output failed"))
+
+	// the claim ends to consume again from the nacked offset
+	select {
+	case err := <-consumed:
+		require.NoError(err)
+	case <-time.After(time.Second):
+		require.FailNow("claim not ended after nack")
+	}
+	assert.Len(session.marked, 0)
+}
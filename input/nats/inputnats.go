@@ -66,12 +66,16 @@ func InitHandler(
 		opts = append(opts, nats.UserCredentials(conf.Creds))
 	}
 
-	conf.client, err = nats.Connect(conf.Host, opts...)
+	conf.Codec, err = config.GetCodec(ctx, raw["codec"], codecjson.ModuleName)
 	if err != nil {
 		return nil, err
 	}
 
-	conf.Codec, err = config.GetCodec(ctx, raw["codec"], codecjson.ModuleName)
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
+	conf.client, err = nats.Connect(conf.Host, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -124,12 +124,28 @@ type nsqhandler struct {
 }
 
 // HandleMessage receives a message from NSQ
+// the message is finished after its events are delivered by outputs, otherwise requeued
 func (h *nsqhandler) HandleMessage(m *nsq.Message) error {
-	ok, err := h.i.Codec.Decode(h.ctx, m.Body, nil, []string{}, h.msgChan)
+	m.DisableAutoResponse()
+	ack := logevent.NewAck(func(err error) {
+		if err != nil {
+			m.Requeue(-1)
+			return
+		}
+		m.Finish()
+	})
+	metadata := map[string]any{
+		"topic":          h.i.Topic,
+		"channel":        h.i.Channel,
+		"remote_address": m.NSQDAddress,
+	}
+	ctx := logevent.ContextWithMetadata(logevent.ContextWithAck(h.ctx, ack), metadata)
+	ok, err := h.i.Codec.Decode(ctx, m.Body, nil, []string{}, h.msgChan)
 	if !ok {
 		goglog.Logger.Errorf("nsq: nok ok, error %s", err.Error())
 	} else if err != nil {
 		goglog.Logger.Errorf("nsq: %s", err.Error())
 	}
+	ack.Done(err)
 	return err
 }
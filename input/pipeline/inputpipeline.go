@@ -0,0 +1,84 @@
+package inputpipeline
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "pipeline"
+
+// errors
+var (
+	ErrNoAddress = errors.New("no address for pipeline input")
+)
+
+// InputConfig holds the configuration json fields and internal objects
+type InputConfig struct {
+	config.InputConfig
+	Address string `json:"address"` // virtual address other pipelines send events to
+
+	msgChan chan logevent.LogEvent
+}
+
+// DefaultInputConfig returns an InputConfig struct with default values
+func DefaultInputConfig() InputConfig {
+	return InputConfig{
+		InputConfig: config.InputConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+	}
+}
+
+// InitHandler initialize the input plugin
+func InitHandler(
+	ctx context.Context,
+	raw config.ConfigRaw,
+	control config.Control,
+) (config.TypeInputConfig, error) {
+	conf := DefaultInputConfig()
+	err := config.ReflectConfig(raw, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.Address == "" {
+		return nil, ErrNoAddress
+	}
+
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
+	// listen on initialization, so other pipelines can send to the address
+	// as soon as all pipelines are initialized
+	conf.msgChan = make(chan logevent.LogEvent)
+	if err = config.ListenPipelineAddress(ctx, conf.Address, conf.msgChan); err != nil {
+		return nil, err
+	}
+
+	return &conf, nil
+}
+
+// Start wraps the actual function starting the plugin
+func (t *InputConfig) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) (err error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-t.msgChan:
+			select {
+			case <-ctx.Done():
+				// not accepted, the input of the sending pipeline delivers it again
+				event.Nack(ctx.Err())
+				return nil
+			case msgChan <- event:
+			}
+		}
+	}
+}
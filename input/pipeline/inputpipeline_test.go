@@ -0,0 +1,62 @@
+package inputpipeline
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+func init() {
+	goglog.Logger.SetLevel(logrus.DebugLevel)
+	config.RegistInputHandler(ModuleName, InitHandler)
+}
+
+func Test_input_pipeline_module(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+input:
+  - type: pipeline
+    address: test-input-pipeline
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	require.NoError(config.SendToPipelineAddress(ctx, "test-input-pipeline", logevent.LogEvent{
+		Message: "pipeline test message",
+	}))
+	if event, err := conf.TestGetOutputEvent(300 * time.Millisecond); assert.NoError(err) {
+		require.Equal("pipeline test message", event.Message)
+	}
+}
+
+func Test_input_pipeline_module_address_in_use(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	raw := config.ConfigRaw{"type": ModuleName, "address": "test-input-pipeline-in-use"}
+	_, err := InitHandler(ctx, raw, nil)
+	require.NoError(err)
+	_, err = InitHandler(ctx, raw, nil)
+	require.True(config.ErrorPipelineAddressInUse1.Match(err))
+
+	_, err = InitHandler(ctx, config.ConfigRaw{"type": ModuleName}, nil)
+	require.ErrorIs(err, ErrNoAddress)
+}
@@ -79,6 +79,15 @@ func InitHandler(
 		return nil, err
 	}
 
+	conf.Codec, err = config.GetCodec(ctx, raw["codec"], codecjson.ModuleName)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
 	conf.client = redis.NewClient(&redis.Options{
 		Addr:     conf.Host,
 		DB:       conf.DB,
@@ -98,11 +107,6 @@ func InitHandler(
 		}
 	}
 
-	conf.Codec, err = config.GetCodec(ctx, raw["codec"], codecjson.ModuleName)
-	if err != nil {
-		return nil, err
-	}
-
 	return &conf, nil
 }
 
@@ -111,7 +115,8 @@ func (i *InputConfig) queueMessage(
 	message string,
 	msgChan chan<- logevent.LogEvent,
 ) (err error) {
-	_, err = i.Codec.Decode(ctx, []byte(message), nil, []string{}, msgChan)
+	metadata := map[string]any{"key": i.Key}
+	_, err = i.Codec.Decode(logevent.ContextWithMetadata(ctx, metadata), []byte(message), nil, []string{}, msgChan)
 
 	return
 }
@@ -166,7 +166,8 @@ func (i *InputConfig) Start(ctx context.Context, msgChan chan<- logevent.LogEven
 			func(conn net.Conn) {
 				eg.Go(func() error {
 					defer conn.Close()
-					i.parse(ctx, conn, msgChan)
+					metadata := map[string]any{"remote_address": conn.RemoteAddr().String()}
+					i.parse(logevent.ContextWithMetadata(ctx, metadata), conn, msgChan)
 					close(doneCh)
 					return nil
 				})
@@ -210,7 +211,8 @@ func (i *InputConfig) handleUDPpacketMode(ctx context.Context, conn net.PacketCo
 					extras := map[string]any{
 						"host_ip": addr.String(),
 					}
-					_, codecErr := i.Codec.Decode(ctx, b[:n], extras, []string{}, msgChan)
+					metadata := map[string]any{"remote_address": addr.String()}
+					_, codecErr := i.Codec.Decode(logevent.ContextWithMetadata(ctx, metadata), b[:n], extras, []string{}, msgChan)
 					if codecErr != nil {
 						logger.Errorf("Input socket %v: %v", i.Address, codecErr)
 					}
@@ -0,0 +1,386 @@
+package inputsyslog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	reuse "github.com/libp2p/go-reuseport"
+	"github.com/tsaikd/KDGoLib/errutil"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "syslog"
+
+// ErrorTag tag added to event when the message is not a valid syslog message
+const ErrorTag = "gogstash_input_syslog_error"
+
+// protocols of listeners
+const (
+	ProtocolUDP = "udp"
+	ProtocolTCP = "tcp"
+	ProtocolTLS = "tls"
+)
+
+// errors
+var (
+	ErrorUnknownProtocol1       = errutil.NewFactory("%q is not a valid protocol, must be one of udp, tcp or tls")
+	ErrorTCPAndTLS              = errutil.NewFactory("tcp and tls can not listen on the same address")
+	ErrorNoCertificate          = errutil.NewFactory("ssl_certificate and ssl_key are required for tls")
+	ErrorInvalidCA1             = errutil.NewFactory("no certificate found in ssl_ca: %q")
+	ErrorSocketAccept           = errutil.NewFactory("socket accept error")
+	ErrorNoPriority             = errutil.NewFactory("no priority in message")
+	ErrorInvalidPriority1       = errutil.NewFactory("invalid priority: %q")
+	ErrorInvalidHeader1         = errutil.NewFactory("invalid rfc5424 header: %q")
+	ErrorInvalidTimestamp1      = errutil.NewFactory("invalid timestamp: %q")
+	ErrorInvalidStructuredData1 = errutil.NewFactory("invalid structured data: %q")
+)
+
+// InputConfig holds the configuration json fields and internal objects
+type InputConfig struct {
+	config.InputConfig
+	Address        string   `json:"address"`                    // host:port to listen on, default: "0.0.0.0:514"
+	Protocols      []string `json:"protocols"`                  // any of ["udp", "tcp", "tls"], default: ["udp", "tcp"]
+	ReusePort      bool     `json:"reuseport,omitempty"`        // SO_REUSEPORT applied or not
+	SSLCertificate string   `json:"ssl_certificate,omitempty"`  // certificate file of tls
+	SSLKey         string   `json:"ssl_key,omitempty"`          // key file of tls
+	SSLCA          string   `json:"ssl_ca,omitempty"`           // CA file to verify client certificates of tls
+	MaxMessageSize int      `json:"max_message_size,omitempty"` // max bytes of a message, longer messages are truncated
+	Timezone       string   `json:"timezone,omitempty"`         // timezone of rfc3164 timestamps, default: local
+
+	loc       *time.Location
+	tlsConfig *tls.Config
+}
+
+// DefaultInputConfig returns an InputConfig struct with default values
+func DefaultInputConfig() InputConfig {
+	return InputConfig{
+		InputConfig: config.InputConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+		Address:        "0.0.0.0:514",
+		Protocols:      []string{ProtocolUDP, ProtocolTCP},
+		MaxMessageSize: 65536,
+	}
+}
+
+// InitHandler initialize the input plugin
+func InitHandler(
+	ctx context.Context,
+	raw config.ConfigRaw,
+	control config.Control,
+) (config.TypeInputConfig, error) {
+	conf := DefaultInputConfig()
+	err := config.ReflectConfig(raw, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(conf.Protocols, ProtocolTCP) && slices.Contains(conf.Protocols, ProtocolTLS) {
+		return nil, ErrorTCPAndTLS.New(nil)
+	}
+	for _, protocol := range conf.Protocols {
+		switch protocol {
+		case ProtocolUDP, ProtocolTCP:
+		case ProtocolTLS:
+			if conf.tlsConfig, err = conf.loadTLSConfig(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, ErrorUnknownProtocol1.New(nil, protocol)
+		}
+	}
+
+	conf.loc = time.Local
+	if conf.Timezone != "" {
+		if conf.loc, err = time.LoadLocation(conf.Timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	return &conf, nil
+}
+
+func (i *InputConfig) loadTLSConfig() (*tls.Config, error) {
+	if i.SSLCertificate == "" || i.SSLKey == "" {
+		return nil, ErrorNoCertificate.New(nil)
+	}
+	cert, err := tls.LoadX509KeyPair(i.SSLCertificate, i.SSLKey)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if i.SSLCA != "" {
+		content, err := os.ReadFile(i.SSLCA)
+		if err != nil {
+			return nil, err
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(content) {
+			return nil, ErrorInvalidCA1.New(nil, i.SSLCA)
+		}
+		tlsConfig.ClientCAs = certPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// Start wraps the actual function starting the plugin
+func (i *InputConfig) Start(ctx context.Context, msgChan chan<- logevent.LogEvent) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	eg, ctx := errgroup.WithContext(ctx)
+	stop := func(err error) error {
+		// close listeners already started
+		cancel()
+		eg.Wait()
+		return err
+	}
+
+	for _, protocol := range i.Protocols {
+		switch protocol {
+		case ProtocolUDP:
+			conn, err := i.listenPacket()
+			if err != nil {
+				return stop(err)
+			}
+			eg.Go(func() error {
+				return i.handleUDP(ctx, conn, msgChan)
+			})
+		case ProtocolTCP, ProtocolTLS:
+			l, err := i.listen()
+			if err != nil {
+				return stop(err)
+			}
+			if protocol == ProtocolTLS {
+				l = tls.NewListener(l, i.tlsConfig)
+			}
+			eg.Go(func() error {
+				return i.handleTCP(ctx, l, msgChan)
+			})
+		}
+		goglog.Logger.Infof("syslog input: start listening %s on %s", protocol, i.Address)
+	}
+	return eg.Wait()
+}
+
+func (i *InputConfig) listenPacket() (net.PacketConn, error) {
+	if i.ReusePort {
+		return reuse.ListenPacket("udp", i.Address)
+	}
+	return net.ListenPacket("udp", i.Address)
+}
+
+func (i *InputConfig) listen() (net.Listener, error) {
+	if i.ReusePort {
+		return reuse.Listen("tcp", i.Address)
+	}
+	return net.Listen("tcp", i.Address)
+}
+
+// handleUDP receives a message in each packet
+func (i *InputConfig) handleUDP(ctx context.Context, conn net.PacketConn, msgChan chan<- logevent.LogEvent) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	b := make([]byte, i.MaxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(b)
+		if n > 0 {
+			i.send(ctx, addr.String(), b[:n], msgChan)
+		}
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handleTCP accepts connections until ctx done
+func (i *InputConfig) handleTCP(ctx context.Context, l net.Listener, msgChan chan<- logevent.LogEvent) error {
+	eg, ctx := errgroup.WithContext(ctx)
+
+	eg.Go(func() error {
+		<-ctx.Done()
+		return l.Close()
+	})
+
+	eg.Go(func() error {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return nil
+				}
+				return ErrorSocketAccept.New(err)
+			}
+			doneCh := make(chan struct{})
+			eg.Go(func() error {
+				select {
+				case <-doneCh:
+				case <-ctx.Done():
+					conn.Close()
+				}
+				return nil
+			})
+			eg.Go(func() error {
+				defer close(doneCh)
+				defer conn.Close()
+				i.handleConn(ctx, conn, msgChan)
+				return nil
+			})
+		}
+	})
+
+	return eg.Wait()
+}
+
+// handleConn receives messages of octet-counting or non-transparent framing (RFC6587),
+// the framing is detected for each message
+func (i *InputConfig) handleConn(ctx context.Context, conn net.Conn, msgChan chan<- logevent.LogEvent) {
+	logger := goglog.Logger
+	remoteAddress := conn.RemoteAddr().String()
+	reader := bufio.NewReader(conn)
+	for {
+		data, err := i.readFrame(reader)
+		if len(bytes.TrimRight(data, "\r\n\x00")) > 0 {
+			i.send(ctx, remoteAddress, data, msgChan)
+		}
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) && ctx.Err() == nil {
+				logger.Errorf("syslog input: read from %s failed: %v", remoteAddress, err)
+			}
+			return
+		}
+	}
+}
+
+// readFrame reads "MSG-LEN SP SYSLOG-MSG" if the frame starts with digits,
+// otherwise a message ended with LF
+func (i *InputConfig) readFrame(reader *bufio.Reader) (data []byte, err error) {
+	digits := []byte{}
+	for len(digits) < 10 {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c == ' ' && len(digits) > 0 {
+			return i.readOctetCounting(reader, digits)
+		}
+		digits = append(digits, c)
+		if c == '\n' {
+			// empty line between messages
+			return digits, nil
+		}
+		if c < '0' || c > '9' {
+			break
+		}
+	}
+	return i.readLine(reader, digits)
+}
+
+func (i *InputConfig) readOctetCounting(reader *bufio.Reader, digits []byte) (data []byte, err error) {
+	size, err := strconv.Atoi(string(digits))
+	if err != nil {
+		return nil, err
+	}
+	data = make([]byte, min(size, i.MaxMessageSize))
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	if size > len(data) {
+		goglog.Logger.Warnf("syslog input: message of %d bytes truncated", size)
+		if _, err = reader.Discard(size - len(data)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// readLine reads the rest of the line started with prefix
+func (i *InputConfig) readLine(reader *bufio.Reader, prefix []byte) (data []byte, err error) {
+	data = prefix
+	truncated := false
+	for {
+		line, err := reader.ReadSlice('\n')
+		if len(data)+len(line) > i.MaxMessageSize {
+			line = line[:max(i.MaxMessageSize-len(data), 0)]
+			truncated = true
+		}
+		data = append(data, line...)
+		if err != bufio.ErrBufferFull {
+			if truncated {
+				goglog.Logger.Warnf("syslog input: message longer than %d bytes truncated", i.MaxMessageSize)
+			}
+			if err == io.EOF && len(data) > 0 {
+				// the last message without LF
+				err = nil
+			}
+			return data, err
+		}
+	}
+}
+
+// send parses the message to event, the remote address is saved in the metadata of the event,
+// the hostname is the remote host if not found in the message
+func (i *InputConfig) send(ctx context.Context, remoteAddress string, data []byte, msgChan chan<- logevent.LogEvent) {
+	msg, err := parseMessage(string(data), time.Now(), i.loc)
+
+	event := logevent.LogEvent{
+		Timestamp: msg.timestamp,
+		Message:   msg.text,
+		Extra: map[string]any{
+			"priority":       msg.priority,
+			"facility":       msg.facility(),
+			"severity":       msg.severity(),
+			"facility_label": facilityLabels[msg.facility()],
+			"severity_label": severityLabels[msg.severity()],
+		},
+	}
+	if err != nil {
+		goglog.Logger.Debugf("syslog input: %v", err)
+		event.AddTag(ErrorTag)
+	}
+	if msg.hostname == "" {
+		msg.hostname, _, _ = net.SplitHostPort(remoteAddress)
+	}
+	for field, value := range map[string]string{
+		"hostname": msg.hostname,
+		"app_name": msg.appName,
+		"procid":   msg.procID,
+		"msgid":    msg.msgID,
+	} {
+		if value != "" {
+			event.Extra[field] = value
+		}
+	}
+	if len(msg.structuredData) > 0 {
+		event.Extra["structured_data"] = msg.structuredData
+	}
+	event.SetMetadata("remote_address", remoteAddress)
+
+	select {
+	case msgChan <- event:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,183 @@
+package inputsyslog
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+)
+
+func init() {
+	goglog.Logger.SetLevel(logrus.DebugLevel)
+	config.RegistInputHandler(ModuleName, InitHandler)
+}
+
+func Test_input_syslog_module(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+input:
+  - type: syslog
+    address: "127.0.0.1:16514"
+    timezone: "UTC"
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+	time.Sleep(500 * time.Millisecond)
+
+	// udp
+	conn, err := net.Dial("udp", "127.0.0.1:16514")
+	require.NoError(err)
+	_, err = conn.Write([]byte("<165>1 2003-10-11T22:14:15.003Z mymachine evntslog 42 ID47 [origin ip=\"10.0.0.1\"] udp message\n"))
+	require.NoError(err)
+	require.NoError(conn.Close())
+	if event, err := conf.TestGetOutputEvent(time.Second); assert.NoError(err) {
+		require.Equal("udp message", event.Message)
+		require.Equal(time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC), event.Timestamp)
+		require.Equal(165, event.Get("priority"))
+		require.Equal(20, event.Get("facility"))
+		require.Equal(5, event.Get("severity"))
+		require.Equal("local4", event.Get("facility_label"))
+		require.Equal("notice", event.Get("severity_label"))
+		require.Equal("mymachine", event.Get("hostname"))
+		require.Equal("evntslog", event.Get("app_name"))
+		require.Equal("42", event.Get("procid"))
+		require.Equal("ID47", event.Get("msgid"))
+		require.Equal("10.0.0.1", event.GetString("structured_data.origin.ip"))
+		require.Contains(event.GetString("@metadata.remote_address"), "127.0.0.1:")
+	}
+
+	// tcp with non-transparent and octet-counting framing
+	conn, err = net.Dial("tcp", "127.0.0.1:16514")
+	require.NoError(err)
+	octetCounted := "<13>1 - host app - - - multiple\nlines"
+	_, err = conn.Write([]byte("<13>Oct 11 22:14:15 host app[7]: first\n" +
+		fmt.Sprintf("%d %s", len(octetCounted), octetCounted) +
+		"\n<13>Oct 11 22:14:16 host app[7]: last\nno priority"))
+	require.NoError(err)
+	require.NoError(conn.Close())
+	if event, err := conf.TestGetOutputEvent(time.Second); assert.NoError(err) {
+		require.Equal("first", event.Message)
+		require.Equal("app", event.Get("app_name"))
+		require.Equal("7", event.Get("procid"))
+	}
+	if event, err := conf.TestGetOutputEvent(time.Second); assert.NoError(err) {
+		require.Equal("multiple\nlines", event.Message)
+	}
+	if event, err := conf.TestGetOutputEvent(time.Second); assert.NoError(err) {
+		require.Equal("last", event.Message)
+	}
+	if event, err := conf.TestGetOutputEvent(time.Second); assert.NoError(err) {
+		require.Equal("no priority", event.Message)
+		require.Equal("127.0.0.1", event.Get("hostname"))
+		require.Equal([]string{ErrorTag}, event.Tags)
+	}
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+func Test_input_syslog_module_tls(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeCertificate(t, certPath, keyPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+input:
+  - type: syslog
+    address: "127.0.0.1:16515"
+    protocols: ["tls"]
+    ssl_certificate: %q
+    ssl_key: %q
+	`, certPath, keyPath))))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+	time.Sleep(500 * time.Millisecond)
+
+	conn, err := tls.Dial("tcp", "127.0.0.1:16515", &tls.Config{InsecureSkipVerify: true})
+	require.NoError(err)
+	message := "<14>1 2024-01-02T03:04:05+08:00 host app - - - over tls"
+	_, err = conn.Write([]byte(fmt.Sprintf("%d %s", len(message), message)))
+	require.NoError(err)
+	if event, err := conf.TestGetOutputEvent(time.Second); assert.NoError(err) {
+		require.Equal("over tls", event.Message)
+		require.Equal("info", event.Get("severity_label"))
+	}
+	require.NoError(conn.Close())
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+func Test_input_syslog_module_config(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx := context.Background()
+	for _, raw := range []config.ConfigRaw{
+		{"protocols": []any{"http"}},
+		{"protocols": []any{"tcp", "tls"}},
+		{"protocols": []any{"tls"}},
+		{"protocols": []any{"tls"}, "ssl_certificate": "not-found.pem", "ssl_key": "not-found.pem"},
+		{"timezone": "Not/Found"},
+	} {
+		_, err := InitHandler(ctx, raw, nil)
+		require.Error(err, raw)
+	}
+}
+
+func writeCertificate(t *testing.T, certPath string, keyPath string) {
+	require := require.New(t)
+
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"gogstash"}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	require.NoError(err)
+	require.NoError(os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: derBytes}), 0o644))
+
+	keyBytes, err := x509.MarshalECPrivateKey(priv)
+	require.NoError(err)
+	require.NoError(os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600))
+}
@@ -0,0 +1,267 @@
+package inputsyslog
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPriority is user.notice, the priority of messages without PRI
+const defaultPriority = 13
+
+var facilityLabels = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var severityLabels = []string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// rfc3164 timestamp, e.g. "Oct  1 12:34:56" or "Oct 1 12:34:56.789"
+var regexpStamp = regexp.MustCompile(`^([A-Z][a-z]{2}) +(\d{1,2}) (\d{2}:\d{2}:\d{2}(?:\.\d+)?)(?: |$)`)
+
+// message is a parsed syslog message
+type message struct {
+	priority       int
+	timestamp      time.Time
+	hostname       string
+	appName        string
+	procID         string
+	msgID          string
+	structuredData map[string]any
+	text           string
+}
+
+func (m message) facility() int {
+	return m.priority / 8
+}
+
+func (m message) severity() int {
+	return m.priority % 8
+}
+
+// parseMessage parses RFC5424 or RFC3164 message, timestamps without year are inferred
+// to the year closest to now, timestamps without zone are in loc, the message is returned
+// as text of user.notice with the error if failed
+func parseMessage(data string, now time.Time, loc *time.Location) (msg message, err error) {
+	data = strings.TrimRight(data, "\r\n\x00")
+	fallback := message{priority: defaultPriority, timestamp: now, text: data}
+
+	priority, rest, err := parsePriority(data)
+	if err != nil {
+		return fallback, err
+	}
+	if isRFC5424(rest) {
+		msg, err = parseRFC5424(rest, now)
+	} else {
+		msg = parseRFC3164(rest, now, loc)
+	}
+	if err != nil {
+		return fallback, err
+	}
+	msg.priority = priority
+	return msg, nil
+}
+
+// parsePriority parses "<PRI>" at the beginning of data
+func parsePriority(data string) (priority int, rest string, err error) {
+	if !strings.HasPrefix(data, "<") {
+		return 0, data, ErrorNoPriority.New(nil)
+	}
+	end := strings.IndexByte(data, '>')
+	if end < 2 || end > 4 {
+		return 0, data, ErrorInvalidPriority1.New(nil, data[:min(len(data), 5)])
+	}
+	priority, err = strconv.Atoi(data[1:end])
+	if err != nil || priority < 0 || priority > 191 || (end > 2 && data[1] == '0') {
+		return 0, data, ErrorInvalidPriority1.New(nil, data[1:end])
+	}
+	return priority, data[end+1:], nil
+}
+
+// isRFC5424 returns true if rest starts with the version of RFC5424
+func isRFC5424(rest string) bool {
+	i := 0
+	for i < len(rest) && i < 3 && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	return i > 0 && rest[0] != '0' && i < len(rest) && rest[i] == ' '
+}
+
+// parseRFC5424 parses "VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]"
+func parseRFC5424(data string, now time.Time) (msg message, err error) {
+	header := make([]string, 6)
+	rest := data
+	for i := range header {
+		var ok bool
+		if header[i], rest, ok = strings.Cut(rest, " "); !ok || header[i] == "" {
+			return msg, ErrorInvalidHeader1.New(nil, data)
+		}
+	}
+
+	if header[1] == "-" {
+		msg.timestamp = now
+	} else if msg.timestamp, err = time.Parse(time.RFC3339Nano, header[1]); err != nil {
+		return msg, ErrorInvalidTimestamp1.New(err, header[1])
+	}
+	msg.hostname = nilValue(header[2])
+	msg.appName = nilValue(header[3])
+	msg.procID = nilValue(header[4])
+	msg.msgID = nilValue(header[5])
+
+	if msg.structuredData, rest, err = parseStructuredData(rest); err != nil {
+		return msg, err
+	}
+	switch {
+	case rest == "":
+	case rest[0] == ' ':
+		msg.text = strings.TrimPrefix(rest[1:], "\xEF\xBB\xBF")
+	default:
+		return msg, ErrorInvalidStructuredData1.New(nil, rest)
+	}
+	return msg, nil
+}
+
+func nilValue(value string) string {
+	if value == "-" {
+		return ""
+	}
+	return value
+}
+
+// parseStructuredData parses SD-ELEMENTs to map of SD-ID to params, or "-"
+func parseStructuredData(data string) (sd map[string]any, rest string, err error) {
+	if strings.HasPrefix(data, "-") {
+		return nil, data[1:], nil
+	}
+	if !strings.HasPrefix(data, "[") {
+		return nil, data, ErrorInvalidStructuredData1.New(nil, data)
+	}
+
+	sd = map[string]any{}
+	rest = data
+	for strings.HasPrefix(rest, "[") {
+		end := strings.IndexAny(rest, " ]")
+		if end < 2 {
+			return nil, data, ErrorInvalidStructuredData1.New(nil, data)
+		}
+		id := rest[1:end]
+		params, ok := sd[id].(map[string]any)
+		if !ok {
+			params = map[string]any{}
+			sd[id] = params
+		}
+		rest = rest[end:]
+
+		for strings.HasPrefix(rest, " ") {
+			name, value, ok := strings.Cut(rest[1:], "=\"")
+			if !ok || name == "" || strings.ContainsAny(name, " ]\"") {
+				return nil, data, ErrorInvalidStructuredData1.New(nil, data)
+			}
+			if value, rest, ok = parseParamValue(value); !ok {
+				return nil, data, ErrorInvalidStructuredData1.New(nil, data)
+			}
+			params[name] = value
+		}
+		if !strings.HasPrefix(rest, "]") {
+			return nil, data, ErrorInvalidStructuredData1.New(nil, data)
+		}
+		rest = rest[1:]
+	}
+	return sd, rest, nil
+}
+
+// parseParamValue returns the unescaped PARAM-VALUE before the closing quote
+func parseParamValue(data string) (value string, rest string, ok bool) {
+	var sb strings.Builder
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '"':
+			return sb.String(), data[i+1:], true
+		case '\\':
+			if i+1 < len(data) && strings.IndexByte(`"\]`, data[i+1]) >= 0 {
+				i++
+				c = data[i]
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", data, false
+}
+
+// parseRFC3164 parses "TIMESTAMP HOSTNAME TAG[PID]: MSG", the hostname may be omitted,
+// rest without timestamp is returned as text
+func parseRFC3164(rest string, now time.Time, loc *time.Location) (msg message) {
+	msg.timestamp = now
+	if token, after, _ := strings.Cut(rest, " "); len(token) > 0 && token[0] >= '0' && token[0] <= '9' {
+		// RFC3339 timestamp sent by some daemons, e.g. rsyslog
+		t, err := time.Parse(time.RFC3339Nano, token)
+		if err != nil {
+			msg.text = rest
+			return msg
+		}
+		msg.timestamp, rest = t, after
+	} else if match := regexpStamp.FindStringSubmatch(rest); match != nil {
+		t, ok := inferYear(match[1]+" "+match[2]+" "+match[3], now, loc)
+		if !ok {
+			msg.text = rest
+			return msg
+		}
+		msg.timestamp, rest = t, rest[len(match[0]):]
+	} else {
+		msg.text = rest
+		return msg
+	}
+	rest = strings.TrimLeft(rest, " ")
+
+	if token, after, ok := strings.Cut(rest, " "); ok && !strings.HasSuffix(token, ":") && !strings.Contains(token, "[") {
+		msg.hostname, rest = token, after
+	}
+
+	end := strings.IndexAny(rest, ":[ ")
+	if end < 1 || rest[end] == ' ' {
+		msg.text = rest
+		return msg
+	}
+	tag, after := rest[:end], rest[end:]
+	if after[0] == '[' {
+		pidEnd := strings.IndexByte(after, ']')
+		if pidEnd < 0 {
+			msg.text = rest
+			return msg
+		}
+		msg.procID, after = after[1:pidEnd], after[pidEnd+1:]
+	}
+	msg.appName = tag
+	after = strings.TrimPrefix(after, ":")
+	msg.text = strings.TrimPrefix(after, " ")
+	return msg
+}
+
+// inferYear returns the time of stamp without year in the year closest to now
+func inferYear(stamp string, now time.Time, loc *time.Location) (t time.Time, ok bool) {
+	now = now.In(loc)
+	for year := now.Year() - 1; year <= now.Year()+1; year++ {
+		candidate, err := time.ParseInLocation("2006 Jan 2 15:04:05", strconv.Itoa(year)+" "+stamp, loc)
+		if err != nil {
+			// e.g. Feb 29 of a non leap year
+			continue
+		}
+		if !ok || absDuration(candidate.Sub(now)) < absDuration(t.Sub(now)) {
+			t, ok = candidate, true
+		}
+	}
+	return t, ok
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
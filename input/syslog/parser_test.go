@@ -0,0 +1,127 @@
+package inputsyslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRFC5424(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	msg, err := parseMessage(`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 `+
+		`[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high \"1\" \\ \]"]`+
+		" \xEF\xBB\xBFAn application event log entry...\n", now, time.UTC)
+	require.NoError(err)
+	require.Equal(165, msg.priority)
+	require.Equal(20, msg.facility())
+	require.Equal(5, msg.severity())
+	require.Equal(time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC), msg.timestamp)
+	require.Equal("mymachine.example.com", msg.hostname)
+	require.Equal("evntslog", msg.appName)
+	require.Equal("", msg.procID)
+	require.Equal("ID47", msg.msgID)
+	require.Equal(map[string]any{
+		"exampleSDID@32473":     map[string]any{"iut": "3", "eventSource": "Application", "eventID": "1011"},
+		"examplePriority@32473": map[string]any{"class": `high "1" \ ]`},
+	}, msg.structuredData)
+	require.Equal("An application event log entry...", msg.text)
+
+	msg, err = parseMessage(`<34>1 - - su 123 - -`, now, time.UTC)
+	require.NoError(err)
+	require.Equal(now, msg.timestamp)
+	require.Equal("", msg.hostname)
+	require.Equal("su", msg.appName)
+	require.Equal("123", msg.procID)
+	require.Nil(msg.structuredData)
+	require.Equal("", msg.text)
+
+	for _, data := range []string{
+		`<34>1 2003-10-11T22:14:15Z host`,
+		`<34>1 2003-10-11 host app - - - msg`,
+		`<34>1 2003-10-11T22:14:15Z host app - - [id a=1] msg`,
+		`<34>1 2003-10-11T22:14:15Z host app - - [id a="1" msg`,
+		`<34>1 2003-10-11T22:14:15Z host app - - [id a="1"]msg`,
+	} {
+		msg, err = parseMessage(data, now, time.UTC)
+		require.Error(err, data)
+		require.Equal(defaultPriority, msg.priority)
+		require.Equal(data, msg.text)
+	}
+}
+
+func TestParseRFC3164(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, loc)
+	msg, err := parseMessage(`<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`, now, loc)
+	require.NoError(err)
+	require.Equal(34, msg.priority)
+	require.Equal(4, msg.facility())
+	require.Equal(2, msg.severity())
+	require.Equal(time.Date(2023, time.October, 11, 22, 14, 15, 0, loc), msg.timestamp)
+	require.Equal("mymachine", msg.hostname)
+	require.Equal("su", msg.appName)
+	require.Equal("'su root' failed for lonvick on /dev/pts/8", msg.text)
+
+	msg, err = parseMessage("<13>Mar  1 08:00:00.250 sshd[1234]: Accepted publickey\r\n", now, loc)
+	require.NoError(err)
+	require.Equal(time.Date(2024, time.March, 1, 8, 0, 0, 250000000, loc), msg.timestamp)
+	require.Equal("", msg.hostname)
+	require.Equal("sshd", msg.appName)
+	require.Equal("1234", msg.procID)
+	require.Equal("Accepted publickey", msg.text)
+
+	msg, err = parseMessage(`<13>2024-02-29T23:59:59.5+08:00 host app[1] message`, now, loc)
+	require.NoError(err)
+	require.True(time.Date(2024, time.February, 29, 23, 59, 59, 500000000, loc).Equal(msg.timestamp))
+	require.Equal("host", msg.hostname)
+	require.Equal("app", msg.appName)
+	require.Equal("message", msg.text)
+
+	msg, err = parseMessage(`<13>Feb 28 10:00:00 host no tag here`, now, loc)
+	require.NoError(err)
+	require.Equal("host", msg.hostname)
+	require.Equal("", msg.appName)
+	require.Equal("no tag here", msg.text)
+
+	msg, err = parseMessage(`<13>not a timestamp`, now, loc)
+	require.NoError(err)
+	require.Equal(now, msg.timestamp)
+	require.Equal("not a timestamp", msg.text)
+
+	msg, err = parseMessage(`no priority`, now, loc)
+	require.Error(err)
+	require.Equal(defaultPriority, msg.priority)
+	require.Equal("no priority", msg.text)
+
+	for _, data := range []string{`<192>msg`, `<013>msg`, `<>msg`, `<1234>msg`, `<a>msg`} {
+		_, err = parseMessage(data, now, loc)
+		require.Error(err, data)
+	}
+}
+
+func TestInferYear(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	for _, testcase := range []struct {
+		now      time.Time
+		stamp    string
+		expected time.Time
+	}{
+		{time.Date(2024, time.January, 1, 0, 0, 10, 0, time.UTC), "Dec 31 23:59:59", time.Date(2023, time.December, 31, 23, 59, 59, 0, time.UTC)},
+		{time.Date(2023, time.December, 31, 23, 59, 0, 0, time.UTC), "Jan 1 00:00:05", time.Date(2024, time.January, 1, 0, 0, 5, 0, time.UTC)},
+		{time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), "Feb 29 12:00:00", time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC)},
+		{time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC), "Jun 1 12:00:00", time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)},
+	} {
+		ts, ok := inferYear(testcase.stamp, testcase.now, time.UTC)
+		require.True(ok)
+		require.Equal(testcase.expected, ts, testcase.stamp)
+	}
+}
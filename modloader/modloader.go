@@ -3,6 +3,7 @@ package modloader
 import (
 	codecazureeventhubjson "github.com/tsaikd/gogstash/codec/azureeventhubjson"
 	codecjson "github.com/tsaikd/gogstash/codec/json"
+	codecmultiline "github.com/tsaikd/gogstash/codec/multiline"
 	"github.com/tsaikd/gogstash/config"
 	filteraddfield "github.com/tsaikd/gogstash/filter/addfield"
 	filtercond "github.com/tsaikd/gogstash/filter/cond"
@@ -26,6 +27,7 @@ import (
 	filteruseragent "github.com/tsaikd/gogstash/filter/useragent"
 	inputazureeventhub "github.com/tsaikd/gogstash/input/azureeventhub"
 	inputbeats "github.com/tsaikd/gogstash/input/beats"
+	inputdeadletter "github.com/tsaikd/gogstash/input/deadletter"
 	inputdockerlog "github.com/tsaikd/gogstash/input/dockerlog"
 	inputdockerstats "github.com/tsaikd/gogstash/input/dockerstats"
 	inputexec "github.com/tsaikd/gogstash/input/exec"
@@ -36,8 +38,10 @@ import (
 	inputlorem "github.com/tsaikd/gogstash/input/lorem"
 	inputnats "github.com/tsaikd/gogstash/input/nats"
 	inputnsq "github.com/tsaikd/gogstash/input/nsq"
+	inputpipeline "github.com/tsaikd/gogstash/input/pipeline"
 	inputredis "github.com/tsaikd/gogstash/input/redis"
 	inputsocket "github.com/tsaikd/gogstash/input/socket"
+	inputsyslog "github.com/tsaikd/gogstash/input/syslog"
 	outputamqp "github.com/tsaikd/gogstash/output/amqp"
 	outputclickhouse "github.com/tsaikd/gogstash/output/clickhouse"
 	outputcond "github.com/tsaikd/gogstash/output/cond"
@@ -50,6 +54,7 @@ import (
 	outputkafka "github.com/tsaikd/gogstash/output/kafka"
 	outputloki "github.com/tsaikd/gogstash/output/loki"
 	outputnsq "github.com/tsaikd/gogstash/output/nsq"
+	outputpipeline "github.com/tsaikd/gogstash/output/pipeline"
 	outputprometheus "github.com/tsaikd/gogstash/output/prometheus"
 	outputredis "github.com/tsaikd/gogstash/output/redis"
 	outputreport "github.com/tsaikd/gogstash/output/report"
@@ -60,6 +65,7 @@ import (
 
 func init() {
 	config.RegistInputHandler(inputbeats.ModuleName, inputbeats.InitHandler)
+	config.RegistInputHandler(inputdeadletter.ModuleName, inputdeadletter.InitHandler)
 	config.RegistInputHandler(inputdockerlog.ModuleName, inputdockerlog.InitHandler)
 	config.RegistInputHandler(inputdockerstats.ModuleName, inputdockerstats.InitHandler)
 	config.RegistInputHandler(inputexec.ModuleName, inputexec.InitHandler)
@@ -71,8 +77,10 @@ func init() {
 	config.RegistInputHandler(inputlorem.ModuleName, inputlorem.InitHandler)
 	config.RegistInputHandler(inputnats.ModuleName, inputnats.InitHandler)
 	config.RegistInputHandler(inputnsq.ModuleName, inputnsq.InitHandler)
+	config.RegistInputHandler(inputpipeline.ModuleName, inputpipeline.InitHandler)
 	config.RegistInputHandler(inputredis.ModuleName, inputredis.InitHandler)
 	config.RegistInputHandler(inputsocket.ModuleName, inputsocket.InitHandler)
+	config.RegistInputHandler(inputsyslog.ModuleName, inputsyslog.InitHandler)
 
 	config.RegistFilterHandler(filteraddfield.ModuleName, filteraddfield.InitHandler)
 	config.RegistFilterHandler(filtercond.ModuleName, filtercond.InitHandler)
@@ -103,7 +111,9 @@ func init() {
 	config.RegistOutputHandler(outputgelf.ModuleName, outputgelf.InitHandler)
 	config.RegistOutputHandler(outputhttp.ModuleName, outputhttp.InitHandler)
 	config.RegistOutputHandler(outputnsq.ModuleName, outputnsq.InitHandler)
+	config.RegistOutputHandler(outputpipeline.ModuleName, outputpipeline.InitHandler)
 	config.RegistOutputHandler(outputprometheus.ModuleName, outputprometheus.InitHandler)
+	config.RegistOutputRestartRequired(outputprometheus.ModuleName)
 	config.RegistOutputHandler(outputredis.ModuleName, outputredis.InitHandler)
 	config.RegistOutputHandler(outputreport.ModuleName, outputreport.InitHandler)
 	config.RegistOutputHandler(outputsocket.ModuleName, outputsocket.InitHandler)
@@ -117,4 +127,5 @@ func init() {
 	config.RegistCodecHandler(config.DefaultCodecName, config.DefaultCodecInitHandler)
 	config.RegistCodecHandler(codecjson.ModuleName, codecjson.InitHandler)
 	config.RegistCodecHandler(codecazureeventhubjson.ModuleName, codecazureeventhubjson.InitHandler)
+	config.RegistCodecHandler(codecmultiline.ModuleName, codecmultiline.InitHandler)
 }
@@ -0,0 +1,358 @@
+package modloader
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/alicebob/miniredis"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+type testMutateOutput struct {
+	config.OutputConfig
+}
+
+func (t *testMutateOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	event.SetValue("nested.value", "mutated")
+	event.SetValue("host", "mutated")
+	event.AddTag("mutated")
+	event.Remove("list[0]")
+	return nil
+}
+
+func newTestEvent(i int) logevent.LogEvent {
+	return logevent.LogEvent{
+		Timestamp: time.Date(2017, time.April, 5, 17, 41, 12, 0, time.UTC),
+		Message:   fmt.Sprintf("message %d", i),
+		Tags:      append(make([]string, 0, 10), "test"),
+		Extra: map[string]any{
+			"type":   "test",
+			"host":   "localhost",
+			"level":  int32(6),
+			"nested": map[string]any{"value": i},
+			"list":   []any{"a", "b"},
+		},
+	}
+}
+
+// serveTest accepts connections of listener and serves them by handle until listener closed
+func serveTest(listener net.Listener, handle func(conn net.Conn)) {
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+}
+
+// handleTestSMTP accepts all mails of a SMTP client without authentication
+func handleTestSMTP(conn net.Conn) {
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 localhost ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); cmd {
+		case "EHLO", "HELO":
+			_ = text.PrintfLine("250 localhost")
+		case "DATA":
+			_ = text.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+			if _, err = text.ReadDotBytes(); err != nil {
+				return
+			}
+			_ = text.PrintfLine("250 OK")
+		case "QUIT":
+			_ = text.PrintfLine("221 bye")
+			return
+		default:
+			_ = text.PrintfLine("250 OK")
+		}
+	}
+}
+
+// handleTestNSQ accepts all messages published by a NSQ producer
+func handleTestNSQ(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	if _, err := io.ReadFull(reader, make([]byte, 4)); err != nil { // protocol magic
+		return
+	}
+	respond := func(data string) error {
+		frame := make([]byte, 8, 8+len(data))
+		binary.BigEndian.PutUint32(frame, uint32(4+len(data)))
+		frame = append(frame, data...) // frame type 0 is response
+		_, err := conn.Write(frame)
+		return err
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.SplitN(strings.TrimSpace(line), " ", 2)[0]; cmd {
+		case "IDENTIFY", "PUB", "MPUB", "DPUB":
+			var size uint32
+			if err = binary.Read(reader, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if _, err = io.CopyN(io.Discard, reader, int64(size)); err != nil {
+				return
+			}
+			err = respond("OK")
+		case "CLS":
+			err = respond("CLOSE_WAIT")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Test_outputs_copy_on_write runs built-in outputs concurrently on the same events with outputs modifying them,
+// run with -race to detect events shared without copy-on-write, outputs of external services are served by
+// stub servers, except amqp which requires a AMQP 0-9-1 broker to initialize and reads events only by
+// MarshalJSON and Template.Format in Output as redis and kafka do
+func Test_outputs_copy_on_write(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	config.RegistOutputHandler("test_mutate", func(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeOutputConfig, error) {
+		return &testMutateOutput{OutputConfig: config.OutputConfig{CommonConfig: config.CommonConfig{Type: "test_mutate"}}}, nil
+	})
+
+	// elastic bulk requests are responded with no errors
+	httpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, "{}")
+	}))
+	defer httpServer.Close()
+
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer tcpListener.Close()
+	serveTest(tcpListener, func(conn net.Conn) {
+		_, _ = io.Copy(io.Discard, conn)
+	})
+
+	smtpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer smtpListener.Close()
+	serveTest(smtpListener, handleTestSMTP)
+
+	nsqListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer nsqListener.Close()
+	serveTest(nsqListener, handleTestNSQ)
+
+	redisServer, err := miniredis.Run()
+	require.NoError(err)
+	defer redisServer.Close()
+
+	// set before the mock broker logs, as the kafka output does
+	if sarama.Logger != goglog.Logger {
+		sarama.Logger = goglog.Logger
+	}
+	kafkaBroker := sarama.NewMockBroker(t, 1)
+	defer kafkaBroker.Close()
+	kafkaBroker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(kafkaBroker.Addr(), kafkaBroker.BrokerID()).
+			SetLeader("test", 0, kafkaBroker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+	})
+	smtpHost, smtpPort, err := net.SplitHostPort(smtpListener.Addr().String())
+	require.NoError(err)
+
+	udpConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(err)
+	defer udpConn.Close()
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			if _, _, err := udpConn.ReadFrom(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(fmt.Sprintf(`
+debugch: true
+output:
+  - type: test_mutate
+  - type: stdout
+    truncate: 20
+  - type: file
+    path: %q
+    codec: "%%{message} %%{nested.value} %%{tags}"
+  - type: report
+    interval: 60
+  - type: prometheus
+    address: "127.0.0.1:0"
+  - type: statsd
+    host: %q
+    increment: ["%%{type}.%%{nested.value}"]
+  - type: socket
+    socket: tcp
+    address: %q
+  - type: http
+    urls: [%q]
+  - type: loki
+    urls: [%q]
+  - type: gelf
+    hosts: [%q]
+  - type: elastic
+    url: [%q]
+    simple_client: true
+    index: "%%{type}"
+    document_id: "%%{nested.value}"
+  - type: elasticv5
+    url: [%q]
+    simple_client: true
+    index: "%%{type}"
+    document_type: "%%{type}"
+    document_id: "%%{nested.value}"
+  - type: clickhouse
+    urls: [%q]
+    table: test
+    batch_size: 10
+  - type: redis
+    host: [%q]
+    key: "%%{type}"
+  - type: kafka
+    version: 0.10.2.0
+    brokers: [%q]
+    topics: [test]
+  - type: nsq
+    nsq: %q
+    topic: test
+  - type: email
+    address: %q
+    port: %s
+    from: from@localhost
+    to: to@localhost
+    subject: test
+  - type: cond
+    condition: "type == 'test'"
+    output:
+      - type: test_mutate
+      - type: stdout
+        truncate: 20
+  - type: pipeline
+    send_to: ["test-copy-on-write"]
+  - type: test_mutate
+pipelines:
+  - name: copy-on-write
+    input:
+      - type: pipeline
+        address: test-copy-on-write
+    output:
+      - type: test_mutate
+	`,
+		filepath.Join(t.TempDir(), "%{type}.log"),
+		udpConn.LocalAddr().String(),
+		tcpListener.Addr().String(),
+		httpServer.URL,
+		httpServer.URL,
+		udpConn.LocalAddr().String(),
+		httpServer.URL,
+		httpServer.URL,
+		httpServer.URL,
+		redisServer.Addr(),
+		kafkaBroker.Addr(),
+		nsqListener.Addr().String(),
+		smtpHost,
+		smtpPort,
+	))))
+	require.NoError(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(conf.Start(ctx))
+
+	const count = 50
+	for i := 0; i < count; i++ {
+		conf.TestInputEvent(newTestEvent(i))
+	}
+	for i := 0; i < count; i++ {
+		event, err := conf.TestGetOutputEvent(5 * time.Second)
+		require.NoError(err)
+		expected := newTestEvent(i)
+		require.Equal(expected.Message, event.Message)
+		require.Equal(expected.Tags, event.Tags)
+		require.Equal(expected.Extra, event.Extra)
+	}
+	for i := 0; i < count; i++ {
+		event, err := conf.GetPipeline("copy-on-write").TestGetOutputEvent(5 * time.Second)
+		require.NoError(err)
+		require.Equal(newTestEvent(i).Extra, event.Extra)
+	}
+
+	cancel()
+	require.NoError(conf.Wait())
+}
+
+// Test_check_offline checks plugins connecting to servers or listening on initialization,
+// with servers not reachable, the check does not connect, listen or register metrics
+func Test_check_offline(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+input:
+  - type: redis
+    host: 127.0.0.1:1
+  - type: pipeline
+    address: test-check-offline
+output:
+  - type: elastic
+    url: ["http://127.0.0.1:1"]
+    index: test
+    idnex: test
+  - type: redis
+    host: ["127.0.0.1:1"]
+  - type: kafka
+    version: 0.10.2.0
+    brokers: ["127.0.0.1:1"]
+    topics: [test]
+  - type: socket
+    socket: tcp
+    address: 127.0.0.1:1
+  - type: amqp
+    urls: ["amqp://127.0.0.1:1"]
+    exchange: test
+    exchange_type: direct
+  - type: prometheus
+    address: "127.0.0.1:0"
+	`)))
+	require.NoError(err)
+
+	// checked twice, metrics registered by the first check would fail the second one
+	for range 2 {
+		errs := conf.Check(context.Background())
+		require.Len(errs, 1, "%v", errs)
+		require.Equal(`pipeline "main" output[0] (elastic): unknown key "idnex"`, errs[0].Error())
+	}
+}
@@ -29,19 +29,22 @@ var (
 // OutputConfig holds the configuration json fields and internal objects
 type OutputConfig struct {
 	config.OutputConfig
-	URLs               []string `json:"urls"`                           // Array of AMQP connection strings formatted per the [RabbitMQ URI Spec](http://www.rabbitmq.com/uri-spec.html).
-	TLSCACerts         []string `json:"tls_ca_certs,omitempty"`         // Array of CA Certificates to load for TLS connections
-	TLSCerts           []string `json:"tls_certs,omitempty"`            // Array of Certificates to load for TLS connections
-	TLSCertKeys        []string `json:"tls_cert_keys,omitempty"`        // Array of Certificate Keys to load for TLS connections (Must NOT be password protected)
-	TLSSkipVerify      bool     `json:"tls_cert_skip_verify,omitempty"` // Skip verification of certifcates. Defaults to false.
-	RoutingKey         string   `json:"routing_key,omitempty"`          // The message routing key used to bind the queue to the exchange. Defaults to empty string.
-	Exchange           string   `json:"exchange"`                       // AMQP exchange name
-	ExchangeType       string   `json:"exchange_type"`                  // AMQP exchange type (fanout, direct, topic or headers).
-	ExchangeDurable    bool     `json:"exchange_durable,omitempty"`     // Whether the exchange should be configured as a durable exchange. Defaults to false.
-	ExchangeAutoDelete bool     `json:"exchange_auto_delete,omitempty"` // Whether the exchange is deleted when all queues have finished and there is no publishing. Defaults to true.
-	Persistent         bool     `json:"persistent,omitempty"`           // Whether published messages should be marked as persistent or transient. Defaults to false.
-	Retries            int      `json:"retries,omitempty"`              // Number of attempts to send a message. Defaults to 3.
-	ReconnectDelay     int      `json:"reconnect_delay,omitempty"`      // Delay between each attempt to reconnect to AMQP server. Defaults to 30 seconds.
+	URLs               []string           `json:"urls"`                           // Array of AMQP connection strings formatted per the [RabbitMQ URI Spec](http://www.rabbitmq.com/uri-spec.html).
+	TLSCACerts         []string           `json:"tls_ca_certs,omitempty"`         // Array of CA Certificates to load for TLS connections
+	TLSCerts           []string           `json:"tls_certs,omitempty"`            // Array of Certificates to load for TLS connections
+	TLSCertKeys        []string           `json:"tls_cert_keys,omitempty"`        // Array of Certificate Keys to load for TLS connections (Must NOT be password protected)
+	TLSSkipVerify      bool               `json:"tls_cert_skip_verify,omitempty"` // Skip verification of certifcates. Defaults to false.
+	RoutingKey         string             `json:"routing_key,omitempty"`          // The message routing key used to bind the queue to the exchange. Defaults to empty string.
+	Exchange           string             `json:"exchange"`                       // AMQP exchange name
+	ExchangeType       string             `json:"exchange_type"`                  // AMQP exchange type (fanout, direct, topic or headers).
+	ExchangeDurable    bool               `json:"exchange_durable,omitempty"`     // Whether the exchange should be configured as a durable exchange. Defaults to false.
+	ExchangeAutoDelete bool               `json:"exchange_auto_delete,omitempty"` // Whether the exchange is deleted when all queues have finished and there is no publishing. Defaults to true.
+	Persistent         bool               `json:"persistent,omitempty"`           // Whether published messages should be marked as persistent or transient. Defaults to false.
+	Retries            int                `json:"retries,omitempty"`              // Number of attempts to send a message. Defaults to 3.
+	ReconnectDelay     int                `json:"reconnect_delay,omitempty"`      // Delay between each attempt to reconnect to AMQP server. Defaults to 30 seconds.
+	StrictFormat       bool               `json:"strict_format,omitempty"`        // Whether events missing fields of exchange or routing_key are rejected. Defaults to false.
+	exchange           *logevent.Template // compiled Exchange
+	routingKey         *logevent.Template // compiled RoutingKey
 	hostPool           hostpool.HostPool
 	amqpClients        map[string]amqpClient
 }
@@ -82,6 +85,18 @@ func InitHandler(
 		return nil, err
 	}
 
+	var err error
+	if conf.exchange, err = logevent.NewTemplate(conf.Exchange); err != nil {
+		return nil, err
+	}
+	if conf.routingKey, err = logevent.NewTemplate(conf.RoutingKey); err != nil {
+		return nil, err
+	}
+
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
 	if err := conf.initAmqpClients(); err != nil {
 		return nil, err
 	}
@@ -133,8 +148,14 @@ func (o *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err
 		return
 	}
 
-	exchange := event.Format(o.Exchange)
-	routingKey := event.Format(o.RoutingKey)
+	exchange, err := o.exchange.Execute(event, o.StrictFormat)
+	if err != nil {
+		return err
+	}
+	routingKey, err := o.routingKey.Execute(event, o.StrictFormat)
+	if err != nil {
+		return err
+	}
 
 	for i := 0; i <= o.Retries; i++ {
 		hp := o.hostPool.Get()
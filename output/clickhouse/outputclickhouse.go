@@ -9,7 +9,6 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
-	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -42,11 +41,8 @@ type OutputConfig struct {
 	// Table is the full ClickHouse table name, e.g. "logs.ids" or "logs.ngfw"
 	Table string `json:"table"`
 
-	// BatchSize defines how many events are buffered before a flush is triggered
-	BatchSize int `json:"batch_size,omitempty"`
-
-	// FlushInterval is a string duration (e.g. "2s", "1m") read from config.
-	// It is parsed into flushInterval at InitHandler.
+	// FlushInterval is an alias of batch_flush_interval kept for compatibility,
+	// e.g. "2s", "1m"
 	FlushInterval string `json:"flush_interval,omitempty"`
 
 	// TsField, if set, defines which field from event.Extra
@@ -66,14 +62,6 @@ type OutputConfig struct {
 
 	// internal HTTP client
 	httpClient *http.Client
-
-	// internal parsed flush interval
-	flushInterval time.Duration
-
-	// internal buffer and synchronization
-	mu        sync.Mutex
-	buffer    []map[string]any
-	lastFlush time.Time
 }
 
 // DefaultOutputConfig returns an OutputConfig struct with default values
@@ -83,9 +71,9 @@ func DefaultOutputConfig() OutputConfig {
 			CommonConfig: config.CommonConfig{
 				Type: ModuleName,
 			},
+			BatchSize:          1000,
+			BatchFlushInterval: "2s",
 		},
-		BatchSize:     1000,
-		FlushInterval: "2s",
 	}
 }
 
@@ -106,20 +94,10 @@ func InitHandler(
 	if conf.Table == "" {
 		return nil, ErrNoTable.New(nil)
 	}
-	if conf.BatchSize <= 0 {
-		conf.BatchSize = 1000
-	}
-	if conf.FlushInterval == "" {
-		conf.FlushInterval = "2s"
+	if conf.FlushInterval != "" {
+		conf.BatchFlushInterval = conf.FlushInterval
 	}
 
-	// Parse flush interval string (e.g. "2s", "1m")
-	d, err := time.ParseDuration(conf.FlushInterval)
-	if err != nil {
-		return nil, fmt.Errorf("clickhouse output: invalid flush_interval %q: %w", conf.FlushInterval, err)
-	}
-	conf.flushInterval = d
-
 	// HTTP client with optional TLS config
 	tr := &http.Transport{
 		DisableCompression: false,
@@ -131,17 +109,28 @@ func InitHandler(
 	}
 	conf.httpClient = &http.Client{Transport: tr}
 
-	conf.buffer = make([]map[string]any, 0, conf.BatchSize)
-	conf.lastFlush = time.Now()
-
-	// Periodic flush goroutine
-	go conf.flushLoop(ctx)
-
 	return &conf, nil
 }
 
-// Output is called for each log event
+// Output inserts the event
 func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
+	return t.OutputBatch(ctx, []logevent.LogEvent{event})
+}
+
+// OutputBatch inserts events in one request using JSONEachRow
+func (t *OutputConfig) OutputBatch(ctx context.Context, events []logevent.LogEvent) (err error) {
+	var buf bytes.Buffer
+	enc := jsoniter.NewEncoder(&buf)
+	for _, event := range events {
+		if err = enc.Encode(t.buildRow(event)); err != nil {
+			return err
+		}
+	}
+	return t.insert(ctx, buf.Bytes())
+}
+
+// buildRow returns the JSONEachRow row of event
+func (t *OutputConfig) buildRow(event logevent.LogEvent) map[string]any {
 	row := make(map[string]any)
 
 	// Copy all Extra fields into the row
@@ -171,66 +160,11 @@ func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err
 		}
 	}
 
-	t.mu.Lock()
-	t.buffer = append(t.buffer, row)
-	needFlush := len(t.buffer) >= t.BatchSize
-	t.mu.Unlock()
-
-	// Flush by size
-	if needFlush {
-		return t.flush(ctx)
-	}
-
-	return nil
-}
-
-// flushLoop performs time-based flushing
-func (t *OutputConfig) flushLoop(ctx context.Context) {
-	ticker := time.NewTicker(t.flushInterval / 2)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			// Final flush on shutdown
-			_ = t.flush(ctx)
-			return
-		case <-ticker.C:
-			t.mu.Lock()
-			hasData := len(t.buffer) > 0
-			shouldFlush := hasData && time.Since(t.lastFlush) >= t.flushInterval
-			t.mu.Unlock()
-
-			if shouldFlush {
-				_ = t.flush(ctx)
-			}
-		}
-	}
+	return row
 }
 
-// flush sends the current batch to ClickHouse using JSONEachRow
-func (t *OutputConfig) flush(ctx context.Context) error {
-	t.mu.Lock()
-	if len(t.buffer) == 0 {
-		t.mu.Unlock()
-		return nil
-	}
-
-	// Swap buffer to avoid blocking Output for long
-	batch := t.buffer
-	t.buffer = make([]map[string]any, 0, t.BatchSize)
-	t.lastFlush = time.Now()
-	t.mu.Unlock()
-
-	var buf bytes.Buffer
-	enc := jsoniter.NewEncoder(&buf)
-	for _, row := range batch {
-		if err := enc.Encode(row); err != nil {
-			goglog.Logger.Errorf("output clickhouse: json encode error: %v", err)
-		}
-	}
-
-	data := buf.Bytes()
+// insert sends rows in JSONEachRow to ClickHouse
+func (t *OutputConfig) insert(ctx context.Context, data []byte) error {
 	url := t.pickURL()
 
 	// Build ClickHouse query: INSERT INTO <table> FORMAT JSONEachRow
@@ -2,14 +2,16 @@ package outputcond
 
 import (
 	"context"
+	"slices"
+	"sync"
 
 	"github.com/Knetic/govaluate"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/condition"
 	"github.com/tsaikd/gogstash/config/goglog"
 	"github.com/tsaikd/gogstash/config/logevent"
-	filtercond "github.com/tsaikd/gogstash/filter/cond"
 )
 
 // ModuleName is the name used in config file
@@ -67,49 +69,148 @@ func InitHandler(
 			return nil, err
 		}
 	}
-	conf.expression, err = govaluate.NewEvaluableExpressionWithFunctions(conf.Condition, filtercond.BuiltInFunctions)
-	return &conf, err
+	conf.expression, err = govaluate.NewEvaluableExpressionWithFunctions(conf.Condition, condition.BuiltInFunctions)
+	if err != nil {
+		return nil, err
+	}
+	for _, output := range slices.Concat(conf.outputs, conf.elseOutputs) {
+		if _, ok := output.(config.TypeBatchOutputConfig); ok {
+			return &BatchOutputConfig{OutputConfig: &conf}, nil
+		}
+	}
+	return &conf, nil
 }
 
 // Output event
 func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
-	if t.expression != nil {
-		ep := filtercond.EventParameters{Event: &event}
-		ret, err := t.expression.Eval(&ep)
+	matched, ok, err := t.match(event)
+	if err != nil || !ok {
+		return err
+	}
+	if matched {
+		return outputAll(ctx, t.outputs, event)
+	} else if len(t.elseOutputs) > 0 {
+		return outputAll(ctx, t.elseOutputs, event)
+	}
+	return nil
+}
+
+// match evaluates the condition on event, ok is false if the condition is not evaluated to a boolean
+func (t *OutputConfig) match(event logevent.LogEvent) (matched bool, ok bool, err error) {
+	if t.expression == nil {
+		return false, false, nil
+	}
+	ep := condition.EventParameters{Event: &event}
+	ret, err := t.expression.Eval(&ep)
+	if err != nil {
+		return false, false, err
+	}
+	if matched, ok = ret.(bool); !ok {
+		goglog.Logger.Warn("output cond condition returns not a boolean, ignored")
+	}
+	return matched, ok, nil
+}
+
+// BatchOutputConfig is the cond output with batch outputs in output or else_output,
+// events are buffered by batch_size and batch_flush_interval of cond,
+// so batch outputs receive batches instead of one event per request
+type BatchOutputConfig struct {
+	*OutputConfig
+}
+
+// OutputBatch sends events satisfying the condition to outputs, and others to else outputs
+func (t *BatchOutputConfig) OutputBatch(ctx context.Context, events []logevent.LogEvent) (err error) {
+	var matched, unmatched []logevent.LogEvent
+	for _, event := range events {
+		r, ok, err := t.match(event)
 		if err != nil {
 			return err
 		}
-		if r, ok := ret.(bool); ok {
-			if r {
-				eg, ctx2 := errgroup.WithContext(ctx)
-				for _, output := range t.outputs {
-					func(output config.TypeOutputConfig) {
-						eg.Go(func() error {
-							if err2 := output.Output(ctx2, event); err2 != nil {
-								goglog.Logger.Errorf("output module %q failed: %v\n", output.GetType(), err2)
-							}
-							return nil
-						})
-					}(output)
+		if !ok {
+			continue
+		}
+		if r {
+			matched = append(matched, event)
+		} else {
+			unmatched = append(unmatched, event)
+		}
+	}
+	if err = outputBatchAll(ctx, t.outputs, matched); err != nil {
+		return err
+	}
+	return outputBatchAll(ctx, t.elseOutputs, unmatched)
+}
+
+// outputAll sends copy-on-write views of event to all outputs concurrently, returns the error of an output
+// rejecting the event if the event is not written to the dead letter queue, so the event is not acknowledged
+func outputAll(ctx context.Context, outputs []config.TypeOutputConfig, event logevent.LogEvent) error {
+	var mutex sync.Mutex
+	var rejectErr error
+	eg, ctx2 := errgroup.WithContext(ctx)
+	for _, output := range outputs {
+		func(output config.TypeOutputConfig) {
+			eg.Go(func() error {
+				if err2 := output.Output(ctx2, event.CopyOnWrite()); err2 != nil {
+					goglog.Logger.Errorf("output module %q failed: %v\n", output.GetType(), err2)
+					if !config.ErrorOutputRetrying.In(err2) && !config.DeadLetter(ctx2, output, event, err2) {
+						mutex.Lock()
+						rejectErr = err2
+						mutex.Unlock()
+					}
 				}
-				return eg.Wait()
-			} else if len(t.elseOutputs) > 0 {
-				eg, ctx2 := errgroup.WithContext(ctx)
-				for _, output := range t.elseOutputs {
-					func(output config.TypeOutputConfig) {
-						eg.Go(func() error {
-							if err2 := output.Output(ctx2, event); err2 != nil {
-								goglog.Logger.Errorf("output module %q failed: %v\n", output.GetType(), err2)
-							}
-							return nil
-						})
-					}(output)
+				return nil
+			})
+		}(output)
+	}
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	return rejectErr
+}
+
+// outputBatchAll sends copy-on-write views of events to all outputs concurrently, batch outputs receive
+// all events in one batch, returns the error of an output rejecting any event not written to the dead letter queue
+func outputBatchAll(ctx context.Context, outputs []config.TypeOutputConfig, events []logevent.LogEvent) error {
+	if len(events) < 1 {
+		return nil
+	}
+	var mutex sync.Mutex
+	var rejectErr error
+	reject := func(output config.TypeOutputConfig, event logevent.LogEvent, err error) {
+		if !config.ErrorOutputRetrying.In(err) && !config.DeadLetter(ctx, output, event, err) {
+			mutex.Lock()
+			rejectErr = err
+			mutex.Unlock()
+		}
+	}
+	eg, ctx2 := errgroup.WithContext(ctx)
+	for _, output := range outputs {
+		eg.Go(func() error {
+			batch, ok := output.(config.TypeBatchOutputConfig)
+			if !ok {
+				for _, event := range events {
+					if err := output.Output(ctx2, event.CopyOnWrite()); err != nil {
+						goglog.Logger.Errorf("output module %q failed: %v\n", output.GetType(), err)
+						reject(output, event, err)
+					}
 				}
-				return eg.Wait()
+				return nil
 			}
-		} else {
-			goglog.Logger.Warn("output cond condition returns not a boolean, ignored")
-		}
+			views := make([]logevent.LogEvent, len(events))
+			for i, event := range events {
+				views[i] = event.CopyOnWrite()
+			}
+			if err := batch.OutputBatch(ctx2, views); err != nil {
+				goglog.Logger.Errorf("output module %q failed to send %d events: %v\n", output.GetType(), len(events), err)
+				for _, event := range events {
+					reject(output, event, err)
+				}
+			}
+			return nil
+		})
 	}
-	return nil
+	if err := eg.Wait(); err != nil {
+		return err
+	}
+	return rejectErr
 }
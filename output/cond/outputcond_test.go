@@ -16,10 +16,33 @@ import (
 	outputstdout "github.com/tsaikd/gogstash/output/stdout"
 )
 
+type testBatchOutput struct {
+	config.OutputConfig
+	batches chan []string
+}
+
+func (t *testBatchOutput) Output(ctx context.Context, event logevent.LogEvent) error {
+	return t.OutputBatch(ctx, []logevent.LogEvent{event})
+}
+
+func (t *testBatchOutput) OutputBatch(ctx context.Context, events []logevent.LogEvent) error {
+	messages := []string{}
+	for _, event := range events {
+		messages = append(messages, event.Message)
+	}
+	t.batches <- messages
+	return nil
+}
+
+var testBatch = &testBatchOutput{batches: make(chan []string, 10)}
+
 func init() {
 	goglog.Logger.SetLevel(logrus.DebugLevel)
 	config.RegistOutputHandler(outputstdout.ModuleName, outputstdout.InitHandler)
 	config.RegistOutputHandler(ModuleName, InitHandler)
+	config.RegistOutputHandler("test_batch", func(ctx context.Context, raw config.ConfigRaw, control config.Control) (config.TypeOutputConfig, error) {
+		return testBatch, config.ReflectConfig(raw, testBatch)
+	})
 }
 
 func Test_filter_cond_module_invalid(t *testing.T) {
@@ -85,3 +108,46 @@ output:
 		require.Equal("outputstdout test message", event.Message)
 	}
 }
+
+func Test_output_cond_module_batch(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+output:
+  - type: cond
+    condition: "level == 'ERROR'"
+    batch_size: 3
+    batch_flush_interval: 10s
+    output:
+      - type: test_batch
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	for _, level := range []string{"ERROR", "WARN", "ERROR"} {
+		conf.TestInputEvent(logevent.LogEvent{
+			Timestamp: time.Now(),
+			Message:   level,
+			Extra: map[string]any{
+				"level": level,
+			},
+		})
+	}
+
+	// nested batch outputs receive the events satisfying the condition in one batch
+	select {
+	case batch := <-testBatch.batches:
+		require.Equal([]string{"ERROR", "ERROR"}, batch)
+	case <-time.After(3 * time.Second):
+		require.Fail("batch not sent")
+	}
+
+	cancel()
+	require.NoError(conf.Wait())
+}
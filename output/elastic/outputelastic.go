@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
@@ -33,6 +34,7 @@ type OutputConfig struct {
 	Username        string   `json:"username"`          // basic auth username to Elasticsearch
 	Password        string   `json:"password"`          // basic auth password to Elasticsearch
 	SimpleClient    bool     `json:"simple_client"`     // if set uses simpleclient instead of newclient, disables some functionality
+	StrictFormat    bool     `json:"strict_format"`     // reject events missing fields of index or document_id, instead of keeping the placeholders
 
 	Sniff bool `json:"sniff"` // find all nodes of your cluster, https://github.com/olivere/elastic/wiki/Sniffing
 
@@ -64,8 +66,21 @@ type OutputConfig struct {
 	// For more information on disabling certificate verification please read https://www.cs.utexas.edu/~shmat/shmat_ccs12.pdf
 	SSLCertValidation bool `json:"ssl_certificate_validation,omitempty"`
 
+	index      *logevent.Template // compiled Index
+	documentID *logevent.Template // compiled DocumentID
+
 	client    *elastic.Client        // elastic client instance
 	processor *elastic.BulkProcessor // elastic bulk processor
+	ctx       context.Context
+
+	pendingMutex sync.Mutex
+	pending      map[elastic.BulkableRequest]pendingRequest // requests in bulk processor
+}
+
+// pendingRequest is the event of a request in bulk processor
+type pendingRequest struct {
+	event   logevent.LogEvent
+	release func(err error) // release acknowledgement of event, nil if event has no ack
 }
 
 // DefaultOutputConfig returns an OutputConfig struct with default values
@@ -90,6 +105,7 @@ func DefaultOutputConfig() OutputConfig {
 // errors
 var (
 	ErrorCreateClientFailed1 = errutil.NewFactory("create elastic client failed: %q")
+	ErrorBulkRequestFailed2  = errutil.NewFactory("bulk request failed: %s: %s")
 )
 
 type errorLogger struct {
@@ -120,6 +136,15 @@ func InitHandler(
 		return nil, err
 	}
 
+	conf.ctx = ctx
+	conf.pending = map[elastic.BulkableRequest]pendingRequest{}
+	if conf.index, err = logevent.NewTemplate(conf.Index); err != nil {
+		return nil, err
+	}
+	if conf.documentID, err = logevent.NewTemplate(conf.DocumentID); err != nil {
+		return nil, err
+	}
+
 	// map Printf to error level
 	logger := &errorLogger{logger: goglog.Logger}
 
@@ -146,15 +171,6 @@ func InitHandler(
 		options = append(options, elastic.SetHttpClient(client))
 	}
 
-	if conf.SimpleClient {
-		conf.client, err = elastic.NewSimpleClient(options...)
-	} else {
-		conf.client, err = elastic.NewClient(options...)
-	}
-	if err != nil {
-		return nil, ErrorCreateClientFailed1.New(err, conf.URL)
-	}
-
 	conf.exponentialBackoffInitialTimeout, err = time.ParseDuration(conf.ExponentialBackoffInitialTimeout)
 	if err != nil {
 		return nil, err
@@ -165,6 +181,19 @@ func InitHandler(
 		return nil, err
 	}
 
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
+	if conf.SimpleClient {
+		conf.client, err = elastic.NewSimpleClient(options...)
+	} else {
+		conf.client, err = elastic.NewClient(options...)
+	}
+	if err != nil {
+		return nil, ErrorCreateClientFailed1.New(err, conf.URL)
+	}
+
 	conf.processor, err = conf.client.BulkProcessor().
 		Name("gogstash-output-elastic").
 		BulkActions(conf.BulkActions).
@@ -182,24 +211,67 @@ func InitHandler(
 
 // BulkAfter execute after a commit to Elasticsearch
 func (t *OutputConfig) BulkAfter(executionID int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
-	if err == nil && response.Errors {
-		// find failed requests, and log it
+	t.pendingMutex.Lock()
+	pending := make([]pendingRequest, len(requests))
+	for i, request := range requests {
+		pending[i] = t.pending[request]
+		delete(t.pending, request)
+	}
+	t.pendingMutex.Unlock()
+
+	// events of failed requests not written to dead letter queue are not acknowledged
+	rejected := map[int]error{}
+	if err != nil {
+		for i := range requests {
+			rejected[i] = err
+		}
+	} else if response.Errors {
+		// find failed requests, log it and send to dead letter queue
 		for i, item := range response.Items {
 			for _, v := range item {
 				if v.Error != nil {
 					goglog.Logger.Errorf("%s: bulk processor request %s failed: %s", ModuleName, requests[i].String(), v.Error.Reason)
+					reason := ErrorBulkRequestFailed2.New(nil, v.Error.Type, v.Error.Reason)
+					if !config.DeadLetter(t.ctx, t, pending[i].event, reason) {
+						rejected[i] = reason
+					}
 				}
 			}
 		}
 	}
+
+	for i, p := range pending {
+		if p.release != nil {
+			p.release(rejected[i])
+		}
+	}
+}
+
+// add adds request of event to bulk processor, the event is acknowledged after the bulk committed,
+// and sent to dead letter queue with metadata if the request failed
+func (t *OutputConfig) add(request elastic.BulkableRequest, event logevent.LogEvent) {
+	pending := pendingRequest{event: event}
+	if event.HasAck() {
+		pending.release = event.HoldAck()
+	}
+	t.pendingMutex.Lock()
+	t.pending[request] = pending
+	t.pendingMutex.Unlock()
+	t.processor.Add(request)
 }
 
 // Output event
 func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
-	index := event.Format(t.Index)
+	index, err := t.index.Execute(event, t.StrictFormat)
+	if err != nil {
+		return err
+	}
 	// elastic index name should be lowercase
 	index = strings.ToLower(index)
-	id := event.Format(t.DocumentID)
+	id, err := t.documentID.Execute(event, t.StrictFormat)
+	if err != nil {
+		return err
+	}
 
 	// Data streams only support op_type='create' in Bulk API.
 	// When OpType is "create", we use BulkCreateRequest and do not set RetryOnConflict.
@@ -208,14 +280,14 @@ func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err
 			Index(index).
 			Id(id).
 			Doc(event)
-		t.processor.Add(createReq)
+		t.add(createReq, event)
 	} else {
 		indexReq := elastic.NewBulkIndexRequest().
 			Index(index).
 			RetryOnConflict(t.RetryOnConflict).
 			Id(id).
 			Doc(event)
-		t.processor.Add(indexReq)
+		t.add(indexReq, event)
 	}
 
 	return
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/deadletter"
 	"github.com/tsaikd/gogstash/config/goglog"
 	"github.com/tsaikd/gogstash/config/logevent"
 )
@@ -173,3 +175,121 @@ output:
 	_, err = client.DeleteIndex(testIndexName).Do(ctx)
 	require.NoError(err)
 }
+
+func Test_output_elastic_dead_letter(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/_bulk") {
+			_, _ = w.Write([]byte(`{"took":1,"errors":true,"items":[{"index":{"_index":"` + testIndexName + `","_id":"ABC","status":400,` +
+				`"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+dead_letter_queue:
+  path: ` + dir + `
+output:
+  - type: ` + ModuleName + `
+    url: ["` + ts.URL + `"]
+    index: "` + testIndexName + `"
+    document_id: "%{fieldstring}"
+    bulk_actions: 1
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	acked := make(chan error, 1)
+	ack := logevent.NewAck(func(err error) { acked <- err })
+	event := logevent.LogEvent{
+		Timestamp: time.Date(2017, 4, 18, 19, 53, 1, 2, time.UTC),
+		Message:   "output elastic dead letter",
+		Extra:     map[string]any{"fieldstring": "ABC"},
+		Metadata:  map[string]any{"source": "test"},
+	}
+	event.SetAck(ack)
+	ack.Done(nil)
+	conf.TestInputEvent(event)
+
+	// the event is acknowledged after written to the dead letter queue
+	select {
+	case err := <-acked:
+		require.NoError(err)
+	case <-time.After(5 * time.Second):
+		require.Fail("event not acknowledged")
+	}
+	entry, _, err := deadletter.NewReader(filepath.Join(dir, "main"), deadletter.Position{}, 10*time.Millisecond).Next(ctx)
+	require.NoError(err)
+	require.Equal("output elastic dead letter", entry.Event.Message)
+	require.Equal("ABC", entry.Event.GetString("fieldstring"))
+	require.Equal("test", entry.Event.Metadata["source"])
+	require.Contains(entry.Reason, "mapper_parsing_exception")
+}
+
+func Test_output_elastic_strict_format(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/_bulk") {
+			assert.Fail("event missing fields sent to elastic")
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+dead_letter_queue:
+  path: ` + dir + `
+output:
+  - type: ` + ModuleName + `
+    url: ["` + ts.URL + `"]
+    index: "` + testIndexName + `-%{service}"
+    document_id: "%{fieldstring}"
+    strict_format: true
+    bulk_actions: 1
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	acked := make(chan error, 1)
+	ack := logevent.NewAck(func(err error) { acked <- err })
+	event := logevent.LogEvent{
+		Timestamp: time.Now(),
+		Message:   "output elastic strict format",
+		Extra:     map[string]any{"fieldstring": "ABC"},
+	}
+	event.SetAck(ack)
+	ack.Done(nil)
+	conf.TestInputEvent(event)
+
+	// the event missing field service is rejected to the dead letter queue
+	select {
+	case err := <-acked:
+		require.NoError(err)
+	case <-time.After(5 * time.Second):
+		require.Fail("event not acknowledged")
+	}
+	entry, _, err := deadletter.NewReader(filepath.Join(dir, "main"), deadletter.Position{}, 10*time.Millisecond).Next(ctx)
+	require.NoError(err)
+	require.Equal("output elastic strict format", entry.Event.Message)
+	require.Contains(entry.Reason, `field "service" of template not found`)
+}
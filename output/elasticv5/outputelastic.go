@@ -63,6 +63,10 @@ type OutputConfig struct {
 	// For more information on disabling certificate verification please read https://www.cs.utexas.edu/~shmat/shmat_ccs12.pdf
 	SSLCertValidation bool `json:"ssl_certificate_validation,omitempty"`
 
+	index        *logevent.Template // compiled Index
+	documentID   *logevent.Template // compiled DocumentID
+	documentType *logevent.Template // compiled DocumentType
+
 	client    *elastic.Client        // elastic client instance
 	processor *elastic.BulkProcessor // elastic bulk processor
 }
@@ -117,6 +121,15 @@ func InitHandler(
 	if err != nil {
 		return nil, err
 	}
+	if conf.index, err = logevent.NewTemplate(conf.Index); err != nil {
+		return nil, err
+	}
+	if conf.documentID, err = logevent.NewTemplate(conf.DocumentID); err != nil {
+		return nil, err
+	}
+	if conf.documentType, err = logevent.NewTemplate(conf.DocumentType); err != nil {
+		return nil, err
+	}
 
 	// map Printf to error level
 	logger := &errorLogger{logger: goglog.Logger}
@@ -144,15 +157,6 @@ func InitHandler(
 		options = append(options, elastic.SetHttpClient(client))
 	}
 
-	if conf.SimpleClient {
-		conf.client, err = elastic.NewSimpleClient(options...)
-	} else {
-		conf.client, err = elastic.NewClient(options...)
-	}
-	if err != nil {
-		return nil, ErrorCreateClientFailed1.New(err, conf.URL)
-	}
-
 	conf.exponentialBackoffInitialTimeout, err = time.ParseDuration(conf.ExponentialBackoffInitialTimeout)
 	if err != nil {
 		return nil, err
@@ -163,6 +167,19 @@ func InitHandler(
 		return nil, err
 	}
 
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
+	if conf.SimpleClient {
+		conf.client, err = elastic.NewSimpleClient(options...)
+	} else {
+		conf.client, err = elastic.NewClient(options...)
+	}
+	if err != nil {
+		return nil, ErrorCreateClientFailed1.New(err, conf.URL)
+	}
+
 	conf.processor, err = conf.client.BulkProcessor().
 		Name("gogstash-output-elastic").
 		BulkActions(conf.BulkActions).
@@ -194,11 +211,11 @@ func (t *OutputConfig) BulkAfter(executionID int64, requests []elastic.BulkableR
 
 // Output event
 func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
-	index := event.Format(t.Index)
+	index := t.index.Format(event)
 	// elastic index name should be lowercase
 	index = strings.ToLower(index)
-	id := event.Format(t.DocumentID)
-	doctype := event.Format(t.DocumentType)
+	id := t.documentID.Format(event)
+	doctype := t.documentType.Format(event)
 
 	indexRequest := elastic.NewBulkIndexRequest().
 		Index(index).
@@ -61,15 +61,18 @@ func (osFS) OpenFile(name string, flag int, perm os.FileMode) (fs.File, error) {
 // OutputConfig holds the configuration json fields and internal objects
 type OutputConfig struct {
 	config.OutputConfig
-	CreateIfDeleted bool   `json:"create_if_deleted"` // If the configured file is deleted, but an event is handled by the plugin, the plugin will recreate the file. Default ⇒ true
-	DirMode         string `json:"dir_mode"`          // Dir access mode to use. Example: "dir_mode" => 0750
-	FileMode        string `json:"file_mode"`         // File access mode to use. Example: "file_mode" => 0640
-	FlushInterval   int    `json:"flush_interval"`    // Flush interval (in seconds) for flushing writes to log files. 0 will flush on every message.
-	DiscardTime     int    `json:"discard_time"`      // Time (in seconds) for discarding messages before retrying to write to file
-	IdleTimeout     int    `json:"idle_timeout"`      // Time (in seconds) without new messages before closing file and releasing resources. 0 will disable timeout.
-	Path            string `json:"path"`              // The path to the file to write. Event fields can be used here, like /var/log/logstash/%{host}/%{application}
-	Codec           string `json:"codec"`             // expression to write to file. E.g. "%{log}"
-	WriteBehavior   string `json:"write_behavior"`    // If append, the file will be opened for appending and each new event will be written at the end of the file. If overwrite, the file will be truncated before writing and only the most recent event will appear in the file.
+	CreateIfDeleted bool               `json:"create_if_deleted"` // If the configured file is deleted, but an event is handled by the plugin, the plugin will recreate the file. Default ⇒ true
+	DirMode         string             `json:"dir_mode"`          // Dir access mode to use. Example: "dir_mode" => 0750
+	FileMode        string             `json:"file_mode"`         // File access mode to use. Example: "file_mode" => 0640
+	FlushInterval   int                `json:"flush_interval"`    // Flush interval (in seconds) for flushing writes to log files. 0 will flush on every message.
+	DiscardTime     int                `json:"discard_time"`      // Time (in seconds) for discarding messages before retrying to write to file
+	IdleTimeout     int                `json:"idle_timeout"`      // Time (in seconds) without new messages before closing file and releasing resources. 0 will disable timeout.
+	Path            string             `json:"path"`              // The path to the file to write. Event fields can be used here, like /var/log/logstash/%{host}/%{application}
+	Codec           string             `json:"codec"`             // expression to write to file. E.g. "%{log}"
+	WriteBehavior   string             `json:"write_behavior"`    // If append, the file will be opened for appending and each new event will be written at the end of the file. If overwrite, the file will be truncated before writing and only the most recent event will appear in the file.
+	StrictFormat    bool               `json:"strict_format"`     // If true, events missing fields of path are rejected instead of being written to a path with the placeholders
+	path            *logevent.Template // compiled Path
+	codec           *logevent.Template // compiled Codec
 	fileMode        os.FileMode
 	dirMode         os.FileMode
 	fs              fs.FileSystem
@@ -125,6 +128,12 @@ func InitHandler(
 	if conf.Path == "" {
 		return nil, ErrorNoPath.New(nil)
 	}
+	if conf.path, err = logevent.NewTemplate(conf.Path); err != nil {
+		return nil, err
+	}
+	if conf.codec, err = logevent.NewTemplate(conf.Codec); err != nil {
+		return nil, err
+	}
 	if conf.WriteBehavior != appendBehavior && conf.WriteBehavior != overwriteBehavior {
 		return nil, ErrorInvalidWriteBehavior.New(nil, conf.WriteBehavior)
 	}
@@ -188,7 +197,10 @@ func (t *OutputConfig) createFile(path string) (fs.File, error) {
 
 // Output event
 func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
-	path := event.Format(t.Path)
+	path, err := t.path.Execute(event, t.StrictFormat)
+	if err != nil {
+		return err
+	}
 
 	t.writersMtx.RLock()
 	channel, alreadyWriting := t.writers[path]
@@ -319,7 +331,7 @@ func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err
 		}
 	}
 
-	log := event.Format(t.Codec)
+	log := t.codec.Format(event)
 	channel <- log
 	return err
 }
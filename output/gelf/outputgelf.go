@@ -96,6 +96,8 @@ func InitHandler(
 func (t *OutputConfig) OutputEvent(ctx context.Context, event logevent.LogEvent) (err error) {
 	var host string
 	var level int32
+	// the event is shared with other outputs, so fields are copied instead of removed
+	extra := make(map[string]any, len(event.Extra)+1)
 	for k, v := range event.Extra {
 		lk := strings.ToLower(k)
 
@@ -103,24 +105,26 @@ func (t *OutputConfig) OutputEvent(ctx context.Context, event logevent.LogEvent)
 			if h, ok := v.(string); ok {
 				host = h
 			}
-			delete(event.Extra, k)
+			continue
 		}
 
 		if lk == "level" {
 			if l, ok := v.(int32); ok {
 				level = l
 			}
-			delete(event.Extra, k)
+			continue
 		}
+
+		extra[k] = v
 	}
 
 	if len(event.Tags) > 0 {
-		event.Extra["tags"] = strings.Join(event.Tags, ", ")
+		extra["tags"] = strings.Join(event.Tags, ", ")
 	}
 
 	for _, w := range t.gelfWriters {
 		err := w.WriteMessage(ctx, &SimpleMessage{
-			Extra:     event.Extra,
+			Extra:     extra,
 			Host:      host,
 			Level:     level,
 			Message:   event.Message,
@@ -27,6 +27,13 @@ var (
 	ErrEndpointDown1  = errutil.NewFactory("%q endpoint down")
 	ErrPermanentError = errutil.NewFactory("%q permanent error %v (discarding event)")
 	ErrSoftError      = errutil.NewFactory("%q retryable error %v")
+	ErrUnknownFormat1 = errutil.NewFactory("unknown format: %q")
+)
+
+// formats of request body
+const (
+	FormatJSON   = "json"   // a JSON object, or a JSON array of events if batch_size is greater than 1
+	FormatNDJSON = "ndjson" // one JSON event per line
 )
 
 // OutputConfig holds the configuration json fields and internal objects
@@ -38,7 +45,7 @@ type OutputConfig struct {
 	RetryInterval       uint              `json:"retry_interval" yaml:"retry_interval"`       // seconds before a new retry in case on error
 	IgnoreSSL           bool              `json:"ignore_ssl" yaml:"ignore_ssl"`               //
 	ContentType         string            `json:"content_type" yaml:"content_type"`           // HTTP content type
-	Format              string            `json:"format" yaml:"format"`                       // Format of data (defaults to json)
+	Format              string            `json:"format" yaml:"format"`                       // Format of data, json or ndjson (defaults to json)
 	Headers             map[string]string `json:"headers" yaml:"headers"`                     // Map of additional headers
 	MaxQueueSize        int               `json:"max_queue_size" yaml:"max_queue_size"`       // max size of queue before deleting events (-1=no limit, 0=disable)
 
@@ -56,7 +63,9 @@ func DefaultOutputConfig() OutputConfig {
 			CommonConfig: config.CommonConfig{
 				Type: ModuleName,
 			},
+			BatchSize: 1,
 		},
+		Format:              FormatJSON,
 		RetryInterval:       30,
 		permanentHttpErrors: MapFromInts([]int{http.StatusNotImplemented, http.StatusMethodNotAllowed, http.StatusNotFound, http.StatusAlreadyReported, http.StatusHTTPVersionNotSupported}),
 		acceptedHttpResult:  MapFromInts([]int{http.StatusOK, http.StatusCreated, http.StatusAccepted}),
@@ -84,6 +93,11 @@ func InitHandler(
 	if len(conf.URLs) == 0 {
 		return nil, ErrNoValidURLs
 	}
+	switch conf.Format {
+	case FormatJSON, FormatNDJSON:
+	default:
+		return nil, ErrUnknownFormat1.New(nil, conf.Format)
+	}
 	conf.httpClient = &http.Client{Transport: &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&net.Dialer{
@@ -103,14 +117,65 @@ func InitHandler(
 	// create the queue
 	conf.queue = queue.NewSimpleQueue(ctx, control, &conf, nil, conf.MaxQueueSize, conf.RetryInterval)
 
-	return conf.queue, nil
+	return &conf, nil
+}
+
+// Output sends the event, or queues it if the output is paused
+func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
+	return t.queue.Output(ctx, event)
+}
+
+// OutputBatch sends events in one request, or queues them if the output is paused
+func (t *OutputConfig) OutputBatch(ctx context.Context, events []logevent.LogEvent) (err error) {
+	if t.queue.Paused() {
+		for _, event := range events {
+			if err = t.queue.Output(ctx, event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return t.send(ctx, events)
 }
 
 // OutputEvent tries to send a message, requeueing if is has a temporary error
 func (t *OutputConfig) OutputEvent(ctx context.Context, event logevent.LogEvent) (err error) {
+	return t.send(ctx, []logevent.LogEvent{event})
+}
+
+// encode returns the request body of events in the configured format
+func (t *OutputConfig) encode(events []logevent.LogEvent) ([]byte, error) {
+	if t.Format == FormatJSON && t.BatchSize <= 1 && len(events) == 1 {
+		return events[0].MarshalJSON()
+	}
+	var buf bytes.Buffer
+	if t.Format == FormatJSON {
+		buf.WriteByte('[')
+	}
+	for i, event := range events {
+		raw, err := event.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 && t.Format == FormatJSON {
+			buf.WriteByte(',')
+		}
+		buf.Write(raw)
+		if t.Format == FormatNDJSON {
+			buf.WriteByte('\n')
+		}
+	}
+	if t.Format == FormatJSON {
+		buf.WriteByte(']')
+	}
+	return buf.Bytes(), nil
+}
+
+// send tries to send events in one request, requeueing them if it has a temporary error
+func (t *OutputConfig) send(ctx context.Context, events []logevent.LogEvent) (err error) {
 	i := rand.Intn(len(t.URLs))
 
-	raw, err := event.MarshalJSON()
+	raw, err := t.encode(events)
 	if err != nil {
 		return err
 	}
@@ -120,9 +185,12 @@ func (t *OutputConfig) OutputEvent(ctx context.Context, event logevent.LogEvent)
 	if err != nil {
 		return err
 	}
-	if t.ContentType != "" {
+	switch {
+	case t.ContentType != "":
 		req.Header.Set("Content-Type", t.ContentType)
-	} else {
+	case t.Format == FormatNDJSON:
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	default:
 		req.Header.Set("Content-Type", "application/json")
 	}
 	req.Header.Set("User-Agent", "gogstash/output"+ModuleName)
@@ -134,33 +202,35 @@ func (t *OutputConfig) OutputEvent(ctx context.Context, event logevent.LogEvent)
 
 	resp, err := t.httpClient.Do(req)
 	if err != nil {
-		t.failedDelivery(ctx, event)
-		return err
+		t.failedDelivery(ctx, events)
+		return config.ErrorOutputRetrying.New(err)
 	}
 	defer resp.Body.Close()
 
 	_, err = io.ReadAll(resp.Body)
 	if err != nil {
-		t.failedDelivery(ctx, event)
-		return err
+		t.failedDelivery(ctx, events)
+		return config.ErrorOutputRetrying.New(err)
 	}
 	if _, isinlist := t.permanentHttpErrors[resp.StatusCode]; isinlist {
 		return ErrPermanentError.New(nil, url, resp.StatusCode)
 	}
 	if _, ok := t.acceptedHttpResult[resp.StatusCode]; !ok {
-		t.failedDelivery(ctx, event)
-		return ErrSoftError.New(nil, url, resp.StatusCode)
+		t.failedDelivery(ctx, events)
+		return ErrSoftError.New(config.ErrorOutputRetrying.New(nil), url, resp.StatusCode)
 	}
 	// the event was sent correctly, we now have to resume inputs if we earlier has requested a pause.
 	return t.queue.Resume(ctx)
 }
 
-// failedDelivery receives an event that failed delivery and triggers a pause event if we have not done so already
-// and places the message in the retry-queue.
-func (t *OutputConfig) failedDelivery(ctx context.Context, event logevent.LogEvent) {
-	err := t.queue.Queue(ctx, event)
-	if err != nil {
-		goglog.Logger.Error("outputhttp ", err.Error())
+// failedDelivery receives events that failed delivery and triggers a pause event if we have not done so already
+// and places the messages in the retry-queue.
+func (t *OutputConfig) failedDelivery(ctx context.Context, events []logevent.LogEvent) {
+	for _, event := range events {
+		if err := t.queue.Queue(ctx, event); err != nil {
+			goglog.Logger.Error("outputhttp ", err.Error())
+			return
+		}
 	}
 }
 
@@ -80,3 +80,45 @@ func TestMapFromInts(t *testing.T) {
 		t.Error("Found element not in list")
 	}
 }
+
+func Test_output_http_module_batch(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	serverRecvMsg := make(chan []byte, 1)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		require.Equal("application/x-ndjson", r.Header.Get("Content-Type"))
+		data, err := io.ReadAll(r.Body)
+		require.NoError(err)
+		serverRecvMsg <- data
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handler))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+output:
+  - type: http
+    urls: ["` + server.URL + `"]
+    format: ndjson
+    batch_size: 2
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	conf.TestInputEvent(logevent.LogEvent{Message: "message 1"})
+	conf.TestInputEvent(logevent.LogEvent{Message: "message 2"})
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("timeout")
+	case msg := <-serverRecvMsg:
+		lines := strings.Split(strings.TrimSpace(string(msg)), "\n")
+		require.Len(lines, 2)
+		require.Contains(lines[0], `"message":"message 1"`)
+		require.Contains(lines[1], `"message":"message 2"`)
+	}
+}
@@ -51,7 +51,10 @@ func InitHandler(
 		return nil, err
 	}
 
-	sarama.Logger = goglog.Logger
+	// sarama.Logger is global and read by running clients, only set it once
+	if sarama.Logger != goglog.Logger {
+		sarama.Logger = goglog.Logger
+	}
 
 	version, err := sarama.ParseKafkaVersion(conf.Version)
 	if err != nil {
@@ -82,6 +85,10 @@ func InitHandler(
 		sarConfig.Net.SASL.Password = conf.Password
 	}
 
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
 	conf.client, err = sarama.NewAsyncProducer(conf.Brokers, sarConfig)
 	if err != nil {
 		goglog.Logger.Errorf("Error creating producer client: %v", err)
@@ -25,6 +25,7 @@ const ModuleName = "loki"
 // errors
 var (
 	ErrNoValidURLs = errutil.NewFactory("no valid URLs found")
+	ErrPushFailed2 = errutil.NewFactory("push to loki failed, status code: %v, response: %s")
 )
 
 // OutputConfig holds the configuration json fields and internal objects
@@ -71,7 +72,16 @@ func ToStringE(i any) (string, error) {
 	}
 }
 
-func buildLokiRequest(event logevent.LogEvent) ([]byte, error) {
+// buildLokiRequest returns one push request of events, each event is a stream
+func buildLokiRequest(events []logevent.LogEvent) ([]byte, error) {
+	request := LokiRequest{Streams: make([]LokiStream, 0, len(events))}
+	for _, event := range events {
+		request.Streams = append(request.Streams, buildLokiStream(event))
+	}
+	return jsoniter.Marshal(request)
+}
+
+func buildLokiStream(event logevent.LogEvent) LokiStream {
 	message := ""
 	if event.Message != "" {
 		message = event.Message
@@ -96,9 +106,7 @@ func buildLokiRequest(event logevent.LogEvent) ([]byte, error) {
 		_stream["tag"] = event.Tags
 	}
 	stream.Stream = _stream
-
-	request := LokiRequest{[]LokiStream{stream}}
-	return jsoniter.Marshal(request)
+	return stream
 }
 
 // DefaultOutputConfig returns an OutputConfig struct with default values
@@ -138,9 +146,14 @@ func InitHandler(
 
 // Output event
 func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
+	return t.OutputBatch(ctx, []logevent.LogEvent{event})
+}
+
+// OutputBatch pushes events in one request
+func (t *OutputConfig) OutputBatch(ctx context.Context, events []logevent.LogEvent) (err error) {
 	i := rand.Intn(len(t.URLs))
 
-	raw, err := buildLokiRequest(event)
+	raw, err := buildLokiRequest(events)
 
 	if err != nil {
 		goglog.Logger.Errorf("output loki: %v", err)
@@ -177,7 +190,6 @@ func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err
 	case http.StatusOK, http.StatusNoContent:
 		return nil
 	default:
-		goglog.Logger.Errorf("output loki  startCode: %v  error:%s", resp.StatusCode, body)
-		return err
+		return ErrPushFailed2.New(nil, resp.StatusCode, body)
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	jsoniter "github.com/json-iterator/go"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,3 +48,22 @@ output:
 		require.Equal("outputloki test message", event.Message)
 	}
 }
+
+func Test_output_loki_buildLokiRequest(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	raw, err := buildLokiRequest([]logevent.LogEvent{
+		{Message: "message 1", Extra: map[string]any{"App": "app1"}},
+		{Message: "message 2", Tags: []string{"tag1"}},
+	})
+	require.NoError(err)
+
+	var request LokiRequest
+	require.NoError(jsoniter.Unmarshal(raw, &request))
+	require.Len(request.Streams, 2)
+	require.Equal("message 1", request.Streams[0].Values[0][1])
+	require.Equal("app1", request.Streams[0].Stream["App"])
+	require.Equal("message 2", request.Streams[1].Values[0][1])
+	require.Equal([]any{"tag1"}, request.Streams[1].Stream["tag"])
+}
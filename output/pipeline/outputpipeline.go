@@ -0,0 +1,108 @@
+package outputpipeline
+
+import (
+	"context"
+	"errors"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+)
+
+// ModuleName is the name used in config file
+const ModuleName = "pipeline"
+
+// MetadataSendTo is the @metadata field of addresses the event is not delivered to yet
+const MetadataSendTo = "pipeline_send_to"
+
+// errors
+var (
+	ErrNoSendTo = errors.New("no send_to address for pipeline output")
+)
+
+// OutputConfig holds the configuration json fields and internal objects
+type OutputConfig struct {
+	config.OutputConfig
+	SendTo []string `json:"send_to"` // addresses of pipeline inputs to forward events to
+}
+
+// DefaultOutputConfig returns an OutputConfig struct with default values
+func DefaultOutputConfig() OutputConfig {
+	return OutputConfig{
+		OutputConfig: config.OutputConfig{
+			CommonConfig: config.CommonConfig{
+				Type: ModuleName,
+			},
+		},
+	}
+}
+
+// InitHandler initialize the output plugin
+func InitHandler(
+	ctx context.Context,
+	raw config.ConfigRaw,
+	control config.Control,
+) (config.TypeOutputConfig, error) {
+	conf := DefaultOutputConfig()
+	err := config.ReflectConfig(raw, &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conf.SendTo) < 1 {
+		return nil, ErrNoSendTo
+	}
+
+	return &conf, nil
+}
+
+// Output event, the event is sent to addresses of MetadataSendTo if set, otherwise to send_to.
+// If some addresses failed after others succeeded, the event is written to the dead letter queue
+// with MetadataSendTo of the failed addresses, so replaying it does not duplicate delivered events.
+func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err error) {
+	addresses := t.SendTo
+	if pending := metadataSendTo(event); len(pending) > 0 {
+		addresses = pending
+	}
+
+	var failed []string
+	for _, address := range addresses {
+		// every receiving pipeline owns its event, the sent event is shared with other outputs
+		sent := event.Clone()
+		sent.Remove(logevent.MetadataField + "." + MetadataSendTo)
+		if sendErr := config.SendToPipelineAddress(ctx, address, sent); sendErr != nil {
+			goglog.Logger.Errorf("output pipeline: send to %q failed: %v", address, sendErr)
+			failed = append(failed, address)
+			err = sendErr
+		}
+	}
+	if len(failed) < 1 || len(failed) == len(addresses) {
+		return err
+	}
+
+	retry := event.Clone()
+	retry.SetMetadata(MetadataSendTo, failed)
+	if config.DeadLetter(ctx, t, retry, err) {
+		return nil
+	}
+	return err
+}
+
+// metadataSendTo returns addresses of MetadataSendTo of event, values decoded from JSON are []any
+func metadataSendTo(event logevent.LogEvent) (addresses []string) {
+	value, ok := event.GetValue(logevent.MetadataField + "." + MetadataSendTo)
+	if !ok {
+		return nil
+	}
+	switch v := value.(type) {
+	case []string:
+		return v
+	case []any:
+		for _, address := range v {
+			if s, ok := address.(string); ok {
+				addresses = append(addresses, s)
+			}
+		}
+	}
+	return addresses
+}
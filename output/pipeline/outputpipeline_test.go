@@ -0,0 +1,151 @@
+package outputpipeline
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tsaikd/gogstash/config"
+	"github.com/tsaikd/gogstash/config/deadletter"
+	"github.com/tsaikd/gogstash/config/goglog"
+	"github.com/tsaikd/gogstash/config/logevent"
+	filteraddfield "github.com/tsaikd/gogstash/filter/addfield"
+	inputpipeline "github.com/tsaikd/gogstash/input/pipeline"
+)
+
+func init() {
+	goglog.Logger.SetLevel(logrus.DebugLevel)
+	config.RegistInputHandler(inputpipeline.ModuleName, inputpipeline.InitHandler)
+	config.RegistFilterHandler(filteraddfield.ModuleName, filteraddfield.InitHandler)
+	config.RegistOutputHandler(ModuleName, InitHandler)
+}
+
+func Test_output_pipeline_module(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+output:
+  - type: pipeline
+    send_to: ["test-pipeline-a", "test-pipeline-b"]
+pipelines:
+  - name: a
+    input:
+      - type: pipeline
+        address: test-pipeline-a
+    filter:
+      - type: add_field
+        key: pipeline
+        value: a
+  - name: b
+    input:
+      - type: pipeline
+        address: test-pipeline-b
+    filter:
+      - type: add_field
+        key: pipeline
+        value: b
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	conf.TestInputEvent(logevent.LogEvent{
+		Timestamp: time.Now(),
+		Message:   "pipeline test message",
+	})
+
+	if event, err := conf.TestGetOutputEvent(300 * time.Millisecond); assert.NoError(err) {
+		require.Equal("pipeline test message", event.Message)
+		require.Nil(event.Extra)
+	}
+	for _, name := range []string{"a", "b"} {
+		if event, err := conf.GetPipeline(name).TestGetOutputEvent(300 * time.Millisecond); assert.NoError(err) {
+			require.Equal("pipeline test message", event.Message)
+			require.Equal(name, event.GetString("pipeline"))
+		}
+	}
+}
+
+func Test_output_pipeline_module_no_address(t *testing.T) {
+	require := require.New(t)
+	require.NotNil(require)
+
+	_, err := InitHandler(context.TODO(), config.ConfigRaw{"type": ModuleName}, nil)
+	require.ErrorIs(err, ErrNoSendTo)
+
+	conf := DefaultOutputConfig()
+	conf.SendTo = []string{"test-pipeline-not-found"}
+	err = conf.Output(context.TODO(), logevent.LogEvent{})
+	require.True(config.ErrorPipelineAddressNotFound1.Match(err))
+}
+
+func Test_output_pipeline_module_partial_failure(t *testing.T) {
+	assert := assert.New(t)
+	assert.NotNil(assert)
+	require := require.New(t)
+	require.NotNil(require)
+
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conf, err := config.LoadFromYAML([]byte(strings.TrimSpace(`
+debugch: true
+dead_letter_queue:
+  path: ` + dir + `
+output:
+  - type: pipeline
+    send_to: ["test-partial-ok", "test-partial-not-found"]
+pipelines:
+  - name: ok
+    input:
+      - type: pipeline
+        address: test-partial-ok
+	`)))
+	require.NoError(err)
+	require.NoError(conf.Start(ctx))
+
+	acked := make(chan error, 1)
+	ack := logevent.NewAck(func(err error) { acked <- err })
+	event := logevent.LogEvent{Timestamp: time.Now(), Message: "partial"}
+	event.SetAck(ack)
+	ack.Done(nil)
+	conf.TestInputEvent(event)
+
+	// delivered to the found address, the event of the failed address is written to the dead letter queue
+	if event, err := conf.GetPipeline("ok").TestGetOutputEvent(300 * time.Millisecond); assert.NoError(err) {
+		require.Equal("partial", event.Message)
+	}
+	select {
+	case err := <-acked:
+		require.NoError(err)
+	case <-time.After(time.Second):
+		require.Fail("event not acknowledged")
+	}
+	entry, _, err := deadletter.NewReader(filepath.Join(dir, "main"), deadletter.Position{}, 10*time.Millisecond).Next(ctx)
+	require.NoError(err)
+	require.Equal("partial", entry.Event.Message)
+	require.Equal([]string{"test-partial-not-found"}, metadataSendTo(entry.Event))
+
+	// replayed event is only sent to the failed addresses
+	output := DefaultOutputConfig()
+	output.SendTo = []string{"test-partial-ok", "test-partial-not-found"}
+	event = logevent.LogEvent{Message: "replay"}
+	event.SetMetadata(MetadataSendTo, []any{"test-partial-ok"})
+	require.NoError(output.Output(ctx, event))
+	if event, err := conf.GetPipeline("ok").TestGetOutputEvent(300 * time.Millisecond); assert.NoError(err) {
+		require.Equal("replay", event.Message)
+		_, ok := event.GetValue(logevent.MetadataField + "." + MetadataSendTo)
+		require.False(ok)
+	}
+}
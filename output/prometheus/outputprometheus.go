@@ -50,6 +50,10 @@ func InitHandler(
 		return nil, err
 	}
 
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
 	if err := prometheus.Register(conf.MsgCount); err != nil {
 		return nil, err
 	}
@@ -27,8 +27,10 @@ type OutputConfig struct {
 	DataType          string   `json:"data_type,omitempty"` // one of ["list", "channel"]
 	Timeout           int      `json:"timeout,omitempty"`
 	ReconnectInterval int      `json:"reconnect_interval,omitempty"`
-	Connections       int      `json:"connections"` // maximum number of socket connections, default: 10
+	Connections       int      `json:"connections"`   // maximum number of socket connections, default: 10
+	StrictFormat      bool     `json:"strict_format"` // reject events missing fields of key, default: false
 
+	key    *logevent.Template // compiled Key
 	client *redis.Client
 }
 
@@ -68,10 +70,18 @@ func InitHandler(
 		return nil, err
 	}
 
+	if conf.key, err = logevent.NewTemplate(conf.Key); err != nil {
+		return nil, err
+	}
+
 	if len(conf.Host) > 1 {
 		goglog.Logger.Warn("deprecated: host number should be only 1")
 	}
 
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
 	conf.client = redis.NewClient(&redis.Options{
 		Addr:     conf.Host[0],
 		PoolSize: conf.Connections,
@@ -91,7 +101,10 @@ func (t *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) (err
 		return ErrorEventMarshalFailed1.New(err, event)
 	}
 
-	key := event.Format(t.Key)
+	key, err := t.key.Execute(event, t.StrictFormat)
+	if err != nil {
+		return err
+	}
 
 	// try to log forever
 	for {
@@ -41,6 +41,10 @@ func InitHandler(
 		return nil, err
 	}
 
+	if config.IsCheck(ctx) {
+		return &conf, nil
+	}
+
 	// init Socket
 	conn, err := net.Dial(conf.Socket, conf.Address)
 	if err != nil {
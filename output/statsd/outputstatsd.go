@@ -143,6 +143,7 @@ func DefaultOutputConfig() OutputConfig {
 			CommonConfig: config.CommonConfig{
 				Type: ModuleName,
 			},
+			BatchFlushInterval: "100ms",
 		},
 		Host:          "localhost:8125",
 		Proto:         "udp",
@@ -265,10 +266,26 @@ func InitHandler(
 
 // Output event
 func (o *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) error {
+	o.output(event)
+	return nil
+}
+
+// OutputBatch sends metrics of events and flushes them to the server
+func (o *OutputConfig) OutputBatch(ctx context.Context, events []logevent.LogEvent) error {
+	for _, event := range events {
+		o.output(event)
+	}
+	if err := o.client.Flush(); err != nil {
+		return ErrorFlushFailed.New(err)
+	}
+	return nil
+}
+
+func (o *OutputConfig) output(event logevent.LogEvent) {
 	t := atomic.LoadInt64(&clientPool.last)
 	if event.Timestamp.Unix() < t {
 		// old event, skip
-		return nil
+		return
 	}
 	for _, tpl := range o.IncrementTpl {
 		if name, err := tpl.Execute(event.Extra); err == nil && len(name) > 0 {
@@ -327,5 +344,4 @@ func (o *OutputConfig) Output(ctx context.Context, event logevent.LogEvent) erro
 			o.client.Timing(name, f)
 		}
 	}
-	return nil
 }
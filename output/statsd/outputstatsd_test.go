@@ -78,6 +78,8 @@ output:
   - type: statsd
     host: "` + server.addr + `"
     prefix: "Log.staging"
+    # events are sent after the batch and the client flush interval
+    batch_flush_interval: "10ms"
     increment:
       - "all.increment.%{logmsg.status}"
       - "all.increment2.%{logmsg.status}"